@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bookstore/internal/audit"
+	"bookstore/internal/catalog"
+	"bookstore/internal/models"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runCommand runs a catalog command given on the command line instead of the server, such as
+// "go run . import books.csv", and returns the exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "import":
+		return importCommand(args[1:])
+	case "export":
+		return exportCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q; the commands are import and export\n", args[0])
+		return 2
+	}
+}
+
+// importCommand imports a catalog file like POST /api/v1/admin/catalog/import, auditing changes as made by "cli"
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "file format: csv, jsonl or onix (default: from the file extension)")
+	dryRun := flags.Bool("dry-run", false, "validate the file without changing the catalog")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: import [-format csv|jsonl|onix] [-dry-run] FILE (- for stdin)")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	name := flags.Arg(0)
+	if *format == "" {
+		detected, ok := catalog.FormatFromFilename(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "cannot tell the format of %s; pass -format\n", name)
+			return 2
+		}
+		*format = detected
+	} else if !catalog.ValidFormat(*format) {
+		fmt.Fprintln(os.Stderr, catalog.ErrUnknownFormat)
+		return 2
+	}
+
+	var input io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	rows, err := catalog.Read(*format, bufio.NewReader(input))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "the %s file could not be read: %v\n", *format, err)
+		return 1
+	}
+	report, err := catalog.Import(models.DB, rows, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import failed:", err)
+		return 1
+	}
+
+	for _, result := range report.Rows {
+		for _, fieldErr := range result.Errors {
+			fmt.Fprintf(os.Stderr, "row %d (%s): %s\n", result.Row, result.ISBN, fieldErr.Message)
+		}
+		if !report.Applied {
+			continue
+		}
+		event := audit.Event{TargetType: audit.TargetBook, TargetID: result.ISBN, After: result.After}
+		switch result.Action {
+		case catalog.ActionCreate:
+			event.Action = audit.ActionBookCreate
+		case catalog.ActionUpdate:
+			event.Action = audit.ActionBookUpdate
+			event.Before = result.Before
+		default:
+			continue
+		}
+		if err := audit.RecordCommand(models.DB, event); err != nil {
+			fmt.Fprintf(os.Stderr, "row %d (%s): failed to write the audit log: %v\n", result.Row, result.ISBN, err)
+		}
+	}
+
+	fmt.Printf("%d rows: %d new, %d updated, %d unchanged, %d invalid\n",
+		report.Total, report.Created, report.Updated, report.Unchanged, report.Invalid)
+	switch {
+	case report.Invalid > 0:
+		fmt.Println("Nothing was imported; fix the invalid rows and try again")
+		return 1
+	case report.DryRun:
+		fmt.Println("Dry run: nothing was imported")
+	case report.Applied:
+		fmt.Println("Catalog imported")
+	}
+	return 0
+}
+
+// exportCommand writes the whole catalog like GET /api/v1/admin/catalog/export
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "", "file format: csv, jsonl or onix (default: from the -o extension, else csv)")
+	output := flags.String("o", "-", "file to write, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *format == "" {
+		*format = catalog.FormatCSV
+		if detected, ok := catalog.FormatFromFilename(*output); ok {
+			*format = detected
+		}
+	} else if !catalog.ValidFormat(*format) {
+		fmt.Fprintln(os.Stderr, catalog.ErrUnknownFormat)
+		return 2
+	}
+
+	books, err := catalog.Load(models.DB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to fetch books:", err)
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := bufio.NewWriter(out)
+	err = catalog.Write(*format, writer, books)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export failed:", err)
+		return 1
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d books to %s\n", len(books), *output)
+	}
+	return 0
+}
@@ -47,7 +47,7 @@ function BookAdminDisplay() {
 
   useEffect(() => {
     // Fetch books from the API
-    api.get('/api/books')
+    api.get('/api/v1/books')
       .then((response) => {
         setBooks(response.data);
       })
@@ -102,13 +102,13 @@ function BookAdminDisplay() {
         download_link: downloadLink,
     };
 
-    api.put(`/api/books/${isbn}`, updatedBook)
+    api.put(`/api/v1/books/${isbn}`, updatedBook)
         .then((response) => {
             if (response.data.message === 'Book updated successfully') {
                 alert('Book updated successfully');
                 window.location.reload();
             } else {
-                alert('Error: ' + response.data.error);
+                alert('Error: ' + response.data.error.message);
             }
         })
         .catch((error) => {
@@ -137,7 +137,7 @@ function BookAdminDisplay() {
         };
   
         // Send a DELETE request to the API with book details in the body
-        const response = await api.delete(`/api/books/${book.isbn}`, {
+        const response = await api.delete(`/api/v1/books/${book.isbn}`, {
           data: bookDetails,
         });
   
@@ -145,7 +145,7 @@ function BookAdminDisplay() {
           alert('Book deleted successfully');
           window.location.reload(); // Refresh the page
         } else {
-          alert('Error: ' + response.data.error);
+          alert('Error: ' + response.data.error.message);
         }
       } catch (error) {
         console.error('Error deleting book:', error);
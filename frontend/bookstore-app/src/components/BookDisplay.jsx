@@ -48,7 +48,7 @@ function BookDisplay() {
 
   useEffect(() => {
     // Fetch books from the API
-    api.get('/api/books')
+    api.get('/api/v1/books')
       .then((response) => {
         setBooks(response.data);
       })
@@ -60,7 +60,7 @@ function BookDisplay() {
   useEffect(() => {
     // Fetch ownership status for each book
     books.forEach((book) => {
-      api.get(`/api/ownershipStatus/${book.isbn}`)
+      api.get(`/api/v1/me/books/${book.isbn}`)
         .then((response) => {
           setOwnershipStatus((prevStatus) => ({
             ...prevStatus,
@@ -75,7 +75,7 @@ function BookDisplay() {
 
   const handleDownloadClick = (isbn) => {
     // Make a GET request to retrieve the download link based on ISBN
-    api.get(`/api/getDownloadLink/${isbn}`)
+    api.get(`/api/v1/me/books/${isbn}/download`)
       .then((response) => {
         const downloadLink = response.data.message;
         if (downloadLink) {
@@ -91,7 +91,11 @@ function BookDisplay() {
       })
       .catch((error) => {
         console.error('Error fetching download link:', error);
-        alert('Error fetching download link. Please try again later.');
+        if (error.response && error.response.data.error) {
+          alert(error.response.data.error.message);
+        } else {
+          alert('Error fetching download link. Please try again later.');
+        }
       });
   };
 
@@ -104,7 +108,7 @@ function BookDisplay() {
     // Check if the confirmation matches the book's ISBN
     if (confirmation === book.isbn) {
       // Initiate the purchase by calling the BuyBook API
-      api.get(`/api/buy-book/${book.isbn}`)
+      api.post(`/api/v1/orders`, { isbn: book.isbn })
         .then((response) => {
           alert(response.data.message); // Show a success message
           
@@ -113,7 +117,11 @@ function BookDisplay() {
         })
         .catch((error) => {
           console.error('Error purchasing book:', error);
-          alert('Error purchasing the book. Please try again later.');
+          if (error.response && error.response.data.error) {
+            alert(error.response.data.error.message);
+          } else {
+            alert('Error purchasing the book. Please try again later.');
+          }
         });
     } else {
       alert('Purchase canceled. ISBN did not match.'); // Show a cancellation message
@@ -55,13 +55,13 @@ function NavbarAdmin() {
     };
   
     // Make a POST request to create the book
-    api.post('/api/books/create-book', newBook)
+    api.post('/api/v1/books', newBook)
       .then((response) => {
         if (response.data.message === 'Book created successfully') {
           alert('Book created successfully');
           window.location.reload(); 
         } else {
-          alert('Error: ' + response.data.error);
+          alert('Error: ' + response.data.error.message);
         }
       })
       .catch((error) => {
@@ -76,7 +76,7 @@ function NavbarAdmin() {
   const handleLogout = async () => {
     try {
       // Make a GET request to the logout endpoint with credentials (cookies)
-      const response = await api.get('/api/auth/logout');
+      const response = await api.post('/api/v1/auth/logout');
 
       if (response.status === 200 && response.data.message === 'Logged out successfully') {
         // Clear sessionStorage and redirect to the home page upon successful logout
@@ -87,7 +87,7 @@ function NavbarAdmin() {
         console.log('Unexpected response:', response.data);
         // Display an alert with the error message if available
         if (response.data.error) {
-          window.alert(response.data.error);
+          window.alert(response.data.error.message);
         }
       }
     } catch (error) {
@@ -95,7 +95,7 @@ function NavbarAdmin() {
       console.error('Error:', error);
       // Display an alert with the error message if available
       if (error.response && error.response.data.error) {
-        window.alert(error.response.data.error);
+        window.alert(error.response.data.error.message);
       }
     } finally {
       // Close any menu or perform cleanup actions
@@ -25,7 +25,7 @@ function NavbarVerified() {
   const handleLogout = async () => {
     try {
       // Make a GET request to the logout endpoint with credentials (cookies)
-      const response = await api.get('/api/auth/logout');
+      const response = await api.post('/api/v1/auth/logout');
 
       if (response.status === 200 && response.data.message === 'Logged out successfully') {
         // Clear sessionStorage and redirect to the home page upon successful logout
@@ -36,7 +36,7 @@ function NavbarVerified() {
         console.log('Unexpected response:', response.data);
         // Display an alert with the error message if available
         if (response.data.error) {
-          window.alert(response.data.error);
+          window.alert(response.data.error.message);
         }
       }
     } catch (error) {
@@ -44,7 +44,7 @@ function NavbarVerified() {
       console.error('Error:', error);
       // Display an alert with the error message if available
       if (error.response && error.response.data.error) {
-        window.alert(error.response.data.error);
+        window.alert(error.response.data.error.message);
       }
     } finally {
       // Close any menu or perform cleanup actions
@@ -97,7 +97,7 @@ function NavbarVerified() {
       };
 
       // Make a DELETE request to the backend route
-      const response = await api.delete('/api/auth/delete-account', {
+      const response = await api.delete('/api/v1/me', {
         data: requestBody, // Include the request body in the DELETE request
       });
 
@@ -136,7 +136,7 @@ function NavbarVerified() {
   const getBalance = async () => {
     try {
       // Make a GET request to the backend route
-      const response = await api.get('/api/getBalance');
+      const response = await api.get('/api/v1/wallet');
 
       if (response.status === 200) {
         // Handle the response data as needed
@@ -148,9 +148,9 @@ function NavbarVerified() {
         console.log('Unexpected response:', response.data);
         if (response.data.error) {
           // Log the error message to the console
-          console.error('Error:', response.data.error);
+          console.error('Error:', response.data.error.message);
           // Display an alert with the error message
-          window.alert(response.data.error);
+          window.alert(response.data.error.message);
         }
       }
     } catch (error) {
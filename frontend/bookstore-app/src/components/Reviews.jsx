@@ -36,7 +36,7 @@ function Reviews() {
     const totalPages = Math.ceil(reviews.length / itemsPerPage);
 
     useEffect(() => {
-        api.get(`/api/getReview/${isbn}`)
+        api.get(`/api/v1/books/${isbn}/reviews`)
             .then((response) => {
                 setReviews(response.data);
             })
@@ -60,7 +60,7 @@ function Reviews() {
     const handleSubmitReview = () => {
         // Validate and submit the review
         if (rating > 0 && comment.trim() !== '') {
-            api.post(`/api/post-review/${isbn}`, {
+            api.post(`/api/v1/books/${isbn}/reviews`, {
                 rating,
                 comment,
             })
@@ -81,7 +81,7 @@ function Reviews() {
     };
     
     const fetchReviews = () => {
-        api.get(`/api/getReview/${isbn}`)
+        api.get(`/api/v1/books/${isbn}/reviews`)
             .then((response) => {
                 setReviews(response.data);
             })
@@ -27,7 +27,7 @@ export default function SignIn() {
 
         try {
             // Make the POST request to register the user
-            const response = await api.post('/api/auth/login', {
+            const response = await api.post('/api/v1/auth/login', {
                 username: userName,
                 email: email,
                 password: password,
@@ -48,9 +48,9 @@ export default function SignIn() {
             }
         } catch (error) {
             // Handle error
-            if ((error.response && error.response.status === 400) || (error.response && error.response.status === 401)) {
+            if (error.response && error.response.data.error) {
                 // Handle specific 400 error scenario
-                const errorMessage = error.response.data.error;
+                const errorMessage = error.response.data.error.message;
                 window.alert(errorMessage);
             } else {
                 console.error('Error:', error);
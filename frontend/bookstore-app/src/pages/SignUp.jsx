@@ -33,7 +33,7 @@ export default function SignUp() {
         }
         try {
             // Make the POST request to register the user
-            const response = await api.post('/api/auth/register', {
+            const response = await api.post('/api/v1/auth/register', {
                 username: userName,
                 email: email,
                 password: password,
@@ -56,9 +56,9 @@ export default function SignUp() {
             }
         } catch (error) {
             // Handle error
-            if (error.response && error.response.status === 400) {
+            if (error.response && error.response.data.error) {
                 // Handle specific 400 error scenario
-                const errorMessage = error.response.data.error;
+                const errorMessage = error.response.data.error.message;
                 window.alert(errorMessage);
             } else {
                 console.error('Error:', error);
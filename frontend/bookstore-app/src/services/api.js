@@ -9,4 +9,39 @@ const instance = axios.create({
   },
 });
 
+// State-changing requests must carry the session's CSRF token
+const unsafeMethods = ['post', 'put', 'patch', 'delete'];
+let csrfToken = null;
+
+const fetchCsrfToken = async () => {
+  const response = await instance.get('/api/v1/csrf-token');
+  csrfToken = response.data.csrf_token;
+  return csrfToken;
+};
+
+instance.interceptors.request.use(async (request) => {
+  if (unsafeMethods.includes(request.method)) {
+    request.headers['X-CSRF-Token'] = csrfToken || (await fetchCsrfToken());
+  }
+  return request;
+});
+
+// Logging in and out replace the token; refresh it once if the session it belonged to has expired
+const keepRotatedToken = (response) => {
+  if (response.data && response.data.csrf_token) {
+    csrfToken = response.data.csrf_token;
+  }
+  return response;
+};
+
+instance.interceptors.response.use(keepRotatedToken, async (error) => {
+  const { config: request, response } = error;
+  if (response && response.data.error && response.data.error.code === 'csrf_token_invalid' && !request.csrfRetried) {
+    request.csrfRetried = true;
+    request.headers['X-CSRF-Token'] = await fetchCsrfToken();
+    return instance(request);
+  }
+  return Promise.reject(error);
+});
+
 export default instance;
@@ -0,0 +1,31 @@
+/*
+   apidocs embeds the OpenAPI 3 description of the API and the page that renders it.
+   openapi.json is maintained by hand next to the handlers; the handlers tests fail
+   when a registered route is missing from it.
+*/
+
+package apidocs
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:generate sh fetch-swagger-ui.sh
+
+// Spec is the OpenAPI 3 document served at /openapi.json
+//
+//go:embed openapi.json
+var Spec []byte
+
+// DocsPage is the Swagger UI page served at /docs; it loads the UI from Assets
+//
+//go:embed docs.html
+var DocsPage []byte
+
+//go:embed assets
+var assets embed.FS
+
+// Assets holds the scripts and styles of the docs page, served under /docs/assets: the vendored
+// Swagger UI in swagger-ui/ and the script that starts it
+var Assets, _ = fs.Sub(assets, "assets")
@@ -0,0 +1,4 @@
+// Renders the OpenAPI specification with the Swagger UI bundle served next to this file
+window.onload = function () {
+  window.ui = SwaggerUIBundle({ url: '/openapi.json', dom_id: '#swagger-ui', withCredentials: true });
+};
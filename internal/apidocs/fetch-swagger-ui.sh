@@ -0,0 +1,16 @@
+#!/bin/sh
+# Vendors the Swagger UI assets served by /docs into assets/swagger-ui, so the docs page loads
+# nothing from third-party hosts. Run through "go generate ./internal/apidocs" and commit the result.
+set -eu
+
+version=5.18.2
+target=assets/swagger-ui
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+curl -fsSL "https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-$version.tgz" | tar -xz -C "$tmp"
+mkdir -p "$target"
+for file in swagger-ui.css swagger-ui-bundle.js LICENSE; do
+	cp "$tmp/package/$file" "$target/$file"
+done
+echo "$version" > "$target/VERSION"
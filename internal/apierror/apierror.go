@@ -0,0 +1,167 @@
+/*
+   apierror defines the single error model returned by the API. Handlers abort with an *Error
+   and the Middleware renders it as
+       {"error": {"code": "...", "message": "...", "fields": [...], "request_id": "..."}}
+   with the matching HTTP status.
+*/
+
+package apierror
+
+import (
+	"bookstore/internal/logging"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable error codes
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidJSON          = "invalid_json"
+	CodeValidation           = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeInternal             = "internal_error"
+	CodeUnavailable          = "service_unavailable"
+	CodeInsufficientFunds    = "insufficient_balance"
+	CodeAlreadyOwned         = "already_owned"
+	CodeNotOwned             = "not_owned"
+	CodeAccountDeleted       = "account_deleted"
+	CodeCSRF                 = "csrf_token_invalid"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeClientCertRequired   = "client_certificate_required"
+	CodeDownloadLinkInvalid  = "download_link_invalid"
+	CodeDownloadLimit        = "download_limit_reached"
+	CodeBadGateway           = "bad_gateway"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeChecksumMismatch     = "checksum_mismatch"
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error is an API error with its HTTP status. Cause is logged but never sent to clients.
+type Error struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+	Cause   error        `json:"-"`
+}
+
+// Envelope is the JSON document sent for every error response
+type Envelope struct {
+	Error Body `json:"error"`
+}
+
+type Body struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Cause)
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// New builds an error with an explicit status and code
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// PayloadTooLarge reports a request body above the limit of its route
+func PayloadTooLarge(limit int64) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", limit))
+}
+
+// Internal hides cause from the client behind a generic message
+func Internal(message string, cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message, Cause: cause}
+}
+
+// Abort records err on the context and stops the handler chain; the Middleware renders it
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// From converts any error into an *Error, treating unknown errors as internal
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Internal("Internal server error", err)
+}
+
+// Middleware renders the last error recorded by a handler, unless a response was already written
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		apiErr := From(c.Errors.Last().Err)
+		if apiErr.Status >= http.StatusInternalServerError {
+			logging.FromContext(c).WithError(apiErr).Error(apiErr.Message)
+		}
+
+		c.JSON(apiErr.Status, Envelope{Error: Body{
+			Code:      apiErr.Code,
+			Message:   apiErr.Message,
+			Fields:    apiErr.Fields,
+			RequestID: logging.RequestID(c),
+		}})
+	}
+}
+
+// Recovery turns a panic in a later handler into an internal error. It goes right after the
+// Middleware, which renders the error once the panic has been recovered.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		Abort(c, Internal("Internal server error", fmt.Errorf("panic: %v", recovered)))
+	})
+}
+
+// NoRoute answers unknown paths with the standard not found error
+func NoRoute(c *gin.Context) {
+	Abort(c, NotFound("Route not found"))
+}
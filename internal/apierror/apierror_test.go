@@ -0,0 +1,150 @@
+package apierror
+
+import (
+	"bookstore/internal/logging"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type signup struct {
+	Email string `json:"email" binding:"required,email"`
+	Age   int    `json:"age" binding:"min=18"`
+}
+
+func render(t *testing.T, body string, handler gin.HandlerFunc) (*httptest.ResponseRecorder, Envelope) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.Middleware(), Middleware())
+	router.POST("/", handler)
+	router.NoRoute(NoRoute)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-123")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var envelope Envelope
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("decoding %q: %v", rec.Body, err)
+		}
+	}
+	return rec, envelope
+}
+
+func TestRecoveryRendersPanicsAsInternalErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.Middleware(), Middleware(), Recovery())
+	router.GET("/", func(c *gin.Context) { panic("nil map") })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "req-456")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var envelope Envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("expected the error envelope, got %q: %v", rec.Body, err)
+	}
+	if rec.Code != http.StatusInternalServerError || envelope.Error.Code != CodeInternal || envelope.Error.RequestID != "req-456" {
+		t.Fatalf("expected 500 %s with the request id, got %d %+v", CodeInternal, rec.Code, envelope)
+	}
+	if strings.Contains(rec.Body.String(), "nil map") {
+		t.Fatalf("expected the panic to stay out of the response, got %s", rec.Body)
+	}
+}
+
+func bindSignup(c *gin.Context) {
+	var input signup
+	if err := c.ShouldBindJSON(&input); err != nil {
+		Abort(c, Validation(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+func TestValidationFieldsUseJSONNames(t *testing.T) {
+	rec, envelope := render(t, `{"email":"nope","age":3}`, bindSignup)
+	if rec.Code != http.StatusBadRequest || envelope.Error.Code != CodeValidation {
+		t.Fatalf("expected 400 %s, got %d %+v", CodeValidation, rec.Code, envelope)
+	}
+	if envelope.Error.RequestID != "req-123" {
+		t.Fatalf("expected the request id in the envelope, got %q", envelope.Error.RequestID)
+	}
+
+	want := map[string]string{"email": "email", "age": "min"}
+	if len(envelope.Error.Fields) != len(want) {
+		t.Fatalf("expected %d field errors, got %+v", len(want), envelope.Error.Fields)
+	}
+	for _, field := range envelope.Error.Fields {
+		if want[field.Field] != field.Rule || field.Message == "" {
+			t.Errorf("unexpected field error %+v", field)
+		}
+	}
+}
+
+func TestValidationBodyErrors(t *testing.T) {
+	cases := []struct {
+		body string
+		code string
+	}{
+		{"", CodeInvalidJSON},
+		{`{"email":`, CodeInvalidJSON},
+		{`{"email":"a@b.c","age":"old"}`, CodeValidation},
+	}
+	for _, tc := range cases {
+		rec, envelope := render(t, tc.body, bindSignup)
+		if rec.Code != http.StatusBadRequest || envelope.Error.Code != tc.code {
+			t.Errorf("body %q: expected 400 %s, got %d %+v", tc.body, tc.code, rec.Code, envelope)
+		}
+	}
+}
+
+func TestInternalErrorHidesCause(t *testing.T) {
+	rec, envelope := render(t, "", func(c *gin.Context) {
+		Abort(c, errors.New("pq: connection refused"))
+	})
+	if rec.Code != http.StatusInternalServerError || envelope.Error.Code != CodeInternal {
+		t.Fatalf("expected 500 %s, got %d %+v", CodeInternal, rec.Code, envelope)
+	}
+	if strings.Contains(rec.Body.String(), "connection refused") {
+		t.Fatalf("internal cause leaked to the client: %s", rec.Body)
+	}
+}
+
+func TestMiddlewareKeepsWrittenResponses(t *testing.T) {
+	rec, _ := render(t, "", func(c *gin.Context) {
+		c.JSON(http.StatusAccepted, gin.H{"message": "queued"})
+		c.Error(errors.New("late failure"))
+	})
+	if rec.Code != http.StatusAccepted || strings.Contains(rec.Body.String(), "internal_error") {
+		t.Fatalf("expected the handler's response to be left alone, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestNoRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.NoRoute(NoRoute)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	var envelope Envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	if rec.Code != http.StatusNotFound || envelope.Error.Code != CodeNotFound {
+		t.Fatalf("expected 404 %s, got %d %+v", CodeNotFound, rec.Code, envelope)
+	}
+}
@@ -0,0 +1,144 @@
+// Conversion of binding and validation failures into field-level errors
+
+package apierror
+
+import (
+	"bookstore/internal/isbn"
+	"bookstore/internal/slug"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report gin binding failures by JSON field name, like the handlers' own validator
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(jsonFieldName)
+		engine.RegisterValidation("isbn", validISBN)
+		engine.RegisterValidation("slug", sluggable)
+	}
+}
+
+// NewValidator returns a validator that names fields after their JSON tag
+func NewValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonFieldName)
+	v.RegisterValidation("isbn", validISBN)
+	v.RegisterValidation("slug", sluggable)
+	return v
+}
+
+// validISBN replaces the validator's own isbn rule, which rejects a lowercase x check digit
+func validISBN(fl validator.FieldLevel) bool {
+	return isbn.Valid(fl.Field().String())
+}
+
+// sluggable accepts names that have a slug, i.e. contain a letter or digit
+func sluggable(fl validator.FieldLevel) bool {
+	return slug.Make(fl.Field().String()) != ""
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// Invalid reports fields rejected by checks the validator cannot make, such as references to
+// records that do not exist, in the same shape as Validation
+func Invalid(fields ...FieldError) *Error {
+	apiErr := New(http.StatusBadRequest, CodeValidation, "Request validation failed")
+	apiErr.Fields = fields
+	return apiErr
+}
+
+// Validation converts an error from ShouldBindJSON or validator.Struct into a 400 error
+func Validation(err error) *Error {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		apiErr := New(http.StatusBadRequest, CodeValidation, "Request validation failed")
+		for _, fieldErr := range validationErrors {
+			field := fieldPath(fieldErr)
+			apiErr.Fields = append(apiErr.Fields, FieldError{
+				Field:   field,
+				Rule:    fieldErr.Tag(),
+				Message: fieldMessage(field, fieldErr),
+			})
+		}
+		return apiErr
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		apiErr := New(http.StatusBadRequest, CodeValidation, "Request validation failed")
+		apiErr.Fields = []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type.String()),
+		}}
+		return apiErr
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return PayloadTooLarge(tooLarge.Limit)
+	}
+
+	if errors.Is(err, io.EOF) {
+		return New(http.StatusBadRequest, CodeInvalidJSON, "Request body is empty")
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return New(http.StatusBadRequest, CodeInvalidJSON, "Request body is not valid JSON")
+	}
+
+	return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "Invalid request", Cause: err}
+}
+
+// fieldPath names a field by its path from the validated struct, such as contributors[0].name
+func fieldPath(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if i := strings.IndexByte(namespace, '.'); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fieldErr.Field()
+}
+
+func fieldMessage(field string, fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required", "required_without":
+		return field + " is required"
+	case "email":
+		return field + " must be a valid email address"
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", field, fieldErr.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", field, fieldErr.Param())
+	case "isbn":
+		return field + " must be a valid ISBN-10 or ISBN-13"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, fieldErr.Param())
+	case "slug":
+		return field + " must contain a letter or digit"
+	case "excluded_without":
+		return fmt.Sprintf("%s needs %s", field, strings.ToLower(fieldErr.Param()))
+	case "bcp47_language_tag":
+		return field + " must be a language tag such as en or pt-BR"
+	case "datetime":
+		return field + " must be a date formatted as YYYY-MM-DD"
+	default:
+		return fmt.Sprintf("%s failed the %s rule", field, fieldErr.Tag())
+	}
+}
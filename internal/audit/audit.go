@@ -0,0 +1,212 @@
+/*
+   audit records admin mutations and authentication events in the audit_logs table:
+   who acted, on what, what changed, from which IP and when.
+*/
+
+package audit
+
+import (
+	"bookstore/internal/logging"
+	"bookstore/internal/models"
+	"bookstore/internal/session_manager"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Audited actions
+const (
+	ActionBookCreate      = "book.create"
+	ActionBookUpdate      = "book.update"
+	ActionBookDelete      = "book.delete"
+	ActionBookRestore     = "book.restore"
+	ActionBookPurge       = "book.purge"
+	ActionBookFileUpload  = "book.file_upload"
+	ActionBookFileDelete  = "book.file_delete"
+	ActionBookCoverUpload = "book.cover_upload"
+	ActionBookCoverDelete = "book.cover_delete"
+	ActionAuthorCreate    = "author.create"
+	ActionAuthorUpdate    = "author.update"
+	ActionAuthorDelete    = "author.delete"
+	ActionCategoryCreate  = "category.create"
+	ActionCategoryUpdate  = "category.update"
+	ActionCategoryDelete  = "category.delete"
+	ActionTagCreate       = "tag.create"
+	ActionTagUpdate       = "tag.update"
+	ActionTagDelete       = "tag.delete"
+	ActionSeriesCreate    = "series.create"
+	ActionSeriesUpdate    = "series.update"
+	ActionSeriesDelete    = "series.delete"
+	ActionWorkCreate      = "work.create"
+	ActionWorkUpdate      = "work.update"
+	ActionWorkDelete      = "work.delete"
+	ActionPublisherCreate = "publisher.create"
+	ActionPublisherUpdate = "publisher.update"
+	ActionPublisherDelete = "publisher.delete"
+	ActionWatermarkLookup = "watermark.lookup"
+	ActionRegister        = "auth.register"
+	ActionLogin           = "auth.login"
+	ActionLoginFailed     = "auth.login_failed"
+	ActionLogout          = "auth.logout"
+	ActionAccountDelete   = "auth.delete_account"
+)
+
+// Audited target types
+const (
+	TargetBook      = "book"
+	TargetAuthor    = "author"
+	TargetCategory  = "category"
+	TargetTag       = "tag"
+	TargetSeries    = "series"
+	TargetWork      = "work"
+	TargetPublisher = "publisher"
+	TargetUser      = "user"
+)
+
+const redacted = "[redacted]"
+
+// Fields that are never written to the audit log, and bookkeeping fields that are not worth diffing
+var (
+	secretFields  = map[string]bool{"Password": true, "password": true}
+	ignoredFields = map[string]bool{"CreatedAt": true, "UpdatedAt": true, "DeletedAt": true}
+)
+
+// Event describes one audited action
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any // state before the action, nil for creations
+	After      any // state after the action, nil for deletions
+
+	// The actor defaults to the session user; set these when the session does not
+	// identify them yet, e.g. during login
+	ActorID   *uint
+	ActorName string
+}
+
+// Record stores the event; failures are logged and never fail the request
+func Record(c *gin.Context, event Event) {
+	db := models.DBWithContext(c.Request.Context())
+	log := logging.FromContext(c).WithField("action", event.Action)
+
+	actorID := event.ActorID
+	if actorID == nil {
+		if session, err := session_manager.Store.Get(c.Request, "session-name"); err == nil {
+			if userID, ok := session.Values["user_id"].(uint); ok {
+				actorID = &userID
+			}
+		}
+	}
+
+	actorName := event.ActorName
+	if actorName == "" && actorID != nil {
+		var user models.User
+		if err := db.Select("username").First(&user, *actorID).Error; err == nil {
+			actorName = user.Username
+		}
+	}
+
+	changes, err := Diff(event.Before, event.After)
+	if err != nil {
+		log.WithError(err).Error("Failed to compute audit diff")
+	}
+
+	entry := models.AuditLog{
+		CreatedAt:  time.Now().UTC(),
+		ActorID:    actorID,
+		ActorName:  actorName,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Changes:    changes,
+		IP:         c.ClientIP(),
+		RequestID:  logging.RequestID(c),
+	}
+	if err := models.CreateAuditLog(db, &entry); err != nil {
+		log.WithError(err).Error("Failed to write audit log")
+	}
+}
+
+// RecordCommand stores an event for an action run from the command line, which has neither a
+// session nor a request; the actor name defaults to "cli"
+func RecordCommand(db *gorm.DB, event Event) error {
+	if event.ActorName == "" {
+		event.ActorName = "cli"
+	}
+	changes, err := Diff(event.Before, event.After)
+	if err != nil {
+		return err
+	}
+	return models.CreateAuditLog(db, &models.AuditLog{
+		CreatedAt:  time.Now().UTC(),
+		ActorID:    event.ActorID,
+		ActorName:  event.ActorName,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Changes:    changes,
+	})
+}
+
+// Diff compares the JSON representation of two values field by field.
+// Either side may be nil; secret fields are redacted and timestamps ignored.
+func Diff(before, after any) (models.AuditChanges, error) {
+	beforeFields, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(beforeFields)+len(afterFields))
+	for key := range beforeFields {
+		keys = append(keys, key)
+	}
+	for key := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := models.AuditChanges{}
+	for _, key := range keys {
+		if ignoredFields[key] {
+			continue
+		}
+		oldValue, newValue := beforeFields[key], afterFields[key]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if secretFields[key] {
+			oldValue, newValue = redacted, redacted
+		}
+		changes[key] = models.AuditChange{Before: oldValue, After: newValue}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return changes, nil
+}
+
+func fields(value any) (map[string]any, error) {
+	if value == nil {
+		return map[string]any{}, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]any{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
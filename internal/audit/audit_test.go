@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"bookstore/internal/models"
+	"testing"
+	"time"
+)
+
+func TestDiffCreateUpdateDelete(t *testing.T) {
+	before := models.BookInput{Title: "Old", Author: "A", ISBN: "1", Price: 10}
+	after := models.BookInput{Title: "New", Author: "A", ISBN: "1", Price: 12}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected title and price to change, got %v", changes)
+	}
+	if changes["title"].Before != "Old" || changes["title"].After != "New" {
+		t.Fatalf("unexpected title change %+v", changes["title"])
+	}
+	if changes["price"].Before != float64(10) || changes["price"].After != float64(12) {
+		t.Fatalf("unexpected price change %+v", changes["price"])
+	}
+
+	created, _ := Diff(nil, after)
+	if created["author"].Before != nil || created["author"].After != "A" {
+		t.Fatalf("expected every field on creation, got %v", created)
+	}
+
+	deleted, _ := Diff(before, nil)
+	if deleted["title"].Before != "Old" || deleted["title"].After != nil {
+		t.Fatalf("expected every field on deletion, got %v", deleted)
+	}
+
+	if same, _ := Diff(before, before); same != nil {
+		t.Fatalf("expected no changes, got %v", same)
+	}
+}
+
+func TestDiffRedactsSecretsAndIgnoresTimestamps(t *testing.T) {
+	before := models.User{Username: "reader", Password: "old-hash", UpdatedAt: time.Now()}
+	after := before
+	after.Password = "new-hash"
+	after.UpdatedAt = before.UpdatedAt.Add(time.Hour)
+	after.IsDeleted = true
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if changes["Password"].Before != redacted || changes["Password"].After != redacted {
+		t.Fatalf("expected the password to be redacted, got %+v", changes["Password"])
+	}
+	if _, ok := changes["UpdatedAt"]; ok {
+		t.Fatal("expected UpdatedAt to be ignored")
+	}
+	if changes["IsDeleted"].After != true {
+		t.Fatalf("expected IsDeleted to change, got %v", changes)
+	}
+}
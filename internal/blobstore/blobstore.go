@@ -0,0 +1,128 @@
+/*
+   blobstore keeps the files of the bookstore, such as uploaded ebooks, behind a small interface with
+   a local filesystem implementation and an S3-compatible one. Objects are addressed by slash
+   separated keys like "books/9780134190440/<sha256>.pdf".
+*/
+
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no object is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Object describes a stored blob. SHA256 (hex) is only known for objects returned by Put.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	SHA256      string
+	ModTime     time.Time
+}
+
+// BlobStore stores and serves blobs
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any existing object, and
+	// returns the object with the SHA-256 of what was written
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (Object, error)
+	// Open returns a seekable reader over the object, so it can serve range requests
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error)
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Default is the store used by the handlers; Setup replaces it once the configuration is loaded
+var Default BlobStore
+
+// Config selects and configures the blob store
+type Config struct {
+	Driver   string // "local" or "s3"
+	LocalDir string
+	S3       S3Config
+}
+
+// ConfigFromEnv reads BLOB_STORE (local by default), BLOB_LOCAL_DIR and the S3_* variables
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Driver:   strings.ToLower(os.Getenv("BLOB_STORE")),
+		LocalDir: os.Getenv("BLOB_LOCAL_DIR"),
+		S3: S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+
+			DialTimeout:           DefaultS3DialTimeout,
+			TLSHandshakeTimeout:   DefaultS3TLSHandshakeTimeout,
+			ResponseHeaderTimeout: DefaultS3ResponseHeaderTimeout,
+		},
+	}
+	if cfg.Driver == "" {
+		cfg.Driver = "local"
+	}
+	if cfg.LocalDir == "" {
+		cfg.LocalDir = "data/blobs"
+	}
+	if cfg.S3.Region == "" {
+		cfg.S3.Region = "us-east-1"
+	}
+	for name, timeout := range map[string]*time.Duration{
+		"S3_DIAL_TIMEOUT":            &cfg.S3.DialTimeout,
+		"S3_TLS_HANDSHAKE_TIMEOUT":   &cfg.S3.TLSHandshakeTimeout,
+		"S3_RESPONSE_HEADER_TIMEOUT": &cfg.S3.ResponseHeaderTimeout,
+	} {
+		if value := os.Getenv(name); value != "" {
+			var err error
+			if *timeout, err = time.ParseDuration(value); err != nil || *timeout <= 0 {
+				return Config{}, fmt.Errorf("%s must be a positive duration such as 10s", name)
+			}
+		}
+	}
+
+	switch cfg.Driver {
+	case "local":
+	case "s3":
+		if cfg.S3.Endpoint == "" || cfg.S3.Bucket == "" || cfg.S3.AccessKeyID == "" || cfg.S3.SecretAccessKey == "" {
+			return Config{}, errors.New("BLOB_STORE=s3 requires S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+	default:
+		return Config{}, fmt.Errorf("BLOB_STORE must be local or s3, got %q", cfg.Driver)
+	}
+	return cfg, nil
+}
+
+// New builds the store selected by cfg
+func New(cfg Config) (BlobStore, error) {
+	if cfg.Driver == "s3" {
+		return NewS3Store(cfg.S3, nil)
+	}
+	return NewLocalStore(cfg.LocalDir)
+}
+
+// Setup makes the store selected by cfg the Default
+func Setup(cfg Config) error {
+	store, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	Default = store
+	return nil
+}
+
+// validKey rejects keys that are empty, absolute or escape the store with ".."
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
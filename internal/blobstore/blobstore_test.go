@@ -0,0 +1,121 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStore runs the behaviour every BlobStore implementation must share
+func testStore(t *testing.T, store BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+	content := []byte("%PDF-1.7 " + strings.Repeat("page ", 2000))
+	sum := sha256.Sum256(content)
+
+	object, err := store.Put(ctx, "books/9780134190440/book.pdf", bytes.NewReader(content), int64(len(content)), "application/pdf")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if object.SHA256 != hex.EncodeToString(sum[:]) || object.Size != int64(len(content)) {
+		t.Fatalf("unexpected object %+v", object)
+	}
+
+	reader, stat, err := store.Open(ctx, "books/9780134190440/book.pdf")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if stat.Size != int64(len(content)) {
+		t.Fatalf("expected size %d, got %+v", len(content), stat)
+	}
+	all, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(all, content) {
+		t.Fatalf("reading the object back: %v", err)
+	}
+
+	// Seeking serves range requests
+	if _, err := reader.Seek(5000, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	part := make([]byte, 10)
+	if _, err := io.ReadFull(reader, part); err != nil || !bytes.Equal(part, content[5000:5010]) {
+		t.Fatalf("expected bytes 5000-5009, got %q (%v)", part, err)
+	}
+	if end, _ := reader.Seek(-4, io.SeekEnd); end != int64(len(content))-4 {
+		t.Fatalf("unexpected end offset %d", end)
+	}
+	tail, _ := io.ReadAll(reader)
+	if !bytes.Equal(tail, content[len(content)-4:]) {
+		t.Fatalf("expected the last 4 bytes, got %q", tail)
+	}
+	reader.Close()
+
+	// A short body is refused and does not replace the stored object
+	if _, err := store.Put(ctx, "books/9780134190440/book.pdf", strings.NewReader("short"), 100, "application/pdf"); err == nil {
+		t.Fatal("expected a short body to be refused")
+	}
+
+	if _, err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, ""); err == nil {
+		t.Fatal("expected a key escaping the store to be refused")
+	}
+
+	if err := store.Delete(ctx, "books/9780134190440/book.pdf"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := store.Open(ctx, "books/9780134190440/book.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after Delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "books/9780134190440/book.pdf"); err != nil {
+		t.Fatalf("deleting a missing object: %v", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	testStore(t, store)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	for _, key := range []string{"BLOB_STORE", "BLOB_LOCAL_DIR", "S3_ENDPOINT", "S3_REGION", "S3_BUCKET", "S3_ACCESS_KEY_ID", "S3_SECRET_ACCESS_KEY", "S3_DIAL_TIMEOUT", "S3_TLS_HANDSHAKE_TIMEOUT", "S3_RESPONSE_HEADER_TIMEOUT"} {
+		t.Setenv(key, "")
+	}
+	cfg, err := ConfigFromEnv()
+	if err != nil || cfg.Driver != "local" || cfg.LocalDir != "data/blobs" {
+		t.Fatalf("unexpected defaults %+v (%v)", cfg, err)
+	}
+
+	t.Setenv("BLOB_STORE", "s3")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected s3 without a bucket to be rejected")
+	}
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "books")
+	t.Setenv("S3_ACCESS_KEY_ID", "key")
+	t.Setenv("S3_SECRET_ACCESS_KEY", "secret")
+	if cfg, err = ConfigFromEnv(); err != nil || cfg.S3.Region != "us-east-1" || cfg.S3.ResponseHeaderTimeout != DefaultS3ResponseHeaderTimeout {
+		t.Fatalf("unexpected s3 config %+v (%v)", cfg, err)
+	}
+	t.Setenv("S3_DIAL_TIMEOUT", "2s")
+	if cfg, err = ConfigFromEnv(); err != nil || cfg.S3.DialTimeout != 2*time.Second {
+		t.Fatalf("expected S3_DIAL_TIMEOUT to be read, got %+v (%v)", cfg, err)
+	}
+	t.Setenv("S3_RESPONSE_HEADER_TIMEOUT", "soon")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected an invalid S3_RESPONSE_HEADER_TIMEOUT to be rejected")
+	}
+	t.Setenv("S3_RESPONSE_HEADER_TIMEOUT", "")
+
+	t.Setenv("BLOB_STORE", "ftp")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected an unknown driver to be rejected")
+	}
+}
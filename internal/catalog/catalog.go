@@ -0,0 +1,442 @@
+/*
+   catalog reads and writes the whole book catalog in bulk, as CSV, JSON lines or ONIX 3.0 XML,
+   and imports it into the database. Imports are all or nothing: every row is validated before
+   anything is written, and books are matched by ISBN, so existing books are updated and new
+   ones created.
+*/
+
+package catalog
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/models"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Supported file formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatONIX  = "onix"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv, jsonl or onix")
+
+// ContentTypes maps each format to the media type it is served with
+var ContentTypes = map[string]string{
+	FormatCSV:   "text/csv; charset=utf-8",
+	FormatJSONL: "application/x-ndjson",
+	FormatONIX:  "application/xml",
+}
+
+// Extensions maps each format to the file extension it is saved with
+var Extensions = map[string]string{
+	FormatCSV:   "csv",
+	FormatJSONL: "jsonl",
+	FormatONIX:  "xml",
+}
+
+// Media types and file extensions accepted on import, on top of those the formats are served with
+var (
+	mediaTypes = map[string]string{
+		"text/csv":             FormatCSV,
+		"application/csv":      FormatCSV,
+		"application/x-ndjson": FormatJSONL,
+		"application/jsonl":    FormatJSONL,
+		"application/xml":      FormatONIX,
+		"text/xml":             FormatONIX,
+	}
+	extensions = map[string]string{
+		".csv":    FormatCSV,
+		".jsonl":  FormatJSONL,
+		".ndjson": FormatJSONL,
+		".xml":    FormatONIX,
+		".onix":   FormatONIX,
+	}
+)
+
+// ValidFormat reports whether format is one of the supported formats
+func ValidFormat(format string) bool {
+	_, ok := ContentTypes[format]
+	return ok
+}
+
+// FormatFromContentType picks the format of an upload from its Content-Type
+func FormatFromContentType(contentType string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	format, ok := mediaTypes[mediaType]
+	return format, ok
+}
+
+// FormatFromFilename picks the format of a file from its extension
+func FormatFromFilename(name string) (string, bool) {
+	format, ok := extensions[strings.ToLower(filepath.Ext(name))]
+	return format, ok
+}
+
+// Row is one book read from an import file, with the problems found while reading it
+type Row struct {
+	Number int // line in CSV and JSON lines files, position of the product in ONIX messages
+	Book   models.BookInput
+	Errors []apierror.FieldError
+}
+
+// Read parses a whole import file. An error means the file as a whole is unreadable; problems
+// with single rows are reported on the rows.
+func Read(format string, r io.Reader) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(r)
+	case FormatJSONL:
+		return readJSONL(r)
+	case FormatONIX:
+		return readONIX(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Write writes books in the given format
+func Write(format string, w io.Writer, books []models.BookInput) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, books)
+	case FormatJSONL:
+		return writeJSONL(w, books)
+	case FormatONIX:
+		return writeONIX(w, books)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// Load returns every book of the catalog with its download link, contributors, categories and tags,
+// ordered by ISBN
+func Load(db *gorm.DB) ([]models.BookInput, error) {
+	var books []models.Book
+	if err := models.WithBookDetails(db).Order("isbn").Find(&books).Error; err != nil {
+		return nil, err
+	}
+	links, err := downloadLinks(db)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]models.BookInput, len(books))
+	for i, book := range books {
+		inputs[i] = book.Input(links[book.ID])
+	}
+	return inputs, nil
+}
+
+// What Import does with a row
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+	ActionInvalid   = "invalid"
+)
+
+// RowResult is the outcome of one imported row
+type RowResult struct {
+	Row    int                   `json:"row"`
+	ISBN   string                `json:"isbn"`
+	Action string                `json:"action"`
+	Errors []apierror.FieldError `json:"errors,omitempty"`
+	Before models.BookInput      `json:"-"` // the stored book, for updates
+	After  models.BookInput      `json:"-"`
+}
+
+// Report sums up an import. Nothing is written when a row is invalid or on a dry run.
+type Report struct {
+	DryRun    bool        `json:"dry_run"`
+	Applied   bool        `json:"applied"`
+	Total     int         `json:"total"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Invalid   int         `json:"invalid"`
+	Rows      []RowResult `json:"rows"`
+}
+
+// stored is a book of the catalog as Import finds it
+type stored struct {
+	book    models.Book
+	link    string
+	hasLink bool
+}
+
+// state is what Import knows of the database before writing anything
+type state struct {
+	books      map[string]stored          // by ISBN
+	categories map[string]models.Category // by slug
+}
+
+// Import validates every row and, unless one is invalid or dryRun is set, creates or updates the
+// books by ISBN in a single transaction. An empty download link keeps the stored one, and so do
+// rows without contributors whose author is unchanged, since most formats only carry the author.
+// Categories and tags left out keep the stored ones; categories must already exist. Empty
+// bibliographic details, such as the publisher or the page count, keep the stored ones too.
+func Import(db *gorm.DB, rows []Row, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun, Total: len(rows), Rows: make([]RowResult, 0, len(rows))}
+
+	var books []models.Book
+	// Books in the trash give up their ISBN, so a row with one of theirs creates a new book
+	if err := models.WithBookDetails(db).Find(&books).Error; err != nil {
+		return report, err
+	}
+	links, err := downloadLinks(db)
+	if err != nil {
+		return report, err
+	}
+	categories, err := models.GetAllCategories(db)
+	if err != nil {
+		return report, err
+	}
+	current := state{books: make(map[string]stored, len(books)), categories: make(map[string]models.Category, len(categories))}
+	for _, book := range books {
+		link, hasLink := links[book.ID]
+		current.books[book.ISBN] = stored{book: book, link: link, hasLink: hasLink}
+	}
+	for _, category := range categories {
+		current.categories[category.Slug] = category
+	}
+
+	seen := make(map[string]int, len(rows))
+	for _, row := range rows {
+		result := plan(row, current, seen)
+		switch result.Action {
+		case ActionCreate:
+			report.Created++
+		case ActionUpdate:
+			report.Updated++
+		case ActionUnchanged:
+			report.Unchanged++
+		case ActionInvalid:
+			report.Invalid++
+		}
+		report.Rows = append(report.Rows, result)
+	}
+	if dryRun || report.Invalid > 0 || report.Created+report.Updated == 0 {
+		return report, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, result := range report.Rows {
+			if err := apply(tx, result, current); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	report.Applied = true
+	return report, nil
+}
+
+// plan validates a row and decides what importing it does
+func plan(row Row, current state, seen map[string]int) RowResult {
+	result := RowResult{Row: row.Number, ISBN: row.Book.ISBN, Errors: row.Errors}
+
+	input := row.Book
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		for _, fieldErr := range apierror.Validation(err).Fields {
+			// A value that could not be read is reported once, not again as missing
+			if !hasFieldError(result.Errors, fieldErr.Field) {
+				result.Errors = append(result.Errors, fieldErr)
+			}
+		}
+	}
+	if len(result.Errors) > 0 {
+		result.Action = ActionInvalid
+		return result
+	}
+
+	input.NormalizeISBN()
+	input.NormalizeTaxonomy()
+	input.NormalizeDetails()
+	result.ISBN = input.ISBN
+	for _, categorySlug := range input.Categories {
+		if _, ok := current.categories[categorySlug]; !ok {
+			result.Errors = append(result.Errors, apierror.FieldError{Field: "categories", Rule: "exists", Message: fmt.Sprintf("category %q does not exist", categorySlug)})
+		}
+	}
+	if len(result.Errors) > 0 {
+		result.Action = ActionInvalid
+		return result
+	}
+	if first, ok := seen[input.ISBN]; ok {
+		result.Action = ActionInvalid
+		result.Errors = []apierror.FieldError{{Field: "isbn", Rule: "unique", Message: "isbn is already used by row " + strconv.Itoa(first)}}
+		return result
+	}
+	seen[input.ISBN] = row.Number
+
+	book, exists := current.books[input.ISBN]
+	if !exists {
+		input.NormalizeContributors()
+		result.Action = ActionCreate
+		result.After = input
+		return result
+	}
+	result.Before = book.book.Input(book.link)
+	result.Before.NormalizeContributors()
+	// An empty list and no categories or tags at all are the same thing
+	if result.Before.Categories == nil {
+		result.Before.Categories = []string{}
+	}
+	if result.Before.Tags == nil {
+		result.Before.Tags = []string{}
+	}
+	if input.DownloadLink == "" {
+		input.DownloadLink = book.link
+	}
+	if len(input.Contributors) == 0 && input.Author == book.book.Author {
+		input.Contributors = result.Before.Contributors
+	}
+	if input.Categories == nil {
+		input.Categories = result.Before.Categories
+	}
+	if input.Tags == nil {
+		input.Tags = result.Before.Tags
+	}
+	keepDetails(&input, result.Before)
+	input.NormalizeContributors()
+	result.After = input
+	if reflect.DeepEqual(result.After, result.Before) {
+		result.Action = ActionUnchanged
+	} else {
+		result.Action = ActionUpdate
+	}
+	return result
+}
+
+// keepDetails fills the bibliographic details a row leaves empty with the stored ones
+func keepDetails(input *models.BookInput, before models.BookInput) {
+	if input.Publisher == "" {
+		input.Publisher, input.Imprint = before.Publisher, before.Imprint
+	}
+	if input.Language == "" {
+		input.Language = before.Language
+	}
+	if input.PageCount == 0 {
+		input.PageCount = before.PageCount
+	}
+	if input.Format == "" {
+		input.Format = before.Format
+	}
+	if input.FileSize == 0 {
+		input.FileSize = before.FileSize
+	}
+	if input.PublicationDate == "" {
+		input.PublicationDate = before.PublicationDate
+	}
+	if input.AgeRating == 0 {
+		input.AgeRating = before.AgeRating
+	}
+}
+
+// apply writes a planned row
+func apply(tx *gorm.DB, result RowResult, current state) error {
+	input := result.After
+	var categories []models.Category
+	for _, categorySlug := range input.Categories {
+		categories = append(categories, current.categories[categorySlug])
+	}
+	if input.Categories != nil && categories == nil {
+		categories = []models.Category{}
+	}
+	stored := current.books[input.ISBN]
+	book := stored.book
+	switch result.Action {
+	case ActionCreate:
+		book = models.Book{
+			Title:         input.Title,
+			Author:        input.Author,
+			Description:   input.Description,
+			ISBN:          input.ISBN,
+			PublishedYear: input.PublishedYear,
+			Price:         input.Price,
+		}
+		book.SetDetails(input)
+		if err := models.AssignPublisher(tx, &book, input.Publisher, input.Imprint); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(&book).Error; err != nil {
+			return err
+		}
+		if err := models.SetBookContributors(tx, &book, input.Contributors); err != nil {
+			return err
+		}
+		if err := models.SetBookTaxonomy(tx, &book, categories, input.Tags); err != nil {
+			return err
+		}
+	case ActionUpdate:
+		book.Title = input.Title
+		book.Author = input.Author
+		book.Description = input.Description
+		book.PublishedYear = input.PublishedYear
+		book.Price = input.Price
+		book.SetDetails(input)
+		if err := models.AssignPublisher(tx, &book, input.Publisher, input.Imprint); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Save(&book).Error; err != nil {
+			return err
+		}
+		if err := models.SetBookContributors(tx, &book, input.Contributors); err != nil {
+			return err
+		}
+		if err := models.SetBookTaxonomy(tx, &book, categories, input.Tags); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	switch {
+	case input.DownloadLink == "" || input.DownloadLink == stored.link && stored.hasLink:
+		return nil
+	case stored.hasLink:
+		return tx.Model(&models.BookDownload{}).Where("book_id = ?", book.ID).Update("download_link", input.DownloadLink).Error
+	default:
+		return tx.Create(&models.BookDownload{BookID: book.ID, ISBN: book.ISBN, DownloadLink: input.DownloadLink}).Error
+	}
+}
+
+// downloadLinks maps book IDs to their download link
+func downloadLinks(db *gorm.DB) (map[uint]string, error) {
+	var downloads []models.BookDownload
+	if err := db.Find(&downloads).Error; err != nil {
+		return nil, err
+	}
+	links := make(map[uint]string, len(downloads))
+	for _, download := range downloads {
+		links[download.BookID] = download.DownloadLink
+	}
+	return links, nil
+}
+
+func hasFieldError(errs []apierror.FieldError, field string) bool {
+	for _, err := range errs {
+		if err.Field == field {
+			return true
+		}
+	}
+	return false
+}
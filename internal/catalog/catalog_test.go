@@ -0,0 +1,255 @@
+package catalog
+
+import (
+	"bookstore/internal/models"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var books = []models.BookInput{
+	{
+		Title:         "The Go Programming Language",
+		Author:        "Alan Donovan, Brian Kernighan",
+		Description:   "Line one & \"two\"\n<three>",
+		ISBN:          "9780134190440",
+		PublishedYear: 2015,
+		Price:         40.5,
+		DownloadLink:  "https://example.com/gopl",
+		Contributors: []models.ContributorInput{
+			{Name: "Alan Donovan", Role: models.RoleAuthor},
+			{Name: "Brian Kernighan", Role: models.RoleAuthor},
+			{Name: "Jane Doe", Role: models.RoleTranslator},
+		},
+		Categories: []string{"computing", "programming-languages"},
+		Tags:       []string{"classic", "go"},
+
+		Publisher:       "Addison-Wesley",
+		Imprint:         "Professional",
+		Language:        "en",
+		PageCount:       380,
+		Format:          models.FormatPaperback,
+		PublicationDate: "2015-10-26",
+		AgeRating:       12,
+	},
+	{Title: "Der Prozess", Author: "Franz Kafka", ISBN: "9783150094525", Price: 5, Language: "de", Format: models.FormatEbook, FileSize: 1 << 20},
+	{Title: "Untitled", Author: "Anonymous", ISBN: "9791090636071", Price: 3},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatJSONL, FormatONIX} {
+		var buf bytes.Buffer
+		if err := Write(format, &buf, books); err != nil {
+			t.Fatalf("%s: Write: %v", format, err)
+		}
+		rows, err := Read(format, &buf)
+		if err != nil {
+			t.Fatalf("%s: Read: %v\n%s", format, err, buf.String())
+		}
+		if len(rows) != len(books) {
+			t.Fatalf("%s: expected %d rows, got %d", format, len(books), len(rows))
+		}
+		for i, row := range rows {
+			want := books[i]
+			switch format {
+			case FormatCSV:
+				// Only the author survives, and the cells of categories and tags are never null
+				want.Contributors = nil
+				if want.Categories == nil {
+					want.Categories, want.Tags = []string{}, []string{}
+				}
+			case FormatONIX:
+				want.DownloadLink = ""
+				want.Categories, want.Tags = nil, nil
+				want.NormalizeContributors()
+			}
+			if len(row.Errors) > 0 || !reflect.DeepEqual(row.Book, want) {
+				t.Errorf("%s: row %d = %+v %v, want %+v", format, i, row.Book, row.Errors, want)
+			}
+		}
+	}
+}
+
+func TestReadCSVRowErrors(t *testing.T) {
+	file := "\ufeffISBN,Title,Author,Price,Published_Year\n" +
+		"9780134190440,Go,Gopher,abc,2015\n" +
+		"\n" +
+		"9780134190440,Go,Gopher\n" +
+		"\"978-0-13-419044-0\", Go , Gopher ,10,\n"
+	rows, err := Read(FormatCSV, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %+v", rows)
+	}
+	if rows[0].Number != 2 || len(rows[0].Errors) != 1 || rows[0].Errors[0].Field != "price" || rows[0].Book.PublishedYear != 2015 {
+		t.Errorf("expected a price error on line 2, got %+v", rows[0])
+	}
+	if rows[1].Number != 4 || len(rows[1].Errors) != 1 || rows[1].Errors[0].Rule != "columns" {
+		t.Errorf("expected a column count error on line 4, got %+v", rows[1])
+	}
+	if rows[2].Number != 5 || len(rows[2].Errors) != 0 || rows[2].Book.Title != "Go" || rows[2].Book.Price != 10 {
+		t.Errorf("expected a valid row on line 5, got %+v", rows[2])
+	}
+
+	for _, header := range []string{"isbn,title,author,price,colour\n", "isbn,title,author\n", "isbn,isbn,title,author,price\n", ""} {
+		if _, err := Read(FormatCSV, strings.NewReader(header)); err == nil {
+			t.Errorf("expected header %q to be rejected", header)
+		}
+	}
+}
+
+func TestReadJSONLRowErrors(t *testing.T) {
+	file := `{"isbn": "9780134190440", "title": "Go", "author": "Gopher", "price": 10}` + "\n\n" +
+		`{"isbn": "9780134190440", "price": "ten"}` + "\n" +
+		`not json` + "\n"
+	rows, err := Read(FormatJSONL, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(rows) != 3 || rows[0].Number != 1 || rows[1].Number != 3 || rows[2].Number != 4 {
+		t.Fatalf("expected rows on lines 1, 3 and 4, got %+v", rows)
+	}
+	if len(rows[0].Errors) != 0 || rows[0].Book.Title != "Go" {
+		t.Errorf("expected a valid first row, got %+v", rows[0])
+	}
+	if len(rows[1].Errors) != 1 || rows[1].Errors[0].Field != "price" || rows[1].Errors[0].Rule != "type" {
+		t.Errorf("expected a price type error, got %+v", rows[1].Errors)
+	}
+	if len(rows[2].Errors) != 1 || rows[2].Errors[0].Rule != "json" {
+		t.Errorf("expected a JSON error, got %+v", rows[2].Errors)
+	}
+}
+
+func TestReadONIX(t *testing.T) {
+	file := `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+  <Header><Sender><SenderName>Publisher</SenderName></Sender><SentDateTime>20240101</SentDateTime></Header>
+  <Product>
+    <RecordReference>com.example.1</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>01</ProductIDType><IDValue>internal-1</IDValue></ProductIdentifier>
+    <ProductIdentifier><ProductIDType>02</ProductIDType><IDValue>0-13-419044-0</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <ProductComposition>00</ProductComposition>
+      <ProductForm>ED</ProductForm>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement>
+          <TitleElementLevel>01</TitleElementLevel>
+          <TitlePrefix>The</TitlePrefix>
+          <TitleWithoutPrefix>Go Programming Language</TitleWithoutPrefix>
+        </TitleElement>
+      </TitleDetail>
+      <Contributor><SequenceNumber>1</SequenceNumber><ContributorRole>A01</ContributorRole><NamesBeforeKey>Alan A. A.</NamesBeforeKey><KeyNames>Donovan</KeyNames></Contributor>
+      <Contributor><SequenceNumber>2</SequenceNumber><ContributorRole>B01</ContributorRole><PersonName>An Editor</PersonName></Contributor>
+      <Contributor><SequenceNumber>3</SequenceNumber><ContributorRole>A01</ContributorRole><PersonName>Brian W. Kernighan</PersonName></Contributor>
+      <Language><LanguageRole>02</LanguageRole><LanguageCode>ger</LanguageCode></Language>
+      <Language><LanguageRole>01</LanguageRole><LanguageCode>eng</LanguageCode></Language>
+      <Extent><ExtentType>11</ExtentType><ExtentValue>400</ExtentValue><ExtentUnit>03</ExtentUnit></Extent>
+      <Extent><ExtentType>00</ExtentType><ExtentValue>380</ExtentValue><ExtentUnit>03</ExtentUnit></Extent>
+      <Extent><ExtentType>22</ExtentType><ExtentValue>2.5</ExtentValue><ExtentUnit>19</ExtentUnit></Extent>
+      <AudienceRange><AudienceRangeQualifier>17</AudienceRangeQualifier><AudienceRangePrecision>03</AudienceRangePrecision><AudienceRangeValue>12</AudienceRangeValue></AudienceRange>
+    </DescriptiveDetail>
+    <CollateralDetail>
+      <TextContent><TextType>02</TextType><ContentAudience>00</ContentAudience><Text>Short.</Text></TextContent>
+      <TextContent><TextType>03</TextType><ContentAudience>00</ContentAudience><Text textformat="05"><p>The <em>authoritative</em> resource</p><p>for Go &amp; more.</p></Text></TextContent>
+    </CollateralDetail>
+    <PublishingDetail>
+      <Imprint><ImprintName>Addison-Wesley Professional</ImprintName></Imprint>
+      <Publisher><PublishingRole>02</PublishingRole><PublisherName>Pearson Distribution</PublisherName></Publisher>
+      <Publisher><PublishingRole>01</PublishingRole><PublisherName>Pearson</PublisherName></Publisher>
+      <PublishingDate><PublishingDateRole>19</PublishingDateRole><Date>20140101</Date></PublishingDate>
+      <PublishingDate><PublishingDateRole>01</PublishingDateRole><Date>20151026</Date></PublishingDate>
+    </PublishingDetail>
+    <ProductSupply>
+      <SupplyDetail>
+        <Supplier><SupplierRole>01</SupplierRole><SupplierName>Publisher</SupplierName></Supplier>
+        <ProductAvailability>20</ProductAvailability>
+        <Price><PriceType>02</PriceType><PriceAmount>34.99</PriceAmount><CurrencyCode>USD</CurrencyCode></Price>
+      </SupplyDetail>
+    </ProductSupply>
+  </Product>
+  <Product>
+    <RecordReference>com.example.2</RecordReference>
+    <NotificationType>05</NotificationType>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9791090636071</IDValue></ProductIdentifier>
+  </Product>
+  <Product>
+    <RecordReference>com.example.3</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9783150094525</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <ProductComposition>00</ProductComposition>
+      <ProductForm>AJ</ProductForm>
+      <Language><LanguageRole>01</LanguageRole><LanguageCode>ger</LanguageCode></Language>
+    </DescriptiveDetail>
+    <PublishingDetail>
+      <Imprint><ImprintName>Reclam</ImprintName></Imprint>
+      <PublishingDate><PublishingDateRole>01</PublishingDateRole><Date dateformat="05">1925</Date></PublishingDate>
+    </PublishingDetail>
+  </Product>
+</ONIXMessage>`
+	rows, err := Read(FormatONIX, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %+v", rows)
+	}
+	want := models.BookInput{
+		Title:         "The Go Programming Language",
+		Author:        "Alan A. A. Donovan, Brian W. Kernighan",
+		Description:   "The authoritative resource for Go & more.",
+		ISBN:          "0-13-419044-0",
+		PublishedYear: 2015,
+		Price:         34.99,
+		Contributors: []models.ContributorInput{
+			{Name: "Alan A. A. Donovan", Role: models.RoleAuthor},
+			{Name: "An Editor", Role: models.RoleEditor},
+			{Name: "Brian W. Kernighan", Role: models.RoleAuthor},
+		},
+
+		Publisher:       "Pearson",
+		Imprint:         "Addison-Wesley Professional",
+		Language:        "en",
+		PageCount:       380,
+		Format:          models.FormatEbook,
+		FileSize:        2.5 * (1 << 20),
+		PublicationDate: "2015-10-26",
+		AgeRating:       12,
+	}
+	if len(rows[0].Errors) != 0 || !reflect.DeepEqual(rows[0].Book, want) {
+		t.Errorf("got %+v %v, want %+v", rows[0].Book, rows[0].Errors, want)
+	}
+	if rows[1].Number != 2 || len(rows[1].Errors) != 1 || rows[1].Errors[0].Field != "NotificationType" {
+		t.Errorf("expected the deletion to be refused, got %+v", rows[1])
+	}
+	// An imprint without a publisher is taken as the publisher
+	if got := rows[2].Book; got.Publisher != "Reclam" || got.Imprint != "" || got.Language != "de" || got.Format != models.FormatAudiobook || got.PublishedYear != 1925 || got.PublicationDate != "" {
+		t.Errorf("expected an audiobook in German from Reclam, got %+v", got)
+	}
+
+	for _, message := range []string{`<ONIXmessage release="3.0"/>`, `<ONIXMessage release="2.1"/>`, `<catalog/>`, ``, `<ONIXMessage release="3.0"><Product>`} {
+		if _, err := Read(FormatONIX, strings.NewReader(message)); err == nil {
+			t.Errorf("expected %q to be rejected", message)
+		}
+	}
+}
+
+func TestFormatDetection(t *testing.T) {
+	if format, ok := FormatFromContentType("text/csv; charset=utf-8"); !ok || format != FormatCSV {
+		t.Errorf("expected csv, got %q", format)
+	}
+	if _, ok := FormatFromContentType("application/json"); ok {
+		t.Error("expected plain JSON to be refused")
+	}
+	if format, ok := FormatFromFilename("catalog.NDJSON"); !ok || format != FormatJSONL {
+		t.Errorf("expected jsonl, got %q", format)
+	}
+	if format, ok := FormatFromFilename("feed.onix"); !ok || format != FormatONIX {
+		t.Errorf("expected onix, got %q", format)
+	}
+}
@@ -0,0 +1,190 @@
+// CSV files: a header row naming the columns, then one book per row. Categories and tags share a
+// cell each, separated by semicolons.
+
+package catalog
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvColumns are the columns of exported files; imports may leave out the optional ones
+var csvColumns = []string{"isbn", "title", "author", "description", "published_year", "price", "download_link", "categories", "tags",
+	"publisher", "imprint", "language", "format", "page_count", "file_size", "publication_date", "age_rating"}
+
+var requiredColumns = []string{"isbn", "title", "author", "price"}
+
+// listSeparator separates the categories and the tags of a book in their cell
+const listSeparator = ";"
+
+func readCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// Spreadsheets tend to start their exports with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !knownColumn(name) {
+			return nil, fmt.Errorf("unknown column %q; columns are %s", name, strings.Join(csvColumns, ", "))
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		row := Row{Number: line}
+		if len(record) != len(header) {
+			row.Errors = append(row.Errors, apierror.FieldError{
+				Field:   "row",
+				Rule:    "columns",
+				Message: fmt.Sprintf("row has %d columns, the header has %d", len(record), len(header)),
+			})
+			rows = append(rows, row)
+			continue
+		}
+
+		value := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.Book = models.BookInput{
+			Title:        value("title"),
+			Author:       value("author"),
+			Description:  value("description"),
+			ISBN:         value("isbn"),
+			DownloadLink: value("download_link"),
+
+			Publisher:       value("publisher"),
+			Imprint:         value("imprint"),
+			Language:        value("language"),
+			Format:          value("format"),
+			PublicationDate: value("publication_date"),
+		}
+		// A file without the column keeps the stored ones, an empty cell removes them
+		if _, ok := columns["categories"]; ok {
+			row.Book.Categories = splitList(value("categories"))
+		}
+		if _, ok := columns["tags"]; ok {
+			row.Book.Tags = splitList(value("tags"))
+		}
+		if year := value("published_year"); year != "" {
+			if row.Book.PublishedYear, err = strconv.Atoi(year); err != nil {
+				row.Errors = append(row.Errors, typeError("published_year", "a whole number"))
+			}
+		}
+		if price := value("price"); price != "" {
+			if row.Book.Price, err = strconv.ParseFloat(price, 64); err != nil {
+				row.Errors = append(row.Errors, typeError("price", "a number"))
+			}
+		}
+		if pages := value("page_count"); pages != "" {
+			if row.Book.PageCount, err = strconv.Atoi(pages); err != nil {
+				row.Errors = append(row.Errors, typeError("page_count", "a whole number"))
+			}
+		}
+		if size := value("file_size"); size != "" {
+			if row.Book.FileSize, err = strconv.ParseInt(size, 10, 64); err != nil {
+				row.Errors = append(row.Errors, typeError("file_size", "a whole number"))
+			}
+		}
+		if age := value("age_rating"); age != "" {
+			if row.Book.AgeRating, err = strconv.Atoi(age); err != nil {
+				row.Errors = append(row.Errors, typeError("age_rating", "a whole number"))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func writeCSV(w io.Writer, books []models.BookInput) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvColumns)
+	for _, book := range books {
+		writer.Write([]string{
+			book.ISBN,
+			book.Title,
+			book.Author,
+			book.Description,
+			formatInt(int64(book.PublishedYear)),
+			strconv.FormatFloat(book.Price, 'f', -1, 64),
+			book.DownloadLink,
+			strings.Join(book.Categories, listSeparator),
+			strings.Join(book.Tags, listSeparator),
+			book.Publisher,
+			book.Imprint,
+			book.Language,
+			book.Format,
+			formatInt(int64(book.PageCount)),
+			formatInt(book.FileSize),
+			book.PublicationDate,
+			formatInt(int64(book.AgeRating)),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatInt writes a whole number, leaving the cell empty for zero
+func formatInt(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// splitList splits a cell of semicolon-separated values, dropping empty ones
+func splitList(cell string) []string {
+	values := []string{}
+	for _, value := range strings.Split(cell, listSeparator) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func knownColumn(name string) bool {
+	for _, column := range csvColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// typeError reports a value that does not have the type of its field
+func typeError(field, kind string) apierror.FieldError {
+	return apierror.FieldError{Field: field, Rule: "type", Message: field + " must be " + kind}
+}
@@ -0,0 +1,60 @@
+// JSON lines files: one book per line, as the JSON body of POST /api/v1/books
+
+package catalog
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/models"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxJSONLine caps a single line, well above any book description
+const maxJSONLine = 1 << 20
+
+func readJSONL(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxJSONLine)
+
+	var rows []Row
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := Row{Number: line}
+		if err := json.Unmarshal(text, &row.Book); err != nil {
+			if fields := apierror.Validation(err).Fields; len(fields) > 0 {
+				row.Errors = fields
+			} else {
+				row.Errors = []apierror.FieldError{{Field: "row", Rule: "json", Message: "row is not a valid JSON object"}}
+			}
+		}
+		rows = append(rows, row)
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return nil, fmt.Errorf("line %d is longer than %d bytes", line+1, maxJSONLine)
+	} else if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line == 0 {
+		return nil, errors.New("the file is empty")
+	}
+	return rows, nil
+}
+
+func writeJSONL(w io.Writer, books []models.BookInput) error {
+	encoder := json.NewEncoder(w)
+	for _, book := range books {
+		if err := encoder.Encode(book); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,630 @@
+/*
+   ONIX 3.0 messages with reference tag names. Imports read a book from each Product: the ISBN-13
+   (or ISBN-10) identifier, the distinctive title, the authors, the description, the publication
+   date and the first price, along with the product form, the language of the text, the page
+   count and file size, the youngest interest age, the publisher and the imprint. ONIX has no
+   place for download links, so imports keep the stored ones and exports leave them out.
+*/
+
+package catalog
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/models"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// ONIX code list values used here
+const (
+	onixISBN10        = "02" // List 5, product identifier types
+	onixGTIN13        = "03"
+	onixISBN13        = "15"
+	onixDelete        = "05"  // List 1, notification types
+	onixTitle         = "01"  // List 15, distinctive title
+	onixProductLevel  = "01"  // List 149, title element at product level
+	onixByAuthor      = "A01" // List 17, contributor roles
+	onixIllustrator   = "A12"
+	onixEditor        = "B01"
+	onixTranslator    = "B06"
+	onixDescription   = "03" // List 153, text types
+	onixShortDesc     = "02"
+	onixPublished     = "01" // List 163, publication date
+	onixXHTML         = "05" // List 34, text formats
+	onixHTML          = "02"
+	onixYYYYMMDD      = "00" // List 55, date formats
+	onixYYYY          = "05"
+	onixTextLanguage  = "01" // List 22, language of text
+	onixPages         = "00" // List 23, main content page count
+	onixContentPages  = "11" // content page count
+	onixFileSize      = "22"
+	onixPageUnit      = "03" // List 24, extent units
+	onixBytes         = "17"
+	onixKbytes        = "18"
+	onixMbytes        = "19"
+	onixInterestAge   = "17" // List 30, interest age in years
+	onixExact         = "01" // List 31, audience range precision
+	onixFrom          = "03"
+	onixPublisherRole = "01" // List 45, publishing roles
+	onixUndefined     = "00" // List 150, product forms
+)
+
+// onixForms maps formats to the ONIX product form exports use
+var onixForms = map[string]string{
+	models.FormatHardcover: "BB",
+	models.FormatPaperback: "BC",
+	models.FormatEbook:     "ED",
+	models.FormatAudiobook: "AJ",
+}
+
+// onixBibliographic maps the ISO 639-2/B language codes ONIX uses to the terminology codes
+// language tags know, where they differ
+var onixBibliographic = map[string]string{
+	"alb": "sqi", "arm": "hye", "baq": "eus", "bur": "mya", "chi": "zho", "cze": "ces", "dut": "nld",
+	"fre": "fra", "geo": "kat", "ger": "deu", "gre": "ell", "ice": "isl", "mac": "mkd", "mao": "mri",
+	"may": "msa", "per": "fas", "rum": "ron", "slo": "slk", "tib": "bod", "wel": "cym",
+}
+
+// onixRoles maps contributor roles to their ONIX code
+var onixRoles = map[string]string{
+	models.RoleAuthor:      onixByAuthor,
+	models.RoleEditor:      onixEditor,
+	models.RoleTranslator:  onixTranslator,
+	models.RoleIllustrator: onixIllustrator,
+}
+
+type onixMessage struct {
+	XMLName  xml.Name      `xml:"http://ns.editeur.org/onix/3.0/reference ONIXMessage"`
+	Release  string        `xml:"release,attr"`
+	Header   onixHeader    `xml:"Header"`
+	Products []onixProduct `xml:"Product"`
+}
+
+type onixHeader struct {
+	SenderName   string `xml:"Sender>SenderName"`
+	SentDateTime string `xml:"SentDateTime"`
+}
+
+type onixProduct struct {
+	RecordReference    string            `xml:"RecordReference"`
+	NotificationType   string            `xml:"NotificationType"`
+	Identifiers        []onixIdentifier  `xml:"ProductIdentifier"`
+	ProductComposition string            `xml:"DescriptiveDetail>ProductComposition,omitempty"`
+	ProductForm        string            `xml:"DescriptiveDetail>ProductForm,omitempty"`
+	Titles             []onixTitleDetail `xml:"DescriptiveDetail>TitleDetail"`
+	Contributors       []onixContributor `xml:"DescriptiveDetail>Contributor"`
+	Languages          []onixLanguage    `xml:"DescriptiveDetail>Language"`
+	Extents            []onixExtent      `xml:"DescriptiveDetail>Extent"`
+	AudienceRanges     []onixAudience    `xml:"DescriptiveDetail>AudienceRange"`
+	Texts              []onixTextContent `xml:"CollateralDetail>TextContent"`
+	Imprints           []onixImprint     `xml:"PublishingDetail>Imprint"`
+	Publishers         []onixPublisher   `xml:"PublishingDetail>Publisher"`
+	Dates              []onixDate        `xml:"PublishingDetail>PublishingDate"`
+	Supplier           *onixSupplier     `xml:"ProductSupply>SupplyDetail>Supplier"`
+	Availability       string            `xml:"ProductSupply>SupplyDetail>ProductAvailability,omitempty"`
+	Prices             []onixPrice       `xml:"ProductSupply>SupplyDetail>Price"`
+}
+
+type onixIdentifier struct {
+	Type  string `xml:"ProductIDType"`
+	Value string `xml:"IDValue"`
+}
+
+type onixTitleDetail struct {
+	Type     string             `xml:"TitleType"`
+	Elements []onixTitleElement `xml:"TitleElement"`
+}
+
+type onixTitleElement struct {
+	Level         string `xml:"TitleElementLevel"`
+	Text          string `xml:"TitleText,omitempty"`
+	Prefix        string `xml:"TitlePrefix,omitempty"`
+	WithoutPrefix string `xml:"TitleWithoutPrefix,omitempty"`
+}
+
+type onixContributor struct {
+	Sequence           int      `xml:"SequenceNumber,omitempty"`
+	Roles              []string `xml:"ContributorRole"`
+	PersonName         string   `xml:"PersonName,omitempty"`
+	PersonNameInverted string   `xml:"PersonNameInverted,omitempty"`
+	NamesBeforeKey     string   `xml:"NamesBeforeKey,omitempty"`
+	KeyNames           string   `xml:"KeyNames,omitempty"`
+	CorporateName      string   `xml:"CorporateName,omitempty"`
+}
+
+type onixLanguage struct {
+	Role string `xml:"LanguageRole"`
+	Code string `xml:"LanguageCode"`
+}
+
+type onixExtent struct {
+	Type  string `xml:"ExtentType"`
+	Value string `xml:"ExtentValue"`
+	Unit  string `xml:"ExtentUnit"`
+}
+
+type onixAudience struct {
+	Qualifier string `xml:"AudienceRangeQualifier"`
+	Precision string `xml:"AudienceRangePrecision"`
+	Value     string `xml:"AudienceRangeValue"`
+}
+
+type onixImprint struct {
+	Name string `xml:"ImprintName"`
+}
+
+type onixPublisher struct {
+	Role string `xml:"PublishingRole,omitempty"`
+	Name string `xml:"PublisherName"`
+}
+
+type onixTextContent struct {
+	Type     string   `xml:"TextType"`
+	Audience string   `xml:"ContentAudience"`
+	Text     onixText `xml:"Text"`
+}
+
+// onixText keeps the markup of XHTML texts, which encoding/xml would otherwise drop
+type onixText struct {
+	Format string `xml:"textformat,attr,omitempty"`
+	Inner  string `xml:",innerxml"`
+}
+
+type onixDate struct {
+	Role string        `xml:"PublishingDateRole"`
+	Date onixDateValue `xml:"Date"`
+}
+
+type onixDateValue struct {
+	Format string `xml:"dateformat,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+type onixSupplier struct {
+	Role string `xml:"SupplierRole"`
+	Name string `xml:"SupplierName"`
+}
+
+type onixPrice struct {
+	Type   string `xml:"PriceType,omitempty"`
+	Amount string `xml:"PriceAmount"`
+}
+
+func readONIX(r io.Reader) ([]Row, error) {
+	decoder := xml.NewDecoder(r)
+	var rows []Row
+	inMessage := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if !inMessage {
+			switch start.Name.Local {
+			case "ONIXMessage":
+			case "ONIXmessage":
+				return nil, errors.New("ONIX short tags are not supported, use reference names")
+			default:
+				return nil, fmt.Errorf("expected an ONIXMessage, found <%s>", start.Name.Local)
+			}
+			if release := attr(start, "release"); !strings.HasPrefix(release, "3.") {
+				return nil, fmt.Errorf("ONIX release %q is not supported, only 3.0 is", release)
+			}
+			inMessage = true
+			continue
+		}
+
+		// Products are decoded one at a time, the header and anything else is skipped
+		if start.Name.Local != "Product" {
+			if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var product onixProduct
+		if err := decoder.DecodeElement(&product, &start); err != nil {
+			return nil, err
+		}
+		rows = append(rows, product.row(len(rows)+1))
+	}
+	if !inMessage {
+		return nil, errors.New("the file is empty")
+	}
+	return rows, nil
+}
+
+func (p onixProduct) row(number int) Row {
+	row := Row{Number: number}
+	if p.NotificationType == onixDelete {
+		row.Errors = append(row.Errors, apierror.FieldError{
+			Field:   "NotificationType",
+			Rule:    "oneof",
+			Message: "deletions (NotificationType 05) are not imported",
+		})
+	}
+	row.Book = models.BookInput{
+		Title:         p.title(),
+		Author:        p.authors(),
+		Contributors:  p.contributors(),
+		Description:   p.description(),
+		ISBN:          p.isbn(),
+		PublishedYear: p.year(),
+
+		Publisher:       p.publisher(),
+		Imprint:         p.imprint(),
+		Language:        p.language(),
+		Format:          p.format(),
+		PublicationDate: p.date(),
+		AgeRating:       p.ageRating(),
+	}
+	row.Book.PageCount, row.Book.FileSize = p.extents()
+	if row.Book.Publisher == "" {
+		// An imprint is all some senders give; it is the publisher as far as books go
+		row.Book.Publisher, row.Book.Imprint = row.Book.Imprint, ""
+	}
+	if len(p.Prices) > 0 {
+		price, err := strconv.ParseFloat(strings.TrimSpace(p.Prices[0].Amount), 64)
+		if err != nil {
+			row.Errors = append(row.Errors, typeError("price", "a number"))
+		}
+		row.Book.Price = price
+	}
+	return row
+}
+
+// isbn prefers the ISBN-13, then a GTIN-13 (the same number for books), then the ISBN-10
+func (p onixProduct) isbn() string {
+	for _, idType := range []string{onixISBN13, onixGTIN13, onixISBN10} {
+		for _, id := range p.Identifiers {
+			if id.Type == idType {
+				return strings.TrimSpace(id.Value)
+			}
+		}
+	}
+	return ""
+}
+
+func (p onixProduct) title() string {
+	var fallback string
+	for _, detail := range p.Titles {
+		for _, element := range detail.Elements {
+			text := strings.TrimSpace(element.Text)
+			if text == "" {
+				text = strings.TrimSpace(strings.TrimSpace(element.Prefix) + " " + strings.TrimSpace(element.WithoutPrefix))
+			}
+			if detail.Type == onixTitle && element.Level == onixProductLevel && text != "" {
+				return text
+			}
+			if fallback == "" {
+				fallback = text
+			}
+		}
+	}
+	return fallback
+}
+
+// authors lists the contributors "by" the book, or every contributor when none is
+func (p onixProduct) authors() string {
+	var authors, others []string
+	for _, contributor := range p.Contributors {
+		name := contributor.name()
+		if name == "" {
+			continue
+		}
+		others = append(others, name)
+		for _, role := range contributor.Roles {
+			if role == onixByAuthor {
+				authors = append(authors, name)
+				break
+			}
+		}
+	}
+	if len(authors) == 0 {
+		authors = others
+	}
+	return strings.Join(authors, ", ")
+}
+
+// contributors lists the contributors in the roles books credit, in sequence; other roles are left out
+func (p onixProduct) contributors() []models.ContributorInput {
+	var contributors []models.ContributorInput
+	for _, contributor := range p.Contributors {
+		name := contributor.name()
+		if name == "" {
+			continue
+		}
+		for _, code := range contributor.Roles {
+			for role, roleCode := range onixRoles {
+				if strings.TrimSpace(code) == roleCode {
+					contributors = append(contributors, models.ContributorInput{Name: name, Role: role})
+				}
+			}
+		}
+	}
+	return contributors
+}
+
+func (c onixContributor) name() string {
+	switch {
+	case c.PersonName != "":
+		return strings.TrimSpace(c.PersonName)
+	case c.KeyNames != "":
+		return strings.TrimSpace(strings.TrimSpace(c.NamesBeforeKey) + " " + strings.TrimSpace(c.KeyNames))
+	case c.PersonNameInverted != "":
+		return strings.TrimSpace(c.PersonNameInverted)
+	default:
+		return strings.TrimSpace(c.CorporateName)
+	}
+}
+
+// description prefers the main description over the short one
+func (p onixProduct) description() string {
+	for _, textType := range []string{onixDescription, onixShortDesc} {
+		for _, content := range p.Texts {
+			if content.Type == textType {
+				return content.Text.plain()
+			}
+		}
+	}
+	return ""
+}
+
+var (
+	markup = regexp.MustCompile(`<[^>]*>`)
+	cdata  = strings.NewReplacer("<![CDATA[", "", "]]>", "")
+)
+
+// plain returns the text without markup; HTML and XHTML texts have their whitespace collapsed
+func (t onixText) plain() string {
+	text := cdata.Replace(t.Inner)
+	if t.Format != onixXHTML && t.Format != onixHTML {
+		return strings.TrimSpace(html.UnescapeString(text))
+	}
+	text = html.UnescapeString(markup.ReplaceAllString(text, " "))
+	if t.Format == onixHTML {
+		// HTML is usually escaped inside the XML, so its tags only appear once unescaped
+		text = markup.ReplaceAllString(text, " ")
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// year reads the year of the publication date, whatever the date format
+func (p onixProduct) year() int {
+	var date string
+	for _, candidate := range p.Dates {
+		if candidate.Role == onixPublished || date == "" {
+			date = strings.TrimSpace(candidate.Date.Value)
+		}
+		if candidate.Role == onixPublished {
+			break
+		}
+	}
+	if len(date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+// date reads the full publication date as YYYY-MM-DD, when it is given to the day
+func (p onixProduct) date() string {
+	for _, candidate := range p.Dates {
+		if candidate.Role != onixPublished || candidate.Date.Format != "" && candidate.Date.Format != onixYYYYMMDD {
+			continue
+		}
+		if date, err := time.Parse("20060102", strings.TrimSpace(candidate.Date.Value)); err == nil {
+			return date.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// format maps the product form to a format: hardbacks, paperbacks, and digital and audio products
+func (p onixProduct) format() string {
+	form := strings.TrimSpace(p.ProductForm)
+	switch {
+	case form == "BB":
+		return models.FormatHardcover
+	case form == "BC":
+		return models.FormatPaperback
+	case strings.HasPrefix(form, "E"):
+		return models.FormatEbook
+	case strings.HasPrefix(form, "A"):
+		return models.FormatAudiobook
+	}
+	return ""
+}
+
+// language reads the language of the text as a language tag
+func (p onixProduct) language() string {
+	for _, candidate := range p.Languages {
+		if candidate.Role != onixTextLanguage {
+			continue
+		}
+		code := strings.ToLower(strings.TrimSpace(candidate.Code))
+		if terminology, ok := onixBibliographic[code]; ok {
+			code = terminology
+		}
+		if base, err := language.ParseBase(code); err == nil {
+			return base.String()
+		}
+	}
+	return ""
+}
+
+// extents reads the page count, preferring the main content, and the file size in bytes
+func (p onixProduct) extents() (pages int, size int64) {
+	for _, extent := range p.Extents {
+		value, err := strconv.ParseFloat(strings.TrimSpace(extent.Value), 64)
+		if err != nil || value < 0 {
+			continue
+		}
+		switch {
+		case (extent.Type == onixPages || extent.Type == onixContentPages && pages == 0) && extent.Unit == onixPageUnit:
+			pages = int(value)
+		case extent.Type == onixFileSize && extent.Unit == onixBytes:
+			size = int64(value)
+		case extent.Type == onixFileSize && extent.Unit == onixKbytes:
+			size = int64(math.Round(value * (1 << 10)))
+		case extent.Type == onixFileSize && extent.Unit == onixMbytes:
+			size = int64(math.Round(value * (1 << 20)))
+		}
+	}
+	return pages, size
+}
+
+// ageRating reads the youngest interest age the book is meant for
+func (p onixProduct) ageRating() int {
+	for _, audience := range p.AudienceRanges {
+		if audience.Qualifier != onixInterestAge || audience.Precision != onixFrom && audience.Precision != onixExact {
+			continue
+		}
+		if age, err := strconv.Atoi(strings.TrimSpace(audience.Value)); err == nil {
+			return age
+		}
+	}
+	return 0
+}
+
+// publisher prefers the publisher in the publisher role over others
+func (p onixProduct) publisher() string {
+	var fallback string
+	for _, publisher := range p.Publishers {
+		name := strings.TrimSpace(publisher.Name)
+		if publisher.Role == onixPublisherRole && name != "" {
+			return name
+		}
+		if fallback == "" {
+			fallback = name
+		}
+	}
+	return fallback
+}
+
+func (p onixProduct) imprint() string {
+	for _, imprint := range p.Imprints {
+		if name := strings.TrimSpace(imprint.Name); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func writeONIX(w io.Writer, books []models.BookInput) error {
+	message := onixMessage{
+		Release: "3.0",
+		Header: onixHeader{
+			SenderName:   "Bookstore",
+			SentDateTime: time.Now().UTC().Format("20060102T1504Z"),
+		},
+		Products: make([]onixProduct, len(books)),
+	}
+	for i, book := range books {
+		message.Products[i] = productOf(book)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(message); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// productOf describes a book as a product on sale, priced in the store's currency; books without
+// a format have an undefined product form
+func productOf(book models.BookInput) onixProduct {
+	form, ok := onixForms[book.Format]
+	if !ok {
+		form = onixUndefined
+	}
+	product := onixProduct{
+		RecordReference:    "bookstore:" + book.ISBN,
+		NotificationType:   "03",
+		Identifiers:        []onixIdentifier{{Type: onixISBN13, Value: book.ISBN}},
+		ProductComposition: "00",
+		ProductForm:        form,
+		Titles: []onixTitleDetail{{
+			Type:     onixTitle,
+			Elements: []onixTitleElement{{Level: onixProductLevel, Text: book.Title}},
+		}},
+		Supplier:     &onixSupplier{Role: "00", Name: "Bookstore"},
+		Availability: "20",
+		Prices:       []onixPrice{{Type: "02", Amount: strconv.FormatFloat(book.Price, 'f', 2, 64)}},
+	}
+	book.NormalizeContributors()
+	for i, contributor := range book.Contributors {
+		product.Contributors = append(product.Contributors, onixContributor{Sequence: i + 1, Roles: []string{onixRoles[contributor.Role]}, PersonName: contributor.Name})
+	}
+	if book.Description != "" {
+		var escaped strings.Builder
+		xml.EscapeText(&escaped, []byte(book.Description))
+		product.Texts = []onixTextContent{{Type: onixDescription, Audience: "00", Text: onixText{Inner: escaped.String()}}}
+	}
+	if book.Language != "" {
+		if tag, err := language.Parse(book.Language); err == nil {
+			base, _ := tag.Base()
+			code := base.ISO3()
+			for bibliographic, terminology := range onixBibliographic {
+				if terminology == code {
+					code = bibliographic
+				}
+			}
+			product.Languages = []onixLanguage{{Role: onixTextLanguage, Code: code}}
+		}
+	}
+	if book.PageCount != 0 {
+		product.Extents = append(product.Extents, onixExtent{Type: onixPages, Value: strconv.Itoa(book.PageCount), Unit: onixPageUnit})
+	}
+	if book.FileSize != 0 {
+		product.Extents = append(product.Extents, onixExtent{Type: onixFileSize, Value: strconv.FormatInt(book.FileSize, 10), Unit: onixBytes})
+	}
+	if book.AgeRating != 0 {
+		product.AudienceRanges = []onixAudience{{Qualifier: onixInterestAge, Precision: onixFrom, Value: strconv.Itoa(book.AgeRating)}}
+	}
+	if book.Imprint != "" {
+		product.Imprints = []onixImprint{{Name: book.Imprint}}
+	}
+	if book.Publisher != "" {
+		product.Publishers = []onixPublisher{{Role: onixPublisherRole, Name: book.Publisher}}
+	}
+	if date, err := time.Parse("2006-01-02", book.PublicationDate); err == nil {
+		product.Dates = []onixDate{{Role: onixPublished, Date: onixDateValue{Format: onixYYYYMMDD, Value: date.Format("20060102")}}}
+	} else if book.PublishedYear != 0 {
+		product.Dates = []onixDate{{Role: onixPublished, Date: onixDateValue{Format: onixYYYY, Value: strconv.Itoa(book.PublishedYear)}}}
+	}
+	return product
+}
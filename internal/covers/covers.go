@@ -0,0 +1,156 @@
+/*
+   covers turns an uploaded cover image into the thumbnails served by the API: every size in Sizes,
+   encoded as both JPEG and WebP. Sources may be JPEG, PNG or WebP and are never upscaled.
+*/
+
+package covers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder
+	"io"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder
+)
+
+// Size is a named thumbnail width; heights keep the aspect ratio of the source
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Sizes are the thumbnails generated for every cover, smallest first
+var Sizes = []Size{
+	{Name: "small", Width: 160},
+	{Name: "medium", Width: 320},
+	{Name: "large", Width: 640},
+}
+
+// Image formats of the generated thumbnails, as file extensions
+const (
+	FormatJPEG = "jpg"
+	FormatWebP = "webp"
+)
+
+// Formats lists the formats every thumbnail is encoded in
+var Formats = []string{FormatJPEG, FormatWebP}
+
+// ContentTypes maps the thumbnail formats to their media types
+var ContentTypes = map[string]string{
+	FormatJPEG: "image/jpeg",
+	FormatWebP: "image/webp",
+}
+
+// Limits protecting the server from oversized uploads and decompression bombs
+const (
+	MaxUploadSize = 10 << 20
+	MaxPixels     = 40_000_000
+	MinWidth      = 100
+)
+
+var ErrUnsupported = errors.New("the cover must be a JPEG, PNG or WebP image")
+
+// Variant is one generated thumbnail
+type Variant struct {
+	Size   Size
+	Format string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Name is the file name of the variant, e.g. "medium.webp"
+func (v Variant) Name() string {
+	return v.Size.Name + "." + v.Format
+}
+
+// Version identifies the source image; cover URLs change with it, so they can be cached forever
+func Version(source []byte) string {
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Decode reads a cover image after checking its dimensions, so huge images are refused before
+// their pixels are allocated
+func Decode(source []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(source))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if config.Width < MinWidth || config.Height < MinWidth {
+		return nil, fmt.Errorf("the cover must be at least %dx%d pixels", MinWidth, MinWidth)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("the cover must not exceed %d pixels", MaxPixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(source))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	return img, nil
+}
+
+// Generate renders every size of src in every format
+func Generate(src image.Image) ([]Variant, error) {
+	var variants []Variant
+	for _, size := range Sizes {
+		thumbnail := resize(src, size.Width)
+		bounds := thumbnail.Bounds()
+		for _, format := range Formats {
+			var buf bytes.Buffer
+			if err := encode(&buf, thumbnail, format); err != nil {
+				return nil, fmt.Errorf("encoding %s %s: %w", size.Name, format, err)
+			}
+			variants = append(variants, Variant{Size: size, Format: format, Width: bounds.Dx(), Height: bounds.Dy(), Data: buf.Bytes()})
+		}
+	}
+	return variants, nil
+}
+
+// resize scales src down to width, flattening transparency onto white since JPEG has no alpha
+func resize(src image.Image, width int) *image.RGBA {
+	bounds := src.Bounds()
+	if width > bounds.Dx() {
+		width = bounds.Dx()
+	}
+	height := (bounds.Dy()*width + bounds.Dx()/2) / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
+
+func encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 82})
+	case FormatWebP:
+		return webp.Encode(w, img, &webp.Options{Quality: 80})
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// ParseVariant splits a variant name such as "medium.webp" and checks it is generated
+func ParseVariant(name string) (Size, string, bool) {
+	for _, size := range Sizes {
+		for _, format := range Formats {
+			if name == size.Name+"."+format {
+				return size, format, true
+			}
+		}
+	}
+	return Size{}, "", false
+}
@@ -0,0 +1,94 @@
+package covers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/chai2010/webp"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 200})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	img, err := Decode(testPNG(t, 400, 600))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	variants, err := Generate(img)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(variants) != len(Sizes)*len(Formats) {
+		t.Fatalf("expected %d variants, got %d", len(Sizes)*len(Formats), len(variants))
+	}
+
+	want := map[string][2]int{"small": {160, 240}, "medium": {320, 480}, "large": {400, 600}}
+	for _, v := range variants {
+		if got := [2]int{v.Width, v.Height}; got != want[v.Size.Name] {
+			t.Errorf("%s: expected %v, got %v", v.Name(), want[v.Size.Name], got)
+		}
+
+		var decoded image.Image
+		switch v.Format {
+		case FormatJPEG:
+			decoded, _, err = image.Decode(bytes.NewReader(v.Data))
+		case FormatWebP:
+			decoded, err = webp.Decode(bytes.NewReader(v.Data))
+		}
+		if err != nil {
+			t.Fatalf("%s does not decode: %v", v.Name(), err)
+		}
+		if decoded.Bounds().Dx() != v.Width || decoded.Bounds().Dy() != v.Height {
+			t.Errorf("%s: encoded size %v does not match %dx%d", v.Name(), decoded.Bounds(), v.Width, v.Height)
+		}
+	}
+}
+
+func TestDecodeRejectsBadImages(t *testing.T) {
+	cases := map[string][]byte{
+		"not an image": []byte("GIF89a? no, plain text"),
+		"too small":    testPNG(t, 50, 80),
+	}
+	for name, source := range cases {
+		if _, err := Decode(source); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// The header alone announces more pixels than allowed; the pixels are never decoded
+	var huge bytes.Buffer
+	png.Encode(&huge, image.NewGray(image.Rect(0, 0, 1, 1)))
+	header := huge.Bytes()
+	// IHDR width and height live at bytes 16-23
+	copy(header[16:24], []byte{0, 0, 0x27, 0x10, 0, 0, 0x27, 0x10}) // 10000x10000
+	if _, err := Decode(header); err == nil {
+		t.Error("expected an image above MaxPixels to be refused")
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	if size, format, ok := ParseVariant("medium.webp"); !ok || size.Width != 320 || format != FormatWebP {
+		t.Fatalf("unexpected parse of medium.webp: %v %q %v", size, format, ok)
+	}
+	for _, name := range []string{"huge.jpg", "small.png", "small", "../small.jpg"} {
+		if _, _, ok := ParseVariant(name); ok {
+			t.Errorf("expected %q to be refused", name)
+		}
+	}
+}
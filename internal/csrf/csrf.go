@@ -0,0 +1,82 @@
+/*
+   csrf protects cookie-authenticated, state-changing requests with synchronizer tokens.
+   A random token is kept in the user's session and handed to the SPA by the token endpoint;
+   every unsafe request must echo it back in the X-CSRF-Token header. Logging in or out replaces
+   the token, so one learned before the session changed hands stops working.
+*/
+
+package csrf
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/session_manager"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// HeaderName is the request header carrying the token
+const HeaderName = "X-CSRF-Token"
+
+const sessionKey = "csrf_token"
+
+// Token returns the token stored in the request's session, creating and saving one if needed
+func Token(c *gin.Context) (string, error) {
+	session, _ := session_manager.Store.Get(c.Request, "session-name")
+	if token, ok := session.Values[sessionKey].(string); ok && token != "" {
+		return token, nil
+	}
+
+	token, err := Rotate(session)
+	if err != nil {
+		return "", err
+	}
+	if err := session.Save(c.Request, c.Writer); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Rotate puts a new token in the session, which the caller saves, and returns it
+func Rotate(session *sessions.Session) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	session.Values[sessionKey] = token
+	return token, nil
+}
+
+// Middleware enforces the token on every request whose method can change state
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			c.Next()
+		default:
+			verify(c)
+		}
+	}
+}
+
+// Protect enforces the token regardless of the method, for legacy GET routes that change state
+func Protect() gin.HandlerFunc {
+	return verify
+}
+
+func verify(c *gin.Context) {
+	session, _ := session_manager.Store.Get(c.Request, "session-name")
+	expected, _ := session.Values[sessionKey].(string)
+	provided := c.GetHeader(HeaderName)
+
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(provided)) != 1 {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeCSRF, "Missing or invalid CSRF token"))
+		return
+	}
+	c.Next()
+}
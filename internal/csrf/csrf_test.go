@@ -0,0 +1,107 @@
+package csrf
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/session_manager"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	session_manager.Store = sessions.NewCookieStore([]byte("csrf-test-secret"))
+	os.Exit(m.Run())
+}
+
+func newRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(apierror.Middleware(), Middleware())
+	router.GET("/token", func(c *gin.Context) {
+		token, err := Token(c)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"csrf_token": token})
+	})
+	router.GET("/read", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/legacy-write", Protect(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/write", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func request(router *gin.Engine, method, path, token string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set(HeaderName, token)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTokenIsStableWithinASession(t *testing.T) {
+	router := newRouter()
+
+	rec := request(router, http.MethodGet, "/token", "", nil)
+	var first map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &first)
+	cookies := rec.Result().Cookies()
+	if first["csrf_token"] == "" || len(cookies) == 0 {
+		t.Fatalf("expected a token and a session cookie, got %v", rec.Body)
+	}
+
+	var second map[string]string
+	json.Unmarshal(request(router, http.MethodGet, "/token", "", cookies).Body.Bytes(), &second)
+	if second["csrf_token"] != first["csrf_token"] {
+		t.Fatalf("expected the same token for the same session, got %q and %q", first["csrf_token"], second["csrf_token"])
+	}
+
+	// A different session gets a different token
+	var other map[string]string
+	json.Unmarshal(request(router, http.MethodGet, "/token", "", nil).Body.Bytes(), &other)
+	if other["csrf_token"] == first["csrf_token"] {
+		t.Fatal("expected a fresh token for a new session")
+	}
+}
+
+func TestMiddlewareEnforcesToken(t *testing.T) {
+	router := newRouter()
+	rec := request(router, http.MethodGet, "/token", "", nil)
+	var body map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	cookies := rec.Result().Cookies()
+	token := body["csrf_token"]
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		token   string
+		cookies []*http.Cookie
+		want    int
+	}{
+		{"safe method", http.MethodGet, "/read", "", nil, http.StatusOK},
+		{"no session", http.MethodPost, "/write", token, nil, http.StatusForbidden},
+		{"no token", http.MethodPost, "/write", "", cookies, http.StatusForbidden},
+		{"wrong token", http.MethodPost, "/write", token + "x", cookies, http.StatusForbidden},
+		{"valid token", http.MethodPost, "/write", token, cookies, http.StatusOK},
+		{"protected GET without token", http.MethodGet, "/legacy-write", "", cookies, http.StatusForbidden},
+		{"protected GET with token", http.MethodGet, "/legacy-write", token, cookies, http.StatusOK},
+	}
+	for _, tc := range cases {
+		rec := request(router, tc.method, tc.path, tc.token, tc.cookies)
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, rec.Code, rec.Body)
+		}
+	}
+}
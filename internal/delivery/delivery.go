@@ -0,0 +1,146 @@
+/*
+   delivery issues and checks the short-lived download URLs of purchased books. A URL is signed with
+   HMAC-SHA256 over the user ID, the ISBN, the expiry time and a random nonce, so it cannot be
+   altered, reused for another book or kept working after it expires, and no two URLs are alike;
+   downloads are counted once per URL. The download proxy streams the file from its
+   upstream location once the signature, ownership and download limit have been checked.
+*/
+
+package delivery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid download signature")
+	ErrExpired          = errors.New("download link expired")
+)
+
+// Config holds the signing secret, the lifetime of download URLs and the per-user download limit
+type Config struct {
+	Secret string
+	TTL    time.Duration
+	// Limit is the number of downloads a user may make of one book within LimitWindow; 0 disables it
+	Limit       int
+	LimitWindow time.Duration
+}
+
+// ConfigFromEnv reads DOWNLOAD_URL_SECRET (defaulting to SESSION_SECRET_KEY), DOWNLOAD_URL_TTL,
+// DOWNLOAD_LIMIT and DOWNLOAD_LIMIT_WINDOW. Defaults: 5m, 5 downloads per 24h.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Secret:      os.Getenv("DOWNLOAD_URL_SECRET"),
+		TTL:         5 * time.Minute,
+		Limit:       5,
+		LimitWindow: 24 * time.Hour,
+	}
+	if cfg.Secret == "" {
+		cfg.Secret = os.Getenv("SESSION_SECRET_KEY")
+	}
+
+	var err error
+	if value := os.Getenv("DOWNLOAD_URL_TTL"); value != "" {
+		if cfg.TTL, err = time.ParseDuration(value); err != nil || cfg.TTL <= 0 {
+			return Config{}, fmt.Errorf("DOWNLOAD_URL_TTL must be a positive duration such as 5m")
+		}
+	}
+	if value := os.Getenv("DOWNLOAD_LIMIT"); value != "" {
+		if cfg.Limit, err = strconv.Atoi(value); err != nil || cfg.Limit < 0 {
+			return Config{}, fmt.Errorf("DOWNLOAD_LIMIT must be a number of downloads, 0 for no limit")
+		}
+	}
+	if value := os.Getenv("DOWNLOAD_LIMIT_WINDOW"); value != "" {
+		if cfg.LimitWindow, err = time.ParseDuration(value); err != nil || cfg.LimitWindow <= 0 {
+			return Config{}, fmt.Errorf("DOWNLOAD_LIMIT_WINDOW must be a positive duration such as 24h")
+		}
+	}
+	return cfg, nil
+}
+
+// Settings holds the active configuration; Setup replaces it once the configuration is loaded
+var Settings = Config{TTL: 5 * time.Minute, Limit: 5, LimitWindow: 24 * time.Hour}
+
+// Setup validates cfg and makes it the active configuration
+func Setup(cfg Config) error {
+	if cfg.Secret == "" {
+		return errors.New("DOWNLOAD_URL_SECRET or SESSION_SECRET_KEY must be set")
+	}
+	Settings = cfg
+	return nil
+}
+
+// HTTPClient fetches book files from their upstream download links
+var HTTPClient = &http.Client{Timeout: 5 * time.Minute}
+
+func signature(secret string, userID uint, isbn string, expires int64, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%d\n%s", userID, isbn, expires, nonce)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURL returns the download proxy URL of isbn for userID, relative to baseURL, and its expiry
+func SignedURL(baseURL string, userID uint, isbn string, now time.Time) (string, time.Time) {
+	expiresAt := now.Add(Settings.TTL).Truncate(time.Second)
+	expires := expiresAt.Unix()
+	random := make([]byte, 9)
+	rand.Read(random)
+	nonce := base64.RawURLEncoding.EncodeToString(random)
+
+	query := url.Values{}
+	query.Set("user", strconv.FormatUint(uint64(userID), 10))
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("nonce", nonce)
+	query.Set("signature", signature(Settings.Secret, userID, isbn, expires, nonce))
+	return baseURL + "/api/v1/downloads/" + url.PathEscape(isbn) + "?" + query.Encode(), expiresAt
+}
+
+// Verify checks the user, expires, nonce and signature query values of a download URL for isbn
+// and returns the user the URL was issued to
+func Verify(isbn string, query url.Values, now time.Time) (uint, error) {
+	userID, err := strconv.ParseUint(query.Get("user"), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+
+	expected := signature(Settings.Secret, uint(userID), isbn, expires, query.Get("nonce"))
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return 0, ErrInvalidSignature
+	}
+	if now.Unix() > expires {
+		return 0, ErrExpired
+	}
+	return uint(userID), nil
+}
+
+// Fetch opens the upstream file at link; the caller closes the body
+func Fetch(ctx context.Context, link string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("upstream answered %s", resp.Status)
+	}
+	return resp, nil
+}
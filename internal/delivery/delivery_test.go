@@ -0,0 +1,93 @@
+package delivery
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parse(t *testing.T, signed string) (string, url.Values) {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", signed, err)
+	}
+	return strings.TrimPrefix(u.Path, "/api/v1/downloads/"), u.Query()
+}
+
+func TestSignedURL(t *testing.T) {
+	Settings = Config{Secret: "test-secret", TTL: 5 * time.Minute}
+	now := time.Now()
+
+	signed, expiresAt := SignedURL("https://api.example.com", 7, "9780134190440", now)
+	if !strings.HasPrefix(signed, "https://api.example.com/api/v1/downloads/9780134190440?") {
+		t.Fatalf("unexpected URL %q", signed)
+	}
+	if expiresAt.Before(now.Add(4*time.Minute)) || expiresAt.After(now.Add(5*time.Minute)) {
+		t.Fatalf("unexpected expiry %v", expiresAt)
+	}
+
+	isbn, query := parse(t, signed)
+	if userID, err := Verify(isbn, query, now); err != nil || userID != 7 {
+		t.Fatalf("expected the URL to verify for user 7, got %d (%v)", userID, err)
+	}
+
+	if _, err := Verify(isbn, query, now.Add(6*time.Minute)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired after the TTL, got %v", err)
+	}
+	if _, err := Verify("9780262033848", query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected the URL to be refused for another book, got %v", err)
+	}
+
+	tampered := url.Values{}
+	for key, values := range query {
+		tampered[key] = values
+	}
+	tampered.Set("user", "8")
+	if _, err := Verify(isbn, tampered, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected the URL to be refused for another user, got %v", err)
+	}
+	tampered = url.Values{"user": {"7"}, "expires": {query.Get("expires") + "0"}, "nonce": query["nonce"], "signature": query["signature"]}
+	if _, err := Verify(isbn, tampered, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected an extended expiry to be refused, got %v", err)
+	}
+	tampered = url.Values{"user": {"7"}, "expires": query["expires"], "nonce": {"other"}, "signature": query["signature"]}
+	if _, err := Verify(isbn, tampered, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected another nonce to be refused, got %v", err)
+	}
+
+	// URLs issued in the same second still differ, since downloads are counted per URL
+	if again, _ := SignedURL("https://api.example.com", 7, "9780134190440", now); again == signed {
+		t.Fatal("expected every URL to have its own nonce")
+	}
+
+	Settings.Secret = "rotated-secret"
+	if _, err := Verify(isbn, query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected URLs signed with an old secret to be refused, got %v", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("SESSION_SECRET_KEY", "session-secret")
+	t.Setenv("DOWNLOAD_URL_SECRET", "")
+	t.Setenv("DOWNLOAD_URL_TTL", "")
+	t.Setenv("DOWNLOAD_LIMIT", "")
+	t.Setenv("DOWNLOAD_LIMIT_WINDOW", "")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil || cfg.Secret != "session-secret" || cfg.TTL != 5*time.Minute || cfg.Limit != 5 || cfg.LimitWindow != 24*time.Hour {
+		t.Fatalf("unexpected defaults %+v (%v)", cfg, err)
+	}
+
+	t.Setenv("DOWNLOAD_LIMIT", "-1")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected a negative limit to be rejected")
+	}
+	t.Setenv("DOWNLOAD_LIMIT", "0")
+	t.Setenv("DOWNLOAD_URL_TTL", "soon")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected an invalid TTL to be rejected")
+	}
+}
@@ -7,18 +7,32 @@
 package handlers
 
 import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/logging"
 	"bookstore/internal/middlewares"
 	"bookstore/internal/models"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func InitializeAdminRoutes(router *gin.Engine) {
-	router.POST("/api/books/create-book", middlewares.AdminOnly(), CreateBook)
-	router.PUT("/api/books/:isbn", middlewares.AdminOnly(), UpdateBook)
-	router.DELETE("/api/books/:isbn", middlewares.AdminOnly(), DeleteBook)
+	router.POST("/api/books/create-book", middlewares.Deprecated("/api/v1/books"), middlewares.AdminOnly(), CreateBook)
+	router.PUT("/api/books/:isbn", middlewares.Deprecated("/api/v1/books/:isbn"), middlewares.AdminOnly(), UpdateBook)
+	router.DELETE("/api/books/:isbn", middlewares.Deprecated("/api/v1/books/:isbn"), middlewares.AdminOnly(), DeleteBook)
+
+	v1 := router.Group("/api/v1", middlewares.AdminOnly())
+	v1.POST("/books", CreateBook)
+	v1.PUT("/books/:isbn", UpdateBook)
+	v1.DELETE("/books/:isbn", DeleteBook)
 }
 
 func CreateBook(c *gin.Context) {
@@ -27,10 +41,45 @@ func CreateBook(c *gin.Context) {
 		return
 	}
 
+	db := models.DBWithContext(c.Request.Context())
+	log := logging.FromContext(c)
+
+	enrich, err := strconv.ParseBool(c.DefaultQuery("enrich", "false"))
+	if err != nil {
+		apierror.Abort(c, apierror.BadRequest("enrich must be true or false"))
+		return
+	}
+
 	var bookInput models.BookInput
-	if err := c.ShouldBindJSON(&bookInput); err != nil {
-		logrus.WithError(err).Warn("Failed to bind JSON")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if enrich {
+		// Fields left out are filled in from the metadata provider before the input is validated
+		err = json.NewDecoder(c.Request.Body).Decode(&bookInput)
+		if err == nil {
+			if !enrichBookInput(c, &bookInput) {
+				return
+			}
+			err = binding.Validator.ValidateStruct(&bookInput)
+		}
+	} else {
+		err = c.ShouldBindJSON(&bookInput)
+	}
+	if err != nil {
+		log.WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+	bookInput.NormalizeISBN()
+	bookInput.NormalizeContributors()
+	bookInput.NormalizeTaxonomy()
+	bookInput.NormalizeDetails()
+
+	log = log.WithField("isbn", bookInput.ISBN)
+
+	if !checkISBNFree(c, db, bookInput.ISBN) {
+		return
+	}
+	categories, ok := findBookCategories(c, db, bookInput.Categories)
+	if !ok {
 		return
 	}
 
@@ -43,28 +92,37 @@ func CreateBook(c *gin.Context) {
 		PublishedYear: bookInput.PublishedYear,
 		Price:         bookInput.Price,
 	}
+	book.SetDetails(bookInput)
 
-	err := models.DB.Create(&book).Error
-	if err != nil {
-		logrus.WithError(err).Error("Failed to create book")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
-		return
-	}
-
-	// Create the download link record
-	downloadLink := models.BookDownload{
-		ISBN:         bookInput.ISBN,
-		DownloadLink: bookInput.DownloadLink,
-	}
+	// The book, its publisher, contributors, taxonomy and download link are written together or not at all
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := models.AssignPublisher(tx, &book, bookInput.Publisher, bookInput.Imprint); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(&book).Error; err != nil {
+			return err
+		}
+		if err := models.SetBookContributors(tx, &book, bookInput.Contributors); err != nil {
+			return err
+		}
+		if err := models.SetBookTaxonomy(tx, &book, categories, bookInput.Tags); err != nil {
+			return err
+		}
 
-	err = models.DB.Create(&downloadLink).Error
+		// Create the download link record; books without one are served from uploaded files
+		if bookInput.DownloadLink == "" {
+			return nil
+		}
+		return tx.Create(&models.BookDownload{BookID: book.ID, ISBN: book.ISBN, DownloadLink: bookInput.DownloadLink}).Error
+	})
 	if err != nil {
-		logrus.WithError(err).Error("Failed to add download link to BookDownload table")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
+		apierror.Abort(c, apierror.Internal("Failed to create book", err))
 		return
 	}
 
-	logrus.Info("Book created successfully")
+	audit.Record(c, audit.Event{Action: audit.ActionBookCreate, TargetType: audit.TargetBook, TargetID: book.ISBN, After: bookInput})
+
+	log.WithField("book_id", book.ID).Info("Book created successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "Book created successfully", "data": book})
 }
 
@@ -73,25 +131,47 @@ func UpdateBook(c *gin.Context) {
 		return
 	}
 
-	isbn := c.Param("isbn")
+	db := models.DBWithContext(c.Request.Context())
 
-	var book models.Book
+	isbn := c.Param("isbn")
+	log := logging.FromContext(c).WithField("isbn", isbn)
 
-	// First, let's retrieve the existing book by ISBN
-	if err := models.DB.Where("isbn = ?", isbn).First(&book).Error; err != nil {
-		logrus.WithError(err).Warn("Book not found")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	// First, let's retrieve the existing book by ISBN, in either form
+	book, err := models.GetBookByISBN(db, isbn)
+	if err != nil {
+		log.WithError(err).Warn("Book not found")
+		apierror.Abort(c, apierror.NotFound("Book not found"))
 		return
 	}
+	isbn = book.ISBN
 
 	// Bind the JSON data to the book variable
 	var bookInput models.BookInput
 	if err := c.ShouldBindJSON(&bookInput); err != nil {
-		logrus.WithError(err).Warn("Failed to bind JSON")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		log.WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+	bookInput.NormalizeISBN()
+	bookInput.NormalizeContributors()
+	bookInput.NormalizeTaxonomy()
+	bookInput.NormalizeDetails()
+	if bookInput.ISBN != book.ISBN && !checkISBNFree(c, db, bookInput.ISBN) {
+		return
+	}
+	categories, ok := findBookCategories(c, db, bookInput.Categories)
+	if !ok {
 		return
 	}
 
+	before := book.Input("")
+	if bookInput.Categories == nil {
+		bookInput.Categories = before.Categories
+	}
+	if bookInput.Tags == nil {
+		bookInput.Tags = before.Tags
+	}
+
 	// Update the book fields
 	book.Title = bookInput.Title
 	book.Author = bookInput.Author
@@ -99,37 +179,52 @@ func UpdateBook(c *gin.Context) {
 	book.ISBN = bookInput.ISBN
 	book.PublishedYear = bookInput.PublishedYear
 	book.Price = bookInput.Price
+	book.SetDetails(bookInput)
 
-	// Save the updated book information
-	if err := models.DB.Save(&book).Error; err != nil {
-		logrus.WithError(err).Error("Failed to update book")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
-		return
-	}
-
-	// Update the download link in the BookDownload table
-	var bookDownload models.BookDownload
-	if err := models.DB.Where("isbn = ?", isbn).First(&bookDownload).Error; err != nil {
-		logrus.WithError(err).Warn("BookDownload entry not found, creating a new one")
-		bookDownload = models.BookDownload{
-			ISBN:         isbn,
-			DownloadLink: bookInput.DownloadLink,
+	// Save the updated book information, its publisher, contributors, taxonomy and download link together
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := models.AssignPublisher(tx, &book, bookInput.Publisher, bookInput.Imprint); err != nil {
+			return err
 		}
-		if err := models.DB.Create(&bookDownload).Error; err != nil {
-			logrus.WithError(err).Error("Failed to create BookDownload entry")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create BookDownload entry"})
-			return
+		if err := tx.Omit(clause.Associations).Save(&book).Error; err != nil {
+			return err
 		}
-	} else {
-		// If the BookDownload entry exists, update the download link
-		if err := models.DB.Model(&models.BookDownload{}).Where("isbn = ?", isbn).Update("download_link", bookInput.DownloadLink).Error; err != nil {
-			logrus.WithError(err).Error("Failed to update download link in BookDownload table")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update download link"})
-			return
+		if book.ISBN != isbn {
+			if err := models.MoveISBNRecords(tx, book.ID, book.ISBN); err != nil {
+				return err
+			}
+		}
+		if err := models.SetBookContributors(tx, &book, bookInput.Contributors); err != nil {
+			return err
+		}
+		if err := models.SetBookTaxonomy(tx, &book, categories, bookInput.Tags); err != nil {
+			return err
 		}
+
+		// Update the download link in the BookDownload table, creating the entry when missing
+		var bookDownload models.BookDownload
+		err := tx.Where("book_id = ?", book.ID).First(&bookDownload).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("BookDownload entry not found, creating a new one")
+			return tx.Create(&models.BookDownload{BookID: book.ID, ISBN: book.ISBN, DownloadLink: bookInput.DownloadLink}).Error
+		}
+		if err != nil {
+			return err
+		}
+		before.DownloadLink = bookDownload.DownloadLink
+		return tx.Model(&models.BookDownload{}).Where("book_id = ?", book.ID).Update("download_link", bookInput.DownloadLink).Error
+	})
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update book", err))
+		return
+	}
+	if book.ISBN != isbn {
+		RenameCovers(c.Request.Context(), []models.ISBNRename{{BookID: book.ID, Old: isbn, New: book.ISBN, CoverVersion: book.CoverVersion}})
 	}
 
-	logrus.Info("Book updated successfully")
+	audit.Record(c, audit.Event{Action: audit.ActionBookUpdate, TargetType: audit.TargetBook, TargetID: isbn, Before: before, After: bookInput})
+
+	log.WithFields(logrus.Fields{"book_id": book.ID, "new_isbn": book.ISBN}).Info("Book updated successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "Book updated successfully", "data": book})
 }
 
@@ -138,21 +233,45 @@ func DeleteBook(c *gin.Context) {
 		return
 	}
 
+	db := models.DBWithContext(c.Request.Context())
+
 	isbn := c.Param("isbn")
+	log := logging.FromContext(c).WithField("isbn", isbn)
 
-	var book models.Book
-	if err := models.DB.Where("isbn = ?", isbn).First(&book).Error; err != nil {
-		logrus.WithError(err).Warn("Book not found")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	book, err := models.GetBookByISBN(db, isbn)
+	if err != nil {
+		log.WithError(err).Warn("Book not found")
+		apierror.Abort(c, apierror.NotFound("Book not found"))
 		return
 	}
+	isbn = book.ISBN
 
-	if err := models.DB.Delete(&book).Error; err != nil {
-		logrus.WithError(err).Error("Failed to delete book")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
+	if err := db.Delete(&book).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete book", err))
 		return
 	}
 
-	logrus.Info("Book deleted successfully")
+	before := book.Input("")
+	if bookDownload, err := models.GetBookDownload(db, book.ID); err == nil {
+		before.DownloadLink = bookDownload.DownloadLink
+	}
+	audit.Record(c, audit.Event{Action: audit.ActionBookDelete, TargetType: audit.TargetBook, TargetID: isbn, Before: before})
+
+	log.WithField("book_id", book.ID).Info("Book deleted successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "Book deleted successfully"})
 }
+
+// checkISBNFree aborts with 409 when a book in the catalog has the ISBN. Books in the trash give
+// theirs up, and cannot be restored while another book has it.
+func checkISBNFree(c *gin.Context, db *gorm.DB, isbn string) bool {
+	_, err := models.GetBookByISBN(db, isbn)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return true
+	case err != nil:
+		apierror.Abort(c, apierror.Internal("Failed to check the ISBN", err))
+	default:
+		apierror.Abort(c, apierror.Conflict("A book with this ISBN already exists"))
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"net/http"
+	"testing"
+)
+
+func TestCreateBookRequiresAdmin(t *testing.T) {
+	setupTestDB(t)
+	input := models.BookInput{Title: "T", Author: "A", ISBN: "1111111111", Price: 5, DownloadLink: "https://example.com/t"}
+
+	rec := serve(http.MethodPost, "/api/books/create-book", "/api/books/create-book", input,
+		sessionCookie(t, 2, "user"), middlewares.AdminOnly(), CreateBook)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+
+	var count int64
+	models.DB.Model(&models.Book{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no books to be created, got %d", count)
+	}
+}
+
+func TestCreateUpdateDeleteBook(t *testing.T) {
+	setupTestDB(t)
+	admin := sessionCookie(t, 1, "admin")
+	input := models.BookInput{Title: "T", Author: "A", ISBN: "1111111111", Price: 5, DownloadLink: "https://example.com/t"}
+
+	rec := serve(http.MethodPost, "/api/books/create-book", "/api/books/create-book", input, admin, middlewares.AdminOnly(), CreateBook)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	input.Title = "Updated"
+	input.DownloadLink = "https://example.com/updated"
+	rec = serve(http.MethodPut, "/api/books/:isbn", "/api/books/1111111111", input, admin, middlewares.AdminOnly(), UpdateBook)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	book, _ := models.GetBookByISBN(models.DB, "1111111111")
+	if book.Title != "Updated" {
+		t.Fatalf("expected updated title, got %q", book.Title)
+	}
+	download, _ := models.GetBookDownload(models.DB, book.ID)
+	if download.DownloadLink != "https://example.com/updated" {
+		t.Fatalf("expected updated download link, got %q", download.DownloadLink)
+	}
+
+	rec = serve(http.MethodDelete, "/api/books/:isbn", "/api/books/1111111111", nil, admin, middlewares.AdminOnly(), DeleteBook)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := models.GetBookByISBN(models.DB, "1111111111"); err == nil {
+		t.Fatal("expected the book to be gone after delete")
+	}
+}
+
+func TestUpdateBookISBNMovesFiles(t *testing.T) {
+	setupTestDB(t)
+	admin := sessionCookie(t, 1, "admin")
+	book := seedBook(t, "9780134190440", 40)
+	if err := models.DB.Create(&models.BookFile{BookID: book.ID, ISBN: "9780134190440", Format: models.FormatPDF, StorageKey: "k", ContentType: "application/pdf", SHA256: "s"}).Error; err != nil {
+		t.Fatalf("seeding book file: %v", err)
+	}
+
+	input := models.BookInput{Title: "T", Author: "A", ISBN: "9781593276034", Price: 40, DownloadLink: "https://example.com/moved"}
+	rec := serve(http.MethodPut, "/api/books/:isbn", "/api/books/9780134190440", input, admin, middlewares.AdminOnly(), UpdateBook)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if download, err := models.GetBookDownload(models.DB, book.ID); err != nil || download.ISBN != "9781593276034" || download.DownloadLink != "https://example.com/moved" {
+		t.Fatalf("expected the download link to follow the new ISBN, got %+v (%v)", download, err)
+	}
+	if file, err := models.GetBookFile(models.DB, book.ID, models.FormatPDF); err != nil || file.ISBN != "9781593276034" {
+		t.Fatalf("expected the file to follow the new ISBN: %v", err)
+	}
+	var left int64
+	models.DB.Model(&models.BookDownload{}).Where("isbn = ?", "9780134190440").Count(&left)
+	if left != 0 {
+		t.Fatalf("expected nothing left under the old ISBN, got %d download links", left)
+	}
+}
+
+func TestCreateUpdateBookRollsBack(t *testing.T) {
+	setupTestDB(t)
+	admin := sessionCookie(t, 1, "admin")
+	seedBook(t, "2222222222", 5)
+
+	// Without a book_downloads table the last write fails, which undoes the ones before it
+	if err := models.DB.Migrator().DropTable(&models.BookDownload{}); err != nil {
+		t.Fatalf("dropping book_downloads: %v", err)
+	}
+	input := models.BookInput{Title: "T", Author: "A", ISBN: "1111111111", Price: 5, DownloadLink: "https://example.com/t",
+		Contributors: []models.ContributorInput{{Name: "Jane Doe", Role: models.RoleTranslator}}, Tags: []string{"classic"},
+		Publisher: "Penguin Books", Imprint: "Penguin Classics"}
+	rec := serve(http.MethodPost, "/api/books/create-book", "/api/books/create-book", input, admin, middlewares.AdminOnly(), CreateBook)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("create: expected 500, got %d: %s", rec.Code, rec.Body)
+	}
+	for name, table := range map[string]any{"books": &models.Book{}, "authors": &models.Author{}, "tags": &models.Tag{},
+		"publishers": &models.Publisher{}, "imprints": &models.Imprint{}} {
+		want := int64(0)
+		if name == "books" {
+			want = 1 // the seeded book
+		}
+		var count int64
+		models.DB.Model(table).Count(&count)
+		if count != want {
+			t.Fatalf("expected %d %s after the failed create, got %d", want, name, count)
+		}
+	}
+
+	input.ISBN = "2222222222"
+	input.Contributors = nil
+	rec = serve(http.MethodPut, "/api/books/:isbn", "/api/books/2222222222", input, admin, middlewares.AdminOnly(), UpdateBook)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("update: expected 500, got %d: %s", rec.Code, rec.Body)
+	}
+	book, _ := models.GetBookByISBN(models.DB.Preload("Tags"), "2222222222")
+	if book.Title != "Title 2222222222" || len(book.Tags) != 0 || book.PublisherID != nil {
+		t.Fatalf("expected the failed update to leave the book alone, got %q with tags %v", book.Title, book.Tags)
+	}
+	var publishers int64
+	models.DB.Model(&models.Publisher{}).Count(&publishers)
+	if publishers != 0 {
+		t.Fatalf("expected no publishers after the failed update, got %d", publishers)
+	}
+}
+
+func TestCreateBookInvalidPayload(t *testing.T) {
+	setupTestDB(t)
+	rec := serve(http.MethodPost, "/api/books/create-book", "/api/books/create-book", map[string]any{"title": "T"},
+		sessionCookie(t, 1, "admin"), middlewares.AdminOnly(), CreateBook)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestUpdateDeleteMissingBook(t *testing.T) {
+	setupTestDB(t)
+	admin := sessionCookie(t, 1, "admin")
+	input := models.BookInput{Title: "T", Author: "A", ISBN: "1111111111", Price: 5, DownloadLink: "https://example.com/t"}
+
+	if rec := serve(http.MethodPut, "/api/books/:isbn", "/api/books/404", input, admin, UpdateBook); rec.Code != http.StatusNotFound {
+		t.Fatalf("update: expected 404, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodDelete, "/api/books/:isbn", "/api/books/404", nil, admin, DeleteBook); rec.Code != http.StatusNotFound {
+		t.Fatalf("delete: expected 404, got %d", rec.Code)
+	}
+}
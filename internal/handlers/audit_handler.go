@@ -0,0 +1,152 @@
+/*
+   audit_handler.go contains the admin-only HTTP handler for querying and exporting the audit log.
+   Entries can be filtered by actor, action and date range and exported as JSON or CSV.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func InitializeAuditRoutes(router *gin.Engine) {
+	router.GET("/api/admin/audit-logs", middlewares.Deprecated("/api/v1/admin/audit-logs"), middlewares.AdminOnly(), GetAuditLogs)
+	router.GET("/api/v1/admin/audit-logs", middlewares.AdminOnly(), GetAuditLogs)
+}
+
+// GetAuditLogs lists audit entries, newest first.
+// Query parameters: actor_id, actor (username or attempted email), action, from and to
+// (RFC 3339 or YYYY-MM-DD, "to" is exclusive), limit, offset and format (json or csv).
+// CSV exports ignore limit and offset and return every matching entry.
+func GetAuditLogs(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		apierror.Abort(c, apierror.BadRequest(err.Error()))
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		apierror.Abort(c, apierror.BadRequest("format must be json or csv"))
+		return
+	}
+	if format == "csv" {
+		filter.Limit, filter.Offset = 0, 0
+	}
+
+	entries, err := models.ListAuditLogs(models.DBWithContext(c.Request.Context()), filter)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch audit logs", err))
+		return
+	}
+
+	if format == "csv" {
+		writeAuditCSV(c, entries)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": entries, "limit": filter.Limit, "offset": filter.Offset})
+}
+
+func parseAuditFilter(c *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		ActorName: c.Query("actor"),
+		Action:    c.Query("action"),
+		Limit:     defaultAuditLimit,
+	}
+
+	if value := c.Query("actor_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return filter, errors.New("actor_id must be a number")
+		}
+		actorID := uint(id)
+		filter.ActorID = &actorID
+	}
+
+	var err error
+	if filter.From, err = parseAuditTime(c.Query("from")); err != nil {
+		return filter, errors.New("from must be RFC 3339 or YYYY-MM-DD")
+	}
+	if filter.To, err = parseAuditTime(c.Query("to")); err != nil {
+		return filter, errors.New("to must be RFC 3339 or YYYY-MM-DD")
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			return filter, errors.New("limit must be between 1 and 1000")
+		}
+		filter.Limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, errors.New("offset must be a positive number")
+		}
+		filter.Offset = offset
+	}
+	return filter, nil
+}
+
+// parseAuditTime accepts RFC 3339 timestamps or plain dates (midnight UTC)
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func writeAuditCSV(c *gin.Context, entries []models.AuditLog) {
+	c.Header("Content-Disposition", `attachment; filename="audit-logs.csv"`)
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Content-Type", "text/csv")
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor_id", "actor_name", "action", "target_type", "target_id", "changes", "ip", "request_id"})
+	for _, entry := range entries {
+		actorID := ""
+		if entry.ActorID != nil {
+			actorID = strconv.FormatUint(uint64(*entry.ActorID), 10)
+		}
+		changes := ""
+		if entry.Changes != nil {
+			data, _ := json.Marshal(entry.Changes)
+			changes = string(data)
+		}
+		w.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			actorID,
+			entry.ActorName,
+			entry.Action,
+			entry.TargetType,
+			entry.TargetID,
+			changes,
+			entry.IP,
+			entry.RequestID,
+		})
+	}
+	w.Flush()
+}
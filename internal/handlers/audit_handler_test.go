@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bookstore/internal/audit"
+	"bookstore/internal/models"
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type auditPage struct {
+	Data []models.AuditLog `json:"data"`
+}
+
+func TestAuditLogRecordsAdminMutations(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	input := validBookInput("9780134190440")
+	admin.do(http.MethodPost, "/api/books/create-book", input).expect(t, http.StatusOK)
+	input.Price = 25
+	admin.do(http.MethodPut, "/api/books/"+input.ISBN, input).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/books/"+input.ISBN, nil).expect(t, http.StatusOK)
+
+	var page auditPage
+	admin.do(http.MethodGet, "/api/admin/audit-logs?actor=admin", nil).expect(t, http.StatusOK).decode(t, &page)
+
+	// Newest first: delete, update, create, then the admin's login
+	want := []string{audit.ActionBookDelete, audit.ActionBookUpdate, audit.ActionBookCreate, audit.ActionLogin}
+	if len(page.Data) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), page.Data)
+	}
+	for i, action := range want {
+		entry := page.Data[i]
+		if entry.Action != action {
+			t.Fatalf("entry %d: expected %s, got %s", i, action, entry.Action)
+		}
+		if entry.ActorName != "admin" || entry.ActorID == nil || entry.IP == "" || entry.RequestID == "" {
+			t.Fatalf("entry %d: missing actor or request details %+v", i, entry)
+		}
+	}
+
+	update := page.Data[1]
+	if update.TargetType != audit.TargetBook || update.TargetID != input.ISBN {
+		t.Fatalf("unexpected update target %s/%s", update.TargetType, update.TargetID)
+	}
+	if len(update.Changes) != 1 || update.Changes["price"].Before != float64(40) || update.Changes["price"].After != float64(25) {
+		t.Fatalf("expected only the price change in the update diff, got %v", update.Changes)
+	}
+	if page.Data[0].Changes["download_link"].Before != input.DownloadLink {
+		t.Fatalf("expected the deleted download link in the diff, got %v", page.Data[0].Changes)
+	}
+}
+
+func TestAuditLogRecordsAuthEvents(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	srv.client().do(http.MethodPost, "/api/auth/login", models.Input{Username: "-", Email: "reader@example.com", Password: "wrong"}).
+		expect(t, http.StatusUnauthorized)
+	reader.do(http.MethodGet, "/api/auth/logout", nil).expect(t, http.StatusOK)
+	reader.do(http.MethodDelete, "/api/auth/delete-account", models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}).
+		expect(t, http.StatusOK)
+
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	for _, action := range []string{audit.ActionRegister, audit.ActionLogin, audit.ActionLoginFailed, audit.ActionLogout, audit.ActionAccountDelete} {
+		var page auditPage
+		admin.do(http.MethodGet, "/api/admin/audit-logs?action="+action+"&actor_id=2", nil).expect(t, http.StatusOK).decode(t, &page)
+		if action == audit.ActionLoginFailed {
+			// The failed attempt had no session, so it is only known by the email that was tried
+			admin.do(http.MethodGet, "/api/admin/audit-logs?action="+action+"&actor=reader@example.com", nil).expect(t, http.StatusOK).decode(t, &page)
+			if len(page.Data) != 1 || page.Data[0].Changes["reason"].After != "invalid password" {
+				t.Fatalf("unexpected failed login entries %+v", page.Data)
+			}
+			continue
+		}
+		if len(page.Data) != 1 {
+			t.Fatalf("%s: expected 1 entry for the reader, got %d", action, len(page.Data))
+		}
+		if action == audit.ActionAccountDelete && page.Data[0].Changes["IsDeleted"].After != true {
+			t.Fatalf("expected the deletion diff, got %v", page.Data[0].Changes)
+		}
+	}
+}
+
+func TestAuditLogFiltersAndExport(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+	admin.do(http.MethodPost, "/api/books/create-book", validBookInput("9780134190440")).expect(t, http.StatusOK)
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	var page auditPage
+	admin.do(http.MethodGet, "/api/admin/audit-logs?from="+tomorrow, nil).expect(t, http.StatusOK).decode(t, &page)
+	if len(page.Data) != 0 {
+		t.Fatalf("expected no entries from tomorrow on, got %d", len(page.Data))
+	}
+	admin.do(http.MethodGet, "/api/admin/audit-logs?to="+tomorrow+"&limit=1", nil).expect(t, http.StatusOK).decode(t, &page)
+	if len(page.Data) != 1 || page.Data[0].Action != audit.ActionBookCreate {
+		t.Fatalf("expected the newest entry only, got %+v", page.Data)
+	}
+
+	resp := admin.do(http.MethodGet, "/api/admin/audit-logs?format=csv&action="+audit.ActionBookCreate, nil).expect(t, http.StatusOK)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("expected a CSV export, got %q", resp.Header.Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(resp.Body))).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing CSV: %v", err)
+	}
+	if len(rows) != 2 || rows[1][4] != audit.ActionBookCreate || !strings.Contains(rows[1][7], "9780134190440") {
+		t.Fatalf("unexpected CSV rows %v", rows)
+	}
+
+	admin.do(http.MethodGet, "/api/admin/audit-logs?from=yesterday", nil).expect(t, http.StatusBadRequest)
+	admin.do(http.MethodGet, "/api/admin/audit-logs?limit=0", nil).expect(t, http.StatusBadRequest)
+	admin.do(http.MethodGet, "/api/admin/audit-logs?format=xml", nil).expect(t, http.StatusBadRequest)
+}
+
+func TestAuditLogAdminOnly(t *testing.T) {
+	srv := newTestServer(t)
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodGet, "/api/admin/audit-logs", nil).expect(t, http.StatusForbidden)
+	srv.client().do(http.MethodGet, "/api/admin/audit-logs", nil).expect(t, http.StatusForbidden)
+}
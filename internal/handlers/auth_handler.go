@@ -6,61 +6,75 @@
 package handlers
 
 import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/csrf"
+	"bookstore/internal/logging"
+	"bookstore/internal/metrics"
+	"bookstore/internal/middlewares"
 	"bookstore/internal/models"
 	"bookstore/internal/session_manager"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
-
-	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var validate = apierror.NewValidator()
+
 func InitializeRoutes(router *gin.Engine) {
 
-	router.POST("/api/auth/register", Register)
-	router.POST("/api/auth/login", Login)
-	router.GET("/api/auth/logout", Logout)
-	router.DELETE("/api/auth/delete-account", DeleteAccount)
+	router.POST("/api/auth/register", middlewares.Deprecated("/api/v1/auth/register"), Register)
+	router.POST("/api/auth/login", middlewares.Deprecated("/api/v1/auth/login"), Login)
+	router.GET("/api/auth/logout", middlewares.Deprecated("/api/v1/auth/logout"), csrf.Protect(), Logout)
+	router.DELETE("/api/auth/delete-account", middlewares.Deprecated("/api/v1/me"), DeleteAccount)
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/auth/register", Register)
+	v1.POST("/auth/login", Login)
+	v1.POST("/auth/logout", Logout)
+	v1.GET("/me", GetMe)
+	v1.DELETE("/me", DeleteAccount)
 }
 
 func Register(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
 	var input models.Input
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.Validation(err))
 		return
 	}
 
-	validate := validator.New()
 	if err := validate.Struct(input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.Validation(err))
 		return
 	}
 
 	var existingUser models.User
-	if err := models.DB.Where("email = ?", input.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User with this email already exists"})
+	if err := db.Where("email = ?", input.Email).First(&existingUser).Error; err == nil {
+		apierror.Abort(c, apierror.Conflict("User with this email already exists"))
 		return
 	}
 
-	if err := models.DB.Where("username = ?", input.Username).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User with this username already exists"})
+	if err := db.Where("username = ?", input.Username).First(&existingUser).Error; err == nil {
+		apierror.Abort(c, apierror.Conflict("User with this username already exists"))
 		return
 	}
 
 	var activeDeletedUser models.User
-	if err := models.DB.Where("email = ?", input.Email).First(&activeDeletedUser).Error; err == nil {
+	if err := db.Where("email = ?", input.Email).First(&activeDeletedUser).Error; err == nil {
 		if activeDeletedUser.IsActive == false && activeDeletedUser.IsDeleted == true {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown error! Contact our team at support@support.com"})
+			apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeAccountDeleted, "This account has been deleted. Contact our team at support@support.com"))
 			return
 		}
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		apierror.Abort(c, apierror.Internal("Failed to hash password", err))
 		return
 	}
 
@@ -70,18 +84,30 @@ func Register(c *gin.Context) {
 		Password: string(hashedPassword),
 	}
 
-	models.DB.Create(&user)
+	db.Create(&user)
 
 	initialBalance := models.Balance{
 		UserID: user.ID,
 		Amount: 5000.0,
 	}
-	models.DB.Create(&initialBalance)
-
+	db.Create(&initialBalance)
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRegister,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		After:      gin.H{"username": user.Username, "email": user.Email},
+		ActorID:    &user.ID,
+		ActorName:  user.Username,
+	})
+
+	metrics.Registrations.Inc()
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
 }
 
 func Login(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
 	session, _ := session_manager.Store.Get(c.Request, "session-name")
 
 	// Delete any existing session values
@@ -91,31 +117,47 @@ func Login(c *gin.Context) {
 
 	var input models.Input
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.Validation(err))
 		return
 	}
 
-	validate := validator.New()
 	if err := validate.Struct(input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.Validation(err))
 		return
 	}
 
+	// Every rejected attempt is counted and audited under the email that was tried
+	loginFailed := func(targetID, reason string) {
+		metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+		audit.Record(c, audit.Event{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   targetID,
+			After:      gin.H{"email": input.Email, "reason": reason},
+			ActorName:  input.Email,
+		})
+	}
+
 	var user models.User
-	if err := models.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		loginFailed("", "unknown email")
+		apierror.Abort(c, apierror.Unauthorized("Invalid email or password"))
 		return
 	}
 
+	userID := strconv.FormatUint(uint64(user.ID), 10)
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		loginFailed(userID, "invalid password")
+		apierror.Abort(c, apierror.Unauthorized("Invalid email or password"))
 		return
 	}
 
 	var activeDeletedUser models.User
-	if err := models.DB.Where("email = ?", input.Email).First(&activeDeletedUser).Error; err == nil {
+	if err := db.Where("email = ?", input.Email).First(&activeDeletedUser).Error; err == nil {
 		if activeDeletedUser.IsActive == false && activeDeletedUser.IsDeleted == true {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown error! Contact our team at support@support.com"})
+			loginFailed(userID, "account deleted")
+			apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeAccountDeleted, "This account has been deleted. Contact our team at support@support.com"))
 			return
 		}
 	}
@@ -131,90 +173,148 @@ func Login(c *gin.Context) {
 		session.Values["role"] = "user"
 	}
 
+	// A CSRF token issued before logging in must not carry over to the user's session
+	csrfToken, err := csrf.Rotate(session)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to issue CSRF token", err))
+		return
+	}
+
 	// Save the session and handle errors
 	if err := session.Save(c.Request, c.Writer); err != nil {
-		// Handle the error gracefully
-		fmt.Println("Error saving session:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+		apierror.Abort(c, apierror.Internal("Failed to save session", err))
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Logged in successfully"})
+	audit.Record(c, audit.Event{Action: audit.ActionLogin, TargetType: audit.TargetUser, TargetID: userID, ActorID: &user.ID, ActorName: user.Username})
+
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
+	c.JSON(http.StatusOK, gin.H{"message": "Logged in successfully", "csrf_token": csrfToken})
 }
 
 func Logout(c *gin.Context) {
 	session, err := session_manager.Store.Get(c.Request, "session-name")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session"})
+		apierror.Abort(c, apierror.Internal("Failed to get session", err))
 		return
 	}
 
 	userID := session.Values["user_id"]
 
 	if userID == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No active user"})
+		apierror.Abort(c, apierror.NotFound("No active user"))
 		return
 	}
 
 	// Clear user ID and role from the session
 	delete(session.Values, "user_id")
 	delete(session.Values, "role")
+	csrfToken, err := csrf.Rotate(session)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to issue CSRF token", err))
+		return
+	}
 
 	// Save the session and handle errors
 	if err := session.Save(c.Request, c.Writer); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session during logout"})
+		apierror.Abort(c, apierror.Internal("Failed to save session during logout", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	event := audit.Event{Action: audit.ActionLogout, TargetType: audit.TargetUser, TargetID: fmt.Sprint(userID)}
+	if id, ok := userID.(uint); ok {
+		event.ActorID = &id
+	}
+	audit.Record(c, event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully", "csrf_token": csrfToken})
 }
 
 func DeleteAccount(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+	log := logging.FromContext(c)
+
 	var input models.Input
 	if err := c.ShouldBindJSON(&input); err != nil {
-		logrus.WithError(err).Error("Invalid request payload")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		log.WithError(err).Error("Invalid request payload")
+		apierror.Abort(c, apierror.Validation(err))
 		return
 	}
 
-	validate := validator.New()
 	if err := validate.Struct(input); err != nil {
-		logrus.WithError(err).Error("Validation error")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		log.WithError(err).Error("Validation error")
+		apierror.Abort(c, apierror.Validation(err))
 		return
 	}
 
 	var user models.User
-	result := models.DB.Where("email = ?", input.Email).First(&user)
+	result := db.Where("email = ?", input.Email).First(&user)
 	if result.Error != nil {
-		logrus.WithError(result.Error).Error("User not found")
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		log.WithError(result.Error).Error("User not found")
+		apierror.Abort(c, apierror.NotFound("User not found"))
 		return
 	}
 
+	log = log.WithField("user_id", user.ID)
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		logrus.WithError(err).Error("Invalid password")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		log.WithError(err).Error("Invalid password")
+		apierror.Abort(c, apierror.Unauthorized("Invalid password"))
 		return
 	}
 
 	if user.IsDeleted {
-		logrus.Warn("Account has already been deleted")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Account has already been deleted"})
+		log.Warn("Account has already been deleted")
+		apierror.Abort(c, apierror.New(http.StatusConflict, apierror.CodeAccountDeleted, "Account has already been deleted"))
 		return
 	}
 
+	before := user
+
 	// Update user properties
 	user.IsDeleted = true
 	user.IsActive = false
 
 	// Save the changes
-	result = models.DB.Save(&user)
+	result = db.Save(&user)
 	if result.Error != nil {
-		logrus.WithError(result.Error).Error("Failed to delete account")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error})
+		apierror.Abort(c, apierror.Internal("Failed to delete account", result.Error))
 		return
 	}
 
-	logrus.Info("Account is successfully deleted")
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionAccountDelete,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		Before:     before,
+		After:      user,
+		ActorID:    &user.ID,
+		ActorName:  user.Username,
+	})
+
+	log.Info("Account is successfully deleted")
 	c.JSON(http.StatusOK, gin.H{"message": "Account is successfully deleted"})
 }
+
+// GetMe returns the profile of the logged in user
+func GetMe(c *gin.Context) {
+	session, _ := session_manager.Store.Get(c.Request, "session-name")
+	userID, exists := session.Values["user_id"].(uint)
+	if !exists {
+		apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
+		return
+	}
+
+	var user models.User
+	if err := models.DBWithContext(c.Request.Context()).First(&user, userID).Error; err != nil {
+		apierror.Abort(c, apierror.NotFound("User not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         user.ID,
+		"username":   user.Username,
+		"email":      user.Email,
+		"role":       session.Values["role"],
+		"created_at": user.CreatedAt,
+	})
+}
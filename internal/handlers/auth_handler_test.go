@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bookstore/internal/models"
+	"net/http"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	setupTestDB(t)
+	input := models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}
+
+	rec := serve(http.MethodPost, "/api/auth/register", "/api/auth/register", input, nil, Register)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var user models.User
+	if err := models.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		t.Fatalf("user not stored: %v", err)
+	}
+	balance, err := models.GetBalanceByUserID(models.DB, user.ID)
+	if err != nil || balance.Amount != 5000 {
+		t.Fatalf("expected an initial balance of 5000, got %+v (%v)", balance, err)
+	}
+
+	rec = serve(http.MethodPost, "/api/auth/register", "/api/auth/register", input, nil, Register)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate email, got %d", rec.Code)
+	}
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	setupTestDB(t)
+	input := models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}
+	serve(http.MethodPost, "/api/auth/register", "/api/auth/register", input, nil, Register)
+
+	bad := input
+	bad.Password = "wrong"
+	if rec := serve(http.MethodPost, "/api/auth/login", "/api/auth/login", bad, nil, Login); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", rec.Code)
+	}
+
+	rec := serve(http.MethodPost, "/api/auth/login", "/api/auth/login", input, nil, Login)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	cookie := cookies[len(cookies)-1]
+
+	if rec := serve(http.MethodGet, "/api/auth/logout", "/api/auth/logout", nil, cookie, Logout); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 on logout, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/api/auth/logout", "/api/auth/logout", nil, nil, Logout); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a session, got %d", rec.Code)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	setupTestDB(t)
+	input := models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}
+	serve(http.MethodPost, "/api/auth/register", "/api/auth/register", input, nil, Register)
+
+	rec := serve(http.MethodDelete, "/api/auth/delete-account", "/api/auth/delete-account", input, nil, DeleteAccount)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(http.MethodDelete, "/api/auth/delete-account", "/api/auth/delete-account", input, nil, DeleteAccount)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for an already deleted account, got %d", rec.Code)
+	}
+
+	if rec := serve(http.MethodPost, "/api/auth/login", "/api/auth/login", input, nil, Login); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a deleted account to be refused login, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,221 @@
+/*
+   author_handler.go contains HTTP request handlers for the authors credited on books: the list
+   of authors, an author's page with their books, and the admin-only handlers that create,
+   rename and delete authors. Books create the authors they credit, so the admin handlers are
+   mostly there to write biographies and fix names.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"bookstore/internal/slug"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func InitializeAuthorRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1")
+	v1.GET("/authors", GetAuthors)
+	v1.GET("/authors/:slug", GetAuthor)
+
+	admin := router.Group("/api/v1", middlewares.AdminOnly())
+	admin.POST("/authors", CreateAuthor)
+	admin.PUT("/authors/:slug", UpdateAuthor)
+	admin.DELETE("/authors/:slug", DeleteAuthor)
+}
+
+// authorSummary is an author in the list of authors
+type authorSummary struct {
+	models.Author
+	BookCount int `json:"book_count"`
+}
+
+// authorPage is an author with the books crediting them
+type authorPage struct {
+	models.Author
+	Books []models.Book `json:"books"`
+}
+
+// GetAuthors lists the authors by name, with the number of books crediting them
+func GetAuthors(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	authors, err := models.GetAllAuthors(db)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch authors", err))
+		return
+	}
+	counts, err := models.CountAuthorBooks(db)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch authors", err))
+		return
+	}
+
+	summaries := make([]authorSummary, len(authors))
+	for i, author := range authors {
+		summaries[i] = authorSummary{Author: author, BookCount: counts[author.ID]}
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
+// GetAuthor returns an author's page: their biography and the books crediting them, newest first
+func GetAuthor(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	author, ok := findAuthor(c, db)
+	if !ok {
+		return
+	}
+	books, err := models.GetAuthorBooks(db, author.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch the author's books", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, authorPage{Author: author, Books: withCovers(books)})
+}
+
+func CreateAuthor(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	var input models.AuthorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	author := models.Author{Name: input.Name, Slug: slug.Make(input.Name), Biography: input.Biography}
+	if _, err := models.GetAuthorBySlug(db, author.Slug); err == nil {
+		apierror.Abort(c, apierror.Conflict("An author with this name already exists"))
+		return
+	}
+	if err := db.Create(&author).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to create author", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAuthorCreate, TargetType: audit.TargetAuthor, TargetID: author.Slug, After: input})
+
+	logging.FromContext(c).WithField("author_id", author.ID).Info("Author created successfully")
+	c.JSON(http.StatusCreated, gin.H{"message": "Author created successfully", "data": author})
+}
+
+// UpdateAuthor renames an author or rewrites their biography; a new name gives them a new slug,
+// and the books crediting them a new author field
+func UpdateAuthor(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	author, ok := findAuthor(c, db)
+	if !ok {
+		return
+	}
+	log := logging.FromContext(c).WithField("author_id", author.ID)
+
+	var input models.AuthorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	newSlug := slug.Make(input.Name)
+	if newSlug != author.Slug {
+		if _, err := models.GetAuthorBySlug(db, newSlug); err == nil {
+			apierror.Abort(c, apierror.Conflict("An author with this name already exists"))
+			return
+		}
+	}
+
+	before := models.AuthorInput{Name: author.Name, Biography: author.Biography}
+	oldSlug := author.Slug
+	author.Name = input.Name
+	author.Slug = newSlug
+	author.Biography = input.Biography
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&author).Error; err != nil {
+			return err
+		}
+		if before.Name == author.Name {
+			return nil
+		}
+		return models.RefreshCreditLines(tx, author.ID)
+	})
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update author", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAuthorUpdate, TargetType: audit.TargetAuthor, TargetID: oldSlug, Before: before, After: input})
+
+	log.WithField("slug", author.Slug).Info("Author updated successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Author updated successfully", "data": author})
+}
+
+// DeleteAuthor removes an author no book credits, deleted books included
+func DeleteAuthor(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	author, ok := findAuthor(c, db)
+	if !ok {
+		return
+	}
+
+	credits, err := models.CountAuthorCredits(db, author.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete author", err))
+		return
+	}
+	if credits > 0 {
+		apierror.Abort(c, apierror.Conflict("The author is credited on books"))
+		return
+	}
+	if err := db.Delete(&author).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete author", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionAuthorDelete,
+		TargetType: audit.TargetAuthor,
+		TargetID:   author.Slug,
+		Before:     models.AuthorInput{Name: author.Name, Biography: author.Biography},
+	})
+
+	logging.FromContext(c).WithField("author_id", author.ID).Info("Author deleted successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Author deleted successfully"})
+}
+
+// findAuthor loads the author named by the :slug parameter, aborting with 404 when there is none
+func findAuthor(c *gin.Context, db *gorm.DB) (models.Author, bool) {
+	author, err := models.GetAuthorBySlug(db, c.Param("slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Author not found"))
+		return author, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch author", err))
+		return author, false
+	}
+	return author, true
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/models"
+	"net/http"
+	"testing"
+)
+
+func TestRoutesAuthors(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	gopl := validBookInput("9780134190440")
+	gopl.Author = "Alan Donovan & Brian Kernighan"
+	var created struct {
+		Data models.Book `json:"data"`
+	}
+	admin.do(http.MethodPost, "/api/v1/books", gopl).expect(t, http.StatusOK).decode(t, &created)
+	if created.Data.Author != "Alan Donovan, Brian Kernighan" || len(created.Data.Contributors) != 2 ||
+		created.Data.Contributors[1].Author.Slug != "brian-kernighan" || created.Data.Contributors[1].Role != models.RoleAuthor {
+		t.Fatalf("expected the author string to be split, got %q %+v", created.Data.Author, created.Data.Contributors)
+	}
+
+	// Contributors take precedence over the author string, and the same person is matched by slug
+	translated := validBookInput("9791090636071")
+	translated.Author = ""
+	translated.PublishedYear = 2017
+	translated.Contributors = []models.ContributorInput{
+		{Name: "brian kernighan"},
+		{Name: "Brian  Kernighan", Role: models.RoleEditor},
+		{Name: "Jeanne Dupont", Role: models.RoleTranslator},
+	}
+	admin.do(http.MethodPost, "/api/v1/books", translated).expect(t, http.StatusOK).decode(t, &created)
+	if created.Data.Author != "Brian Kernighan" || len(created.Data.Contributors) != 3 {
+		t.Fatalf("unexpected book %q %+v", created.Data.Author, created.Data.Contributors)
+	}
+
+	var authors []struct {
+		models.Author
+		BookCount int `json:"book_count"`
+	}
+	srv.client().do(http.MethodGet, "/api/v1/authors", nil).expect(t, http.StatusOK).decode(t, &authors)
+	if len(authors) != 3 || authors[0].Slug != "alan-donovan" || authors[1].Slug != "brian-kernighan" || authors[1].BookCount != 2 {
+		t.Fatalf("unexpected authors %+v", authors)
+	}
+
+	var page struct {
+		models.Author
+		Books []models.Book `json:"books"`
+	}
+	srv.client().do(http.MethodGet, "/api/v1/authors/brian-kernighan", nil).expect(t, http.StatusOK).decode(t, &page)
+	if page.Name != "Brian Kernighan" || len(page.Books) != 2 || page.Books[0].ISBN != translated.ISBN {
+		t.Fatalf("expected the author's books, newest first, got %+v", page)
+	}
+	srv.client().do(http.MethodGet, "/api/v1/authors/nobody", nil).expect(t, http.StatusNotFound)
+
+	// Renaming an author moves their page and rewrites the author of their books
+	admin.do(http.MethodPut, "/api/v1/authors/brian-kernighan", models.AuthorInput{Name: "Brian W. Kernighan", Biography: "Co-author of K&R."}).
+		expect(t, http.StatusOK)
+	srv.client().do(http.MethodGet, "/api/v1/authors/brian-w-kernighan", nil).expect(t, http.StatusOK).decode(t, &page)
+	if page.Biography != "Co-author of K&R." {
+		t.Fatalf("expected the biography, got %+v", page.Author)
+	}
+	var book models.Book
+	srv.client().do(http.MethodGet, "/api/v1/books/"+gopl.ISBN, nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Author != "Alan Donovan, Brian W. Kernighan" {
+		t.Fatalf("expected the credit line to follow the rename, got %q", book.Author)
+	}
+	admin.do(http.MethodPut, "/api/v1/authors/brian-w-kernighan", models.AuthorInput{Name: "Alan Donovan"}).expect(t, http.StatusConflict)
+
+	// Updating a book replaces its contributors
+	gopl.Author = "Alan Donovan"
+	admin.do(http.MethodPut, "/api/v1/books/"+gopl.ISBN, gopl).expect(t, http.StatusOK)
+	srv.client().do(http.MethodGet, "/api/v1/authors/brian-w-kernighan", nil).expect(t, http.StatusOK).decode(t, &page)
+	if len(page.Books) != 1 {
+		t.Fatalf("expected one book left, got %+v", page.Books)
+	}
+
+	admin.do(http.MethodPost, "/api/v1/authors", models.AuthorInput{Name: "Rob Pike", Biography: "Gopher."}).expect(t, http.StatusCreated)
+	admin.do(http.MethodPost, "/api/v1/authors", models.AuthorInput{Name: "rob pike"}).expect(t, http.StatusConflict)
+	admin.do(http.MethodDelete, "/api/v1/authors/alan-donovan", nil).expect(t, http.StatusConflict)
+	admin.do(http.MethodDelete, "/api/v1/authors/rob-pike", nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/authors/rob-pike", nil).expect(t, http.StatusNotFound)
+
+	var apiErr apierror.Envelope
+	invalid := validBookInput("9780262510875")
+	invalid.Author = ""
+	invalid.Contributors = []models.ContributorInput{{Name: "?!", Role: "ghostwriter"}}
+	admin.do(http.MethodPost, "/api/v1/books", invalid).expect(t, http.StatusBadRequest).decode(t, &apiErr)
+	if len(apiErr.Error.Fields) != 2 || apiErr.Error.Fields[0].Field != "contributors[0].name" || apiErr.Error.Fields[1].Rule != "oneof" {
+		t.Fatalf("unexpected validation error %+v", apiErr.Error)
+	}
+	invalid.Contributors = nil
+	admin.do(http.MethodPost, "/api/v1/books", invalid).expect(t, http.StatusBadRequest)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/v1/authors", models.AuthorInput{Name: "Someone"}).expect(t, http.StatusForbidden)
+	reader.do(http.MethodPut, "/api/v1/authors/alan-donovan", models.AuthorInput{Name: "Someone"}).expect(t, http.StatusForbidden)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import "bookstore/internal/covers"
+
+// BodyLimits caps request bodies per route, keyed by "METHOD /route"; routes not listed
+// here get the server-wide MAX_BODY_SIZE. Legacy aliases share the limit of their successor.
+var BodyLimits = map[string]int64{
+	"POST /api/v1/auth/register":           4 << 10,
+	"POST /api/auth/register":              4 << 10,
+	"POST /api/v1/auth/login":              4 << 10,
+	"POST /api/auth/login":                 4 << 10,
+	"DELETE /api/v1/me":                    4 << 10,
+	"DELETE /api/auth/delete-account":      4 << 10,
+	"POST /api/v1/books":                   64 << 10,
+	"POST /api/books/create-book":          64 << 10,
+	"PUT /api/v1/books/:isbn":              64 << 10,
+	"PUT /api/books/:isbn":                 64 << 10,
+	"POST /api/v1/authors":                 64 << 10,
+	"PUT /api/v1/authors/:slug":            64 << 10,
+	"POST /api/v1/categories":              4 << 10,
+	"PUT /api/v1/categories/:slug":         4 << 10,
+	"POST /api/v1/tags":                    1 << 10,
+	"PUT /api/v1/tags/:slug":               1 << 10,
+	"POST /api/v1/series":                  64 << 10,
+	"PUT /api/v1/series/:slug":             64 << 10,
+	"PUT /api/v1/series/:slug/books/:isbn": 1 << 10,
+	"POST /api/v1/works":                   4 << 10,
+	"PUT /api/v1/works/:id":                4 << 10,
+	"PUT /api/v1/works/:id/editions/:isbn": 1 << 10,
+	"POST /api/v1/publishers":              4 << 10,
+	"PUT /api/v1/publishers/:slug":         4 << 10,
+	"POST /api/v1/books/:isbn/reviews":     16 << 10,
+	"POST /api/post-review/:isbn":          16 << 10,
+	"POST /api/v1/orders":                  1 << 10,
+	"POST /api/v1/books/:isbn/files":       MaxBookFileSize + 1<<20, // room for the multipart envelope
+	"POST /api/v1/books/:isbn/cover":       covers.MaxUploadSize + 1<<20,
+	"POST /api/v1/admin/watermarks/lookup": MaxBookFileSize + 1<<20,
+	"POST /api/v1/admin/catalog/import":    MaxCatalogSize,
+}
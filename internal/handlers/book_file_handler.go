@@ -0,0 +1,202 @@
+/*
+   book_file_handler.go contains the admin HTTP request handlers for the ebook files of a book.
+   Files are uploaded as multipart forms, checked to be EPUB or PDF, verified against an optional
+   SHA-256 checksum and kept in the blob store; buyers download them through the signed download URLs.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/blobstore"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// MaxBookFileSize caps the size of an uploaded ebook file
+const MaxBookFileSize = 256 << 20
+
+func InitializeBookFileRoutes(router *gin.Engine) {
+	files := router.Group("/api/v1/books/:isbn/files", middlewares.AdminOnly())
+	files.GET("", ListBookFiles)
+	files.POST("", UploadBookFile)
+	files.DELETE("/:format", DeleteBookFile)
+}
+
+// ListBookFiles returns the files uploaded for a book
+func ListBookFiles(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	book, err := models.GetBookByISBN(db, c.Param("isbn"))
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return
+	}
+	files, err := models.GetBookFiles(db, book.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch book files", err))
+		return
+	}
+	c.JSON(http.StatusOK, files)
+}
+
+// UploadBookFile stores the "file" field of a multipart form as the book's EPUB or PDF file.
+// When the "sha256" field is set, the upload is rejected unless the stored file matches it.
+func UploadBookFile(c *gin.Context) {
+	extendDeadlines(c)
+	db := models.DBWithContext(c.Request.Context())
+	isbn := c.Param("isbn")
+	log := logging.FromContext(c).WithField("isbn", isbn)
+
+	book, err := models.GetBookByISBN(db, isbn)
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return
+	}
+
+	upload, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Abort(c, apierror.PayloadTooLarge(tooLarge.Limit))
+			return
+		}
+		apierror.Abort(c, apierror.BadRequest("A multipart form with a file field is required"))
+		return
+	}
+	defer upload.Close()
+
+	expected := strings.ToLower(strings.TrimSpace(c.PostForm("sha256")))
+	if expected != "" && !isHexSHA256(expected) {
+		apierror.Abort(c, apierror.BadRequest("sha256 must be 64 hexadecimal characters"))
+		return
+	}
+
+	head := make([]byte, 64)
+	n, _ := io.ReadFull(upload, head)
+	format, contentType := detectBookFormat(head[:n])
+	if format == "" {
+		apierror.Abort(c, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "Only EPUB and PDF files are accepted"))
+		return
+	}
+	if _, err := upload.Seek(0, io.SeekStart); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to read upload", err))
+		return
+	}
+
+	// Every upload gets a new key, so a replaced file stays downloadable until the new record is saved
+	suffix := make([]byte, 16)
+	rand.Read(suffix)
+	key := path.Join("books", isbn, hex.EncodeToString(suffix)+"."+format)
+	object, err := blobstore.Default.Put(c.Request.Context(), key, upload, header.Size, contentType)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to store file", err))
+		return
+	}
+	if expected != "" && object.SHA256 != expected {
+		blobstore.Default.Delete(c.Request.Context(), object.Key)
+		apierror.Abort(c, apierror.New(http.StatusUnprocessableEntity, apierror.CodeChecksumMismatch, "The uploaded file does not match its sha256 checksum"))
+		return
+	}
+
+	file := models.BookFile{
+		BookID:      book.ID,
+		ISBN:        book.ISBN,
+		Format:      format,
+		StorageKey:  object.Key,
+		Filename:    path.Base(header.Filename),
+		ContentType: contentType,
+		Size:        object.Size,
+		SHA256:      object.SHA256,
+	}
+	replaced, err := models.SaveBookFile(db, &file)
+	if err != nil {
+		blobstore.Default.Delete(c.Request.Context(), object.Key)
+		apierror.Abort(c, apierror.Internal("Failed to save book file", err))
+		return
+	}
+	if replaced != nil && replaced.StorageKey != file.StorageKey {
+		if err := blobstore.Default.Delete(c.Request.Context(), replaced.StorageKey); err != nil {
+			log.WithError(err).Warn("Failed to delete replaced book file")
+		}
+	}
+
+	event := audit.Event{Action: audit.ActionBookFileUpload, TargetType: audit.TargetBook, TargetID: isbn, After: file}
+	if replaced != nil {
+		event.Before = *replaced
+	}
+	audit.Record(c, event)
+
+	log.WithFields(logrus.Fields{"format": format, "size": file.Size, "sha256": file.SHA256}).Info("Book file uploaded")
+	c.JSON(http.StatusCreated, gin.H{"message": "File uploaded successfully", "data": file})
+}
+
+// DeleteBookFile removes the book's file in the given format
+func DeleteBookFile(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+	isbn := c.Param("isbn")
+
+	book, err := models.GetBookByISBN(db, isbn)
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return
+	}
+	file, err := models.GetBookFile(db, book.ID, c.Param("format"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Book file not found"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch book file", err))
+		return
+	}
+
+	if err := models.DeleteBookFile(db, file); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete book file", err))
+		return
+	}
+	if err := blobstore.Default.Delete(c.Request.Context(), file.StorageKey); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to delete book file from the blob store")
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionBookFileDelete, TargetType: audit.TargetBook, TargetID: isbn, Before: file})
+	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
+}
+
+// detectBookFormat recognises PDF and EPUB files by their first bytes
+func detectBookFormat(head []byte) (format, contentType string) {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return models.FormatPDF, "application/pdf"
+	// An EPUB is a ZIP archive whose first, uncompressed entry is "mimetype"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")) && len(head) >= 58 &&
+		string(head[30:38]) == "mimetype" && string(head[38:58]) == "application/epub+zip":
+		return models.FormatEPUB, "application/epub+zip"
+	}
+	return "", ""
+}
+
+func isHexSHA256(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
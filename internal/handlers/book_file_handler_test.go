@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bookstore/internal/apierror"
+	"bookstore/internal/blobstore"
+	"bookstore/internal/delivery"
+	"bookstore/internal/models"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upload posts content as the file field of a multipart form, with an optional sha256 field
+func (c *testClient) upload(isbn, filename string, content []byte, checksum string) testResponse {
+	c.srv.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if checksum != "" {
+		form.WriteField("sha256", checksum)
+	}
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write(content)
+	form.Close()
+	return c.send(http.MethodPost, "/api/v1/books/"+isbn+"/files", &body, http.Header{"Content-Type": {form.FormDataContentType()}})
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// testEPUB builds a minimal EPUB container: a ZIP whose first, stored entry is the mimetype
+func testEPUB(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	mimetype, _ := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	mimetype.Write([]byte("application/epub+zip"))
+	container, _ := archive.Create("META-INF/container.xml")
+	container.Write([]byte(`<?xml version="1.0"?><container version="1.0"/>`))
+	if err := archive.Close(); err != nil {
+		t.Fatalf("building EPUB: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testPDF builds a minimal PDF with a cross-reference table, which downloads can be watermarked through
+func testPDF(title string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [] /Count 0 >>", "<< /Title (" + title + ") >>"}
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestRoutesBookFiles(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	book := seedBook(t, "9780134190440", 40)
+	pdf := testPDF("The Go Programming Language " + strings.Repeat("chapter ", 500))
+
+	var apiErr apierror.Envelope
+	admin.upload(book.ISBN, "gopl.pdf", pdf, strings.Repeat("0", 64)).expect(t, http.StatusUnprocessableEntity).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeChecksumMismatch {
+		t.Fatalf("expected checksum_mismatch, got %+v", apiErr)
+	}
+	admin.upload(book.ISBN, "notes.txt", []byte("plain text"), "").expect(t, http.StatusUnsupportedMediaType)
+	admin.upload("0000000000", "gopl.pdf", pdf, "").expect(t, http.StatusNotFound)
+	admin.send(http.MethodPost, "/api/v1/books/"+book.ISBN+"/files", strings.NewReader("{}"), http.Header{"Content-Type": {"application/json"}}).
+		expect(t, http.StatusBadRequest)
+
+	var uploaded struct {
+		Data models.BookFile `json:"data"`
+	}
+	admin.upload(book.ISBN, "gopl.pdf", pdf, sha256Hex(pdf)).expect(t, http.StatusCreated).decode(t, &uploaded)
+	if uploaded.Data.Format != models.FormatPDF || uploaded.Data.Size != int64(len(pdf)) || uploaded.Data.SHA256 != sha256Hex(pdf) {
+		t.Fatalf("unexpected uploaded file %+v", uploaded.Data)
+	}
+	admin.upload(book.ISBN, "gopl.epub", testEPUB(t), "").expect(t, http.StatusCreated)
+
+	var files []models.BookFile
+	admin.do(http.MethodGet, "/api/v1/books/"+book.ISBN+"/files", nil).expect(t, http.StatusOK).decode(t, &files)
+	if len(files) != 2 || files[0].Format != models.FormatEPUB || files[1].Format != models.FormatPDF {
+		t.Fatalf("expected an EPUB and a PDF, got %+v", files)
+	}
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.upload(book.ISBN, "gopl.pdf", pdf, "").expect(t, http.StatusForbidden)
+	reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: book.ISBN}).expect(t, http.StatusCreated)
+
+	var link struct {
+		Message string   `json:"message"`
+		Formats []string `json:"formats"`
+	}
+	reader.do(http.MethodGet, "/api/v1/me/books/"+book.ISBN+"/download", nil).expect(t, http.StatusOK).decode(t, &link)
+	if strings.Join(link.Formats, ",") != "epub,pdf" {
+		t.Fatalf("expected both formats to be offered, got %v", link.Formats)
+	}
+	signedPath := strings.TrimPrefix(link.Message, srv.server.URL)
+
+	// The buyer gets a watermarked copy, which starts with the uploaded file
+	resp := reader.send(http.MethodGet, signedPath+"&format=pdf", nil, nil).expect(t, http.StatusOK)
+	full := resp.Body
+	if !bytes.HasPrefix(full, pdf) || len(full) == len(pdf) || resp.Header.Get("Content-Type") != "application/pdf" ||
+		resp.Header.Get("ETag") != `"`+sha256Hex(full)+`"` || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("unexpected download %v", resp.Header)
+	}
+
+	// Resuming with a range request returns the rest and is not counted as another download
+	resp = reader.send(http.MethodGet, signedPath+"&format=pdf", nil, http.Header{"Range": {"bytes=100-"}}).expect(t, http.StatusPartialContent)
+	if !bytes.Equal(resp.Body, full[100:]) {
+		t.Fatalf("expected the file from byte 100, got %d bytes", len(resp.Body))
+	}
+	if used, _ := models.CountDownloadsSince(models.DB, 2, book.ID, time.Now().Add(-time.Hour)); used != 1 {
+		t.Fatalf("expected 1 counted download, got %d", used)
+	}
+
+	// The EPUB is served when no format is asked for
+	resp = reader.send(http.MethodGet, signedPath, nil, nil).expect(t, http.StatusOK)
+	if resp.Header.Get("Content-Disposition") != `attachment; filename="9780134190440.epub"` {
+		t.Fatalf("expected the EPUB, got %v", resp.Header)
+	}
+
+	// Replacing the PDF removes the previous blob
+	revised := testPDF("The Go Programming Language, revised")
+	admin.upload(book.ISBN, "gopl-2.pdf", revised, sha256Hex(revised)).expect(t, http.StatusCreated)
+	if _, _, err := blobstore.Default.Open(context.Background(), uploaded.Data.StorageKey); err == nil && uploaded.Data.StorageKey != "" {
+		t.Fatal("expected the replaced blob to be deleted")
+	}
+	stored, _ := models.GetBookFile(models.DB, book.ID, models.FormatPDF)
+	if _, _, err := blobstore.Default.Open(context.Background(), stored.StorageKey); err != nil {
+		t.Fatalf("expected the new blob to be stored: %v", err)
+	}
+
+	admin.do(http.MethodDelete, "/api/v1/books/"+book.ISBN+"/files/pdf", nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/books/"+book.ISBN+"/files/pdf", nil).expect(t, http.StatusNotFound)
+	if _, _, err := blobstore.Default.Open(context.Background(), stored.StorageKey); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected the deleted blob to be gone, got %v", err)
+	}
+	reader.send(http.MethodGet, signedPath+"&format=pdf", nil, nil).expect(t, http.StatusNotFound)
+}
+
+func TestRoutesBookFileRangeRequestsCount(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	book := seedBook(t, "9780134190440", 40)
+	pdf := testPDF("The Go Programming Language")
+	admin.upload(book.ISBN, "gopl.pdf", pdf, "").expect(t, http.StatusCreated)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: book.ISBN}).expect(t, http.StatusCreated)
+
+	// Fetch more links than the limit allows before using any of them
+	var paths []string
+	for i := 0; i <= delivery.Settings.Limit; i++ {
+		var link struct {
+			Message string `json:"message"`
+		}
+		reader.do(http.MethodGet, "/api/v1/me/books/"+book.ISBN+"/download", nil).expect(t, http.StatusOK).decode(t, &link)
+		paths = append(paths, strings.TrimPrefix(link.Message, srv.server.URL))
+	}
+
+	// A range request not starting at byte 0 still counts the first time a link is used
+	for i, signedPath := range paths {
+		resp := reader.send(http.MethodGet, signedPath, nil, http.Header{"Range": {"bytes=1-"}})
+		if i < delivery.Settings.Limit {
+			resp.expect(t, http.StatusPartialContent)
+			// Resuming with the same link is not counted again
+			reader.send(http.MethodGet, signedPath, nil, http.Header{"Range": {"bytes=1-"}}).expect(t, http.StatusPartialContent)
+			continue
+		}
+		var apiErr apierror.Envelope
+		resp.expect(t, http.StatusTooManyRequests).decode(t, &apiErr)
+		if apiErr.Error.Code != apierror.CodeDownloadLimit {
+			t.Fatalf("expected download_limit_reached, got %+v", apiErr)
+		}
+	}
+	if used, _ := models.CountDownloadsSince(models.DB, 2, book.ID, time.Now().Add(-time.Hour)); used != int64(delivery.Settings.Limit) {
+		t.Fatalf("expected %d counted downloads, got %d", delivery.Settings.Limit, used)
+	}
+}
+
+func TestDetectBookFormat(t *testing.T) {
+	cases := map[string]string{
+		"%PDF-1.4\n":                 models.FormatPDF,
+		string(testEPUB(t)):          models.FormatEPUB,
+		"PK\x03\x04 plain zip":       "",
+		"<html><body></body></html>": "",
+	}
+	for head, want := range cases {
+		if got, _ := detectBookFormat([]byte(head)); got != want {
+			t.Errorf("detectBookFormat(%.12q) = %q, want %q", head, got, want)
+		}
+	}
+}
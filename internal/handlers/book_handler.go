@@ -1,50 +1,136 @@
 /*
    book_handler.go contains HTTP request handlers for managing bookstore books.
-   These handlers include functionality for fetching all books and retrieving details
-   of a specific book by ID.
+   These handlers include functionality for fetching all books, filtered by category, tag,
+   publisher, language, format and age rating, counting them by category and tag, and
+   retrieving details of a specific book.
 */
 
 package handlers
 
 import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/middlewares"
 	"bookstore/internal/models"
+	"bookstore/internal/slug"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
 )
 
 func InitializeBookRoutes(router *gin.Engine) {
-	router.GET("/api/books", GetBooks)
-	router.GET("/api/books/:id", GetBookDetails)
+	router.GET("/api/books", middlewares.Deprecated("/api/v1/books"), GetBooks)
+	// Its successor looks books up by ISBN instead of ID, so GetBookDetails links to it
+	router.GET("/api/books/:id", middlewares.Deprecated(""), GetBookDetails)
+
+	v1 := router.Group("/api/v1")
+	v1.GET("/books", GetBooks)
+	v1.GET("/books/facets", GetBookFacets)
+	v1.GET("/books/:isbn", GetBook)
 }
 
 func GetBooks(c *gin.Context) {
-	// Get all books from the database
-	books, err := models.GetAllBooks()
+	db := models.DBWithContext(c.Request.Context())
+
+	filter, ok := bookFilter(c)
+	if !ok {
+		return
+	}
+
+	// Get the books matching the filter from the database
+	books, err := models.FindBooks(db, filter)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch books", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, withCovers(books))
+}
+
+// GetBookFacets counts the books matching the listing's filter in each category and tag
+func GetBookFacets(c *gin.Context) {
+	filter, ok := bookFilter(c)
+	if !ok {
+		return
+	}
+	facets, err := models.CountFacets(models.DBWithContext(c.Request.Context()), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		apierror.Abort(c, apierror.Internal("Failed to count books", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, books)
+	c.JSON(http.StatusOK, facets)
+}
+
+// bookFilter reads the query parameters of the book listing, aborting with 400 on invalid ones
+func bookFilter(c *gin.Context) (models.BookFilter, bool) {
+	filter := models.BookFilter{
+		Category:  slug.Make(c.Query("category")),
+		Publisher: slug.Make(c.Query("publisher")),
+		Format:    strings.ToLower(c.Query("format")),
+	}
+	for _, tag := range c.QueryArray("tag") {
+		if tagSlug := slug.Make(tag); tagSlug != "" {
+			filter.Tags = append(filter.Tags, tagSlug)
+		}
+	}
+	if value := c.Query("language"); value != "" {
+		tag, err := language.Parse(value)
+		if err != nil {
+			apierror.Abort(c, apierror.BadRequest("language must be a language tag such as en or pt-BR"))
+			return filter, false
+		}
+		filter.Language = tag.String()
+	}
+	switch filter.Format {
+	case "", models.FormatHardcover, models.FormatPaperback, models.FormatEbook, models.FormatAudiobook:
+	default:
+		apierror.Abort(c, apierror.BadRequest("format must be one of: hardcover paperback ebook audiobook"))
+		return filter, false
+	}
+	if value := c.Query("max_age_rating"); value != "" {
+		age, err := strconv.Atoi(value)
+		if err != nil || age < 0 {
+			apierror.Abort(c, apierror.BadRequest("max_age_rating must be a whole number of years"))
+			return filter, false
+		}
+		filter.MaxAgeRating = &age
+	}
+	return filter, true
 }
 
 func GetBookDetails(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
 	// Get the book ID from the URL parameter
 	bookIDStr := c.Param("id")
 	bookID, err := strconv.Atoi(bookIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		apierror.Abort(c, apierror.BadRequest("Invalid book ID"))
 		return
 	}
 
 	// Get the book details from the database
-	book, err := models.GetBookByID(bookID)
+	book, err := models.GetBookByID(db, bookID)
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return
+	}
+
+	middlewares.SuccessorVersion(c, "/api/v1/books/"+url.PathEscape(book.ISBN))
+	c.JSON(http.StatusOK, withCovers([]models.Book{book})[0])
+}
+
+// GetBook looks a book up by ISBN
+func GetBook(c *gin.Context) {
+	book, err := models.GetBookByISBN(models.DBWithContext(c.Request.Context()), c.Param("isbn"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Abort(c, apierror.NotFound("Book not found"))
 		return
 	}
 
-	c.JSON(http.StatusOK, book)
+	c.JSON(http.StatusOK, withCovers([]models.Book{book})[0])
 }
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"bookstore/internal/models"
+	"net/http"
+	"testing"
+)
+
+func TestGetBooks(t *testing.T) {
+	setupTestDB(t)
+	seedBook(t, "1111111111", 10)
+	seedBook(t, "2222222222", 20)
+
+	rec := serve(http.MethodGet, "/api/books", "/api/books", nil, nil, GetBooks)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var books []models.Book
+	decode(t, rec, &books)
+	if len(books) != 2 {
+		t.Fatalf("expected 2 books, got %d", len(books))
+	}
+}
+
+func TestGetBookDetails(t *testing.T) {
+	setupTestDB(t)
+	book := seedBook(t, "1111111111", 10)
+
+	rec := serve(http.MethodGet, "/api/books/:id", "/api/books/1", nil, nil, GetBookDetails)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var got models.Book
+	decode(t, rec, &got)
+	if got.ISBN != book.ISBN {
+		t.Fatalf("expected ISBN %s, got %s", book.ISBN, got.ISBN)
+	}
+	if link := rec.Header().Get("Link"); link != `</api/v1/books/`+book.ISBN+`>; rel="successor-version"` {
+		t.Fatalf("expected a Link to the book on /api/v1, got %q", link)
+	}
+
+	if rec := serve(http.MethodGet, "/api/books/:id", "/api/books/abc", nil, nil, GetBookDetails); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non numeric id, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/api/books/:id", "/api/books/42", nil, nil, GetBookDetails); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing book, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+   catalog_handler.go contains the admin-only HTTP handlers that import and export the whole
+   catalog in bulk, as CSV, JSON lines or ONIX 3.0 XML. Imports upsert books by ISBN and are all
+   or nothing; see the catalog package for the formats.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/catalog"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// MaxCatalogSize caps an imported catalog file
+const MaxCatalogSize = 32 << 20
+
+func InitializeCatalogRoutes(router *gin.Engine) {
+	admin := router.Group("/api/v1/admin/catalog", middlewares.AdminOnly())
+	admin.POST("/import", ImportCatalog)
+	admin.GET("/export", ExportCatalog)
+}
+
+// ImportCatalog creates or updates the books of the file sent as the request body. The format
+// comes from the format query parameter, or else the Content-Type; with dry_run=true the file is
+// only validated. The report lists every row and answers 422 when a row is invalid.
+func ImportCatalog(c *gin.Context) {
+	extendDeadlines(c)
+	format := c.Query("format")
+	if format == "" {
+		var ok bool
+		if format, ok = catalog.FormatFromContentType(c.ContentType()); !ok {
+			apierror.Abort(c, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType,
+				"Send a CSV, JSON lines or ONIX file, or name its format with ?format="))
+			return
+		}
+	} else if !catalog.ValidFormat(format) {
+		apierror.Abort(c, apierror.BadRequest(catalog.ErrUnknownFormat.Error()))
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		apierror.Abort(c, apierror.BadRequest("dry_run must be true or false"))
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+	log := logging.FromContext(c).WithFields(logrus.Fields{"format": format, "dry_run": dryRun})
+
+	rows, err := catalog.Read(format, c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Abort(c, apierror.PayloadTooLarge(tooLarge.Limit))
+			return
+		}
+		apierror.Abort(c, apierror.BadRequest(fmt.Sprintf("The %s file could not be read: %v", format, err)))
+		return
+	}
+	if len(rows) == 0 {
+		apierror.Abort(c, apierror.BadRequest("The file contains no books"))
+		return
+	}
+
+	report, err := catalog.Import(db, rows, dryRun)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to import the catalog", err))
+		return
+	}
+	if report.Applied {
+		for _, result := range report.Rows {
+			switch result.Action {
+			case catalog.ActionCreate:
+				audit.Record(c, audit.Event{Action: audit.ActionBookCreate, TargetType: audit.TargetBook, TargetID: result.ISBN, After: result.After})
+			case catalog.ActionUpdate:
+				audit.Record(c, audit.Event{Action: audit.ActionBookUpdate, TargetType: audit.TargetBook, TargetID: result.ISBN, Before: result.Before, After: result.After})
+			}
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"created": report.Created, "updated": report.Updated, "unchanged": report.Unchanged, "invalid": report.Invalid, "applied": report.Applied,
+	}).Info("Catalog imported")
+	status := http.StatusOK
+	if report.Invalid > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
+}
+
+// ExportCatalog downloads every book, with its download link, in the format query parameter (csv by default)
+func ExportCatalog(c *gin.Context) {
+	format := c.DefaultQuery("format", catalog.FormatCSV)
+	if !catalog.ValidFormat(format) {
+		apierror.Abort(c, apierror.BadRequest(catalog.ErrUnknownFormat.Error()))
+		return
+	}
+
+	books, err := catalog.Load(models.DBWithContext(c.Request.Context()))
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch books", err))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="catalog.%s"`, catalog.Extensions[format]))
+	c.Header("Content-Type", catalog.ContentTypes[format])
+	c.Status(http.StatusOK)
+	if err := catalog.Write(format, c.Writer, books); err != nil {
+		logging.FromContext(c).WithError(err).Error("Failed to write the catalog export")
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bookstore/internal/audit"
+	"bookstore/internal/catalog"
+	"bookstore/internal/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// importCatalog posts a catalog file to the admin import
+func (c *testClient) importCatalog(query, contentType, file string) testResponse {
+	c.srv.t.Helper()
+	return c.send(http.MethodPost, "/api/v1/admin/catalog/import"+query, strings.NewReader(file), http.Header{"Content-Type": {contentType}})
+}
+
+func TestRoutesCatalogImportExport(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+	seedBook(t, "9780134190440", 40)
+
+	file := "isbn,title,author,price,published_year,download_link\n" +
+		"0-13-419044-0,The Go Programming Language,Alan Donovan,35,2015,\n" +
+		"979-10-90636-07-1,New Book,Someone,12.5,,https://example.com/new\n"
+
+	// A dry run reports what would happen without changing anything
+	var report catalog.Report
+	admin.importCatalog("?dry_run=true", "text/csv", file).expect(t, http.StatusOK).decode(t, &report)
+	if !report.DryRun || report.Applied || report.Created != 1 || report.Updated != 1 || len(report.Rows) != 2 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+	if report.Rows[0].Row != 2 || report.Rows[0].ISBN != "9780134190440" || report.Rows[0].Action != catalog.ActionUpdate {
+		t.Fatalf("expected line 2 to update the seeded book, got %+v", report.Rows[0])
+	}
+	if _, err := models.GetBookByISBN(models.DB, "9791090636071"); err == nil {
+		t.Fatal("expected the dry run to create nothing")
+	}
+
+	// One invalid row rejects the whole file
+	invalid := file + "9780134190441,Bad,Nobody,1,,\n" + "9780134190440,Twice,Nobody,1,,\n"
+	report = catalog.Report{}
+	admin.importCatalog("", "text/csv", invalid).expect(t, http.StatusUnprocessableEntity).decode(t, &report)
+	if report.Applied || report.Invalid != 2 || report.Rows[2].Errors[0].Field != "isbn" || report.Rows[3].Errors[0].Rule != "unique" {
+		t.Fatalf("expected the bad and repeated ISBNs to be reported, got %+v", report)
+	}
+	if book, _ := models.GetBookByISBN(models.DB, "9780134190440"); book.Price != 40 {
+		t.Fatal("expected nothing to be imported")
+	}
+
+	// The import upserts by ISBN and keeps the download link when the file has none
+	report = catalog.Report{}
+	admin.importCatalog("", "text/csv", file).expect(t, http.StatusOK).decode(t, &report)
+	if !report.Applied || report.Created != 1 || report.Updated != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	updated, _ := models.GetBookByISBN(models.DB, "9780134190440")
+	if updated.Price != 35 || updated.Author != "Alan Donovan" || updated.PublishedYear != 2015 {
+		t.Fatalf("expected the book to be updated, got %+v", updated)
+	}
+	if download, _ := models.GetBookDownload(models.DB, updated.ID); download == nil || download.DownloadLink != "https://example.com/9780134190440" {
+		t.Fatalf("expected the download link to be kept, got %+v", download)
+	}
+	created, _ := models.GetBookByISBN(models.DB, "9791090636071")
+	if download, _ := models.GetBookDownload(models.DB, created.ID); download == nil || download.DownloadLink != "https://example.com/new" {
+		t.Fatalf("expected the new book's download link, got %+v", download)
+	}
+
+	var page auditPage
+	admin.do(http.MethodGet, "/api/v1/admin/audit-logs?action="+audit.ActionBookUpdate, nil).expect(t, http.StatusOK).decode(t, &page)
+	if len(page.Data) != 1 || page.Data[0].TargetID != "9780134190440" || page.Data[0].Changes["price"].After != float64(35) {
+		t.Fatalf("expected the update to be audited, got %+v", page.Data)
+	}
+
+	// Exports in every format import back unchanged
+	for _, format := range []string{catalog.FormatCSV, catalog.FormatJSONL, catalog.FormatONIX} {
+		resp := admin.do(http.MethodGet, "/api/v1/admin/catalog/export?format="+format, nil).expect(t, http.StatusOK)
+		if resp.Header.Get("Content-Type") != catalog.ContentTypes[format] ||
+			resp.Header.Get("Content-Disposition") != `attachment; filename="catalog.`+catalog.Extensions[format]+`"` {
+			t.Fatalf("%s: unexpected headers %v", format, resp.Header)
+		}
+		report = catalog.Report{}
+		admin.importCatalog("?format="+format, "application/octet-stream", string(resp.Body)).expect(t, http.StatusOK).decode(t, &report)
+		if report.Unchanged != 2 || report.Applied {
+			t.Fatalf("%s: expected the export to import unchanged, got %+v\n%s", format, report, resp.Body)
+		}
+	}
+
+	admin.importCatalog("", "application/json", file).expect(t, http.StatusUnsupportedMediaType)
+	admin.importCatalog("?format=xlsx", "text/csv", file).expect(t, http.StatusBadRequest)
+	admin.importCatalog("", "text/csv", "isbn,title\n").expect(t, http.StatusBadRequest)
+	admin.importCatalog("", "text/csv", "isbn,title,author,price\n").expect(t, http.StatusBadRequest)
+	admin.do(http.MethodGet, "/api/v1/admin/catalog/export?format=xlsx", nil).expect(t, http.StatusBadRequest)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.importCatalog("", "text/csv", file).expect(t, http.StatusForbidden)
+	reader.do(http.MethodGet, "/api/v1/admin/catalog/export", nil).expect(t, http.StatusForbidden)
+}
@@ -0,0 +1,264 @@
+/*
+   cover_handler.go contains the HTTP request handlers for book covers. Admins upload one image per
+   book; it is resized into every thumbnail size in JPEG and WebP and kept in the blob store. The
+   thumbnails are public, and their URLs carry the cover version so browsers can cache them forever.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/blobstore"
+	"bookstore/internal/covers"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func InitializeCoverRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1")
+	v1.GET("/books/:isbn/cover/:variant", GetCover)
+	v1.POST("/books/:isbn/cover", middlewares.AdminOnly(), UploadCover)
+	v1.DELETE("/books/:isbn/cover", middlewares.AdminOnly(), DeleteCover)
+}
+
+// coverKey is the blob store key of one thumbnail of a cover version
+func coverKey(isbn, version, variant string) string {
+	return path.Join("covers", isbn, version, variant)
+}
+
+// coverURLs lists the thumbnail URLs of a cover version
+func coverURLs(isbn, version string) models.Cover {
+	base := PublicBaseURL + "/api/v1/books/" + isbn + "/cover/"
+	cover := models.Cover{}
+	for _, size := range covers.Sizes {
+		cover[size.Name] = models.CoverImage{
+			JPEG: base + size.Name + "." + covers.FormatJPEG + "?v=" + version,
+			WebP: base + size.Name + "." + covers.FormatWebP + "?v=" + version,
+		}
+	}
+	return cover
+}
+
+// withCovers fills in the cover URLs of books that have a cover
+func withCovers(books []models.Book) []models.Book {
+	for i := range books {
+		if books[i].CoverVersion != "" {
+			books[i].Cover = coverURLs(books[i].ISBN, books[i].CoverVersion)
+		}
+	}
+	return books
+}
+
+// GetCover serves one thumbnail, e.g. /api/v1/books/:isbn/cover/medium.webp
+func GetCover(c *gin.Context) {
+	variant := c.Param("variant")
+	_, format, ok := covers.ParseVariant(variant)
+	if !ok {
+		apierror.Abort(c, apierror.NotFound("Unknown cover size or format"))
+		return
+	}
+
+	book, err := models.GetBookByISBN(models.DBWithContext(c.Request.Context()), c.Param("isbn"))
+	if err != nil || book.CoverVersion == "" {
+		apierror.Abort(c, apierror.NotFound("Cover not found"))
+		return
+	}
+
+	reader, object, err := blobstore.Default.Open(c.Request.Context(), coverKey(book.ISBN, book.CoverVersion, variant))
+	if errors.Is(err, blobstore.ErrNotFound) {
+		apierror.Abort(c, apierror.NotFound("Cover not found"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to open cover", err))
+		return
+	}
+	defer reader.Close()
+
+	// Versioned URLs never change content; unversioned or outdated ones must be revalidated
+	if c.Query("v") == book.CoverVersion {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "public, no-cache")
+	}
+	c.Header("Content-Type", covers.ContentTypes[format])
+	c.Header("ETag", fmt.Sprintf(`"%s-%s"`, book.CoverVersion, variant))
+	http.ServeContent(c.Writer, c.Request, "", object.ModTime, reader)
+}
+
+// UploadCover replaces the cover of a book with the "file" field of a multipart form
+func UploadCover(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+	ctx := c.Request.Context()
+	isbn := c.Param("isbn")
+	log := logging.FromContext(c).WithField("isbn", isbn)
+
+	book, err := models.GetBookByISBN(db, isbn)
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return
+	}
+	isbn = book.ISBN
+
+	upload, _, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Abort(c, apierror.PayloadTooLarge(tooLarge.Limit))
+			return
+		}
+		apierror.Abort(c, apierror.BadRequest("A multipart form with a file field is required"))
+		return
+	}
+	defer upload.Close()
+
+	source, err := io.ReadAll(io.LimitReader(upload, covers.MaxUploadSize+1))
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to read upload", err))
+		return
+	}
+	if len(source) > covers.MaxUploadSize {
+		apierror.Abort(c, apierror.PayloadTooLarge(covers.MaxUploadSize))
+		return
+	}
+
+	img, err := covers.Decode(source)
+	if errors.Is(err, covers.ErrUnsupported) {
+		apierror.Abort(c, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, err.Error()))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusUnprocessableEntity, apierror.CodeValidation, err.Error()))
+		return
+	}
+	variants, err := covers.Generate(img)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to generate thumbnails", err))
+		return
+	}
+
+	version := covers.Version(source)
+	for _, variant := range variants {
+		key := coverKey(isbn, version, variant.Name())
+		if _, err := blobstore.Default.Put(ctx, key, bytes.NewReader(variant.Data), int64(len(variant.Data)), covers.ContentTypes[variant.Format]); err != nil {
+			deleteCoverVersion(c, isbn, version)
+			apierror.Abort(c, apierror.Internal("Failed to store thumbnails", err))
+			return
+		}
+	}
+
+	if err := models.SetCoverVersion(db, book.ID, version); err != nil {
+		deleteCoverVersion(c, isbn, version)
+		apierror.Abort(c, apierror.Internal("Failed to save cover", err))
+		return
+	}
+	if book.CoverVersion != "" && book.CoverVersion != version {
+		deleteCoverVersion(c, isbn, book.CoverVersion)
+	}
+
+	audit.Record(c, audit.Event{
+		Action: audit.ActionBookCoverUpload, TargetType: audit.TargetBook, TargetID: isbn,
+		Before: coverAudit(book.CoverVersion), After: coverAudit(version),
+	})
+
+	log.WithField("cover_version", version).Info("Cover uploaded")
+	c.JSON(http.StatusCreated, gin.H{"message": "Cover uploaded successfully", "data": coverURLs(isbn, version)})
+}
+
+// DeleteCover removes the cover of a book
+func DeleteCover(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+	isbn := c.Param("isbn")
+
+	book, err := models.GetBookByISBN(db, isbn)
+	if err != nil || book.CoverVersion == "" {
+		apierror.Abort(c, apierror.NotFound("Cover not found"))
+		return
+	}
+	isbn = book.ISBN
+
+	if err := models.SetCoverVersion(db, book.ID, ""); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete cover", err))
+		return
+	}
+	deleteCoverVersion(c, isbn, book.CoverVersion)
+
+	audit.Record(c, audit.Event{Action: audit.ActionBookCoverDelete, TargetType: audit.TargetBook, TargetID: isbn, Before: coverAudit(book.CoverVersion)})
+	c.JSON(http.StatusOK, gin.H{"message": "Cover deleted successfully"})
+}
+
+// deleteCoverVersion removes every thumbnail of a cover version, logging failures. Thumbnails
+// another book with the ISBN still shows, such as one in the trash, are kept.
+func deleteCoverVersion(c *gin.Context, isbn, version string) {
+	inUse, err := models.CoverVersionInUse(models.DBWithContext(c.Request.Context()), isbn, version, 0)
+	if err != nil {
+		logging.FromContext(c).WithError(err).WithField("cover_version", version).Warn("Failed to check whether a cover is in use")
+		return
+	} else if inUse {
+		return
+	}
+	for _, size := range covers.Sizes {
+		for _, format := range covers.Formats {
+			if err := blobstore.Default.Delete(c.Request.Context(), coverKey(isbn, version, size.Name+"."+format)); err != nil {
+				logging.FromContext(c).WithError(err).WithField("cover_version", version).Warn("Failed to delete cover thumbnail")
+			}
+		}
+	}
+}
+
+// coverAudit describes a cover version in audit diffs
+func coverAudit(version string) any {
+	if version == "" {
+		return nil
+	}
+	return gin.H{"cover_version": version}
+}
+
+// RenameCovers moves the thumbnails of books whose ISBN was normalized or changed, as their keys
+// include the ISBN. Failures are logged; such a book shows broken thumbnails until its cover is uploaded again.
+func RenameCovers(ctx context.Context, renames []models.ISBNRename) {
+	for _, rename := range renames {
+		if rename.CoverVersion == "" {
+			continue
+		}
+		// A book in the trash with the old ISBN may show the same thumbnails, which then stay
+		keepSource, err := models.CoverVersionInUse(models.DBWithContext(ctx), rename.Old, rename.CoverVersion, rename.BookID)
+		if err != nil {
+			logrus.WithError(err).WithField("isbn", rename.Old).Warn("Failed to check whether a cover is in use")
+			keepSource = true
+		}
+		for _, size := range covers.Sizes {
+			for _, format := range covers.Formats {
+				variant := size.Name + "." + format
+				from := coverKey(rename.Old, rename.CoverVersion, variant)
+				to := coverKey(rename.New, rename.CoverVersion, variant)
+				if err := moveCover(ctx, from, to, covers.ContentTypes[format], keepSource); err != nil {
+					logrus.WithError(err).WithFields(logrus.Fields{"isbn": rename.New, "variant": variant}).Warn("Failed to move cover thumbnail")
+				}
+			}
+		}
+	}
+}
+
+func moveCover(ctx context.Context, from, to, contentType string, keepSource bool) error {
+	reader, object, err := blobstore.Default.Open(ctx, from)
+	if err != nil {
+		return err
+	}
+	_, err = blobstore.Default.Put(ctx, to, reader, object.Size, contentType)
+	reader.Close()
+	if err != nil || keepSource {
+		return err
+	}
+	return blobstore.Default.Delete(ctx, from)
+}
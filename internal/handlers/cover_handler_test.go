@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bookstore/internal/blobstore"
+	"bookstore/internal/models"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// uploadCover posts image as the file field of a multipart form to the cover route
+func (c *testClient) uploadCover(isbn string, image []byte) testResponse {
+	c.srv.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "cover.jpg")
+	part.Write(image)
+	form.Close()
+	return c.send(http.MethodPost, "/api/v1/books/"+isbn+"/cover", &body, http.Header{"Content-Type": {form.FormDataContentType()}})
+}
+
+func testCover(t *testing.T, shade uint8) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 500, 750))
+	for y := 0; y < 750; y++ {
+		for x := 0; x < 500; x++ {
+			img.Set(x, y, color.RGBA{R: shade, G: uint8(x), B: uint8(y), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("encoding cover: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoutesCovers(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+	book := seedBook(t, "9780134190440", 40)
+	seedBook(t, "9781593279288", 30)
+
+	admin.uploadCover(book.ISBN, []byte("not an image")).expect(t, http.StatusUnsupportedMediaType)
+	admin.uploadCover("0000000000", testCover(t, 0)).expect(t, http.StatusNotFound)
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.uploadCover(book.ISBN, testCover(t, 0)).expect(t, http.StatusForbidden)
+
+	var uploaded struct {
+		Data models.Cover `json:"data"`
+	}
+	admin.uploadCover(book.ISBN, testCover(t, 0)).expect(t, http.StatusCreated).decode(t, &uploaded)
+	if len(uploaded.Data) != 3 || uploaded.Data["medium"].WebP == "" {
+		t.Fatalf("expected three cover sizes, got %+v", uploaded.Data)
+	}
+
+	// Listings and details carry the cover URLs; books without a cover have none
+	var books []models.Book
+	reader.do(http.MethodGet, "/api/v1/books", nil).expect(t, http.StatusOK).decode(t, &books)
+	for _, b := range books {
+		if (b.ISBN == book.ISBN) != (b.Cover != nil) {
+			t.Fatalf("unexpected cover for %s: %+v", b.ISBN, b.Cover)
+		}
+	}
+	var details models.Book
+	reader.do(http.MethodGet, "/api/v1/books/"+book.ISBN, nil).expect(t, http.StatusOK).decode(t, &details)
+	if details.Cover["large"].JPEG != uploaded.Data["large"].JPEG {
+		t.Fatalf("expected the cover URLs in the book details, got %+v", details.Cover)
+	}
+
+	// Versioned thumbnails are public and cacheable forever
+	medium := strings.TrimPrefix(uploaded.Data["medium"].WebP, srv.server.URL)
+	anon := srv.clientWithoutCSRF()
+	resp := anon.send(http.MethodGet, medium, nil, nil).expect(t, http.StatusOK)
+	if resp.Header.Get("Content-Type") != "image/webp" || !strings.Contains(resp.Header.Get("Cache-Control"), "immutable") {
+		t.Fatalf("unexpected thumbnail headers %v", resp.Header)
+	}
+	etag := resp.Header.Get("ETag")
+	anon.send(http.MethodGet, medium, nil, http.Header{"If-None-Match": {etag}}).expect(t, http.StatusNotModified)
+
+	small := strings.TrimPrefix(uploaded.Data["small"].JPEG, srv.server.URL)
+	resp = anon.send(http.MethodGet, small, nil, nil).expect(t, http.StatusOK)
+	thumbnail, err := jpeg.DecodeConfig(bytes.NewReader(resp.Body))
+	if err != nil || thumbnail.Width != 160 || thumbnail.Height != 240 {
+		t.Fatalf("expected a 160x240 JPEG, got %+v (%v)", thumbnail, err)
+	}
+	anon.send(http.MethodGet, "/api/v1/books/"+book.ISBN+"/cover/huge.png", nil, nil).expect(t, http.StatusNotFound)
+
+	// A thumbnail missing from the blob store is not found rather than a server error
+	version := uploaded.Data["small"].JPEG[strings.LastIndex(uploaded.Data["small"].JPEG, "=")+1:]
+	blobstore.Default.Delete(context.Background(), coverKey(book.ISBN, version, "small.webp"))
+	anon.send(http.MethodGet, "/api/v1/books/"+book.ISBN+"/cover/small.webp", nil, nil).expect(t, http.StatusNotFound)
+
+	// A new cover changes the URLs and removes the old thumbnails
+	admin.uploadCover(book.ISBN, testCover(t, 200)).expect(t, http.StatusCreated)
+	stored, _ := models.GetBookByISBN(models.DB, book.ISBN)
+	oldVersion := uploaded.Data["medium"].WebP[strings.LastIndex(uploaded.Data["medium"].WebP, "=")+1:]
+	if stored.CoverVersion == oldVersion {
+		t.Fatal("expected a new cover version")
+	}
+	if _, _, err := blobstore.Default.Open(context.Background(), coverKey(book.ISBN, oldVersion, "medium.webp")); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected the old thumbnails to be deleted, got %v", err)
+	}
+	resp = anon.send(http.MethodGet, medium, nil, http.Header{"If-None-Match": {etag}}).expect(t, http.StatusOK)
+	if resp.Header.Get("Cache-Control") != "public, no-cache" {
+		t.Fatalf("expected an outdated URL to be revalidated, got %v", resp.Header)
+	}
+
+	admin.do(http.MethodDelete, "/api/v1/books/"+book.ISBN+"/cover", nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/books/"+book.ISBN+"/cover", nil).expect(t, http.StatusNotFound)
+	anon.send(http.MethodGet, medium, nil, nil).expect(t, http.StatusNotFound)
+	var withoutCover models.Book
+	reader.do(http.MethodGet, "/api/v1/books/"+book.ISBN, nil).expect(t, http.StatusOK).decode(t, &withoutCover)
+	if withoutCover.Cover != nil {
+		t.Fatalf("expected no cover after deletion, got %+v", withoutCover.Cover)
+	}
+}
+
+func TestRoutesCoverFollowsISBNChange(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+	book := seedBook(t, "9780134190440", 40)
+	admin.uploadCover(book.ISBN, testCover(t, 0)).expect(t, http.StatusCreated)
+
+	admin.do(http.MethodPut, "/api/v1/books/"+book.ISBN, validBookInput("9781593276034")).expect(t, http.StatusOK)
+	var details models.Book
+	admin.do(http.MethodGet, "/api/v1/books/9781593276034", nil).expect(t, http.StatusOK).decode(t, &details)
+	if len(details.Cover) == 0 {
+		t.Fatal("expected the book to keep its cover")
+	}
+	for _, image := range details.Cover {
+		srv.clientWithoutCSRF().send(http.MethodGet, strings.TrimPrefix(image.JPEG, srv.server.URL), nil, nil).expect(t, http.StatusOK)
+	}
+	stored, _ := models.GetBookByISBN(models.DB, "9781593276034")
+	if _, _, err := blobstore.Default.Open(context.Background(), coverKey(book.ISBN, stored.CoverVersion, "large.jpg")); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected no thumbnails left under the old ISBN, got %v", err)
+	}
+}
+
+func TestRenameCoversFollowsNormalizedISBNs(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+	book := seedBook(t, "9780134190440", 40)
+
+	var uploaded struct {
+		Data models.Cover `json:"data"`
+	}
+	admin.uploadCover(book.ISBN, testCover(t, 0)).expect(t, http.StatusCreated).decode(t, &uploaded)
+	stored, _ := models.GetBookByISBN(models.DB, book.ISBN)
+
+	// Pretend the cover was uploaded while the book was stored under a hyphenated ISBN-10
+	rename := models.ISBNRename{BookID: book.ID, Old: "0-13-419044-0", New: book.ISBN, CoverVersion: stored.CoverVersion}
+	RenameCovers(context.Background(), []models.ISBNRename{{BookID: book.ID, Old: rename.New, New: rename.Old, CoverVersion: rename.CoverVersion}})
+	if _, _, err := blobstore.Default.Open(context.Background(), coverKey(book.ISBN, stored.CoverVersion, "large.jpg")); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected the thumbnails to be moved away, got %v", err)
+	}
+
+	RenameCovers(context.Background(), []models.ISBNRename{rename})
+	for _, image := range uploaded.Data {
+		srv.clientWithoutCSRF().send(http.MethodGet, strings.TrimPrefix(image.WebP, srv.server.URL), nil, nil).expect(t, http.StatusOK)
+	}
+	if _, _, err := blobstore.Default.Open(context.Background(), coverKey(rename.Old, stored.CoverVersion, "large.jpg")); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected no thumbnails left under the old ISBN, got %v", err)
+	}
+}
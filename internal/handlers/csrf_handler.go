@@ -0,0 +1,29 @@
+/*
+   csrf_handler.go hands out the CSRF token that the SPA must send with every state-changing request.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/csrf"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitializeCSRFRoutes(router *gin.Engine) {
+	router.GET("/api/v1/csrf-token", GetCSRFToken)
+}
+
+// GetCSRFToken returns the session's CSRF token, starting a session if there is none yet
+func GetCSRFToken(c *gin.Context) {
+	token, err := csrf.Token(c)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to issue CSRF token", err))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"csrf_token": token})
+}
@@ -0,0 +1,49 @@
+/*
+   docs_handler.go serves the OpenAPI specification of every route in this package
+   and the interactive documentation page built on it, together with its embedded assets.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apidocs"
+	"bookstore/internal/apierror"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitializeDocsRoutes(router *gin.Engine) {
+	router.GET("/openapi.json", OpenAPISpec)
+	router.GET("/docs", Docs)
+	router.GET("/docs/assets/*file", DocsAsset)
+}
+
+func OpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", apidocs.Spec)
+}
+
+// docsCSP lets the docs page load its own scripts and styles; the API default allows nothing
+const docsCSP = "default-src 'none'; script-src 'self'; style-src 'self'; " +
+	"img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'; base-uri 'none'"
+
+func Docs(c *gin.Context) {
+	c.Header("Content-Security-Policy", docsCSP)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", apidocs.DocsPage)
+}
+
+// DocsAsset serves a script or style of the docs page, e.g. /docs/assets/swagger-ui/swagger-ui.css
+func DocsAsset(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("file"), "/")
+	data, err := fs.ReadFile(apidocs.Assets, name)
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Asset not found"))
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, mime.TypeByExtension(path.Ext(name)), data)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bookstore/internal/apidocs"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// ginParam matches path parameters such as ":isbn" or "*file", which OpenAPI writes as "{isbn}"
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z_]+)`)
+
+func TestOpenAPISpecCoversEveryRoute(t *testing.T) {
+	srv := newTestServer(t)
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(apidocs.Spec, &spec); err != nil {
+		t.Fatalf("decoding spec: %v", err)
+	}
+
+	for _, route := range srv.router.Routes() {
+		path := ginParam.ReplaceAllString(route.Path, "{$1}")
+		if _, ok := spec.Paths[path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s %s is registered but missing from openapi.json", route.Method, path)
+		}
+	}
+}
+
+func TestServeOpenAPIAndDocs(t *testing.T) {
+	srv := newTestServer(t)
+	client := srv.client()
+
+	resp := client.do(http.MethodGet, "/openapi.json", nil).expect(t, http.StatusOK)
+	var spec map[string]any
+	resp.decode(t, &spec)
+	if spec["openapi"] != "3.0.3" {
+		t.Fatalf("expected an OpenAPI 3 document, got %v", spec["openapi"])
+	}
+
+	resp = client.do(http.MethodGet, "/docs", nil).expect(t, http.StatusOK)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !strings.Contains(string(resp.Body), "/docs/assets/docs.js") {
+		t.Fatalf("expected the docs page, got %s", resp.Body)
+	}
+	if strings.Contains(string(resp.Body), "https://") {
+		t.Fatalf("expected the docs page to load nothing from other hosts, got %s", resp.Body)
+	}
+
+	resp = client.do(http.MethodGet, "/docs/assets/docs.js", nil).expect(t, http.StatusOK)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/javascript") || !strings.Contains(string(resp.Body), "/openapi.json") {
+		t.Fatalf("expected the docs script, got %v %s", resp.Header, resp.Body)
+	}
+	resp = client.do(http.MethodGet, "/docs/assets/swagger-ui/swagger-ui-bundle.js", nil).expect(t, http.StatusOK)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/javascript") || !strings.Contains(string(resp.Body), "SwaggerUIBundle") {
+		t.Fatalf("expected the vendored Swagger UI bundle, got %v", resp.Header)
+	}
+	resp = client.do(http.MethodGet, "/docs/assets/swagger-ui/swagger-ui.css", nil).expect(t, http.StatusOK)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/css") {
+		t.Fatalf("expected the vendored Swagger UI styles, got %v", resp.Header)
+	}
+	client.do(http.MethodGet, "/docs/assets/missing.js", nil).expect(t, http.StatusNotFound)
+	client.do(http.MethodGet, "/docs/assets/../openapi.json", nil).expect(t, http.StatusNotFound)
+	client.do(http.MethodGet, "/docs/assets/swagger-ui/", nil).expect(t, http.StatusNotFound)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bookstore/internal/csrf"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testServer is a running instance of every route in this package backed by a throwaway database
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	server *httptest.Server
+}
+
+// testClient is a browser-like client that keeps its own session cookie between requests.
+// Like the SPA, it fetches a CSRF token before its first request and sends it with every request.
+type testClient struct {
+	srv       *testServer
+	http      *http.Client
+	csrfToken string
+	noCSRF    bool
+}
+
+// testResponse is a recorded response with its body already read
+type testResponse struct {
+	Code   int
+	Header http.Header
+	Body   []byte
+}
+
+// testSecurityConfig is the security configuration of the test server, with a frontend allowed by CORS
+var testSecurityConfig = middlewares.SecurityConfig{
+	ContentSecurityPolicy: middlewares.DefaultCSP,
+	HSTSMaxAge:            time.Hour,
+	FrameOptions:          "DENY",
+	ReferrerPolicy:        "no-referrer",
+	AllowedOrigins:        []string{testFrontendOrigin},
+	MaxBodySize:           1 << 20,
+}
+
+// testFrontendOrigin is the origin of the SPA in tests
+const testFrontendOrigin = "http://localhost:5173"
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	setupTestDB(t)
+
+	router, err := NewRouter("bookstore-test", testSecurityConfig)
+	if err != nil {
+		t.Fatalf("building the router: %v", err)
+	}
+	RegisterRoutes(router)
+
+	srv := &testServer{t: t, router: router, server: httptest.NewServer(router)}
+	t.Cleanup(srv.server.Close)
+	return srv
+}
+
+func (s *testServer) client() *testClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		s.t.Fatalf("creating cookie jar: %v", err)
+	}
+	return &testClient{srv: s, http: &http.Client{Jar: jar}}
+}
+
+// clientWithoutCSRF returns a client that never sends a CSRF token, like a forged cross-site request
+func (s *testServer) clientWithoutCSRF() *testClient {
+	c := s.client()
+	c.noCSRF = true
+	return c
+}
+
+// seedAdmin stores the admin account that the admin routes recognise by username
+func (s *testServer) seedAdmin(email, password string) {
+	s.t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		s.t.Fatalf("hashing password: %v", err)
+	}
+	admin := models.User{Username: "admin", Email: email, Password: string(hash)}
+	if err := models.DB.Create(&admin).Error; err != nil {
+		s.t.Fatalf("seeding admin: %v", err)
+	}
+}
+
+func (c *testClient) do(method, path string, body any) testResponse {
+	c.srv.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			c.srv.t.Fatalf("encoding body: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	return c.send(method, path, reader, http.Header{"Content-Type": {"application/json"}})
+}
+
+// send makes a request with a raw body and headers, such as a multipart upload or a range request
+func (c *testClient) send(method, path string, body io.Reader, header http.Header) testResponse {
+	c.srv.t.Helper()
+
+	if !c.noCSRF && c.csrfToken == "" {
+		c.noCSRF = true
+		var token map[string]string
+		c.do(http.MethodGet, "/api/v1/csrf-token", nil).expect(c.srv.t, http.StatusOK).decode(c.srv.t, &token)
+		c.noCSRF = false
+		c.csrfToken = token["csrf_token"]
+	}
+
+	req, err := http.NewRequest(method, c.srv.server.URL+path, body)
+	if err != nil {
+		c.srv.t.Fatalf("building request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if !c.noCSRF {
+		req.Header.Set(csrf.HeaderName, c.csrfToken)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.srv.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.srv.t.Fatalf("reading body: %v", err)
+	}
+
+	// Like the SPA, pick up the token that logging in or out replaced the session's with
+	var rotated struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	if json.Unmarshal(data, &rotated) == nil && rotated.CSRFToken != "" {
+		c.csrfToken = rotated.CSRFToken
+	}
+	return testResponse{Code: resp.StatusCode, Header: resp.Header, Body: data}
+}
+
+// register signs up a new account and logs the client in with it
+func (c *testClient) register(username, password string) {
+	c.srv.t.Helper()
+	input := models.Input{Username: username, Email: username + "@example.com", Password: password}
+	if resp := c.do(http.MethodPost, "/api/auth/register", input); resp.Code != http.StatusCreated {
+		c.srv.t.Fatalf("register %s: expected 201, got %d: %s", username, resp.Code, resp.Body)
+	}
+	c.login(input.Email, password)
+}
+
+func (c *testClient) login(email, password string) {
+	c.srv.t.Helper()
+	input := models.Input{Username: "-", Email: email, Password: password}
+	if resp := c.do(http.MethodPost, "/api/auth/login", input); resp.Code != http.StatusOK {
+		c.srv.t.Fatalf("login %s: expected 200, got %d: %s", email, resp.Code, resp.Body)
+	}
+}
+
+func (r testResponse) expect(t *testing.T, code int) testResponse {
+	t.Helper()
+	if r.Code != code {
+		t.Fatalf("expected status %d, got %d: %s", code, r.Code, r.Body)
+	}
+	return r
+}
+
+func (r testResponse) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("decoding response %q: %v", r.Body, err)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+   health_handler.go contains the liveness and readiness probes used by load balancers and
+   orchestrators. Liveness only reports that the process is serving, readiness also checks the database.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/models"
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds how long a readiness probe waits for the database
+const readinessTimeout = 2 * time.Second
+
+var shuttingDown atomic.Bool
+
+func InitializeHealthRoutes(router *gin.Engine) {
+	router.GET("/healthz", Healthz)
+	router.GET("/readyz", Readyz)
+}
+
+// MarkShuttingDown makes readiness fail so that no new traffic is routed here while requests drain
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func Readyz(c *gin.Context) {
+	if shuttingDown.Load() {
+		apierror.Abort(c, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "Server is shutting down"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := models.PingDB(ctx); err != nil {
+		apierror.Abort(c, &apierror.Error{Status: http.StatusServiceUnavailable, Code: apierror.CodeUnavailable, Message: "Database unreachable", Cause: err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
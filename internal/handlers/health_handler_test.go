@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"bookstore/internal/models"
+	"net/http"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	if rec := serve(http.MethodGet, "/healthz", "/healthz", nil, nil, Healthz); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	setupTestDB(t)
+	if rec := serve(http.MethodGet, "/readyz", "/readyz", nil, nil, Readyz); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with a reachable database, got %d", rec.Code)
+	}
+
+	if err := models.CloseDB(); err != nil {
+		t.Fatalf("CloseDB: %v", err)
+	}
+	if rec := serve(http.MethodGet, "/readyz", "/readyz", nil, nil, Readyz); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with a closed database, got %d", rec.Code)
+	}
+}
+
+func TestReadyzWhileShuttingDown(t *testing.T) {
+	setupTestDB(t)
+	MarkShuttingDown()
+	t.Cleanup(func() { shuttingDown.Store(false) })
+
+	if rec := serve(http.MethodGet, "/readyz", "/readyz", nil, nil, Readyz); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while shutting down, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/healthz", "/healthz", nil, nil, Healthz); rec.Code != http.StatusOK {
+		t.Fatalf("expected liveness to stay 200, got %d", rec.Code)
+	}
+}
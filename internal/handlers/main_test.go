@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/blobstore"
+	"bookstore/internal/delivery"
+	"bookstore/internal/models"
+	"bookstore/internal/session_manager"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"github.com/sirupsen/logrus"
+)
+
+// testMetricsToken is the bearer token of /metrics in tests
+const testMetricsToken = "handlers-test-metrics-token"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logrus.SetOutput(io.Discard)
+	session_manager.Store = sessions.NewCookieStore([]byte("handlers-test-secret"))
+	delivery.Setup(delivery.Config{Secret: "handlers-test-secret", TTL: 5 * time.Minute, Limit: 2, LimitWindow: 24 * time.Hour})
+
+	blobDir, err := os.MkdirTemp("", "bookstore-blobs-")
+	if err != nil {
+		panic(err)
+	}
+	blobstore.Setup(blobstore.Config{Driver: "local", LocalDir: blobDir})
+	MetricsToken = testMetricsToken
+	code := m.Run()
+	os.RemoveAll(blobDir)
+	os.Exit(code)
+}
+
+// setupTestDB points models.DB at a fresh in-memory SQLite database
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	db, err := models.OpenDB(models.DBConfig{Driver: models.DriverSQLite, DSN: models.SQLiteMemory})
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+}
+
+// sessionCookie returns a cookie carrying a logged in session for the given user and role
+func sessionCookie(t *testing.T, userID uint, role string) *http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := session_manager.Store.Get(req, "session-name")
+	session.Values["user_id"] = userID
+	session.Values["role"] = role
+	if err := session.Save(req, rec); err != nil {
+		t.Fatalf("saving session: %v", err)
+	}
+	return rec.Result().Cookies()[0]
+}
+
+// serve runs a single handler chain against a request and returns the recorded response
+func serve(method, route, target string, body any, cookie *http.Cookie, chain ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.Handle(method, route, chain...)
+
+	var reader io.Reader
+	if body != nil {
+		payload, _ := json.Marshal(body)
+		reader = bytes.NewReader(payload)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+}
+
+func seedBook(t *testing.T, isbn string, price float64) models.Book {
+	t.Helper()
+	book := models.Book{Title: "Title " + isbn, Author: "Author", ISBN: isbn, Price: price}
+	if err := models.DB.Create(&book).Error; err != nil {
+		t.Fatalf("seeding book: %v", err)
+	}
+	download := models.BookDownload{BookID: book.ID, ISBN: book.ISBN, DownloadLink: "https://example.com/" + isbn}
+	if err := models.DB.Create(&download).Error; err != nil {
+		t.Fatalf("seeding download link: %v", err)
+	}
+	return book
+}
+
+func seedUser(t *testing.T, username string, balance float64) models.User {
+	t.Helper()
+	user := models.User{Username: username, Email: username + "@example.com", Password: "x"}
+	if err := models.DB.Create(&user).Error; err != nil {
+		t.Fatalf("seeding user: %v", err)
+	}
+	if err := models.CreateBalance(models.DB, user.ID, balance); err != nil {
+		t.Fatalf("seeding balance: %v", err)
+	}
+	return user
+}
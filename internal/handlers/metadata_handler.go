@@ -0,0 +1,103 @@
+/*
+   metadata_handler.go contains the admin-only HTTP handler that looks up a book's metadata by
+   ISBN from the configured provider, to pre-fill a new book or refresh a stored one, and the
+   enrichment of books created with ?enrich=true.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/isbn"
+	"bookstore/internal/logging"
+	"bookstore/internal/metadata"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitializeMetadataRoutes(router *gin.Engine) {
+	admin := router.Group("/api/v1/admin/metadata", middlewares.AdminOnly())
+	admin.GET("/:isbn", LookupMetadata)
+}
+
+// LookupMetadata returns what the provider knows about an ISBN, along with the stored book if any
+func LookupMetadata(c *gin.Context) {
+	canonical, err := isbn.Parse(c.Param("isbn"))
+	if err != nil {
+		apierror.Abort(c, apierror.BadRequest("Invalid ISBN: "+err.Error()))
+		return
+	}
+
+	found, apiErr := lookupMetadata(c.Request.Context(), canonical.String())
+	if apiErr != nil {
+		apierror.Abort(c, apiErr)
+		return
+	}
+
+	response := gin.H{"data": found}
+	if book, err := models.GetBookByISBN(models.DBWithContext(c.Request.Context()), canonical.String()); err == nil {
+		response["book"] = book
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// lookupMetadata asks the provider about a canonical ISBN; a failure comes as the error to answer with
+func lookupMetadata(ctx context.Context, number string) (metadata.Metadata, *apierror.Error) {
+	if metadata.Default == nil {
+		return metadata.Metadata{}, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "Metadata lookups are disabled")
+	}
+	found, err := metadata.Default.Lookup(ctx, number)
+	if errors.Is(err, metadata.ErrNotFound) {
+		return found, apierror.NotFound("The metadata provider does not know this ISBN")
+	} else if err != nil {
+		return found, &apierror.Error{Status: http.StatusBadGateway, Code: apierror.CodeBadGateway, Message: "The metadata provider is unavailable", Cause: err}
+	}
+	return found, nil
+}
+
+// enrichBookInput fills the fields left empty in a new book from the provider; the fields sent
+// always win, and a book the provider does not know is left as it is. On failure it aborts the
+// request and returns false.
+func enrichBookInput(c *gin.Context, in *models.BookInput) bool {
+	canonical, err := isbn.Parse(in.ISBN)
+	if err != nil {
+		// Validation reports the ISBN
+		return true
+	}
+	found, apiErr := lookupMetadata(c.Request.Context(), canonical.String())
+	if apiErr != nil && apiErr.Status == http.StatusNotFound {
+		logging.FromContext(c).WithField("isbn", canonical.String()).Info("No metadata to enrich the book with")
+		return true
+	} else if apiErr != nil {
+		apierror.Abort(c, apiErr)
+		return false
+	}
+
+	if in.Title == "" {
+		in.Title = found.Title
+	}
+	if in.Author == "" && len(in.Contributors) == 0 {
+		in.Author = found.Author()
+		for _, name := range found.Authors {
+			in.Contributors = append(in.Contributors, models.ContributorInput{Name: name, Role: models.RoleAuthor})
+		}
+	}
+	if in.Description == "" {
+		in.Description = found.Description
+	}
+	if in.PublishedYear == 0 {
+		in.PublishedYear = found.PublishedYear
+	}
+	if in.Publisher == "" && len(found.Publishers) > 0 {
+		in.Publisher = found.Publishers[0]
+	}
+	if in.PageCount == 0 {
+		in.PageCount = found.PageCount
+	}
+	return true
+}
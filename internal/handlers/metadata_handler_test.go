@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/metadata"
+	"bookstore/internal/models"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// failingProvider stands in for a provider that cannot be reached
+type failingProvider struct{}
+
+func (failingProvider) Lookup(ctx context.Context, isbn string) (metadata.Metadata, error) {
+	return metadata.Metadata{}, errors.New("connection refused")
+}
+
+// useMetadataProvider replaces the provider for the duration of a test
+func useMetadataProvider(t *testing.T, provider metadata.MetadataProvider) {
+	previous := metadata.Default
+	metadata.Default = provider
+	t.Cleanup(func() { metadata.Default = previous })
+}
+
+func TestRoutesMetadataLookupAndEnrich(t *testing.T) {
+	useMetadataProvider(t, metadata.Fixtures{
+		"9780134190440": {
+			Title:         "The Go Programming Language",
+			Authors:       []string{"Alan A. A. Donovan", "Brian W. Kernighan"},
+			Description:   "The authoritative resource to writing clear and idiomatic Go.",
+			PublishedYear: 2015,
+		},
+	})
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	var lookup struct {
+		Data metadata.Metadata `json:"data"`
+		Book *models.Book      `json:"book"`
+	}
+	admin.do(http.MethodGet, "/api/v1/admin/metadata/0-13-419044-0", nil).expect(t, http.StatusOK).decode(t, &lookup)
+	if lookup.Data.ISBN != "9780134190440" || lookup.Data.Title != "The Go Programming Language" || lookup.Data.Source != "fixtures" || lookup.Book != nil {
+		t.Fatalf("unexpected lookup %+v", lookup)
+	}
+	admin.do(http.MethodGet, "/api/v1/admin/metadata/9791090636071", nil).expect(t, http.StatusNotFound)
+	admin.do(http.MethodGet, "/api/v1/admin/metadata/9780134190441", nil).expect(t, http.StatusBadRequest)
+
+	// Enrichment fills in what the admin left out and keeps what they sent
+	var created struct {
+		Data models.Book `json:"data"`
+	}
+	admin.do(http.MethodPost, "/api/v1/books?enrich=true", map[string]any{"isbn": "0134190440", "price": 40, "title": "GOPL"}).
+		expect(t, http.StatusOK).decode(t, &created)
+	if created.Data.Title != "GOPL" || created.Data.Author != "Alan A. A. Donovan, Brian W. Kernighan" || created.Data.PublishedYear != 2015 ||
+		created.Data.Description == "" {
+		t.Fatalf("expected the book to be enriched, got %+v", created.Data)
+	}
+
+	lookup.Book = nil
+	admin.do(http.MethodGet, "/api/v1/admin/metadata/9780134190440", nil).expect(t, http.StatusOK).decode(t, &lookup)
+	if lookup.Book == nil || lookup.Book.Title != "GOPL" {
+		t.Fatalf("expected the stored book next to the metadata, got %+v", lookup.Book)
+	}
+
+	// Unknown books are still validated as usual, and enrichment must be asked for
+	var apiErr apierror.Envelope
+	admin.do(http.MethodPost, "/api/v1/books?enrich=true", map[string]any{"isbn": "9791090636071", "price": 10}).
+		expect(t, http.StatusBadRequest).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeValidation || len(apiErr.Error.Fields) != 2 {
+		t.Fatalf("expected title and author to be required, got %+v", apiErr.Error)
+	}
+	admin.do(http.MethodPost, "/api/v1/books", map[string]any{"isbn": "9780804429573", "price": 10}).expect(t, http.StatusBadRequest)
+	admin.do(http.MethodPost, "/api/v1/books?enrich=maybe", map[string]any{"isbn": "9780804429573", "price": 10}).expect(t, http.StatusBadRequest)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodGet, "/api/v1/admin/metadata/9780134190440", nil).expect(t, http.StatusForbidden)
+
+	useMetadataProvider(t, failingProvider{})
+	admin.do(http.MethodGet, "/api/v1/admin/metadata/9780134190440", nil).expect(t, http.StatusBadGateway)
+	admin.do(http.MethodPost, "/api/v1/books?enrich=true", map[string]any{"isbn": "9780804429573", "price": 10}).expect(t, http.StatusBadGateway)
+
+	useMetadataProvider(t, nil)
+	admin.do(http.MethodGet, "/api/v1/admin/metadata/9780134190440", nil).expect(t, http.StatusServiceUnavailable)
+}
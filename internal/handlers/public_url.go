@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// PublicBaseURL is the address clients reach the API at, such as "https://books.example.com",
+// which absolute links in responses, like signed download URLs and cover URLs, start with. It
+// comes from configuration rather than the Host and X-Forwarded-* headers, which clients control;
+// when empty, the links are paths relative to the API.
+var PublicBaseURL string
+
+// PublicBaseURLFromEnv reads PUBLIC_BASE_URL, an http or https URL optionally with a path prefix
+func PublicBaseURLFromEnv() (string, error) {
+	value := strings.TrimSpace(os.Getenv("PUBLIC_BASE_URL"))
+	if value == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("PUBLIC_BASE_URL must be an http or https URL such as https://books.example.com, got %q", value)
+	}
+	return strings.TrimSuffix(value, "/"), nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bookstore/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPublicBaseURLFromEnv(t *testing.T) {
+	for value, want := range map[string]string{
+		"":                                 "",
+		"https://books.example.com":        "https://books.example.com",
+		"https://books.example.com/":       "https://books.example.com",
+		"http://localhost:8080/bookstore/": "http://localhost:8080/bookstore",
+	} {
+		t.Setenv("PUBLIC_BASE_URL", value)
+		if got, err := PublicBaseURLFromEnv(); err != nil || got != want {
+			t.Fatalf("PUBLIC_BASE_URL=%q: expected %q, got %q, %v", value, want, got, err)
+		}
+	}
+	for _, value := range []string{"books.example.com", "ftp://books.example.com", "https://", "https://books.example.com/?a=b", "https://books.example.com/#top"} {
+		t.Setenv("PUBLIC_BASE_URL", value)
+		if _, err := PublicBaseURLFromEnv(); err == nil {
+			t.Fatalf("PUBLIC_BASE_URL=%q: expected an error", value)
+		}
+	}
+}
+
+func TestLinksIgnoreForwardedHeaders(t *testing.T) {
+	setupTestDB(t)
+	book := seedBook(t, "1111111111", 30)
+	user := seedUser(t, "reader", 100)
+	if err := models.CreateTransaction(models.DB, user.ID, book.ID, book.Price); err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	if err := models.DB.Model(&book).Update("cover_version", "v1").Error; err != nil {
+		t.Fatalf("setting the cover version: %v", err)
+	}
+	cookie := sessionCookie(t, user.ID, "user")
+
+	router := gin.New()
+	router.GET("/api/getDownloadLink/:isbn", GetDownloadLink)
+	router.GET("/api/v1/books/:isbn", GetBook)
+	links := func() (string, string) {
+		t.Helper()
+		get := func(target string, v any) {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Host = "attacker.example"
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("X-Forwarded-Host", "attacker.example")
+			req.AddCookie(cookie)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s: expected 200, got %d %s", target, rec.Code, rec.Body)
+			}
+			decode(t, rec, v)
+		}
+		var link map[string]any
+		get("/api/getDownloadLink/"+book.ISBN, &link)
+		var details models.Book
+		get("/api/v1/books/"+book.ISBN, &details)
+		message, _ := link["message"].(string)
+		return message, details.Cover["small"].JPEG
+	}
+
+	// Without a configured address the links are relative
+	download, cover := links()
+	if !strings.HasPrefix(download, "/api/v1/downloads/"+book.ISBN+"?") || !strings.HasPrefix(cover, "/api/v1/books/"+book.ISBN+"/cover/") {
+		t.Fatalf("expected relative links, got %q and %q", download, cover)
+	}
+
+	PublicBaseURL = "https://books.example.com"
+	t.Cleanup(func() { PublicBaseURL = "" })
+	download, cover = links()
+	if !strings.HasPrefix(download, "https://books.example.com/api/v1/downloads/") || !strings.HasPrefix(cover, "https://books.example.com/api/v1/books/") {
+		t.Fatalf("expected links on PUBLIC_BASE_URL, got %q and %q", download, cover)
+	}
+}
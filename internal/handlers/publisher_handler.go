@@ -0,0 +1,202 @@
+/*
+   publisher_handler.go contains HTTP request handlers for the publishers of books: the list of
+   publishers with their imprints, a publisher's page with its books, and the admin-only
+   handlers that create, rename and delete publishers. Books create the publishers and imprints
+   they name, so the admin handlers are mostly there to fix names.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"bookstore/internal/slug"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func InitializePublisherRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1")
+	v1.GET("/publishers", GetPublishers)
+	v1.GET("/publishers/:slug", GetPublisher)
+
+	admin := router.Group("/api/v1", middlewares.AdminOnly())
+	admin.POST("/publishers", CreatePublisher)
+	admin.PUT("/publishers/:slug", UpdatePublisher)
+	admin.DELETE("/publishers/:slug", DeletePublisher)
+}
+
+// publisherSummary is a publisher in the list of publishers
+type publisherSummary struct {
+	models.Publisher
+	BookCount int `json:"book_count"`
+}
+
+// publisherPage is a publisher with its books
+type publisherPage struct {
+	models.Publisher
+	Books []models.Book `json:"books"`
+}
+
+// GetPublishers lists the publishers by name, with their imprints and number of books
+func GetPublishers(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	publishers, err := models.GetAllPublishers(db)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch publishers", err))
+		return
+	}
+	counts, err := models.CountPublisherBooks(db)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch publishers", err))
+		return
+	}
+
+	summaries := make([]publisherSummary, len(publishers))
+	for i, publisher := range publishers {
+		summaries[i] = publisherSummary{Publisher: publisher, BookCount: counts[publisher.ID]}
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
+// GetPublisher returns a publisher's page: its imprints and its books, newest first
+func GetPublisher(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	publisher, ok := findPublisher(c, db)
+	if !ok {
+		return
+	}
+	books, err := models.GetPublisherBooks(db, publisher.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch the publisher's books", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, publisherPage{Publisher: publisher, Books: withCovers(books)})
+}
+
+func CreatePublisher(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	var input models.PublisherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	publisher := models.Publisher{Name: input.Name, Slug: slug.Make(input.Name)}
+	if _, err := models.GetPublisherBySlug(db, publisher.Slug); err == nil {
+		apierror.Abort(c, apierror.Conflict("A publisher with this name already exists"))
+		return
+	}
+	if err := db.Create(&publisher).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to create publisher", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionPublisherCreate, TargetType: audit.TargetPublisher, TargetID: publisher.Slug, After: input})
+
+	logging.FromContext(c).WithField("publisher_id", publisher.ID).Info("Publisher created successfully")
+	c.JSON(http.StatusCreated, gin.H{"message": "Publisher created successfully", "data": publisher})
+}
+
+// UpdatePublisher renames a publisher; a new name gives it a new slug
+func UpdatePublisher(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	publisher, ok := findPublisher(c, db)
+	if !ok {
+		return
+	}
+
+	var input models.PublisherInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	newSlug := slug.Make(input.Name)
+	if newSlug != publisher.Slug {
+		if _, err := models.GetPublisherBySlug(db, newSlug); err == nil {
+			apierror.Abort(c, apierror.Conflict("A publisher with this name already exists"))
+			return
+		}
+	}
+
+	before := models.PublisherInput{Name: publisher.Name}
+	oldSlug := publisher.Slug
+	publisher.Name = input.Name
+	publisher.Slug = newSlug
+	if err := db.Omit("Imprints").Save(&publisher).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update publisher", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionPublisherUpdate, TargetType: audit.TargetPublisher, TargetID: oldSlug, Before: before, After: input})
+
+	logging.FromContext(c).WithField("publisher_id", publisher.ID).Info("Publisher updated successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Publisher updated successfully", "data": publisher})
+}
+
+// DeletePublisher removes a publisher, with its imprints, when no book names it, deleted books included
+func DeletePublisher(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	publisher, ok := findPublisher(c, db)
+	if !ok {
+		return
+	}
+	titles, err := models.CountPublisherTitles(db, publisher.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete publisher", err))
+		return
+	}
+	if titles > 0 {
+		apierror.Abort(c, apierror.Conflict("The publisher has books"))
+		return
+	}
+	if err := models.DeletePublisher(db, publisher); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete publisher", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionPublisherDelete, TargetType: audit.TargetPublisher, TargetID: publisher.Slug, Before: models.PublisherInput{Name: publisher.Name}})
+
+	logging.FromContext(c).WithField("publisher_id", publisher.ID).Info("Publisher deleted successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Publisher deleted successfully"})
+}
+
+// findPublisher loads the publisher named by the :slug parameter, aborting with 404 when there is none
+func findPublisher(c *gin.Context, db *gorm.DB) (models.Publisher, bool) {
+	publisher, err := models.GetPublisherBySlug(db, c.Param("slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Publisher not found"))
+		return publisher, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch publisher", err))
+		return publisher, false
+	}
+	return publisher, true
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/models"
+	"net/http"
+	"testing"
+)
+
+func TestRoutesPublishersAndBookDetails(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	gopl := validBookInput("9780134190440")
+	gopl.Publisher = "Addison-Wesley"
+	gopl.Imprint = "Professional"
+	gopl.Language = "EN-gb"
+	gopl.PageCount = 380
+	gopl.Format = models.FormatPaperback
+	gopl.PublicationDate = "2015-10-26"
+	gopl.AgeRating = 16
+	admin.do(http.MethodPost, "/api/v1/books", gopl).expect(t, http.StatusOK)
+
+	kafka := validBookInput("9783150094525")
+	kafka.Publisher = "Reclam"
+	kafka.Language = "de"
+	kafka.Format = models.FormatEbook
+	kafka.FileSize = 1 << 20
+	admin.do(http.MethodPost, "/api/v1/books", kafka).expect(t, http.StatusOK)
+
+	sicp := validBookInput("9780262510875")
+	sicp.Publisher = "addison wesley"
+	sicp.Language = "en"
+	sicp.Format = models.FormatPaperback
+	admin.do(http.MethodPost, "/api/v1/books", sicp).expect(t, http.StatusOK)
+
+	var book models.Book
+	srv.client().do(http.MethodGet, "/api/v1/books/9780134190440", nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Publisher == nil || book.Publisher.Name != "Addison-Wesley" || book.Imprint == nil || book.Imprint.Name != "Professional" {
+		t.Fatalf("expected the publisher and imprint, got %+v %+v", book.Publisher, book.Imprint)
+	}
+	if book.Language != "en-GB" || book.PageCount != 380 || book.PublicationDate != "2015-10-26" || book.PublishedYear != 2015 || book.AgeRating != 16 {
+		t.Fatalf("unexpected details %+v", book)
+	}
+
+	var apiErr apierror.Envelope
+	invalid := validBookInput("9780552131056")
+	invalid.Imprint = "Corgi"
+	invalid.Language = "not a language"
+	invalid.PublicationDate = "26/10/2015"
+	invalid.Format = "scroll"
+	admin.do(http.MethodPost, "/api/v1/books", invalid).expect(t, http.StatusBadRequest).decode(t, &apiErr)
+	if len(apiErr.Error.Fields) != 4 || apiErr.Error.Fields[0].Field != "imprint" || apiErr.Error.Fields[0].Rule != "excluded_without" {
+		t.Fatalf("unexpected validation error %+v", apiErr.Error)
+	}
+
+	for query, want := range map[string]int{
+		"publisher=addison-wesley":                  2,
+		"language=en":                               2,
+		"language=en-GB":                            1,
+		"format=paperback&max_age_rating=12":        1,
+		"publisher=reclam&format=ebook&language=de": 1,
+		"publisher=nobody":                          0,
+	} {
+		var books []models.Book
+		srv.client().do(http.MethodGet, "/api/v1/books?"+query, nil).expect(t, http.StatusOK).decode(t, &books)
+		if len(books) != want {
+			t.Errorf("%s: expected %d books, got %d", query, want, len(books))
+		}
+	}
+	for _, query := range []string{"format=scroll", "language=%21%21", "max_age_rating=-1", "max_age_rating=old"} {
+		srv.client().do(http.MethodGet, "/api/v1/books?"+query, nil).expect(t, http.StatusBadRequest)
+	}
+
+	var publishers []struct {
+		models.Publisher
+		BookCount int `json:"book_count"`
+	}
+	srv.client().do(http.MethodGet, "/api/v1/publishers", nil).expect(t, http.StatusOK).decode(t, &publishers)
+	if len(publishers) != 2 || publishers[0].Slug != "addison-wesley" || publishers[0].BookCount != 2 || len(publishers[0].Imprints) != 1 {
+		t.Fatalf("unexpected publishers %+v", publishers)
+	}
+	var page struct {
+		models.Publisher
+		Books []models.Book `json:"books"`
+	}
+	srv.client().do(http.MethodGet, "/api/v1/publishers/reclam", nil).expect(t, http.StatusOK).decode(t, &page)
+	if page.Name != "Reclam" || len(page.Books) != 1 || page.Books[0].FileSize != 1<<20 {
+		t.Fatalf("unexpected publisher page %+v", page)
+	}
+	srv.client().do(http.MethodGet, "/api/v1/publishers/nobody", nil).expect(t, http.StatusNotFound)
+
+	// Updating a book without a publisher takes it away, leaving the publisher in place
+	admin.do(http.MethodPut, "/api/v1/books/9783150094525", validBookInput("9783150094525")).expect(t, http.StatusOK)
+	book = models.Book{}
+	srv.client().do(http.MethodGet, "/api/v1/books/9783150094525", nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Publisher != nil || book.Language != "" || book.FileSize != 0 {
+		t.Fatalf("expected the details to be cleared, got %+v", book)
+	}
+
+	admin.do(http.MethodPost, "/api/v1/publishers", models.PublisherInput{Name: "reclam"}).expect(t, http.StatusConflict)
+	admin.do(http.MethodPost, "/api/v1/publishers", models.PublisherInput{Name: "Penguin"}).expect(t, http.StatusCreated)
+	admin.do(http.MethodPut, "/api/v1/publishers/penguin", models.PublisherInput{Name: "Addison Wesley"}).expect(t, http.StatusConflict)
+	admin.do(http.MethodPut, "/api/v1/publishers/addison-wesley", models.PublisherInput{Name: "Addison-Wesley Longman"}).expect(t, http.StatusOK)
+	book = models.Book{}
+	srv.client().do(http.MethodGet, "/api/v1/books/9780262510875", nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Publisher == nil || book.Publisher.Slug != "addison-wesley-longman" {
+		t.Fatalf("expected the renamed publisher, got %+v", book.Publisher)
+	}
+	admin.do(http.MethodDelete, "/api/v1/publishers/addison-wesley-longman", nil).expect(t, http.StatusConflict)
+	admin.do(http.MethodDelete, "/api/v1/publishers/reclam", nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/publishers/reclam", nil).expect(t, http.StatusNotFound)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/v1/publishers", models.PublisherInput{Name: "Mine"}).expect(t, http.StatusForbidden)
+	reader.do(http.MethodDelete, "/api/v1/publishers/penguin", nil).expect(t, http.StatusForbidden)
+}
@@ -6,6 +6,9 @@
 package handlers
 
 import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/metrics"
+	"bookstore/internal/middlewares"
 	"bookstore/internal/models"
 	"bookstore/internal/session_manager"
 	"net/http"
@@ -15,24 +18,30 @@ import (
 )
 
 func InitializeReviewRoutes(router *gin.Engine) {
-	router.GET("/api/getReview/:isbn", GetReviewByISBN)
-	router.POST("/api/post-review/:isbn", PostReview)
+	router.GET("/api/getReview/:isbn", middlewares.Deprecated("/api/v1/books/:isbn/reviews"), GetReviewByISBN)
+	router.POST("/api/post-review/:isbn", middlewares.Deprecated("/api/v1/books/:isbn/reviews"), PostReview)
+
+	v1 := router.Group("/api/v1")
+	v1.GET("/books/:isbn/reviews", GetReviewByISBN)
+	v1.POST("/books/:isbn/reviews", PostReview)
 }
 
 func GetReviewByISBN(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
 	isbn := c.Param("isbn")
 
 	var book models.Book
-	if err := models.DB.Where("isbn = ?", isbn).Preload("Reviews").First(&book).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	if err := db.Where("isbn = ?", isbn).Preload("Reviews").First(&book).Error; err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
 		return
 	}
 
 	reviewDetails := []gin.H{}
 	for _, review := range book.Reviews {
 		var user models.User
-		if err := models.DB.Where("id = ?", review.UserID).First(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user details"})
+		if err := db.Where("id = ?", review.UserID).First(&user).Error; err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to fetch user details", err))
 			return
 		}
 
@@ -48,19 +57,25 @@ func GetReviewByISBN(c *gin.Context) {
 }
 
 func PostReview(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
 	isbn := c.Param("isbn")
-	book, err := models.GetBookByISBN(isbn)
+	book, err := models.GetBookByISBN(db, isbn)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Abort(c, apierror.NotFound("Book not found"))
 		return
 	}
 
 	session, _ := session_manager.Store.Get(c.Request, "session-name")
-	userID := session.Values["user_id"].(uint)
+	userID, exists := session.Values["user_id"].(uint)
+	if !exists {
+		apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
+		return
+	}
 
-	var input models.Review
+	var input models.ReviewInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.Validation(err))
 		return
 	}
 
@@ -73,11 +88,12 @@ func PostReview(c *gin.Context) {
 		CreatedAt: time.Now(),
 	}
 
-	err = models.DB.Create(&review).Error
+	err = db.Create(&review).Error
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post review"})
+		apierror.Abort(c, apierror.Internal("Failed to post review", err))
 		return
 	}
 
+	metrics.ReviewsPosted.Inc()
 	c.JSON(http.StatusCreated, gin.H{"message": "Review posted successfully"})
 }
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPostAndGetReview(t *testing.T) {
+	setupTestDB(t)
+	book := seedBook(t, "1111111111", 10)
+	user := seedUser(t, "reader", 100)
+
+	review := map[string]any{"rating": 4, "comment": "Nice!"}
+	rec := serve(http.MethodPost, "/api/post-review/:isbn", "/api/post-review/"+book.ISBN, review,
+		sessionCookie(t, user.ID, "user"), PostReview)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(http.MethodGet, "/api/getReview/:isbn", "/api/getReview/"+book.ISBN, nil, nil, GetReviewByISBN)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var reviews []map[string]any
+	decode(t, rec, &reviews)
+	if len(reviews) != 1 || reviews[0]["userName"] != "reader" || reviews[0]["comment"] != "Nice!" {
+		t.Fatalf("unexpected reviews %v", reviews)
+	}
+}
+
+func TestReviewUnknownBook(t *testing.T) {
+	setupTestDB(t)
+	if rec := serve(http.MethodGet, "/api/getReview/:isbn", "/api/getReview/404", nil, nil, GetReviewByISBN); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+	rec := serve(http.MethodPost, "/api/post-review/:isbn", "/api/post-review/404", map[string]any{"rating": 1},
+		sessionCookie(t, 1, "user"), PostReview)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
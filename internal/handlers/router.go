@@ -0,0 +1,75 @@
+/*
+   router.go assembles the API: the middleware every request goes through and every route. The
+   server and the tests build their router from here, so they cannot drift apart.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/csrf"
+	"bookstore/internal/logging"
+	"bookstore/internal/metrics"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/tracing"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsToken is the bearer token Prometheus scrapes /metrics with; without one /metrics is not served
+var MetricsToken string
+
+// NewRouter returns an engine with the middleware every request goes through. Spans and access
+// logs come first, then the error renderer and panic recovery, then the security headers, CORS,
+// body limits, metrics, CSRF checks and ISBN normalization.
+func NewRouter(serviceName string, cfg middlewares.SecurityConfig) (*gin.Engine, error) {
+	router := gin.New()
+	// The client address comes from X-Forwarded-For only behind the proxies in TRUSTED_PROXIES
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("configuring TRUSTED_PROXIES: %w", err)
+	}
+	corsMiddleware, err := middlewares.CORS(cfg, csrf.HeaderName, logging.RequestIDHeader)
+	if err != nil {
+		return nil, fmt.Errorf("configuring CORS: %w", err)
+	}
+
+	router.Use(tracing.Middleware(serviceName))
+	router.Use(logging.Middleware())
+	router.Use(apierror.Middleware())
+	router.Use(apierror.Recovery())
+	router.Use(middlewares.SecurityHeaders(cfg))
+	router.Use(corsMiddleware)
+	router.Use(middlewares.BodyLimit(cfg.MaxBodySize, BodyLimits))
+	router.Use(metrics.Middleware())
+	router.Use(csrf.Middleware())
+	router.Use(middlewares.NormalizeISBN())
+	return router, nil
+}
+
+// RegisterRoutes adds every route of the API to router
+func RegisterRoutes(router *gin.Engine) {
+	InitializeRoutes(router)
+	InitializeBookRoutes(router)
+	InitializeAdminRoutes(router)
+	InitializeAuthorRoutes(router)
+	InitializeTaxonomyRoutes(router)
+	InitializeSeriesRoutes(router)
+	InitializePublisherRoutes(router)
+	InitializeTrashRoutes(router)
+	InitializeReviewRoutes(router)
+	InitializeTransactionRoutes(router)
+	InitializeBookFileRoutes(router)
+	InitializeCoverRoutes(router)
+	InitializeWatermarkRoutes(router)
+	InitializeCatalogRoutes(router)
+	InitializeMetadataRoutes(router)
+	InitializeAuditRoutes(router)
+	InitializeDocsRoutes(router)
+	InitializeCSRFRoutes(router)
+	InitializeHealthRoutes(router)
+	if MetricsToken != "" {
+		router.GET("/metrics", metrics.Handler(MetricsToken))
+	}
+	router.NoRoute(apierror.NoRoute)
+}
@@ -0,0 +1,623 @@
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/csrf"
+	"bookstore/internal/delivery"
+	"bookstore/internal/metrics"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func validBookInput(isbn string) models.BookInput {
+	return models.BookInput{
+		Title:         "The Go Programming Language",
+		Author:        "Alan Donovan",
+		Description:   "Go book",
+		ISBN:          isbn,
+		PublishedYear: 2015,
+		Price:         40,
+		DownloadLink:  "https://example.com/" + isbn,
+	}
+}
+
+func TestRoutesRegistrationAndSession(t *testing.T) {
+	srv := newTestServer(t)
+	reader := srv.client()
+	reader.register("reader", "secret")
+
+	var balance map[string]float64
+	reader.do(http.MethodGet, "/api/getBalance", nil).expect(t, http.StatusOK).decode(t, &balance)
+	if balance["balance"] != 5000 {
+		t.Fatalf("expected the starting balance of 5000, got %v", balance)
+	}
+
+	// Registering the same email or username again fails
+	dup := srv.client()
+	dup.do(http.MethodPost, "/api/auth/register", models.Input{Username: "other", Email: "reader@example.com", Password: "x"}).
+		expect(t, http.StatusConflict)
+	dup.do(http.MethodPost, "/api/auth/register", models.Input{Username: "reader", Email: "other@example.com", Password: "x"}).
+		expect(t, http.StatusConflict)
+	dup.do(http.MethodPost, "/api/auth/register", models.Input{Username: "bad", Email: "not-an-email", Password: "x"}).
+		expect(t, http.StatusBadRequest)
+
+	reader.do(http.MethodGet, "/api/auth/logout", nil).expect(t, http.StatusOK)
+	reader.do(http.MethodGet, "/api/getBalance", nil).expect(t, http.StatusUnauthorized)
+	reader.do(http.MethodGet, "/api/auth/logout", nil).expect(t, http.StatusNotFound)
+}
+
+func TestRoutesLoginFailures(t *testing.T) {
+	srv := newTestServer(t)
+	srv.client().register("reader", "secret")
+
+	anon := srv.client()
+	anon.do(http.MethodPost, "/api/auth/login", models.Input{Username: "-", Email: "reader@example.com", Password: "wrong"}).
+		expect(t, http.StatusUnauthorized)
+	anon.do(http.MethodPost, "/api/auth/login", models.Input{Username: "-", Email: "nobody@example.com", Password: "secret"}).
+		expect(t, http.StatusUnauthorized)
+	anon.do(http.MethodPost, "/api/auth/login", map[string]string{"email": "reader@example.com"}).
+		expect(t, http.StatusBadRequest)
+}
+
+func TestRoutesDeleteAccount(t *testing.T) {
+	srv := newTestServer(t)
+	reader := srv.client()
+	reader.register("reader", "secret")
+
+	input := models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}
+	reader.do(http.MethodDelete, "/api/auth/delete-account", models.Input{Username: "reader", Email: input.Email, Password: "wrong"}).
+		expect(t, http.StatusUnauthorized)
+	reader.do(http.MethodDelete, "/api/auth/delete-account", input).expect(t, http.StatusOK)
+	reader.do(http.MethodDelete, "/api/auth/delete-account", input).expect(t, http.StatusConflict)
+	srv.client().do(http.MethodPost, "/api/auth/login", input).expect(t, http.StatusForbidden)
+}
+
+func TestRoutesAdminBookCRUD(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	input := validBookInput("9780134190440")
+	admin.do(http.MethodPost, "/api/books/create-book", input).expect(t, http.StatusOK)
+	admin.do(http.MethodPost, "/api/books/create-book", input).expect(t, http.StatusConflict)
+	admin.do(http.MethodPost, "/api/books/create-book", map[string]string{"title": "missing fields"}).
+		expect(t, http.StatusBadRequest)
+
+	var books []models.Book
+	srv.client().do(http.MethodGet, "/api/books", nil).expect(t, http.StatusOK).decode(t, &books)
+	if len(books) != 1 || books[0].ISBN != input.ISBN {
+		t.Fatalf("expected the created book in the listing, got %+v", books)
+	}
+
+	var book models.Book
+	srv.client().do(http.MethodGet, "/api/books/1", nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Title != input.Title {
+		t.Fatalf("expected title %q, got %q", input.Title, book.Title)
+	}
+
+	input.Price = 25
+	admin.do(http.MethodPut, "/api/books/"+input.ISBN, input).expect(t, http.StatusOK)
+	srv.client().do(http.MethodGet, "/api/books/1", nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Price != 25 {
+		t.Fatalf("expected the updated price 25, got %v", book.Price)
+	}
+	admin.do(http.MethodPut, "/api/books/0000000000", input).expect(t, http.StatusNotFound)
+
+	admin.do(http.MethodDelete, "/api/books/"+input.ISBN, nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/books/"+input.ISBN, nil).expect(t, http.StatusNotFound)
+	srv.client().do(http.MethodGet, "/api/books/1", nil).expect(t, http.StatusNotFound)
+}
+
+func TestRoutesISBNForms(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	var apiErr apierror.Envelope
+	admin.do(http.MethodPost, "/api/v1/books", validBookInput("0-13-419044-1")).expect(t, http.StatusBadRequest).decode(t, &apiErr)
+	if len(apiErr.Error.Fields) != 1 || apiErr.Error.Fields[0].Field != "isbn" || apiErr.Error.Fields[0].Rule != "isbn" {
+		t.Fatalf("expected an isbn rule failure, got %+v", apiErr)
+	}
+
+	// A hyphenated ISBN-10 is stored as its ISBN-13, and either form finds the book
+	var created struct {
+		Data models.Book `json:"data"`
+	}
+	admin.do(http.MethodPost, "/api/v1/books", validBookInput("0-13-419044-0")).expect(t, http.StatusOK).decode(t, &created)
+	if created.Data.ISBN != "9780134190440" || created.Data.ISBN10 != "0134190440" {
+		t.Fatalf("expected the canonical ISBN, got %q and %q", created.Data.ISBN, created.Data.ISBN10)
+	}
+	admin.do(http.MethodPost, "/api/v1/books", validBookInput("978-0-13-419044-0")).expect(t, http.StatusConflict)
+	for _, form := range []string{"9780134190440", "0134190440", "978-0-13-419044-0"} {
+		var book models.Book
+		srv.client().do(http.MethodGet, "/api/v1/books/"+form, nil).expect(t, http.StatusOK).decode(t, &book)
+		if book.ISBN != "9780134190440" {
+			t.Fatalf("GET %s: expected the book, got %+v", form, book)
+		}
+	}
+	srv.client().do(http.MethodGet, "/api/v1/books/0134190441", nil).expect(t, http.StatusNotFound)
+
+	// Purchases and ownership checks accept either form too
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: "0-13-419044-0"}).expect(t, http.StatusCreated)
+	var owned map[string]bool
+	reader.do(http.MethodGet, "/api/ownershipStatus/9780134190440", nil).expect(t, http.StatusOK).decode(t, &owned)
+	if !owned["status"] {
+		t.Fatal("expected the book to be owned")
+	}
+
+	// Changing the ISBN to one another book has is a conflict
+	admin.do(http.MethodPost, "/api/v1/books", validBookInput("9781593279288")).expect(t, http.StatusOK)
+	admin.do(http.MethodPut, "/api/v1/books/1593279280", validBookInput("0134190440")).expect(t, http.StatusConflict)
+	admin.do(http.MethodPut, "/api/v1/books/1593279280", validBookInput("1-59327-928-0")).expect(t, http.StatusOK)
+}
+
+func TestRoutesAdminOnly(t *testing.T) {
+	srv := newTestServer(t)
+	seedBook(t, "9780134190440", 40)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	anon := srv.client()
+
+	for _, c := range []*testClient{reader, anon} {
+		c.do(http.MethodPost, "/api/books/create-book", validBookInput("9781593279288")).expect(t, http.StatusForbidden)
+		c.do(http.MethodPut, "/api/books/9780134190440", validBookInput("9780134190440")).expect(t, http.StatusForbidden)
+		c.do(http.MethodDelete, "/api/books/9780134190440", nil).expect(t, http.StatusForbidden)
+	}
+}
+
+func TestRoutesPurchaseFlow(t *testing.T) {
+	srv := newTestServer(t)
+	book := seedBook(t, "9780134190440", 40)
+	seedBook(t, "9781593279288", 6000)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+
+	var status map[string]bool
+	reader.do(http.MethodGet, "/api/ownershipStatus/"+book.ISBN, nil).expect(t, http.StatusOK).decode(t, &status)
+	if status["status"] {
+		t.Fatal("expected the book not to be owned before purchase")
+	}
+
+	var apiErr apierror.Envelope
+	reader.do(http.MethodGet, "/api/getDownloadLink/"+book.ISBN, nil).expect(t, http.StatusForbidden).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeNotOwned {
+		t.Fatalf("expected not_owned before purchase, got %+v", apiErr)
+	}
+
+	reader.do(http.MethodGet, "/api/buy-book/"+book.ISBN, nil).expect(t, http.StatusOK)
+
+	var balance map[string]float64
+	reader.do(http.MethodGet, "/api/getBalance", nil).expect(t, http.StatusOK).decode(t, &balance)
+	if balance["balance"] != 4960 {
+		t.Fatalf("expected balance 4960 after purchase, got %v", balance)
+	}
+
+	reader.do(http.MethodGet, "/api/ownershipStatus/"+book.ISBN, nil).expect(t, http.StatusOK).decode(t, &status)
+	if !status["status"] {
+		t.Fatal("expected the book to be owned after purchase")
+	}
+	var link map[string]any
+	reader.do(http.MethodGet, "/api/getDownloadLink/"+book.ISBN, nil).expect(t, http.StatusOK).decode(t, &link)
+	if message, _ := link["message"].(string); !strings.Contains(message, "/api/v1/downloads/"+book.ISBN+"?") {
+		t.Fatalf("expected a signed download URL after purchase, got %v", link)
+	}
+
+	// Buying again is answered by the ownership middleware and does not charge twice
+	reader.do(http.MethodGet, "/api/buy-book/"+book.ISBN, nil).expect(t, http.StatusConflict).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeAlreadyOwned {
+		t.Fatalf("expected already_owned, got %+v", apiErr)
+	}
+	reader.do(http.MethodGet, "/api/getBalance", nil).expect(t, http.StatusOK).decode(t, &balance)
+	if balance["balance"] != 4960 {
+		t.Fatalf("expected balance to stay 4960, got %v", balance)
+	}
+
+	reader.do(http.MethodGet, "/api/buy-book/9781593279288", nil).expect(t, http.StatusForbidden)
+	reader.do(http.MethodGet, "/api/buy-book/0000000000", nil).expect(t, http.StatusNotFound)
+
+	anon := srv.client()
+	anon.do(http.MethodGet, "/api/buy-book/"+book.ISBN, nil).expect(t, http.StatusUnauthorized)
+	anon.do(http.MethodGet, "/api/ownershipStatus/"+book.ISBN, nil).expect(t, http.StatusUnauthorized)
+	anon.do(http.MethodGet, "/api/getDownloadLink/"+book.ISBN, nil).expect(t, http.StatusUnauthorized)
+}
+
+func TestRoutesReviews(t *testing.T) {
+	srv := newTestServer(t)
+	book := seedBook(t, "9780134190440", 40)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/post-review/"+book.ISBN, map[string]any{"rating": 5, "comment": "Nice!"}).
+		expect(t, http.StatusCreated)
+	reader.do(http.MethodPost, "/api/post-review/0000000000", map[string]any{"rating": 5}).
+		expect(t, http.StatusNotFound)
+
+	var reviews []map[string]any
+	srv.client().do(http.MethodGet, "/api/getReview/"+book.ISBN, nil).expect(t, http.StatusOK).decode(t, &reviews)
+	if len(reviews) != 1 || reviews[0]["userName"] != "reader" || reviews[0]["rating"] != float64(5) {
+		t.Fatalf("unexpected reviews %v", reviews)
+	}
+	srv.client().do(http.MethodGet, "/api/getReview/0000000000", nil).expect(t, http.StatusNotFound)
+
+	srv.client().do(http.MethodPost, "/api/post-review/"+book.ISBN, map[string]any{"rating": 1}).
+		expect(t, http.StatusUnauthorized)
+}
+
+func TestRoutesBusinessMetrics(t *testing.T) {
+	srv := newTestServer(t)
+	book := seedBook(t, "9780134190440", 40)
+
+	registrations := testutil.ToFloat64(metrics.Registrations)
+	successes := testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginSuccess))
+	failures := testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginFailure))
+	purchases := testutil.ToFloat64(metrics.Purchases)
+	revenue := testutil.ToFloat64(metrics.Revenue)
+	reviews := testutil.ToFloat64(metrics.ReviewsPosted)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	srv.client().do(http.MethodPost, "/api/auth/login", models.Input{Username: "-", Email: "reader@example.com", Password: "wrong"}).
+		expect(t, http.StatusUnauthorized)
+	reader.do(http.MethodGet, "/api/buy-book/"+book.ISBN, nil).expect(t, http.StatusOK)
+	reader.do(http.MethodGet, "/api/buy-book/"+book.ISBN, nil).expect(t, http.StatusConflict) // already owned, not counted
+	reader.do(http.MethodPost, "/api/post-review/"+book.ISBN, map[string]any{"rating": 4}).expect(t, http.StatusCreated)
+
+	checks := []struct {
+		name       string
+		before     float64
+		collector  prometheus.Collector
+		wantChange float64
+	}{
+		{"registrations", registrations, metrics.Registrations, 1},
+		{"login successes", successes, metrics.Logins.WithLabelValues(metrics.LoginSuccess), 1},
+		{"login failures", failures, metrics.Logins.WithLabelValues(metrics.LoginFailure), 1},
+		{"purchases", purchases, metrics.Purchases, 1},
+		{"revenue", revenue, metrics.Revenue, 40},
+		{"reviews", reviews, metrics.ReviewsPosted, 1},
+	}
+	for _, check := range checks {
+		if got := testutil.ToFloat64(check.collector) - check.before; got != check.wantChange {
+			t.Errorf("%s: expected change %v, got %v", check.name, check.wantChange, got)
+		}
+	}
+}
+
+func TestRoutesV1(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.do(http.MethodPost, "/api/v1/auth/login", models.Input{Username: "-", Email: "admin@example.com", Password: "admin-pass"}).
+		expect(t, http.StatusOK)
+
+	input := validBookInput("9780134190440")
+	admin.do(http.MethodPost, "/api/v1/books", input).expect(t, http.StatusOK)
+	srv.client().do(http.MethodPost, "/api/v1/books", validBookInput("9781593279288")).expect(t, http.StatusForbidden)
+
+	reader := srv.client()
+	reader.do(http.MethodPost, "/api/v1/auth/register", models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}).
+		expect(t, http.StatusCreated)
+	reader.do(http.MethodPost, "/api/v1/auth/login", models.Input{Username: "-", Email: "reader@example.com", Password: "secret"}).
+		expect(t, http.StatusOK)
+
+	var me map[string]any
+	reader.do(http.MethodGet, "/api/v1/me", nil).expect(t, http.StatusOK).decode(t, &me)
+	if me["username"] != "reader" || me["role"] != "user" {
+		t.Fatalf("unexpected profile %v", me)
+	}
+
+	var book models.Book
+	reader.do(http.MethodGet, "/api/v1/books/"+input.ISBN, nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Title != input.Title {
+		t.Fatalf("expected title %q, got %q", input.Title, book.Title)
+	}
+	reader.do(http.MethodGet, "/api/v1/books/0000000000", nil).expect(t, http.StatusNotFound)
+
+	// Buying goes through POST /orders and shows up in the user's library
+	reader.do(http.MethodPost, "/api/v1/orders", map[string]string{}).expect(t, http.StatusBadRequest)
+	resp := reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: input.ISBN}).expect(t, http.StatusCreated)
+	var created struct {
+		Data models.Order `json:"data"`
+	}
+	resp.decode(t, &created)
+	if created.Data.ISBN != input.ISBN || created.Data.Amount != 40 || created.Data.ID == 0 {
+		t.Fatalf("unexpected order %+v", created.Data)
+	}
+	location := resp.Header.Get("Location")
+	reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: input.ISBN}).expect(t, http.StatusConflict)
+
+	var order models.Order
+	reader.do(http.MethodGet, location, nil).expect(t, http.StatusOK).decode(t, &order)
+	if order.ID != created.Data.ID || order.Title != input.Title {
+		t.Fatalf("expected order %+v at %s, got %+v", created.Data, location, order)
+	}
+	var orders []models.Order
+	reader.do(http.MethodGet, "/api/v1/orders", nil).expect(t, http.StatusOK).decode(t, &orders)
+	if len(orders) != 1 {
+		t.Fatalf("expected one order, got %+v", orders)
+	}
+	admin.do(http.MethodGet, location, nil).expect(t, http.StatusNotFound)
+
+	var balance map[string]float64
+	reader.do(http.MethodGet, "/api/v1/wallet", nil).expect(t, http.StatusOK).decode(t, &balance)
+	if balance["balance"] != 4960 {
+		t.Fatalf("expected balance 4960, got %v", balance)
+	}
+
+	var owned []models.Book
+	reader.do(http.MethodGet, "/api/v1/me/books", nil).expect(t, http.StatusOK).decode(t, &owned)
+	if len(owned) != 1 || owned[0].ISBN != input.ISBN {
+		t.Fatalf("expected the bought book in the library, got %+v", owned)
+	}
+	var status map[string]bool
+	reader.do(http.MethodGet, "/api/v1/me/books/"+input.ISBN, nil).expect(t, http.StatusOK).decode(t, &status)
+	if !status["status"] {
+		t.Fatal("expected the book to be owned")
+	}
+	reader.do(http.MethodGet, "/api/v1/me/books/"+input.ISBN+"/download", nil).expect(t, http.StatusOK)
+
+	reader.do(http.MethodPost, "/api/v1/books/"+input.ISBN+"/reviews", map[string]any{"rating": 6}).expect(t, http.StatusBadRequest)
+	reader.do(http.MethodPost, "/api/v1/books/"+input.ISBN+"/reviews", map[string]any{"rating": 5}).expect(t, http.StatusCreated)
+	var reviews []map[string]any
+	srv.client().do(http.MethodGet, "/api/v1/books/"+input.ISBN+"/reviews", nil).expect(t, http.StatusOK).decode(t, &reviews)
+	if len(reviews) != 1 {
+		t.Fatalf("expected one review, got %v", reviews)
+	}
+
+	reader.do(http.MethodPost, "/api/v1/auth/logout", nil).expect(t, http.StatusOK)
+	reader.do(http.MethodGet, "/api/v1/me", nil).expect(t, http.StatusUnauthorized)
+	reader.do(http.MethodDelete, "/api/v1/me", models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}).
+		expect(t, http.StatusOK)
+
+	admin.do(http.MethodDelete, "/api/v1/books/"+input.ISBN, nil).expect(t, http.StatusOK)
+	admin.do(http.MethodGet, "/api/v1/admin/audit-logs", nil).expect(t, http.StatusOK)
+}
+
+func TestRoutesLegacyAliasesAreDeprecated(t *testing.T) {
+	srv := newTestServer(t)
+	book := seedBook(t, "9780134190440", 40)
+	reader := srv.client()
+	reader.register("reader", "secret")
+
+	resp := reader.do(http.MethodGet, "/api/getReview/"+book.ISBN, nil).expect(t, http.StatusOK)
+	if resp.Header.Get("Deprecation") == "" {
+		t.Fatal("expected a Deprecation header on a legacy route")
+	}
+	if link := resp.Header.Get("Link"); link != `</api/v1/books/9780134190440/reviews>; rel="successor-version"` {
+		t.Fatalf("unexpected Link header %q", link)
+	}
+
+	// The book details moved from IDs to ISBNs, so their successor is the book's own URL
+	resp = reader.do(http.MethodGet, fmt.Sprintf("/api/books/%d", book.ID), nil).expect(t, http.StatusOK)
+	if link := resp.Header.Get("Link"); link != `</api/v1/books/9780134190440>; rel="successor-version"` || resp.Header.Get("Deprecation") == "" {
+		t.Fatalf("unexpected Link header %q", link)
+	}
+
+	// Errors from legacy routes are flagged too
+	resp = srv.client().do(http.MethodGet, "/api/getBalance", nil).expect(t, http.StatusUnauthorized)
+	if resp.Header.Get("Deprecation") == "" {
+		t.Fatal("expected a Deprecation header on a rejected legacy request")
+	}
+
+	resp = reader.do(http.MethodGet, "/api/v1/books/"+book.ISBN+"/reviews", nil).expect(t, http.StatusOK)
+	if resp.Header.Get("Deprecation") != "" {
+		t.Fatal("expected no Deprecation header on /api/v1")
+	}
+}
+
+func TestRoutesServeCORSAndMetrics(t *testing.T) {
+	srv := newTestServer(t)
+
+	header := http.Header{"Origin": {testFrontendOrigin}, "Access-Control-Request-Method": {http.MethodPost}}
+	resp := srv.clientWithoutCSRF().send(http.MethodOptions, "/api/v1/orders", nil, header)
+	if resp.Header.Get("Access-Control-Allow-Origin") != testFrontendOrigin || resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected the frontend to be allowed by CORS, got %d %v", resp.Code, resp.Header)
+	}
+	header.Set("Origin", "https://evil.example.com")
+	resp = srv.clientWithoutCSRF().send(http.MethodOptions, "/api/v1/orders", nil, header)
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected other origins to be refused, got %v", resp.Header)
+	}
+
+	srv.clientWithoutCSRF().send(http.MethodGet, "/metrics", nil, nil).expect(t, http.StatusUnauthorized)
+	resp = srv.clientWithoutCSRF().send(http.MethodGet, "/metrics", nil, http.Header{"Authorization": {"Bearer " + testMetricsToken}}).expect(t, http.StatusOK)
+	if !strings.Contains(string(resp.Body), "http_requests_total") {
+		t.Fatalf("expected the request metrics, got %.200s", resp.Body)
+	}
+}
+
+func TestRoutesRecoverFromPanics(t *testing.T) {
+	srv := newTestServer(t)
+	srv.router.GET("/api/v1/panic", func(c *gin.Context) { panic("unexpected") })
+
+	var apiErr apierror.Envelope
+	resp := srv.client().do(http.MethodGet, "/api/v1/panic", nil).expect(t, http.StatusInternalServerError)
+	resp.decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeInternal || apiErr.Error.RequestID == "" {
+		t.Fatalf("expected the internal error envelope with a request id, got %+v", apiErr)
+	}
+	if resp.Header.Get("Content-Security-Policy") == "" {
+		t.Fatal("expected the security headers on a recovered response")
+	}
+
+	// The server keeps serving
+	srv.client().do(http.MethodGet, "/api/v1/books", nil).expect(t, http.StatusOK)
+}
+
+func TestRoutesRequireCSRFToken(t *testing.T) {
+	srv := newTestServer(t)
+	book := seedBook(t, "9780134190440", 40)
+	reader := srv.client()
+	reader.register("reader", "secret")
+
+	// A forged request rides on the reader's session cookie but cannot know the token
+	forged := srv.clientWithoutCSRF()
+	forged.http.Jar = reader.http.Jar
+
+	var apiErr apierror.Envelope
+	forged.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: book.ISBN}).expect(t, http.StatusForbidden).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeCSRF {
+		t.Fatalf("expected %s, got %+v", apierror.CodeCSRF, apiErr)
+	}
+	forged.do(http.MethodGet, "/api/buy-book/"+book.ISBN, nil).expect(t, http.StatusForbidden)
+	forged.do(http.MethodDelete, "/api/v1/me", models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}).
+		expect(t, http.StatusForbidden)
+	forged.do(http.MethodGet, "/api/auth/logout", nil).expect(t, http.StatusForbidden)
+
+	// Reads need no token, and nothing was bought
+	var status map[string]bool
+	forged.do(http.MethodGet, "/api/v1/me/books/"+book.ISBN, nil).expect(t, http.StatusOK).decode(t, &status)
+	if status["status"] {
+		t.Fatal("expected the forged purchase to be refused")
+	}
+
+	reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: book.ISBN}).expect(t, http.StatusCreated)
+}
+
+func TestRoutesRotateCSRFTokenOnLoginAndLogout(t *testing.T) {
+	srv := newTestServer(t)
+	book := seedBook(t, "9780134190440", 40)
+	reader := srv.client()
+	reader.do(http.MethodPost, "/api/auth/register", models.Input{Username: "reader", Email: "reader@example.com", Password: "secret"}).
+		expect(t, http.StatusCreated)
+	anonymous := reader.csrfToken
+
+	// The token from before logging in, which another page may have seen, no longer works
+	reader.login("reader@example.com", "secret")
+	if reader.csrfToken == anonymous {
+		t.Fatal("expected logging in to issue a new CSRF token")
+	}
+	stale := srv.clientWithoutCSRF()
+	stale.http.Jar = reader.http.Jar
+	order := strings.NewReader(`{"isbn": "` + book.ISBN + `"}`)
+	stale.send(http.MethodPost, "/api/v1/orders", order, http.Header{"Content-Type": {"application/json"}, csrf.HeaderName: {anonymous}}).
+		expect(t, http.StatusForbidden)
+	reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: book.ISBN}).expect(t, http.StatusCreated)
+
+	loggedIn := reader.csrfToken
+	reader.do(http.MethodPost, "/api/v1/auth/logout", nil).expect(t, http.StatusOK)
+	if reader.csrfToken == loggedIn {
+		t.Fatal("expected logging out to issue a new CSRF token")
+	}
+	var token map[string]string
+	reader.do(http.MethodGet, "/api/v1/csrf-token", nil).expect(t, http.StatusOK).decode(t, &token)
+	if token["csrf_token"] != reader.csrfToken {
+		t.Fatalf("expected the session to keep the token issued on logout, got %q", token["csrf_token"])
+	}
+}
+
+func TestRoutesSecurityHeadersAndBodyLimits(t *testing.T) {
+	srv := newTestServer(t)
+	client := srv.client()
+
+	resp := client.do(http.MethodGet, "/api/v1/books", nil).expect(t, http.StatusOK)
+	if resp.Header.Get("Content-Security-Policy") != middlewares.DefaultCSP || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("expected the security headers on API responses, got %v", resp.Header)
+	}
+	resp = client.do(http.MethodGet, "/docs", nil).expect(t, http.StatusOK)
+	if csp := resp.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self'") ||
+		strings.Contains(csp, "https:") || strings.Contains(csp, "'unsafe-inline'") {
+		t.Fatalf("expected the docs page to load only its own assets, got %q", csp)
+	}
+
+	// Registration is capped well below the server-wide default
+	big := models.Input{Username: strings.Repeat("a", 8<<10), Email: "big@example.com", Password: "secret"}
+	var apiErr apierror.Envelope
+	client.do(http.MethodPost, "/api/v1/auth/register", big).expect(t, http.StatusRequestEntityTooLarge).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodePayloadTooLarge {
+		t.Fatalf("expected %s, got %+v", apierror.CodePayloadTooLarge, apiErr)
+	}
+}
+
+func TestRoutesSignedDownloads(t *testing.T) {
+	srv := newTestServer(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.7 book"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	book := seedBook(t, "9780134190440", 40)
+	if err := models.DB.Model(&models.BookDownload{}).Where("book_id = ?", book.ID).Update("download_link", upstream.URL+"/files/gopl.pdf").Error; err != nil {
+		t.Fatalf("pointing the download link at the test upstream: %v", err)
+	}
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: book.ISBN}).expect(t, http.StatusCreated)
+	other := srv.client()
+	other.register("other", "secret")
+
+	var link struct {
+		Message        string    `json:"message"`
+		ExpiresAt      time.Time `json:"expires_at"`
+		DownloadsUsed  int       `json:"downloads_used"`
+		DownloadsLimit int       `json:"downloads_limit"`
+	}
+	reader.do(http.MethodGet, "/api/v1/me/books/"+book.ISBN+"/download", nil).expect(t, http.StatusOK).decode(t, &link)
+	if link.DownloadsUsed != 0 || link.DownloadsLimit != 2 || time.Until(link.ExpiresAt) > 5*time.Minute {
+		t.Fatalf("unexpected download link %+v", link)
+	}
+	signedPath := strings.TrimPrefix(link.Message, srv.server.URL)
+
+	// The URL itself is the credential, so it works without a session
+	anon := srv.clientWithoutCSRF()
+	resp := anon.do(http.MethodGet, signedPath, nil).expect(t, http.StatusOK)
+	if string(resp.Body) != "%PDF-1.7 book" || resp.Header.Get("Content-Type") != "application/pdf" ||
+		resp.Header.Get("Content-Disposition") != `attachment; filename="9780134190440.pdf"` {
+		t.Fatalf("unexpected download %v %q", resp.Header, resp.Body)
+	}
+
+	var apiErr apierror.Envelope
+	tampered := strings.Replace(signedPath, "user=1", "user=2", 1)
+	anon.do(http.MethodGet, tampered, nil).expect(t, http.StatusForbidden).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeDownloadLinkInvalid {
+		t.Fatalf("expected download_link_invalid for a tampered URL, got %+v", apiErr)
+	}
+	expired, _ := delivery.SignedURL("", 1, book.ISBN, time.Now().Add(-time.Hour))
+	anon.do(http.MethodGet, expired, nil).expect(t, http.StatusForbidden).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeDownloadLinkInvalid || !strings.Contains(apiErr.Error.Message, "expired") {
+		t.Fatalf("expected an expired link to be refused, got %+v", apiErr)
+	}
+	notOwned, _ := delivery.SignedURL("", 2, book.ISBN, time.Now())
+	anon.do(http.MethodGet, notOwned, nil).expect(t, http.StatusForbidden).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeNotOwned {
+		t.Fatalf("expected not_owned for a user who did not buy the book, got %+v", apiErr)
+	}
+
+	// Opening the same URL again continues that download and is not counted again
+	anon.do(http.MethodGet, signedPath, nil).expect(t, http.StatusOK)
+
+	// The second URL uses up the limit of 2; both the link and the proxy then refuse
+	var second, third struct {
+		Message string `json:"message"`
+	}
+	reader.do(http.MethodGet, "/api/v1/me/books/"+book.ISBN+"/download", nil).expect(t, http.StatusOK).decode(t, &second)
+	reader.do(http.MethodGet, "/api/v1/me/books/"+book.ISBN+"/download", nil).expect(t, http.StatusOK).decode(t, &third)
+	anon.do(http.MethodGet, strings.TrimPrefix(second.Message, srv.server.URL), nil).expect(t, http.StatusOK)
+	anon.do(http.MethodGet, strings.TrimPrefix(third.Message, srv.server.URL), nil).expect(t, http.StatusTooManyRequests).decode(t, &apiErr)
+	if apiErr.Error.Code != apierror.CodeDownloadLimit {
+		t.Fatalf("expected download_limit_reached, got %+v", apiErr)
+	}
+	reader.do(http.MethodGet, "/api/v1/me/books/"+book.ISBN+"/download", nil).expect(t, http.StatusTooManyRequests)
+
+	used, err := models.CountDownloadsSince(models.DB, 1, book.ID, time.Now().Add(-time.Hour))
+	if err != nil || used != 2 {
+		t.Fatalf("expected 2 recorded downloads, got %d (%v)", used, err)
+	}
+}
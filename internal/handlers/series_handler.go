@@ -0,0 +1,517 @@
+/*
+   series_handler.go contains HTTP request handlers for grouping books: series, whose books are
+   read in volume order, and works, whose books are editions of the same text with their own
+   ISBN and price. Anyone can read a series in order or the editions of a work; admins create
+   the groupings and place books in them.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"bookstore/internal/slug"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func InitializeSeriesRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1")
+	v1.GET("/series", GetAllSeries)
+	v1.GET("/series/:slug", GetSeries)
+	v1.GET("/works/:id", GetWork)
+	v1.GET("/books/:isbn/editions", GetBookEditions)
+
+	admin := router.Group("/api/v1", middlewares.AdminOnly())
+	admin.POST("/series", CreateSeries)
+	admin.PUT("/series/:slug", UpdateSeries)
+	admin.DELETE("/series/:slug", DeleteSeries)
+	admin.PUT("/series/:slug/books/:isbn", SetSeriesVolume)
+	admin.DELETE("/series/:slug/books/:isbn", RemoveSeriesVolume)
+	admin.POST("/works", CreateWork)
+	admin.PUT("/works/:id", UpdateWork)
+	admin.DELETE("/works/:id", DeleteWork)
+	admin.PUT("/works/:id/editions/:isbn", SetWorkEdition)
+	admin.DELETE("/works/:id/editions/:isbn", RemoveWorkEdition)
+}
+
+// seriesSummary is a series in the list of series
+type seriesSummary struct {
+	models.Series
+	BookCount int `json:"book_count"`
+}
+
+// seriesPage is a series with its books in order
+type seriesPage struct {
+	models.Series
+	Books []models.Book `json:"books"`
+}
+
+// workPage is a work with its editions
+type workPage struct {
+	models.Work
+	Editions []models.Book `json:"editions"`
+}
+
+// volumeChange is the audited placement of a book in a series
+type volumeChange struct {
+	ISBN   string  `json:"isbn"`
+	Volume float64 `json:"volume,omitempty"`
+}
+
+// editionChange is the audited placement of a book in a work
+type editionChange struct {
+	ISBN    string `json:"isbn"`
+	Edition string `json:"edition,omitempty"`
+}
+
+// GetAllSeries lists the series by name, with their number of books
+func GetAllSeries(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	series, err := models.GetAllSeries(db)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch series", err))
+		return
+	}
+	counts, err := models.CountSeriesBooks(db)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch series", err))
+		return
+	}
+
+	summaries := make([]seriesSummary, len(series))
+	for i, s := range series {
+		summaries[i] = seriesSummary{Series: s, BookCount: counts[s.ID]}
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
+// GetSeries returns a series with its books in volume order
+func GetSeries(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	series, ok := findSeries(c, db)
+	if !ok {
+		return
+	}
+	books, err := models.GetSeriesBooks(db, series.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch the series' books", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, seriesPage{Series: series, Books: withCovers(books)})
+}
+
+// GetWork returns a work with its editions
+func GetWork(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	work, ok := findWork(c, db)
+	if !ok {
+		return
+	}
+	editions, err := models.GetEditions(db, work.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch the work's editions", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, workPage{Work: work, Editions: withCovers(editions)})
+}
+
+// GetBookEditions lists every edition of the work a book belongs to, the book included; a book
+// that belongs to no work is its only edition
+func GetBookEditions(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
+	book, err := models.GetBookByISBN(db, c.Param("isbn"))
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return
+	}
+	editions := []models.Book{book}
+	if book.WorkID != nil {
+		if editions, err = models.GetEditions(db, *book.WorkID); err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to fetch the book's editions", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, withCovers(editions))
+}
+
+func CreateSeries(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	var input models.SeriesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	series := models.Series{Name: input.Name, Slug: slug.Make(input.Name), Description: input.Description}
+	if _, err := models.GetSeriesBySlug(db, series.Slug); err == nil {
+		apierror.Abort(c, apierror.Conflict("A series with this name already exists"))
+		return
+	}
+	if err := db.Create(&series).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to create series", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionSeriesCreate, TargetType: audit.TargetSeries, TargetID: series.Slug, After: input})
+
+	logging.FromContext(c).WithField("series_id", series.ID).Info("Series created successfully")
+	c.JSON(http.StatusCreated, gin.H{"message": "Series created successfully", "data": series})
+}
+
+// UpdateSeries renames or describes a series; a new name gives it a new slug
+func UpdateSeries(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	series, ok := findSeries(c, db)
+	if !ok {
+		return
+	}
+
+	var input models.SeriesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	newSlug := slug.Make(input.Name)
+	if newSlug != series.Slug {
+		if _, err := models.GetSeriesBySlug(db, newSlug); err == nil {
+			apierror.Abort(c, apierror.Conflict("A series with this name already exists"))
+			return
+		}
+	}
+
+	before := models.SeriesInput{Name: series.Name, Description: series.Description}
+	oldSlug := series.Slug
+	series.Name = input.Name
+	series.Slug = newSlug
+	series.Description = input.Description
+	if err := db.Save(&series).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update series", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionSeriesUpdate, TargetType: audit.TargetSeries, TargetID: oldSlug, Before: before, After: input})
+
+	logging.FromContext(c).WithField("series_id", series.ID).Info("Series updated successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Series updated successfully", "data": series})
+}
+
+// DeleteSeries deletes a series; its books stay in the catalog outside of any series
+func DeleteSeries(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	series, ok := findSeries(c, db)
+	if !ok {
+		return
+	}
+	if err := models.DeleteSeries(db, series); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete series", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionSeriesDelete,
+		TargetType: audit.TargetSeries,
+		TargetID:   series.Slug,
+		Before:     models.SeriesInput{Name: series.Name, Description: series.Description},
+	})
+
+	logging.FromContext(c).WithField("series_id", series.ID).Info("Series deleted successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Series deleted successfully"})
+}
+
+// SetSeriesVolume places a book in a series as a volume, moving it out of its previous series
+func SetSeriesVolume(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	series, ok := findSeries(c, db)
+	if !ok {
+		return
+	}
+	book, err := models.GetBookByISBN(db, c.Param("isbn"))
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return
+	}
+
+	var input models.VolumeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	var before *volumeChange
+	if book.Series != nil && book.Series.ID == series.ID {
+		before = &volumeChange{ISBN: book.ISBN, Volume: book.SeriesVolume}
+	}
+	if err := models.SetBookSeries(db, &book, series, input.Volume); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update series", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionSeriesUpdate,
+		TargetType: audit.TargetSeries,
+		TargetID:   series.Slug,
+		Before:     before,
+		After:      volumeChange{ISBN: book.ISBN, Volume: input.Volume},
+	})
+
+	logging.FromContext(c).WithField("series_id", series.ID).WithField("isbn", book.ISBN).Info("Series volume set successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Series volume set successfully", "data": withCovers([]models.Book{book})[0]})
+}
+
+// RemoveSeriesVolume takes a book out of a series
+func RemoveSeriesVolume(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	series, ok := findSeries(c, db)
+	if !ok {
+		return
+	}
+	book, err := models.GetBookByISBN(db, c.Param("isbn"))
+	if err != nil || book.SeriesID == nil || *book.SeriesID != series.ID {
+		apierror.Abort(c, apierror.NotFound("Book not found in this series"))
+		return
+	}
+
+	before := volumeChange{ISBN: book.ISBN, Volume: book.SeriesVolume}
+	if err := models.RemoveBookSeries(db, &book); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update series", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionSeriesUpdate, TargetType: audit.TargetSeries, TargetID: series.Slug, Before: before})
+
+	logging.FromContext(c).WithField("series_id", series.ID).WithField("isbn", book.ISBN).Info("Book removed from series successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Book removed from series successfully"})
+}
+
+func CreateWork(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	var input models.WorkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	work := models.Work{Title: input.Title}
+	if err := db.Create(&work).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to create work", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionWorkCreate, TargetType: audit.TargetWork, TargetID: strconv.FormatUint(uint64(work.ID), 10), After: input})
+
+	logging.FromContext(c).WithField("work_id", work.ID).Info("Work created successfully")
+	c.JSON(http.StatusCreated, gin.H{"message": "Work created successfully", "data": work})
+}
+
+// UpdateWork renames a work
+func UpdateWork(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	work, ok := findWork(c, db)
+	if !ok {
+		return
+	}
+
+	var input models.WorkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	before := models.WorkInput{Title: work.Title}
+	work.Title = input.Title
+	if err := db.Save(&work).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update work", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionWorkUpdate, TargetType: audit.TargetWork, TargetID: c.Param("id"), Before: before, After: input})
+
+	logging.FromContext(c).WithField("work_id", work.ID).Info("Work updated successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Work updated successfully", "data": work})
+}
+
+// DeleteWork deletes a work; its editions stay in the catalog as books of their own
+func DeleteWork(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	work, ok := findWork(c, db)
+	if !ok {
+		return
+	}
+	if err := models.DeleteWork(db, work); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete work", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionWorkDelete, TargetType: audit.TargetWork, TargetID: c.Param("id"), Before: models.WorkInput{Title: work.Title}})
+
+	logging.FromContext(c).WithField("work_id", work.ID).Info("Work deleted successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Work deleted successfully"})
+}
+
+// SetWorkEdition makes a book an edition of a work, moving it out of its previous work
+func SetWorkEdition(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	work, ok := findWork(c, db)
+	if !ok {
+		return
+	}
+	book, err := models.GetBookByISBN(db, c.Param("isbn"))
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return
+	}
+
+	var input models.EditionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	var before *editionChange
+	if book.WorkID != nil && *book.WorkID == work.ID {
+		before = &editionChange{ISBN: book.ISBN, Edition: book.Edition}
+	}
+	if err := models.SetBookWork(db, &book, work, input.Edition); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update work", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionWorkUpdate,
+		TargetType: audit.TargetWork,
+		TargetID:   c.Param("id"),
+		Before:     before,
+		After:      editionChange{ISBN: book.ISBN, Edition: input.Edition},
+	})
+
+	logging.FromContext(c).WithField("work_id", work.ID).WithField("isbn", book.ISBN).Info("Edition set successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Edition set successfully", "data": withCovers([]models.Book{book})[0]})
+}
+
+// RemoveWorkEdition takes a book out of a work
+func RemoveWorkEdition(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	work, ok := findWork(c, db)
+	if !ok {
+		return
+	}
+	book, err := models.GetBookByISBN(db, c.Param("isbn"))
+	if err != nil || book.WorkID == nil || *book.WorkID != work.ID {
+		apierror.Abort(c, apierror.NotFound("Book not found in this work"))
+		return
+	}
+
+	before := editionChange{ISBN: book.ISBN, Edition: book.Edition}
+	if err := models.RemoveBookWork(db, &book); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update work", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionWorkUpdate, TargetType: audit.TargetWork, TargetID: c.Param("id"), Before: before})
+
+	logging.FromContext(c).WithField("work_id", work.ID).WithField("isbn", book.ISBN).Info("Edition removed successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Edition removed successfully"})
+}
+
+// findSeries loads the series named by the :slug parameter, aborting with 404 when there is none
+func findSeries(c *gin.Context, db *gorm.DB) (models.Series, bool) {
+	series, err := models.GetSeriesBySlug(db, c.Param("slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Series not found"))
+		return series, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch series", err))
+		return series, false
+	}
+	return series, true
+}
+
+// findWork loads the work with the :id parameter, aborting with 404 when there is none
+func findWork(c *gin.Context, db *gorm.DB) (models.Work, bool) {
+	workID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apierror.Abort(c, apierror.BadRequest("Invalid work ID"))
+		return models.Work{}, false
+	}
+	work, err := models.GetWorkByID(db, uint(workID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Work not found"))
+		return work, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch work", err))
+		return work, false
+	}
+	return work, true
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bookstore/internal/models"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRoutesSeriesAndWorks(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	for _, isbn := range []string{"9780552131056", "9780552124751", "9780062225672", "9780134190440"} {
+		admin.do(http.MethodPost, "/api/v1/books", validBookInput(isbn)).expect(t, http.StatusOK)
+	}
+
+	admin.do(http.MethodPost, "/api/v1/series", models.SeriesInput{Name: "Discworld", Description: "Novels set on a flat world."}).
+		expect(t, http.StatusCreated)
+	admin.do(http.MethodPost, "/api/v1/series", models.SeriesInput{Name: "discworld"}).expect(t, http.StatusConflict)
+
+	// Editions of a volume share its number, and fractions fit between volumes
+	volumes := map[string]float64{"9780552131056": 3, "9780552124751": 1, "9780062225672": 1, "9780134190440": 1.5}
+	for isbn, volume := range volumes {
+		admin.do(http.MethodPut, "/api/v1/series/discworld/books/"+isbn, models.VolumeInput{Volume: volume}).expect(t, http.StatusOK)
+	}
+	admin.do(http.MethodPut, "/api/v1/series/discworld/books/9780552131056", models.VolumeInput{Volume: 0}).expect(t, http.StatusBadRequest)
+	admin.do(http.MethodPut, "/api/v1/series/discworld/books/9780262510875", models.VolumeInput{Volume: 2}).expect(t, http.StatusNotFound)
+	admin.do(http.MethodPut, "/api/v1/series/nothing/books/9780552131056", models.VolumeInput{Volume: 2}).expect(t, http.StatusNotFound)
+
+	var page struct {
+		models.Series
+		Books []models.Book `json:"books"`
+	}
+	srv.client().do(http.MethodGet, "/api/v1/series/discworld", nil).expect(t, http.StatusOK).decode(t, &page)
+	if page.Description != "Novels set on a flat world." || len(page.Books) != 4 {
+		t.Fatalf("unexpected series %+v", page)
+	}
+	for i, volume := range []float64{1, 1, 1.5, 3} {
+		if page.Books[i].SeriesVolume != volume {
+			t.Fatalf("expected the books in volume order, got %v at %d", page.Books[i].SeriesVolume, i)
+		}
+	}
+
+	admin.do(http.MethodDelete, "/api/v1/series/discworld/books/9780134190440", nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/series/discworld/books/9780134190440", nil).expect(t, http.StatusNotFound)
+	var series []struct {
+		models.Series
+		BookCount int `json:"book_count"`
+	}
+	srv.client().do(http.MethodGet, "/api/v1/series", nil).expect(t, http.StatusOK).decode(t, &series)
+	if len(series) != 1 || series[0].BookCount != 3 {
+		t.Fatalf("unexpected series list %+v", series)
+	}
+
+	// Works group the editions of a text, each with its own ISBN and price
+	var created struct {
+		Data models.Work `json:"data"`
+	}
+	admin.do(http.MethodPost, "/api/v1/works", models.WorkInput{Title: "The Colour of Magic"}).expect(t, http.StatusCreated).decode(t, &created)
+	workPath := fmt.Sprintf("/api/v1/works/%d", created.Data.ID)
+	admin.do(http.MethodPut, workPath+"/editions/9780552124751", models.EditionInput{Edition: "Paperback"}).expect(t, http.StatusOK)
+	admin.do(http.MethodPut, workPath+"/editions/9780062225672", models.EditionInput{Edition: "Ebook"}).expect(t, http.StatusOK)
+
+	var work struct {
+		models.Work
+		Editions []models.Book `json:"editions"`
+	}
+	srv.client().do(http.MethodGet, workPath, nil).expect(t, http.StatusOK).decode(t, &work)
+	if work.Title != "The Colour of Magic" || len(work.Editions) != 2 {
+		t.Fatalf("unexpected work %+v", work)
+	}
+	var editions []models.Book
+	srv.client().do(http.MethodGet, "/api/v1/books/9780062225672/editions", nil).expect(t, http.StatusOK).decode(t, &editions)
+	if len(editions) != 2 || editions[0].WorkID == nil || *editions[0].WorkID != created.Data.ID {
+		t.Fatalf("expected both editions, got %+v", editions)
+	}
+	srv.client().do(http.MethodGet, "/api/v1/books/9780552131056/editions", nil).expect(t, http.StatusOK).decode(t, &editions)
+	if len(editions) != 1 || editions[0].ISBN != "9780552131056" {
+		t.Fatalf("expected a book outside any work to be its only edition, got %+v", editions)
+	}
+
+	// Updating a book keeps its series and work
+	admin.do(http.MethodPut, "/api/v1/books/9780062225672", validBookInput("9780062225672")).expect(t, http.StatusOK)
+	var book models.Book
+	srv.client().do(http.MethodGet, "/api/v1/books/9780062225672", nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Series == nil || book.Series.Slug != "discworld" || book.SeriesVolume != 1 || book.Edition != "Ebook" {
+		t.Fatalf("expected the book to stay grouped, got %+v %v %q", book.Series, book.SeriesVolume, book.Edition)
+	}
+
+	admin.do(http.MethodDelete, workPath+"/editions/9780552131056", nil).expect(t, http.StatusNotFound)
+	admin.do(http.MethodDelete, workPath+"/editions/9780552124751", nil).expect(t, http.StatusOK)
+	admin.do(http.MethodPut, workPath, models.WorkInput{Title: "Colour of Magic"}).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, workPath, nil).expect(t, http.StatusOK)
+	srv.client().do(http.MethodGet, workPath, nil).expect(t, http.StatusNotFound)
+	srv.client().do(http.MethodGet, "/api/v1/works/first", nil).expect(t, http.StatusBadRequest)
+
+	admin.do(http.MethodPut, "/api/v1/series/discworld", models.SeriesInput{Name: "The Discworld"}).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/series/the-discworld", nil).expect(t, http.StatusOK)
+	book = models.Book{}
+	srv.client().do(http.MethodGet, "/api/v1/books/9780062225672", nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.Series != nil || book.SeriesVolume != 0 || book.WorkID != nil {
+		t.Fatalf("expected the book to be ungrouped, got %+v", book)
+	}
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/v1/series", models.SeriesInput{Name: "Mine"}).expect(t, http.StatusForbidden)
+	reader.do(http.MethodPost, "/api/v1/works", models.WorkInput{Title: "Mine"}).expect(t, http.StatusForbidden)
+}
@@ -0,0 +1,366 @@
+/*
+   taxonomy_handler.go contains HTTP request handlers for classifying books: the category tree
+   and the tags, which anyone can list, and the admin-only handlers that create, rename, move
+   and delete them. Books are assigned categories and tags in CreateBook and UpdateBook.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"bookstore/internal/slug"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func InitializeTaxonomyRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1")
+	v1.GET("/categories", GetCategories)
+	v1.GET("/tags", GetTags)
+
+	admin := router.Group("/api/v1", middlewares.AdminOnly())
+	admin.POST("/categories", CreateCategory)
+	admin.PUT("/categories/:slug", UpdateCategory)
+	admin.DELETE("/categories/:slug", DeleteCategory)
+	admin.POST("/tags", CreateTag)
+	admin.PUT("/tags/:slug", UpdateTag)
+	admin.DELETE("/tags/:slug", DeleteTag)
+}
+
+// GetCategories returns the category tree, each level ordered by name
+func GetCategories(c *gin.Context) {
+	categories, err := models.GetAllCategories(models.DBWithContext(c.Request.Context()))
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch categories", err))
+		return
+	}
+	c.JSON(http.StatusOK, models.CategoryTree(categories))
+}
+
+func CreateCategory(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	var input models.CategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	category := models.Category{Name: input.Name, Slug: slug.Make(input.Name), Description: input.Description}
+	if _, err := models.GetCategoryBySlug(db, category.Slug); err == nil {
+		apierror.Abort(c, apierror.Conflict("A category with this name already exists"))
+		return
+	}
+	parent, ok := findParentCategory(c, db, input.Parent)
+	if !ok {
+		return
+	}
+	if parent != nil {
+		category.ParentID = &parent.ID
+	}
+	if err := db.Create(&category).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to create category", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionCategoryCreate, TargetType: audit.TargetCategory, TargetID: category.Slug, After: input})
+
+	logging.FromContext(c).WithField("category_id", category.ID).Info("Category created successfully")
+	c.JSON(http.StatusCreated, gin.H{"message": "Category created successfully", "data": category})
+}
+
+// UpdateCategory renames, describes or moves a category; a new name gives it a new slug
+func UpdateCategory(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	category, ok := findCategory(c, db)
+	if !ok {
+		return
+	}
+	log := logging.FromContext(c).WithField("category_id", category.ID)
+
+	var input models.CategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	newSlug := slug.Make(input.Name)
+	if newSlug != category.Slug {
+		if _, err := models.GetCategoryBySlug(db, newSlug); err == nil {
+			apierror.Abort(c, apierror.Conflict("A category with this name already exists"))
+			return
+		}
+	}
+	parent, ok := findParentCategory(c, db, input.Parent)
+	if !ok {
+		return
+	}
+	var parentID *uint
+	if parent != nil {
+		err := models.CheckCategoryParent(db, category.ID, parent.ID)
+		if errors.Is(err, models.ErrCategoryCycle) {
+			apierror.Abort(c, apierror.Invalid(apierror.FieldError{Field: "parent", Rule: "cycle", Message: err.Error()}))
+			return
+		} else if err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to update category", err))
+			return
+		}
+		parentID = &parent.ID
+	}
+
+	before := categoryInput(db, category)
+	oldSlug := category.Slug
+	category.Name = input.Name
+	category.Slug = newSlug
+	category.Description = input.Description
+	category.ParentID = parentID
+	if err := db.Save(&category).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update category", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionCategoryUpdate, TargetType: audit.TargetCategory, TargetID: oldSlug, Before: before, After: input})
+
+	log.WithField("slug", category.Slug).Info("Category updated successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully", "data": category})
+}
+
+// DeleteCategory removes a category without subcategories; its books lose it
+func DeleteCategory(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	category, ok := findCategory(c, db)
+	if !ok {
+		return
+	}
+	subcategories, err := models.CountSubcategories(db, category.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete category", err))
+		return
+	}
+	if subcategories > 0 {
+		apierror.Abort(c, apierror.Conflict("The category has subcategories"))
+		return
+	}
+
+	before := categoryInput(db, category)
+	if err := models.DeleteCategory(db, category); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete category", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionCategoryDelete, TargetType: audit.TargetCategory, TargetID: category.Slug, Before: before})
+
+	logging.FromContext(c).WithField("category_id", category.ID).Info("Category deleted successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// GetTags lists the tags by name
+func GetTags(c *gin.Context) {
+	tags, err := models.GetAllTags(models.DBWithContext(c.Request.Context()))
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch tags", err))
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+func CreateTag(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	var input models.TagInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	tag := models.Tag{Name: input.Name, Slug: slug.Make(input.Name)}
+	if _, err := models.GetTagBySlug(db, tag.Slug); err == nil {
+		apierror.Abort(c, apierror.Conflict("A tag with this name already exists"))
+		return
+	}
+	if err := db.Create(&tag).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to create tag", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionTagCreate, TargetType: audit.TargetTag, TargetID: tag.Slug, After: input})
+
+	logging.FromContext(c).WithField("tag_id", tag.ID).Info("Tag created successfully")
+	c.JSON(http.StatusCreated, gin.H{"message": "Tag created successfully", "data": tag})
+}
+
+// UpdateTag renames a tag; a new name gives it a new slug
+func UpdateTag(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	tag, ok := findTag(c, db)
+	if !ok {
+		return
+	}
+
+	var input models.TagInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logging.FromContext(c).WithError(err).Warn("Failed to bind JSON")
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	newSlug := slug.Make(input.Name)
+	if newSlug != tag.Slug {
+		if _, err := models.GetTagBySlug(db, newSlug); err == nil {
+			apierror.Abort(c, apierror.Conflict("A tag with this name already exists"))
+			return
+		}
+	}
+
+	before := models.TagInput{Name: tag.Name}
+	oldSlug := tag.Slug
+	tag.Name = input.Name
+	tag.Slug = newSlug
+	if err := db.Save(&tag).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update tag", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionTagUpdate, TargetType: audit.TargetTag, TargetID: oldSlug, Before: before, After: input})
+
+	logging.FromContext(c).WithField("tag_id", tag.ID).Info("Tag updated successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Tag updated successfully", "data": tag})
+}
+
+// DeleteTag removes a tag from every book and deletes it
+func DeleteTag(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	tag, ok := findTag(c, db)
+	if !ok {
+		return
+	}
+	if err := models.DeleteTag(db, tag); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete tag", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionTagDelete, TargetType: audit.TargetTag, TargetID: tag.Slug, Before: models.TagInput{Name: tag.Name}})
+
+	logging.FromContext(c).WithField("tag_id", tag.ID).Info("Tag deleted successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+// findCategory loads the category named by the :slug parameter, aborting with 404 when there is none
+func findCategory(c *gin.Context, db *gorm.DB) (models.Category, bool) {
+	category, err := models.GetCategoryBySlug(db, c.Param("slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Category not found"))
+		return category, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch category", err))
+		return category, false
+	}
+	return category, true
+}
+
+// findParentCategory loads the parent named in a category input, nil for a top-level category
+func findParentCategory(c *gin.Context, db *gorm.DB, parentSlug string) (*models.Category, bool) {
+	if parentSlug == "" {
+		return nil, true
+	}
+	parent, err := models.GetCategoryBySlug(db, parentSlug)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.Invalid(apierror.FieldError{Field: "parent", Rule: "exists", Message: fmt.Sprintf("category %q does not exist", parentSlug)}))
+		return nil, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch category", err))
+		return nil, false
+	}
+	return &parent, true
+}
+
+// categoryInput describes a stored category in the admin input format, for audit diffs
+func categoryInput(db *gorm.DB, category models.Category) models.CategoryInput {
+	input := models.CategoryInput{Name: category.Name, Description: category.Description}
+	if category.ParentID != nil {
+		var parent models.Category
+		if err := db.First(&parent, *category.ParentID).Error; err == nil {
+			input.Parent = parent.Slug
+		}
+	}
+	return input
+}
+
+// findTag loads the tag named by the :slug parameter, aborting with 404 when there is none
+func findTag(c *gin.Context, db *gorm.DB) (models.Tag, bool) {
+	tag, err := models.GetTagBySlug(db, c.Param("slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Tag not found"))
+		return tag, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch tag", err))
+		return tag, false
+	}
+	return tag, true
+}
+
+// findBookCategories loads the categories assigned in a book input, nil when they are left out.
+// Unknown slugs fail the request as a validation error.
+func findBookCategories(c *gin.Context, db *gorm.DB, slugs []string) ([]models.Category, bool) {
+	if slugs == nil {
+		return nil, true
+	}
+	categories, missing, err := models.FindCategories(db, slugs)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch categories", err))
+		return nil, false
+	}
+	if len(missing) > 0 {
+		apierror.Abort(c, apierror.Invalid(missingCategories(missing)...))
+		return nil, false
+	}
+	return categories, true
+}
+
+// missingCategories reports category slugs that match no category
+func missingCategories(slugs []string) []apierror.FieldError {
+	fields := make([]apierror.FieldError, len(slugs))
+	for i, missing := range slugs {
+		fields[i] = apierror.FieldError{Field: "categories", Rule: "exists", Message: fmt.Sprintf("category %q does not exist", missing)}
+	}
+	return fields
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/catalog"
+	"bookstore/internal/models"
+	"net/http"
+	"testing"
+)
+
+func TestRoutesTaxonomy(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	admin.do(http.MethodPost, "/api/v1/categories", models.CategoryInput{Name: "Fiction"}).expect(t, http.StatusCreated)
+	admin.do(http.MethodPost, "/api/v1/categories", models.CategoryInput{Name: "Fantasy", Parent: "fiction"}).expect(t, http.StatusCreated)
+	admin.do(http.MethodPost, "/api/v1/categories", models.CategoryInput{Name: "Computing"}).expect(t, http.StatusCreated)
+	admin.do(http.MethodPost, "/api/v1/categories", models.CategoryInput{Name: "fiction"}).expect(t, http.StatusConflict)
+
+	var apiErr apierror.Envelope
+	admin.do(http.MethodPost, "/api/v1/categories", models.CategoryInput{Name: "Poetry", Parent: "verse"}).
+		expect(t, http.StatusBadRequest).decode(t, &apiErr)
+	if len(apiErr.Error.Fields) != 1 || apiErr.Error.Fields[0].Field != "parent" || apiErr.Error.Fields[0].Rule != "exists" {
+		t.Fatalf("expected an unknown parent to be refused, got %+v", apiErr.Error)
+	}
+	admin.do(http.MethodPut, "/api/v1/categories/fiction", models.CategoryInput{Name: "Fiction", Parent: "fantasy"}).
+		expect(t, http.StatusBadRequest)
+
+	var tree []models.Category
+	srv.client().do(http.MethodGet, "/api/v1/categories", nil).expect(t, http.StatusOK).decode(t, &tree)
+	if len(tree) != 2 || tree[1].Slug != "fiction" || len(tree[1].Children) != 1 || tree[1].Children[0].Slug != "fantasy" {
+		t.Fatalf("unexpected category tree %+v", tree)
+	}
+
+	// Books are given categories by slug and tags by name, creating the tags
+	hobbit := validBookInput("9780547928227")
+	hobbit.Categories = []string{"Fantasy"}
+	hobbit.Tags = []string{"Classic", "dragons", "classic"}
+	var created struct {
+		Data models.Book `json:"data"`
+	}
+	admin.do(http.MethodPost, "/api/v1/books", hobbit).expect(t, http.StatusOK).decode(t, &created)
+	if len(created.Data.Categories) != 1 || created.Data.Categories[0].Slug != "fantasy" || len(created.Data.Tags) != 2 {
+		t.Fatalf("unexpected taxonomy %+v %+v", created.Data.Categories, created.Data.Tags)
+	}
+	sicp := validBookInput("9780262510875")
+	sicp.Categories = []string{"computing"}
+	sicp.Tags = []string{"classic"}
+	admin.do(http.MethodPost, "/api/v1/books", sicp).expect(t, http.StatusOK)
+	admin.do(http.MethodPost, "/api/v1/books", validBookInput("9791090636071")).expect(t, http.StatusOK)
+
+	invalid := validBookInput("9780134190440")
+	invalid.Categories = []string{"poetry"}
+	admin.do(http.MethodPost, "/api/v1/books", invalid).expect(t, http.StatusBadRequest).decode(t, &apiErr)
+	if len(apiErr.Error.Fields) != 1 || apiErr.Error.Fields[0].Field != "categories" || apiErr.Error.Fields[0].Rule != "exists" {
+		t.Fatalf("expected an unknown category to be refused, got %+v", apiErr.Error)
+	}
+
+	// The listing filters by category, including subcategories, and by every tag given
+	var books []models.Book
+	srv.client().do(http.MethodGet, "/api/v1/books?category=fiction", nil).expect(t, http.StatusOK).decode(t, &books)
+	if len(books) != 1 || books[0].ISBN != hobbit.ISBN {
+		t.Fatalf("expected the hobbit, got %+v", books)
+	}
+	srv.client().do(http.MethodGet, "/api/v1/books?tag=classic", nil).expect(t, http.StatusOK).decode(t, &books)
+	if len(books) != 2 {
+		t.Fatalf("expected two classics, got %d", len(books))
+	}
+	srv.client().do(http.MethodGet, "/api/v1/books?tag=classic&tag=dragons", nil).expect(t, http.StatusOK).decode(t, &books)
+	if len(books) != 1 {
+		t.Fatalf("expected one classic with dragons, got %d", len(books))
+	}
+
+	var facets models.Facets
+	srv.client().do(http.MethodGet, "/api/v1/books/facets", nil).expect(t, http.StatusOK).decode(t, &facets)
+	if facets.Total != 3 || len(facets.Categories) != 3 || len(facets.Tags) != 2 || facets.Tags[0].Slug != "classic" || facets.Tags[0].Count != 2 {
+		t.Fatalf("unexpected facets %+v", facets)
+	}
+	srv.client().do(http.MethodGet, "/api/v1/books/facets?tag=dragons", nil).expect(t, http.StatusOK).decode(t, &facets)
+	if facets.Total != 1 || len(facets.Categories) != 2 || facets.Categories[0].Count != 1 {
+		t.Fatalf("unexpected filtered facets %+v", facets)
+	}
+
+	// Updating a book without categories or tags keeps them; empty lists remove them
+	hobbit.Categories, hobbit.Tags = nil, nil
+	admin.do(http.MethodPut, "/api/v1/books/"+hobbit.ISBN, hobbit).expect(t, http.StatusOK)
+	var book models.Book
+	srv.client().do(http.MethodGet, "/api/v1/books/"+hobbit.ISBN, nil).expect(t, http.StatusOK).decode(t, &book)
+	if len(book.Categories) != 1 || len(book.Tags) != 2 {
+		t.Fatalf("expected the taxonomy to be kept, got %+v %+v", book.Categories, book.Tags)
+	}
+	hobbit.Tags = []string{}
+	admin.do(http.MethodPut, "/api/v1/books/"+hobbit.ISBN, hobbit).expect(t, http.StatusOK)
+	srv.client().do(http.MethodGet, "/api/v1/books/"+hobbit.ISBN, nil).expect(t, http.StatusOK).decode(t, &book)
+	if len(book.Categories) != 1 || len(book.Tags) != 0 {
+		t.Fatalf("expected the tags to be removed, got %+v", book.Tags)
+	}
+
+	// Imports assign categories and tags too, and refuse unknown categories
+	var report catalog.Report
+	file := "isbn,title,author,price,categories,tags\n" +
+		"9791090636071,Book,Author,10,computing;fiction,new; classic\n"
+	admin.importCatalog("", "text/csv", file).expect(t, http.StatusOK).decode(t, &report)
+	srv.client().do(http.MethodGet, "/api/v1/books/9791090636071", nil).expect(t, http.StatusOK).decode(t, &book)
+	if len(book.Categories) != 2 || len(book.Tags) != 2 || book.Tags[1].Name != "new" {
+		t.Fatalf("expected the import to assign the taxonomy, got %+v %+v", book.Categories, book.Tags)
+	}
+	report = catalog.Report{}
+	admin.importCatalog("", "text/csv", "isbn,title,author,price,categories\n9791090636071,Book,Author,10,poetry\n").
+		expect(t, http.StatusUnprocessableEntity).decode(t, &report)
+	if report.Invalid != 1 || report.Rows[0].Errors[0].Rule != "exists" {
+		t.Fatalf("expected the unknown category to be reported, got %+v", report)
+	}
+
+	// Categories with subcategories cannot be deleted; deleting the others unassigns them
+	admin.do(http.MethodDelete, "/api/v1/categories/fiction", nil).expect(t, http.StatusConflict)
+	admin.do(http.MethodPut, "/api/v1/categories/fantasy", models.CategoryInput{Name: "Fantasy & Myth"}).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/categories/fiction", nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/categories/fantasy-myth", nil).expect(t, http.StatusOK)
+	srv.client().do(http.MethodGet, "/api/v1/books/"+hobbit.ISBN, nil).expect(t, http.StatusOK).decode(t, &book)
+	if len(book.Categories) != 0 {
+		t.Fatalf("expected the category to be unassigned, got %+v", book.Categories)
+	}
+
+	admin.do(http.MethodPost, "/api/v1/tags", models.TagInput{Name: "Go"}).expect(t, http.StatusCreated)
+	admin.do(http.MethodPost, "/api/v1/tags", models.TagInput{Name: "go"}).expect(t, http.StatusConflict)
+	admin.do(http.MethodPut, "/api/v1/tags/classic", models.TagInput{Name: "Classics"}).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/tags/new", nil).expect(t, http.StatusOK)
+	var tags []models.Tag
+	srv.client().do(http.MethodGet, "/api/v1/tags", nil).expect(t, http.StatusOK).decode(t, &tags)
+	if len(tags) != 3 || tags[0].Slug != "classics" || tags[1].Slug != "go" || tags[2].Slug != "dragons" {
+		t.Fatalf("unexpected tags %+v", tags)
+	}
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/v1/categories", models.CategoryInput{Name: "Poetry"}).expect(t, http.StatusForbidden)
+	reader.do(http.MethodDelete, "/api/v1/categories/computing", nil).expect(t, http.StatusForbidden)
+	reader.do(http.MethodPost, "/api/v1/tags", models.TagInput{Name: "Poetry"}).expect(t, http.StatusForbidden)
+}
@@ -1,84 +1,206 @@
 /*
    transaction_handler.go contains HTTP request handlers for managing book transactions and ownership status in a bookstore.
-   These handlers include functionality for buying books, checking balance, ownership status, and retrieving download links.
+   These handlers include functionality for buying books (orders), checking balance, ownership status, and retrieving download links.
 */
 
 package handlers
 
 import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/blobstore"
+	"bookstore/internal/csrf"
+	"bookstore/internal/delivery"
+	"bookstore/internal/logging"
+	"bookstore/internal/metrics"
 	"bookstore/internal/middlewares"
 	"bookstore/internal/models"
 	"bookstore/internal/session_manager"
+	"errors"
+	"fmt"
 	"net/http"
+	"path"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 func InitializeTransactionRoutes(router *gin.Engine) {
-	router.GET("/api/buy-book/:isbn", middlewares.CheckOwnershipStatus(), BuyBook)
-	router.GET("/api/getBalance", GetBalance)
-	router.GET("/api/ownershipStatus/:isbn", OwnershipStatus)
-	router.GET("/api/getDownloadLink/:isbn", GetDownloadLink)
+	router.GET("/api/buy-book/:isbn", middlewares.Deprecated("/api/v1/orders"), csrf.Protect(), middlewares.CheckOwnershipStatus(), BuyBook)
+	router.GET("/api/getBalance", middlewares.Deprecated("/api/v1/wallet"), GetBalance)
+	router.GET("/api/ownershipStatus/:isbn", middlewares.Deprecated("/api/v1/me/books/:isbn"), OwnershipStatus)
+	router.GET("/api/getDownloadLink/:isbn", middlewares.Deprecated("/api/v1/me/books/:isbn/download"), GetDownloadLink)
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/orders", CreateOrder)
+	v1.GET("/orders", ListOrders)
+	v1.GET("/orders/:id", GetOrder)
+	v1.GET("/wallet", GetBalance)
+	v1.GET("/me/books", ListOwnedBooks)
+	v1.GET("/me/books/:isbn", OwnershipStatus)
+	v1.GET("/me/books/:isbn/download", GetDownloadLink)
+	v1.GET("/downloads/:isbn", DownloadBook)
 }
 
+// BuyBook is the legacy purchase route; the ownership middleware has already refused books the user owns
 func BuyBook(c *gin.Context) {
 	session, _ := session_manager.Store.Get(c.Request, "session-name")
 	userID, exists := session.Values["user_id"].(uint)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
 		return
 	}
 
-	isbn := c.Param("isbn")
-	book, err := models.GetBookByISBN(isbn)
+	if _, ok := purchaseBook(c, userID, c.Param("isbn")); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Book purchased successfully"})
+	}
+}
+
+// CreateOrder buys the book named in the request body
+func CreateOrder(c *gin.Context) {
+	session, _ := session_manager.Store.Get(c.Request, "session-name")
+	userID, exists := session.Values["user_id"].(uint)
+	if !exists {
+		apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
+		return
+	}
+
+	var input models.OrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.Validation(err))
+		return
+	}
+
+	ownsBook, err := models.HasUserBoughtBook(models.DBWithContext(c.Request.Context()), userID, input.ISBN)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Abort(c, apierror.Internal("Failed to check ownership status", err))
+		return
+	}
+	if ownsBook {
+		apierror.Abort(c, apierror.New(http.StatusConflict, apierror.CodeAlreadyOwned, "Already bought"))
 		return
 	}
 
-	balance, err := models.GetBalanceByUserID(models.DB, userID)
+	order, ok := purchaseBook(c, userID, input.ISBN)
+	if !ok {
+		return
+	}
+	c.Header("Location", fmt.Sprintf("/api/v1/orders/%d", order.ID))
+	c.JSON(http.StatusCreated, gin.H{"message": "Book purchased successfully", "data": order})
+}
+
+// purchaseBook charges the book's price to the user and records the order.
+// On failure it aborts the request with the matching API error and returns false.
+func purchaseBook(c *gin.Context, userID uint, isbn string) (models.Order, bool) {
+	db := models.DBWithContext(c.Request.Context())
+	log := logging.FromContext(c).WithFields(logrus.Fields{"user_id": userID, "isbn": isbn})
+
+	book, err := models.GetBookByISBN(db, isbn)
+	if err != nil {
+		apierror.Abort(c, apierror.NotFound("Book not found"))
+		return models.Order{}, false
+	}
+
+	// Deduct the book price and record the transaction together, so a failed order refunds the price
+	var order models.Order
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := models.DeductBalance(tx, userID, book.Price); err != nil {
+			return err
+		}
+		order, err = models.CreateOrder(tx, userID, book)
+		return err
+	})
+	if errors.Is(err, models.ErrInsufficientFunds) {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeInsufficientFunds, "Insufficient balance"))
+		return models.Order{}, false
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch balance"})
+		apierror.Abort(c, apierror.Internal("Failed to purchase the book", err))
+		return models.Order{}, false
+	}
+
+	log.WithField("amount", book.Price).Info("Book purchased")
+	metrics.RecordPurchase(book.Price)
+	return order, true
+}
+
+// ListOrders returns the user's orders, newest first
+func ListOrders(c *gin.Context) {
+	session, _ := session_manager.Store.Get(c.Request, "session-name")
+	userID, exists := session.Values["user_id"].(uint)
+	if !exists {
+		apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
+		return
+	}
+
+	orders, err := models.GetOrdersByUserID(models.DBWithContext(c.Request.Context()), userID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch orders", err))
 		return
 	}
 
-	if balance.Amount < book.Price {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient balance"})
+	c.JSON(http.StatusOK, orders)
+}
+
+func GetOrder(c *gin.Context) {
+	session, _ := session_manager.Store.Get(c.Request, "session-name")
+	userID, exists := session.Values["user_id"].(uint)
+	if !exists {
+		apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
 		return
 	}
 
-	// Deduct the book price from the user's balance
-	newBalance := balance.Amount - book.Price
-	err = models.UpdateBalance(models.DB, userID, newBalance)
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		logrus.WithError(err).Error("Failed to update balance")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update balance"})
+		apierror.Abort(c, apierror.BadRequest("Invalid order ID"))
+		return
+	}
+
+	order, err := models.GetOrderByID(models.DBWithContext(c.Request.Context()), userID, uint(orderID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Order not found"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch order", err))
 		return
 	}
 
-	// Record the transaction
-	err = models.CreateTransaction(models.DB, userID, book.ID, book.Price)
+	c.JSON(http.StatusOK, order)
+}
+
+// ListOwnedBooks returns every book the user has bought
+func ListOwnedBooks(c *gin.Context) {
+	session, _ := session_manager.Store.Get(c.Request, "session-name")
+	userID, exists := session.Values["user_id"].(uint)
+	if !exists {
+		apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
+		return
+	}
+
+	books, err := models.GetOwnedBooks(models.DBWithContext(c.Request.Context()), userID)
 	if err != nil {
-		logrus.WithError(err).Error("Failed to create transaction")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction"})
+		apierror.Abort(c, apierror.Internal("Failed to fetch books", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Book purchased successfully"})
+	c.JSON(http.StatusOK, withCovers(books))
 }
 
 func GetBalance(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
 	session, _ := session_manager.Store.Get(c.Request, "session-name")
 	userID, exists := session.Values["user_id"].(uint)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
 		return
 	}
 
-	balance, err := models.GetBalanceByUserID(models.DB, userID)
+	balance, err := models.GetBalanceByUserID(db, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch balance"})
+		apierror.Abort(c, apierror.Internal("Failed to fetch balance", err))
 		return
 	}
 
@@ -87,16 +209,18 @@ func GetBalance(c *gin.Context) {
 
 // OwnershipStatus handles the ownership status check for a user and a book
 func OwnershipStatus(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
 	// Get the user ID from the session
 	session, err := session_manager.Store.Get(c.Request, "session-name")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session"})
+		apierror.Abort(c, apierror.Internal("Failed to get session", err))
 		return
 	}
 
 	userID, exists := session.Values["user_id"]
 	if !exists || userID == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not logged in"})
+		apierror.Abort(c, apierror.Unauthorized("User not logged in"))
 		return
 	}
 
@@ -104,43 +228,219 @@ func OwnershipStatus(c *gin.Context) {
 	isbn := c.Param("isbn")
 
 	// Check if the user has bought the book with the given ISBN
-	hasBought, err := models.HasUserBoughtBook(userID.(uint), isbn)
+	hasBought, err := models.HasUserBoughtBook(db, userID.(uint), isbn)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check ownership"})
+		apierror.Abort(c, apierror.Internal("Failed to check ownership", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": hasBought})
 }
 
+// GetDownloadLink issues a short-lived signed download URL of a purchased book, bound to the user
 func GetDownloadLink(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+
 	session, _ := session_manager.Store.Get(c.Request, "session-name")
-	userID, exists := session.Values["user_id"]
-	if !exists || userID == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": false})
+	userID, exists := session.Values["user_id"].(uint)
+	if !exists {
+		apierror.Abort(c, apierror.Unauthorized("User not logged in"))
 		return
 	}
 
 	isbn := c.Param("isbn")
 	if isbn == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ISBN is required"})
+		apierror.Abort(c, apierror.BadRequest("ISBN is required"))
+		return
+	}
+
+	// Owners keep their books after they are deleted from the catalog
+	book, err := models.GetOwnedBookByISBN(db, userID, isbn)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeNotOwned, "Book has not been bought"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to check ownership", err))
+		return
+	}
+	used, ok := checkDownloadLimit(c, userID, book.ID)
+	if !ok {
+		return
+	}
+
+	files, err := models.GetBookFiles(db, book.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch book files", err))
+		return
+	}
+	formats := make([]string, 0, len(files))
+	for _, file := range files {
+		formats = append(formats, file.Format)
+	}
+
+	link, expiresAt := delivery.SignedURL(PublicBaseURL, userID, isbn, time.Now())
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"message":         link,
+		"expires_at":      expiresAt,
+		"formats":         formats,
+		"downloads_used":  used,
+		"downloads_limit": delivery.Settings.Limit,
+	})
+}
+
+// DownloadBook streams a purchased book to the holder of a valid signed download URL
+func DownloadBook(c *gin.Context) {
+	db := models.DBWithContext(c.Request.Context())
+	isbn := c.Param("isbn")
+
+	userID, err := delivery.Verify(isbn, c.Request.URL.Query(), time.Now())
+	if errors.Is(err, delivery.ErrExpired) {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeDownloadLinkInvalid, "Download link has expired"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeDownloadLinkInvalid, "Invalid download link"))
 		return
 	}
 
-	hasBought, err := models.HasUserBoughtBook(userID.(uint), isbn)
+	// Ownership is checked again so refunded or deleted accounts cannot use links issued earlier.
+	// Owners keep their books after they are deleted from the catalog.
+	book, err := models.GetOwnedBookByISBN(db, userID, isbn)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeNotOwned, "Book has not been bought"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to check ownership", err))
+		return
+	}
+	// Uploaded files are served from the blob store; books without one fall back to their download link
+	files, err := models.GetBookFiles(db, book.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check ownership"})
+		apierror.Abort(c, apierror.Internal("Failed to fetch book files", err))
+		return
+	}
+	format := c.Query("format")
+	var selected *models.BookFile
+	for i := range files {
+		if format == "" || files[i].Format == format {
+			selected = &files[i]
+			break
+		}
+	}
+	if selected == nil && format != "" {
+		apierror.Abort(c, apierror.NotFound("No "+format+" file is available for this book"))
 		return
 	}
 
-	if hasBought {
-		bookDownload, err := models.GetBookDownloadByISBN(isbn)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch download link"})
+	var bookDownload *models.BookDownload
+	if selected == nil {
+		bookDownload, err = models.GetBookDownload(db, book.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && bookDownload.DownloadLink == "") {
+			apierror.Abort(c, apierror.NotFound("No file is available for this book"))
+			return
+		} else if err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to fetch download link", err))
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": bookDownload.DownloadLink})
-	} else {
-		c.JSON(http.StatusOK, gin.H{"message": false})
 	}
+
+	// A signed URL counts once per file: later requests with it, ranged or not, continue that
+	// download, and only a new URL, which the limit applies to, counts again
+	link := c.Query("signature")
+	servedFormat := ""
+	if selected != nil {
+		servedFormat = selected.Format
+	}
+	counted, err := models.HasDownloaded(db, userID, book.ID, link, servedFormat)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to count downloads", err))
+		return
+	}
+	if !counted {
+		if _, ok := checkDownloadLimit(c, userID, book.ID); !ok {
+			return
+		}
+	}
+	extendDeadlines(c)
+	if selected != nil {
+		serveBookFile(c, userID, book, *selected, link, counted)
+		return
+	}
+
+	upstream, err := delivery.Fetch(c.Request.Context(), bookDownload.DownloadLink)
+	if err != nil {
+		logging.FromContext(c).WithError(err).WithField("isbn", isbn).Error("Failed to fetch book file")
+		apierror.Abort(c, apierror.New(http.StatusBadGateway, apierror.CodeBadGateway, "The book file is temporarily unavailable"))
+		return
+	}
+	defer upstream.Body.Close()
+
+	if !counted && !recordDownload(c, userID, book, link, "") {
+		return
+	}
+
+	contentType := upstream.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	filename := isbn + path.Ext(upstream.Request.URL.Path)
+	c.Header("Cache-Control", "private, no-store")
+	c.DataFromReader(http.StatusOK, upstream.ContentLength, contentType, upstream.Body, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", filename),
+	})
+}
+
+// serveBookFile streams the user's watermarked copy of a file from the blob store, answering
+// range requests so downloads can resume. The download is recorded under the signed URL link
+// unless it was already counted.
+func serveBookFile(c *gin.Context, userID uint, book models.Book, file models.BookFile, link string, counted bool) {
+	marked, ok := watermarkedCopy(c, userID, book, file)
+	if !ok {
+		return
+	}
+	reader, object, err := blobstore.Default.Open(c.Request.Context(), marked.StorageKey)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to open book file", err))
+		return
+	}
+	defer reader.Close()
+
+	if !counted && !recordDownload(c, userID, book, link, file.Format) {
+		return
+	}
+
+	c.Header("Content-Type", file.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", book.ISBN+"."+file.Format))
+	c.Header("ETag", `"`+marked.SHA256+`"`)
+	c.Header("Cache-Control", "private, no-store")
+	http.ServeContent(c.Writer, c.Request, "", object.ModTime, reader)
+}
+
+// recordDownload counts a download of the book by the user with a signed URL; on failure it
+// aborts the request and returns false
+func recordDownload(c *gin.Context, userID uint, book models.Book, link, format string) bool {
+	if err := models.RecordDownload(models.DBWithContext(c.Request.Context()), userID, book.ID, link, format); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to record download", err))
+		return false
+	}
+	metrics.Downloads.Inc()
+	logging.FromContext(c).WithFields(logrus.Fields{"user_id": userID, "isbn": book.ISBN}).Info("Book downloaded")
+	return true
+}
+
+// checkDownloadLimit returns how many times the user downloaded the book within the limit window.
+// When the limit is reached it aborts the request and returns false.
+func checkDownloadLimit(c *gin.Context, userID, bookID uint) (int64, bool) {
+	since := time.Now().Add(-delivery.Settings.LimitWindow)
+	used, err := models.CountDownloadsSince(models.DBWithContext(c.Request.Context()), userID, bookID, since)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to count downloads", err))
+		return 0, false
+	}
+	if limit := delivery.Settings.Limit; limit > 0 && used >= int64(limit) {
+		apierror.Abort(c, apierror.New(http.StatusTooManyRequests, apierror.CodeDownloadLimit,
+			fmt.Sprintf("Download limit of %d per %s reached", limit, delivery.Settings.LimitWindow)))
+		return used, false
+	}
+	return used, true
 }
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestBuyBook(t *testing.T) {
+	setupTestDB(t)
+	book := seedBook(t, "1111111111", 30)
+	user := seedUser(t, "reader", 100)
+	cookie := sessionCookie(t, user.ID, "user")
+
+	rec := serve(http.MethodGet, "/api/buy-book/:isbn", "/api/buy-book/"+book.ISBN, nil, cookie,
+		middlewares.CheckOwnershipStatus(), BuyBook)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	balance, _ := models.GetBalanceByUserID(models.DB, user.ID)
+	if balance.Amount != 70 {
+		t.Fatalf("expected balance 70, got %v", balance.Amount)
+	}
+
+	// A second purchase is stopped by the ownership middleware
+	rec = serve(http.MethodGet, "/api/buy-book/:isbn", "/api/buy-book/"+book.ISBN, nil, cookie,
+		middlewares.CheckOwnershipStatus(), BuyBook)
+	var body apierror.Envelope
+	decode(t, rec, &body)
+	if rec.Code != http.StatusConflict || body.Error.Code != apierror.CodeAlreadyOwned {
+		t.Fatalf("expected 409 already_owned, got %d %+v", rec.Code, body)
+	}
+	balance, _ = models.GetBalanceByUserID(models.DB, user.ID)
+	if balance.Amount != 70 {
+		t.Fatalf("expected the balance to be unchanged, got %v", balance.Amount)
+	}
+}
+
+func TestBuyBookFailures(t *testing.T) {
+	setupTestDB(t)
+	book := seedBook(t, "1111111111", 300)
+	user := seedUser(t, "reader", 100)
+
+	if rec := serve(http.MethodGet, "/api/buy-book/:isbn", "/api/buy-book/"+book.ISBN, nil, nil, BuyBook); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a session, got %d", rec.Code)
+	}
+
+	cookie := sessionCookie(t, user.ID, "user")
+	if rec := serve(http.MethodGet, "/api/buy-book/:isbn", "/api/buy-book/404", nil, cookie, BuyBook); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown book, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/api/buy-book/:isbn", "/api/buy-book/"+book.ISBN, nil, cookie, BuyBook); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for insufficient balance, got %d", rec.Code)
+	}
+}
+
+func TestConcurrentPurchasesCannotOverdraw(t *testing.T) {
+	setupTestDB(t)
+	user := seedUser(t, "reader", 100)
+	cookie := sessionCookie(t, user.ID, "user")
+	// Pause after balance reads so that purchases checking the balance before paying would overlap
+	err := models.DB.Callback().Query().After("gorm:query").Register("slow_balances", func(db *gorm.DB) {
+		if db.Statement.Table == "balances" {
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+	if err != nil {
+		t.Fatalf("registering the callback: %v", err)
+	}
+
+	// Five books at 30 each, bought at once, on a balance that covers three
+	var wg sync.WaitGroup
+	codes := make(chan int, 5)
+	for i := 1; i <= 5; i++ {
+		book := seedBook(t, strings.Repeat(strconv.Itoa(i), 10), 30)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serve(http.MethodGet, "/api/buy-book/:isbn", "/api/buy-book/"+book.ISBN, nil, cookie, BuyBook).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	bought := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			bought++
+		case http.StatusForbidden:
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	balance, _ := models.GetBalanceByUserID(models.DB, user.ID)
+	orders, _ := models.GetOrdersByUserID(models.DB, user.ID)
+	if bought != 3 || len(orders) != 3 || balance.Amount != 10 {
+		t.Fatalf("expected 3 purchases leaving 10, got %d purchases, %d orders and %v", bought, len(orders), balance.Amount)
+	}
+}
+
+func TestFailedOrderRefundsTheBalance(t *testing.T) {
+	setupTestDB(t)
+	book := seedBook(t, "1111111111", 30)
+	user := seedUser(t, "reader", 100)
+	err := models.DB.Callback().Create().Before("gorm:create").Register("fail_transactions", func(db *gorm.DB) {
+		if db.Statement.Table == "transactions" {
+			db.AddError(errors.New("disk full"))
+		}
+	})
+	if err != nil {
+		t.Fatalf("registering the callback: %v", err)
+	}
+
+	rec := serve(http.MethodGet, "/api/buy-book/:isbn", "/api/buy-book/"+book.ISBN, nil, sessionCookie(t, user.ID, "user"), BuyBook)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when the order cannot be recorded, got %d", rec.Code)
+	}
+	if balance, _ := models.GetBalanceByUserID(models.DB, user.ID); balance.Amount != 100 {
+		t.Fatalf("expected the price to be refunded, got a balance of %v", balance.Amount)
+	}
+}
+
+func TestBalanceOwnershipAndDownloadLink(t *testing.T) {
+	setupTestDB(t)
+	book := seedBook(t, "1111111111", 30)
+	user := seedUser(t, "reader", 100)
+	cookie := sessionCookie(t, user.ID, "user")
+
+	rec := serve(http.MethodGet, "/api/getBalance", "/api/getBalance", nil, cookie, GetBalance)
+	var balance map[string]float64
+	decode(t, rec, &balance)
+	if balance["balance"] != 100 {
+		t.Fatalf("expected balance 100, got %v", balance)
+	}
+
+	var status map[string]any
+	decode(t, serve(http.MethodGet, "/api/ownershipStatus/:isbn", "/api/ownershipStatus/"+book.ISBN, nil, cookie, OwnershipStatus), &status)
+	if status["status"] != false {
+		t.Fatalf("expected not owned, got %v", status)
+	}
+
+	rec = serve(http.MethodGet, "/api/getDownloadLink/:isbn", "/api/getDownloadLink/"+book.ISBN, nil, cookie, GetDownloadLink)
+	var notOwned apierror.Envelope
+	decode(t, rec, &notOwned)
+	if rec.Code != http.StatusForbidden || notOwned.Error.Code != apierror.CodeNotOwned {
+		t.Fatalf("expected 403 not_owned before purchase, got %d %+v", rec.Code, notOwned)
+	}
+
+	var link map[string]any
+
+	if err := models.CreateTransaction(models.DB, user.ID, book.ID, book.Price); err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+
+	decode(t, serve(http.MethodGet, "/api/ownershipStatus/:isbn", "/api/ownershipStatus/"+book.ISBN, nil, cookie, OwnershipStatus), &status)
+	if status["status"] != true {
+		t.Fatalf("expected owned, got %v", status)
+	}
+	decode(t, serve(http.MethodGet, "/api/getDownloadLink/:isbn", "/api/getDownloadLink/"+book.ISBN, nil, cookie, GetDownloadLink), &link)
+	if message, _ := link["message"].(string); !strings.HasPrefix(message, "/api/v1/downloads/"+book.ISBN+"?") {
+		t.Fatalf("expected a signed download URL, got %v", link)
+	}
+
+	if rec := serve(http.MethodGet, "/api/getBalance", "/api/getBalance", nil, nil, GetBalance); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a session, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"bookstore/internal/logging"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TransferTimeout replaces the server's read and write timeouts for the requests that upload or
+// download whole files, which take longer than SERVER_READ_TIMEOUT and SERVER_WRITE_TIMEOUT
+// allow; 0 keeps the server timeouts.
+var TransferTimeout = 30 * time.Minute
+
+// extendDeadlines gives the request TransferTimeout from now to read its body and write its response
+func extendDeadlines(c *gin.Context) {
+	if TransferTimeout <= 0 {
+		return
+	}
+	deadline := time.Now().Add(TransferTimeout)
+	controller := http.NewResponseController(c.Writer)
+	for _, err := range []error{controller.SetReadDeadline(deadline), controller.SetWriteDeadline(deadline)} {
+		// Recorders used in tests have no connection to extend
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logging.FromContext(c).WithError(err).Warn("Failed to extend the request deadlines")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExtendDeadlines(t *testing.T) {
+	router := gin.New()
+	slow := func(c *gin.Context) {
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	}
+	router.GET("/short", slow)
+	router.GET("/transfer", func(c *gin.Context) {
+		extendDeadlines(c)
+		slow(c)
+	})
+
+	srv := httptest.NewUnstartedServer(router)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	if resp, err := http.Get(srv.URL + "/short"); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the server write timeout to cut off a slow response")
+	}
+	resp, err := http.Get(srv.URL + "/transfer")
+	if err != nil {
+		t.Fatalf("expected the extended deadline to let the response through: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "done" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+   trash_handler.go contains the admin-only HTTP request handlers for deleted books. Deleting a
+   book moves it to the trash, where its owners can still download it and a new book can take its
+   ISBN; these handlers list the trash, restore books from it and purge the books nobody bought.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/blobstore"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func InitializeTrashRoutes(router *gin.Engine) {
+	admin := router.Group("/api/v1/admin/trash", middlewares.AdminOnly())
+	admin.GET("/books", ListDeletedBooks)
+	admin.POST("/books/:isbn/restore", RestoreBook)
+	admin.DELETE("/books/:isbn", PurgeBook)
+}
+
+// deletedBook is a book in the trash with its number of purchases; bought books cannot be purged
+type deletedBook struct {
+	models.Book
+	Purchases int `json:"purchases"`
+}
+
+// ListDeletedBooks lists the books in the trash, most recently deleted first
+func ListDeletedBooks(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	books, err := models.GetDeletedBooks(db)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch deleted books", err))
+		return
+	}
+	purchases, err := models.CountDeletedBookPurchases(db)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch deleted books", err))
+		return
+	}
+
+	deleted := make([]deletedBook, len(books))
+	for i, book := range withCovers(books) {
+		deleted[i] = deletedBook{Book: book, Purchases: purchases[book.ID]}
+	}
+	c.JSON(http.StatusOK, deleted)
+}
+
+// RestoreBook brings a deleted book back into the catalog as it was
+func RestoreBook(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+
+	book, ok := findDeletedBook(c, db)
+	if !ok {
+		return
+	}
+	err := models.RestoreBook(db, &book)
+	if errors.Is(err, models.ErrISBNTaken) {
+		apierror.Abort(c, apierror.Conflict("Another book in the catalog has this ISBN; change its ISBN or delete it first"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to restore book", err))
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionBookRestore, TargetType: audit.TargetBook, TargetID: book.ISBN})
+
+	logging.FromContext(c).WithField("book_id", book.ID).Info("Book restored successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Book restored successfully", "data": withCovers([]models.Book{book})[0]})
+}
+
+// PurgeBook permanently deletes a book from the trash with its files; books someone bought stay
+// for their owners
+func PurgeBook(c *gin.Context) {
+	if c.IsAborted() {
+		return
+	}
+
+	db := models.DBWithContext(c.Request.Context())
+	log := logging.FromContext(c)
+
+	book, ok := findDeletedBook(c, db)
+	if !ok {
+		return
+	}
+	before := book.Input("")
+	if bookDownload, err := models.GetBookDownload(db, book.ID); err == nil {
+		before.DownloadLink = bookDownload.DownloadLink
+	}
+
+	files, err := models.PurgeBook(db, book)
+	if errors.Is(err, models.ErrBookPurchased) {
+		apierror.Abort(c, apierror.Conflict("The book has been bought and its owners can still download it, so it cannot be purged"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to purge book", err))
+		return
+	}
+	for _, file := range files {
+		if err := blobstore.Default.Delete(c.Request.Context(), file.StorageKey); err != nil {
+			log.WithError(err).Warn("Failed to delete book file from the blob store")
+		}
+	}
+	if book.CoverVersion != "" {
+		deleteCoverVersion(c, book.ISBN, book.CoverVersion)
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionBookPurge, TargetType: audit.TargetBook, TargetID: book.ISBN, Before: before})
+
+	log.WithField("book_id", book.ID).Info("Book purged successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Book purged successfully"})
+}
+
+// findDeletedBook loads the deleted book named by the :isbn parameter, the most recently deleted one
+// when several have the ISBN, aborting with 404 when there is none
+func findDeletedBook(c *gin.Context, db *gorm.DB) (models.Book, bool) {
+	book, err := models.GetDeletedBookByISBN(db, c.Param("isbn"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("Deleted book not found"))
+		return book, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch deleted book", err))
+		return book, false
+	}
+	return book, true
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bookstore/internal/models"
+	"net/http"
+	"testing"
+)
+
+func TestRoutesTrash(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	bought := validBookInput("9780134190440")
+	unsold := validBookInput("9780262510875")
+	unsold.Categories = []string{}
+	unsold.Tags = []string{"classic"}
+	admin.do(http.MethodPost, "/api/v1/books", bought).expect(t, http.StatusOK)
+	admin.do(http.MethodPost, "/api/v1/books", unsold).expect(t, http.StatusOK)
+
+	reader := srv.client()
+	reader.register("reader", "secret")
+	reader.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: bought.ISBN}).expect(t, http.StatusCreated)
+
+	admin.do(http.MethodDelete, "/api/v1/books/"+bought.ISBN, nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/books/"+unsold.ISBN, nil).expect(t, http.StatusOK)
+	srv.client().do(http.MethodGet, "/api/v1/books/"+bought.ISBN, nil).expect(t, http.StatusNotFound)
+
+	// Owners keep their deleted books, but nobody can buy them any more
+	reader.do(http.MethodGet, "/api/v1/me/books/"+bought.ISBN+"/download", nil).expect(t, http.StatusOK)
+	var owned []models.Book
+	reader.do(http.MethodGet, "/api/v1/me/books", nil).expect(t, http.StatusOK).decode(t, &owned)
+	if len(owned) != 1 || owned[0].ISBN != bought.ISBN || !owned[0].DeletedAt.Valid {
+		t.Fatalf("expected the deleted book in the library, got %+v", owned)
+	}
+	other := srv.client()
+	other.register("other", "secret")
+	other.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: bought.ISBN}).expect(t, http.StatusNotFound)
+
+	var trash []struct {
+		models.Book
+		Purchases int `json:"purchases"`
+	}
+	admin.do(http.MethodGet, "/api/v1/admin/trash/books", nil).expect(t, http.StatusOK).decode(t, &trash)
+	if len(trash) != 2 || trash[0].ISBN != unsold.ISBN || trash[0].Purchases != 0 || trash[1].Purchases != 1 {
+		t.Fatalf("unexpected trash %+v", trash)
+	}
+
+	// A deleted book gives up its ISBN, and cannot be restored while a new book has it
+	admin.do(http.MethodPut, "/api/v1/books/"+unsold.ISBN, unsold).expect(t, http.StatusNotFound)
+	admin.do(http.MethodPost, "/api/v1/books", unsold).expect(t, http.StatusOK)
+	var book models.Book
+	srv.client().do(http.MethodGet, "/api/v1/books/"+unsold.ISBN, nil).expect(t, http.StatusOK).decode(t, &book)
+	if len(book.Tags) != 1 {
+		t.Fatalf("expected the new book to have only its own tags, got %+v", book.Tags)
+	}
+	admin.do(http.MethodPost, "/api/v1/admin/trash/books/"+unsold.ISBN+"/restore", nil).expect(t, http.StatusConflict)
+
+	// The same goes for a bought book, which cannot be purged either; its owner keeps the copy they
+	// bought, and the new book can be bought by others
+	reprint := validBookInput(bought.ISBN)
+	reprint.DownloadLink = "https://example.com/reprint"
+	admin.do(http.MethodPost, "/api/v1/books", reprint).expect(t, http.StatusOK)
+	admin.do(http.MethodPost, "/api/v1/admin/trash/books/"+bought.ISBN+"/restore", nil).expect(t, http.StatusConflict)
+	admin.do(http.MethodDelete, "/api/v1/admin/trash/books/"+bought.ISBN, nil).expect(t, http.StatusConflict)
+	old, _ := models.GetDeletedBookByISBN(models.DB, bought.ISBN)
+	var owner models.User
+	models.DB.Where("username = ?", "reader").First(&owner)
+	if owned, err := models.GetOwnedBookByISBN(models.DB, owner.ID, bought.ISBN); err != nil || owned.ID != old.ID {
+		t.Fatalf("expected the reader to own the deleted book %d, got %+v, %v", old.ID, owned, err)
+	}
+	reader.do(http.MethodGet, "/api/v1/me/books/"+bought.ISBN+"/download", nil).expect(t, http.StatusOK)
+	other.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: bought.ISBN}).expect(t, http.StatusCreated)
+
+	admin.do(http.MethodDelete, "/api/v1/admin/trash/books/0-262-51087-1", nil).expect(t, http.StatusOK)
+	admin.do(http.MethodDelete, "/api/v1/admin/trash/books/"+unsold.ISBN, nil).expect(t, http.StatusNotFound)
+	admin.do(http.MethodPost, "/api/v1/admin/trash/books/"+unsold.ISBN+"/restore", nil).expect(t, http.StatusNotFound)
+
+	// Once the new book moves to another ISBN, the bought one can come back
+	admin.do(http.MethodPut, "/api/v1/books/"+bought.ISBN, validBookInput("9781593279288")).expect(t, http.StatusOK)
+	admin.do(http.MethodPost, "/api/v1/admin/trash/books/"+bought.ISBN+"/restore", nil).expect(t, http.StatusOK)
+	srv.client().do(http.MethodGet, "/api/v1/books/"+bought.ISBN, nil).expect(t, http.StatusOK).decode(t, &book)
+	if book.ID != old.ID {
+		t.Fatalf("expected the restored book %d, got %d", old.ID, book.ID)
+	}
+	admin.do(http.MethodGet, "/api/v1/admin/trash/books", nil).expect(t, http.StatusOK).decode(t, &trash)
+	if len(trash) != 0 {
+		t.Fatalf("expected an empty trash, got %+v", trash)
+	}
+
+	var logs struct {
+		Data []models.AuditLog `json:"data"`
+	}
+	admin.do(http.MethodGet, "/api/v1/admin/audit-logs?action=book.purge", nil).expect(t, http.StatusOK).decode(t, &logs)
+	if len(logs.Data) != 1 || logs.Data[0].TargetID != unsold.ISBN {
+		t.Fatalf("expected the purge to be audited, got %+v", logs.Data)
+	}
+
+	reader.do(http.MethodGet, "/api/v1/admin/trash/books", nil).expect(t, http.StatusForbidden)
+	reader.do(http.MethodPost, "/api/v1/admin/trash/books/"+bought.ISBN+"/restore", nil).expect(t, http.StatusForbidden)
+}
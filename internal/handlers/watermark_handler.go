@@ -0,0 +1,232 @@
+/*
+   watermark_handler.go contains the watermarking of downloaded book files and the admin-only
+   HTTP handlers that trace a leaked copy back to its buyer. Every buyer gets their own copy of
+   each file, marked with their identity and transaction and kept in the blob store until the
+   book file is replaced.
+*/
+
+package handlers
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/audit"
+	"bookstore/internal/blobstore"
+	"bookstore/internal/logging"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/models"
+	"bookstore/internal/watermark"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func InitializeWatermarkRoutes(router *gin.Engine) {
+	admin := router.Group("/api/v1/admin/watermarks", middlewares.AdminOnly())
+	admin.POST("/lookup", LookupWatermark)
+	admin.GET("/:fingerprint", GetWatermark)
+}
+
+// LookupWatermark identifies the buyer of a copy uploaded as the "file" field of a multipart form
+func LookupWatermark(c *gin.Context) {
+	extendDeadlines(c)
+	upload, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Abort(c, apierror.PayloadTooLarge(tooLarge.Limit))
+			return
+		}
+		apierror.Abort(c, apierror.BadRequest("A multipart form with a file field is required"))
+		return
+	}
+	defer upload.Close()
+
+	fingerprint, err := watermark.Extract(upload, header.Size)
+	if errors.Is(err, watermark.ErrNotFound) {
+		apierror.Abort(c, apierror.NotFound("No watermark was found in the file"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to read the file", err))
+		return
+	}
+	respondWatermark(c, fingerprint)
+}
+
+// GetWatermark identifies the buyer of the copy carrying a fingerprint read from it by other means
+func GetWatermark(c *gin.Context) {
+	respondWatermark(c, c.Param("fingerprint"))
+}
+
+// respondWatermark answers with the purchase behind a fingerprint; lookups are audited as they reveal buyers
+func respondWatermark(c *gin.Context, fingerprint string) {
+	db := models.DBWithContext(c.Request.Context())
+
+	marked, err := models.GetWatermarkByFingerprint(db, fingerprint)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.NotFound("No copy carries this watermark"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to look up watermark", err))
+		return
+	}
+
+	buyer := gin.H{"id": marked.UserID}
+	var user models.User
+	if err := db.First(&user, marked.UserID).Error; err == nil {
+		buyer["username"] = user.Username
+		buyer["email"] = user.Email
+	}
+	book := gin.H{"id": marked.BookID}
+	var found models.Book
+	if err := db.Unscoped().First(&found, marked.BookID).Error; err == nil {
+		book["isbn"] = found.ISBN
+		book["title"] = found.Title
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionWatermarkLookup,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatUint(uint64(marked.UserID), 10),
+		After:      gin.H{"fingerprint": marked.Fingerprint, "format": marked.Format, "transaction_id": marked.TransactionID},
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"fingerprint":    marked.Fingerprint,
+		"format":         marked.Format,
+		"transaction_id": marked.TransactionID,
+		"created_at":     marked.CreatedAt,
+		"buyer":          buyer,
+		"book":           book,
+	})
+}
+
+// watermarkedCopy returns the user's copy of a book file, making it when the user has none yet or
+// the file was replaced since. A remade copy keeps its fingerprint, so earlier leaks stay traceable.
+// On failure it aborts the request and returns false.
+func watermarkedCopy(c *gin.Context, userID uint, book models.Book, file models.BookFile) (models.Watermark, bool) {
+	ctx := c.Request.Context()
+	db := models.DBWithContext(ctx)
+	log := logging.FromContext(c).WithFields(logrus.Fields{"user_id": userID, "isbn": book.ISBN, "format": file.Format})
+
+	marked, err := models.GetWatermark(db, userID, book.ID, file.Format)
+	if err == nil && marked.SourceSHA256 == file.SHA256 {
+		return marked, true
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Abort(c, apierror.Internal("Failed to fetch watermarked copy", err))
+		return marked, false
+	}
+
+	purchase, err := models.GetPurchase(db, userID, book.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch purchase", err))
+		return marked, false
+	}
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to fetch buyer", err))
+		return marked, false
+	}
+
+	if marked.Fingerprint == "" {
+		marked.Fingerprint = watermark.NewFingerprint()
+	}
+	mark := watermark.Mark{
+		Fingerprint:   marked.Fingerprint,
+		Buyer:         fmt.Sprintf("%s <%s>", user.Username, user.Email),
+		TransactionID: purchase.ID,
+		PurchasedAt:   purchase.CreatedAt,
+	}
+	key := path.Join("watermarks", book.ISBN, marked.Fingerprint, file.SHA256[:16]+"."+file.Format)
+	object, err := makeWatermarkedCopy(ctx, file, mark, key)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to watermark the book file", err))
+		return marked, false
+	}
+
+	previousKey := marked.StorageKey
+	marked.UserID = userID
+	marked.BookID = book.ID
+	marked.Format = file.Format
+	marked.TransactionID = purchase.ID
+	marked.SourceSHA256 = file.SHA256
+	marked.StorageKey = object.Key
+	marked.Size = object.Size
+	marked.SHA256 = object.SHA256
+	if err := models.SaveWatermark(db, &marked); err != nil {
+		// A concurrent download of the same file may have made the user's first copy first
+		if winner, getErr := models.GetWatermark(db, userID, book.ID, file.Format); getErr == nil && winner.Fingerprint != marked.Fingerprint {
+			blobstore.Default.Delete(ctx, object.Key)
+			return winner, true
+		}
+		apierror.Abort(c, apierror.Internal("Failed to save watermarked copy", err))
+		return marked, false
+	}
+	if previousKey != "" && previousKey != object.Key {
+		if err := blobstore.Default.Delete(ctx, previousKey); err != nil {
+			log.WithError(err).Warn("Failed to delete outdated watermarked copy")
+		}
+	}
+
+	log.WithField("fingerprint", marked.Fingerprint).Info("Watermarked copy created")
+	return marked, true
+}
+
+// makeWatermarkedCopy marks the book file and stores the result under key
+func makeWatermarkedCopy(ctx context.Context, file models.BookFile, mark watermark.Mark, key string) (blobstore.Object, error) {
+	reader, object, err := blobstore.Default.Open(ctx, file.StorageKey)
+	if err != nil {
+		return blobstore.Object{}, err
+	}
+	defer reader.Close()
+
+	// Both formats need random access; stores that stream over the network are spooled to disk
+	src, ok := reader.(io.ReaderAt)
+	if !ok {
+		spool, err := os.CreateTemp("", "bookstore-source-*")
+		if err != nil {
+			return blobstore.Object{}, err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		if _, err := io.Copy(spool, reader); err != nil {
+			return blobstore.Object{}, err
+		}
+		src = spool
+	}
+
+	out, err := os.CreateTemp("", "bookstore-watermark-*")
+	if err != nil {
+		return blobstore.Object{}, err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	switch file.Format {
+	case models.FormatEPUB:
+		err = watermark.EPUB(out, src, object.Size, mark)
+	case models.FormatPDF:
+		err = watermark.PDF(out, src, object.Size, mark)
+	default:
+		err = watermark.ErrUnsupported
+	}
+	if err != nil {
+		return blobstore.Object{}, err
+	}
+
+	size, err := out.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return blobstore.Object{}, err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return blobstore.Object{}, err
+	}
+	return blobstore.Default.Put(ctx, key, out, size, file.ContentType)
+}
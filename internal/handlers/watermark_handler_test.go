@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bookstore/internal/audit"
+	"bookstore/internal/blobstore"
+	"bookstore/internal/models"
+	"bookstore/internal/watermark"
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// lookupWatermark posts content to the admin watermark lookup
+func (c *testClient) lookupWatermark(content []byte) testResponse {
+	c.srv.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "leaked.pdf")
+	part.Write(content)
+	form.Close()
+	return c.send(http.MethodPost, "/api/v1/admin/watermarks/lookup", &body, http.Header{"Content-Type": {form.FormDataContentType()}})
+}
+
+// downloadPDF fetches a signed link for a book the client owns and downloads its PDF
+func (c *testClient) downloadPDF(isbn string) []byte {
+	c.srv.t.Helper()
+	var link struct {
+		Message string `json:"message"`
+	}
+	c.do(http.MethodGet, "/api/v1/me/books/"+isbn+"/download", nil).expect(c.srv.t, http.StatusOK).decode(c.srv.t, &link)
+	signedPath := strings.TrimPrefix(link.Message, c.srv.server.URL)
+	return c.send(http.MethodGet, signedPath+"&format=pdf", nil, nil).expect(c.srv.t, http.StatusOK).Body
+}
+
+func TestRoutesWatermarks(t *testing.T) {
+	srv := newTestServer(t)
+	srv.seedAdmin("admin@example.com", "admin-pass")
+	admin := srv.client()
+	admin.login("admin@example.com", "admin-pass")
+
+	book := seedBook(t, "9780134190440", 40)
+	pdf := testPDF("The Go Programming Language")
+	admin.upload(book.ISBN, "gopl.pdf", pdf, "").expect(t, http.StatusCreated)
+
+	alice := srv.client()
+	alice.register("alice", "secret")
+	var order struct {
+		Data models.Order `json:"data"`
+	}
+	alice.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: book.ISBN}).expect(t, http.StatusCreated).decode(t, &order)
+	bob := srv.client()
+	bob.register("bob", "secret")
+	bob.do(http.MethodPost, "/api/v1/orders", models.OrderInput{ISBN: book.ISBN}).expect(t, http.StatusCreated)
+
+	// Every buyer gets their own copy, which is made once and then served again
+	alicesCopy := alice.downloadPDF(book.ISBN)
+	if again := alice.downloadPDF(book.ISBN); !bytes.Equal(again, alicesCopy) {
+		t.Fatal("expected the cached copy to be served again")
+	}
+	bobsCopy := bob.downloadPDF(book.ISBN)
+	if bytes.Equal(alicesCopy, bobsCopy) {
+		t.Fatal("expected buyers to get differently marked copies")
+	}
+	if !bytes.Contains(alicesCopy, []byte("(Licensed to alice <alice@example.com>, transaction #")) {
+		t.Fatalf("expected the buyer in the document information:\n%s", alicesCopy[len(pdf):])
+	}
+
+	var found struct {
+		Fingerprint   string `json:"fingerprint"`
+		Format        string `json:"format"`
+		TransactionID uint   `json:"transaction_id"`
+		Buyer         struct {
+			ID       uint   `json:"id"`
+			Username string `json:"username"`
+			Email    string `json:"email"`
+		} `json:"buyer"`
+		Book struct {
+			ISBN string `json:"isbn"`
+		} `json:"book"`
+	}
+	admin.lookupWatermark(alicesCopy).expect(t, http.StatusOK).decode(t, &found)
+	if found.Buyer.Username != "alice" || found.Buyer.Email != "alice@example.com" || found.TransactionID != order.Data.ID ||
+		found.Book.ISBN != book.ISBN || found.Format != models.FormatPDF {
+		t.Fatalf("expected alice's purchase, got %+v", found)
+	}
+	fingerprint, _ := watermark.Extract(bytes.NewReader(alicesCopy), int64(len(alicesCopy)))
+	if found.Fingerprint != fingerprint {
+		t.Fatalf("expected fingerprint %s, got %s", fingerprint, found.Fingerprint)
+	}
+	admin.do(http.MethodGet, "/api/v1/admin/watermarks/"+fingerprint, nil).expect(t, http.StatusOK)
+	admin.do(http.MethodGet, "/api/v1/admin/watermarks/"+strings.Repeat("0", 32), nil).expect(t, http.StatusNotFound)
+	admin.lookupWatermark(pdf).expect(t, http.StatusNotFound)
+	alice.lookupWatermark(alicesCopy).expect(t, http.StatusForbidden)
+
+	var page auditPage
+	admin.do(http.MethodGet, "/api/v1/admin/audit-logs?action="+audit.ActionWatermarkLookup, nil).expect(t, http.StatusOK).decode(t, &page)
+	if len(page.Data) != 2 || page.Data[0].TargetType != audit.TargetUser || page.Data[0].TargetID != "2" {
+		t.Fatalf("expected the lookups of alice's copy to be audited, got %+v", page.Data)
+	}
+
+	// Replacing the book file remakes the copy under the same fingerprint and drops the outdated one
+	bobsMark, _ := models.GetWatermark(models.DB, 3, book.ID, models.FormatPDF)
+	revised := testPDF("The Go Programming Language, revised")
+	admin.upload(book.ISBN, "gopl-2.pdf", revised, "").expect(t, http.StatusCreated)
+	bobsNewCopy := bob.downloadPDF(book.ISBN)
+	if !bytes.HasPrefix(bobsNewCopy, revised) {
+		t.Fatal("expected the copy to be remade from the new file")
+	}
+	if got, _ := watermark.Extract(bytes.NewReader(bobsNewCopy), int64(len(bobsNewCopy))); got != bobsMark.Fingerprint {
+		t.Fatalf("expected the fingerprint %s to be kept, got %s", bobsMark.Fingerprint, got)
+	}
+	if _, _, err := blobstore.Default.Open(context.Background(), bobsMark.StorageKey); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected the outdated copy to be deleted, got %v", err)
+	}
+}
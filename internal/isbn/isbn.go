@@ -0,0 +1,114 @@
+/*
+   isbn validates ISBN-10 and ISBN-13 numbers and converts between them. Books are stored under
+   their canonical form: the ISBN-13, digits only. Hyphens and spaces are ignored on input and a
+   lowercase x is accepted as the ISBN-10 check digit.
+*/
+
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrLength    = errors.New("an ISBN has 10 or 13 digits")
+	ErrCharacter = errors.New("an ISBN may only contain digits, hyphens and spaces, and end in X when it is an ISBN-10")
+	ErrPrefix    = errors.New("an ISBN-13 starts with 978 or 979")
+	ErrChecksum  = errors.New("the ISBN check digit does not match")
+)
+
+// ISBN is a valid ISBN in its canonical form, an ISBN-13 without hyphens
+type ISBN string
+
+// Parse validates an ISBN-10 or ISBN-13, with or without hyphens, and returns its canonical form
+func Parse(s string) (ISBN, error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+	switch len(digits) {
+	case 10:
+		for i, r := range digits {
+			if !isDigit(r) && !(r == 'X' && i == 9) {
+				return "", ErrCharacter
+			}
+		}
+		if checkDigit10(digits[:9]) != digits[9] {
+			return "", ErrChecksum
+		}
+		body := "978" + digits[:9]
+		return ISBN(body + string(checkDigit13(body))), nil
+	case 13:
+		for _, r := range digits {
+			if !isDigit(r) {
+				return "", ErrCharacter
+			}
+		}
+		if !strings.HasPrefix(digits, "978") && !strings.HasPrefix(digits, "979") {
+			return "", ErrPrefix
+		}
+		if checkDigit13(digits[:12]) != digits[12] {
+			return "", ErrChecksum
+		}
+		return ISBN(digits), nil
+	default:
+		return "", ErrLength
+	}
+}
+
+// Normalize returns the canonical form of s, or s unchanged when it is not a valid ISBN.
+// It suits lookups, where an invalid ISBN should simply match nothing.
+func Normalize(s string) string {
+	canonical, err := Parse(s)
+	if err != nil {
+		return s
+	}
+	return string(canonical)
+}
+
+// Valid reports whether s is a valid ISBN-10 or ISBN-13
+func Valid(s string) bool {
+	_, err := Parse(s)
+	return err == nil
+}
+
+func (i ISBN) String() string {
+	return string(i)
+}
+
+// ISBN10 returns the ISBN-10 form; only ISBN-13s starting with 978 have one
+func (i ISBN) ISBN10() (string, bool) {
+	if len(i) != 13 || !strings.HasPrefix(string(i), "978") {
+		return "", false
+	}
+	body := string(i[3:12])
+	return body + string(checkDigit10(body)), true
+}
+
+// checkDigit10 computes the ISBN-10 check digit of the first nine digits
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(body[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 computes the ISBN-13 check digit of the first twelve digits
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(body[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
@@ -0,0 +1,58 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in   string
+		want ISBN
+		err  error
+	}{
+		{in: "9780134190440", want: "9780134190440"},
+		{in: "978-0-13-419044-0", want: "9780134190440"},
+		{in: "0134190440", want: "9780134190440"},
+		{in: "0-13-419044-0", want: "9780134190440"},
+		{in: "080442957x", want: "9780804429573"},
+		{in: "0 8044 2957 X", want: "9780804429573"},
+		{in: "979-10-90636-07-1", want: "9791090636071"},
+		{in: "9780134190441", err: ErrChecksum},
+		{in: "0134190441", err: ErrChecksum},
+		{in: "X134190440", err: ErrCharacter},
+		{in: "97801341904X0", err: ErrCharacter},
+		{in: "9770134190440", err: ErrPrefix},
+		{in: "404", err: ErrLength},
+		{in: "", err: ErrLength},
+	}
+	for _, tc := range cases {
+		got, err := Parse(tc.in)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Errorf("Parse(%q) = %q, %v; want %q, %v", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestISBN10(t *testing.T) {
+	cases := map[ISBN]string{
+		"9780134190440": "0134190440",
+		"9780804429573": "080442957X",
+		"9791090636071": "",
+	}
+	for in, want := range cases {
+		got, ok := in.ISBN10()
+		if got != want || ok != (want != "") {
+			t.Errorf("%s.ISBN10() = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize("0-13-419044-0"); got != "9780134190440" {
+		t.Errorf("expected the canonical form, got %q", got)
+	}
+	if got := Normalize("not-an-isbn"); got != "not-an-isbn" {
+		t.Errorf("expected an invalid ISBN to be left alone, got %q", got)
+	}
+}
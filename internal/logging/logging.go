@@ -0,0 +1,105 @@
+/*
+   logging configures the global logrus logger (JSON lines to a rotating file, stdout or both)
+   and provides the request-scoped logger used by handlers.
+*/
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Supported values for the LOG_OUTPUT environment variable
+const (
+	OutputFile   = "file"
+	OutputStdout = "stdout"
+	OutputBoth   = "both"
+)
+
+// Config describes where log lines go and how the log file is rotated
+type Config struct {
+	Output     string
+	Filename   string
+	MaxSize    int // megabytes before rotation
+	MaxBackups int // old log files to retain
+	MaxAge     int // days to retain old log files
+	Level      logrus.Level
+}
+
+// ConfigFromEnv reads the LOG_* environment variables, falling back on defaults
+func ConfigFromEnv() Config {
+	output := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_OUTPUT")))
+	if output == "" {
+		output = OutputFile
+	}
+
+	logFileName := os.Getenv("LOG_FILENAME")
+	if logFileName == "" {
+		logFileName = "app.log" // Default log file name
+	}
+
+	level, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+
+	return Config{
+		Output:     output,
+		Filename:   filepath.Join("..", logFileName), // relative to the project's parent directory
+		MaxSize:    intFromEnv("LOG_FILE_MAXSIZE", 10),
+		MaxBackups: intFromEnv("LOG_FILE_MAXBACKUPS", 3),
+		MaxAge:     intFromEnv("LOG_FILE_MAXAGE", 7),
+		Level:      level,
+	}
+}
+
+func intFromEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Writer builds the sink described by the configuration
+func (cfg Config) Writer() (io.Writer, error) {
+	file := func() io.Writer {
+		return &lumberjack.Logger{
+			Filename:   cfg.Filename,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+		}
+	}
+
+	switch cfg.Output {
+	case OutputFile:
+		return file(), nil
+	case OutputStdout:
+		return os.Stdout, nil
+	case OutputBoth:
+		return io.MultiWriter(file(), os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unsupported log output %q", cfg.Output)
+	}
+}
+
+// Setup points the global logrus logger at the configured sink with JSON formatting
+func Setup(cfg Config) error {
+	out, err := cfg.Writer()
+	if err != nil {
+		return err
+	}
+	logrus.SetOutput(out)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetLevel(cfg.Level)
+	return nil
+}
@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"bookstore/internal/session_manager"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	session_manager.Store = sessions.NewCookieStore([]byte("logging-test-secret"))
+	os.Exit(m.Run())
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("LOG_OUTPUT", "")
+	t.Setenv("LOG_FILENAME", "")
+	t.Setenv("LOG_FILE_MAXBACKUPS", "9")
+	t.Setenv("LOG_LEVEL", "debug")
+
+	cfg := ConfigFromEnv()
+	if cfg.Output != OutputFile {
+		t.Fatalf("expected file output by default, got %q", cfg.Output)
+	}
+	if cfg.Filename != filepath.Join("..", "app.log") {
+		t.Fatalf("unexpected log file %q", cfg.Filename)
+	}
+	if cfg.MaxBackups != 9 || cfg.MaxSize != 10 {
+		t.Fatalf("expected MaxBackups 9 and MaxSize 10, got %+v", cfg)
+	}
+	if cfg.Level != logrus.DebugLevel {
+		t.Fatalf("expected debug level, got %v", cfg.Level)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	for _, output := range []string{OutputFile, OutputStdout, OutputBoth} {
+		cfg := Config{Output: output, Filename: filepath.Join(t.TempDir(), "app.log")}
+		if _, err := cfg.Writer(); err != nil {
+			t.Errorf("%s: unexpected error %v", output, err)
+		}
+	}
+	if _, err := (Config{Output: "syslog"}).Writer(); err == nil {
+		t.Fatal("expected an error for an unsupported output")
+	}
+}
+
+func newRouter(handler gin.HandlerFunc) (*gin.Engine, *test.Hook) {
+	logrus.SetOutput(io.Discard)
+	hook := test.NewGlobal()
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/books/:isbn", handler)
+	return router, hook
+}
+
+func TestMiddlewareGeneratesRequestID(t *testing.T) {
+	var seen string
+	router, hook := newRouter(func(c *gin.Context) {
+		seen = RequestID(c)
+		FromContext(c).Info("handled")
+		c.Status(http.StatusNoContent)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books/123", nil))
+
+	id := rec.Header().Get(RequestIDHeader)
+	if len(id) != 32 || id != seen {
+		t.Fatalf("expected a generated 32 character ID visible to the handler, got %q and %q", id, seen)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("expected a handler line and an access line, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Data["request_id"] != id || entry.Data["route"] != "/api/books/:isbn" {
+			t.Fatalf("expected request fields on every line, got %v", entry.Data)
+		}
+	}
+	access := hook.LastEntry()
+	if access.Data["status"] != http.StatusNoContent || access.Data["path"] != "/api/books/123" {
+		t.Fatalf("unexpected access log fields %v", access.Data)
+	}
+	if _, ok := access.Data["latency_ms"]; !ok {
+		t.Fatal("expected latency on the access log")
+	}
+}
+
+func TestMiddlewarePropagatesRequestIDAndUser(t *testing.T) {
+	router, hook := newRouter(func(c *gin.Context) { c.Status(http.StatusNotFound) })
+
+	// Build a session cookie for user 7
+	req := httptest.NewRequest(http.MethodGet, "/api/books/123", nil)
+	cookieRec := httptest.NewRecorder()
+	session, _ := session_manager.Store.Get(req, "session-name")
+	session.Values["user_id"] = uint(7)
+	session.Save(req, cookieRec)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/books/123", nil)
+	req.Header.Set(RequestIDHeader, "upstream-id.1")
+	req.AddCookie(cookieRec.Result().Cookies()[0])
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "upstream-id.1" {
+		t.Fatalf("expected the incoming ID to be propagated, got %q", got)
+	}
+	access := hook.LastEntry()
+	if access.Data["user_id"] != uint(7) {
+		t.Fatalf("expected user_id 7 on the access log, got %v", access.Data["user_id"])
+	}
+	if access.Level != logrus.WarnLevel {
+		t.Fatalf("expected a 404 to be logged as a warning, got %v", access.Level)
+	}
+}
+
+func TestMiddlewareRejectsUnsafeRequestID(t *testing.T) {
+	router, _ := newRouter(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/books/123", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got == "" || got == req.Header.Get(RequestIDHeader) {
+		t.Fatalf("expected a freshly generated ID, got %q", got)
+	}
+}
+
+func TestFromContextWithoutMiddleware(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if FromContext(c) == nil {
+		t.Fatal("expected a fallback logger")
+	}
+}
+
+func TestMiddlewareAddsTraceID(t *testing.T) {
+	router, hook := newRouter(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/books/123", nil).WithContext(ctx)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := hook.LastEntry().Data["trace_id"]; got != traceID.String() {
+		t.Fatalf("expected trace_id %s, got %v", traceID, got)
+	}
+}
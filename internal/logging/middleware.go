@@ -0,0 +1,103 @@
+// Request-scoped logging: correlation IDs, per-request logger and access log
+
+package logging
+
+import (
+	"bookstore/internal/session_manager"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the correlation ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+const loggerKey = "logger"
+
+// Incoming IDs are echoed into logs and headers, so only accept short, plain tokens
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Middleware assigns or propagates the X-Request-ID, attaches a request logger to the context
+// and writes one access log line per request once it completes
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		fields := logrus.Fields{
+			"request_id": requestID,
+			"method":     c.Request.Method,
+			"route":      route,
+		}
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			fields["trace_id"] = spanContext.TraceID().String()
+		}
+		if session, err := session_manager.Store.Get(c.Request, "session-name"); err == nil {
+			if userID, ok := session.Values["user_id"].(uint); ok {
+				fields["user_id"] = userID
+			}
+		}
+		entry := logrus.WithFields(fields)
+		c.Set(loggerKey, entry)
+
+		c.Next()
+
+		access := entry.WithFields(logrus.Fields{
+			"path":       c.Request.URL.Path,
+			"status":     c.Writer.Status(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  c.ClientIP(),
+			"bytes":      c.Writer.Size(),
+		})
+		if len(c.Errors) > 0 {
+			access = access.WithField("errors", c.Errors.String())
+		}
+
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			access.Error("request completed")
+		case status >= 400:
+			access.Warn("request completed")
+		default:
+			access.Info("request completed")
+		}
+	}
+}
+
+// FromContext returns the request logger, or the global logger outside of Middleware
+func FromContext(c *gin.Context) *logrus.Entry {
+	if value, ok := c.Get(loggerKey); ok {
+		if entry, ok := value.(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// RequestID returns the correlation ID assigned by Middleware
+func RequestID(c *gin.Context) string {
+	return c.Writer.Header().Get(RequestIDHeader)
+}
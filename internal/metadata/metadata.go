@@ -0,0 +1,142 @@
+/*
+   metadata looks up the bibliographic metadata of a book by ISBN from an external provider, so
+   admins can pre-fill or refresh a book instead of typing it in. Open Library is supported, and a
+   fixture-backed provider stands in for it in tests and offline development.
+*/
+
+package metadata
+
+import (
+	"bookstore/internal/isbn"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the provider knows no book with the ISBN
+var ErrNotFound = errors.New("no metadata found for this ISBN")
+
+// Metadata is what a provider knows about an edition
+type Metadata struct {
+	ISBN          string   `json:"isbn"`
+	Title         string   `json:"title"`
+	Authors       []string `json:"authors"`
+	Description   string   `json:"description,omitempty"`
+	PublishedYear int      `json:"published_year,omitempty"`
+	Publishers    []string `json:"publishers,omitempty"`
+	PageCount     int      `json:"page_count,omitempty"`
+	CoverURL      string   `json:"cover_url,omitempty"`
+	Source        string   `json:"source"`
+}
+
+// Author joins the authors the way books store them, in a single string
+func (m Metadata) Author() string {
+	return strings.Join(m.Authors, ", ")
+}
+
+// MetadataProvider looks up books by ISBN
+type MetadataProvider interface {
+	// Lookup returns the metadata of the edition with the given canonical ISBN-13, or ErrNotFound
+	Lookup(ctx context.Context, isbn string) (Metadata, error)
+}
+
+// Default is the provider used by the handlers, nil when lookups are disabled; Setup replaces it
+var Default MetadataProvider
+
+// Config selects and configures the provider
+type Config struct {
+	Provider       string // "openlibrary", "fixtures" or "none"
+	OpenLibraryURL string
+	FixturesFile   string
+	Timeout        time.Duration
+}
+
+// ConfigFromEnv reads METADATA_PROVIDER (openlibrary by default), METADATA_OPENLIBRARY_URL,
+// METADATA_FIXTURES_FILE and METADATA_TIMEOUT
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Provider:       strings.ToLower(os.Getenv("METADATA_PROVIDER")),
+		OpenLibraryURL: os.Getenv("METADATA_OPENLIBRARY_URL"),
+		FixturesFile:   os.Getenv("METADATA_FIXTURES_FILE"),
+		Timeout:        5 * time.Second,
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = "openlibrary"
+	}
+	if cfg.OpenLibraryURL == "" {
+		cfg.OpenLibraryURL = "https://openlibrary.org"
+	}
+	if value := os.Getenv("METADATA_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return Config{}, fmt.Errorf("METADATA_TIMEOUT must be a positive duration, got %q", value)
+		}
+		cfg.Timeout = timeout
+	}
+
+	switch cfg.Provider {
+	case "openlibrary", "none":
+	case "fixtures":
+		if cfg.FixturesFile == "" {
+			return Config{}, errors.New("METADATA_PROVIDER=fixtures requires METADATA_FIXTURES_FILE")
+		}
+	default:
+		return Config{}, fmt.Errorf("METADATA_PROVIDER must be openlibrary, fixtures or none, got %q", cfg.Provider)
+	}
+	return cfg, nil
+}
+
+// New builds the provider selected by cfg, nil for "none"
+func New(cfg Config) (MetadataProvider, error) {
+	switch cfg.Provider {
+	case "none":
+		return nil, nil
+	case "fixtures":
+		return LoadFixtures(cfg.FixturesFile)
+	default:
+		return NewOpenLibrary(cfg.OpenLibraryURL, cfg.Timeout), nil
+	}
+}
+
+// Setup makes the provider selected by cfg the Default
+func Setup(cfg Config) error {
+	provider, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	Default = provider
+	return nil
+}
+
+// Fixtures is a provider answering from a fixed set of books keyed by ISBN, in any form
+type Fixtures map[string]Metadata
+
+// LoadFixtures reads fixtures from a JSON object mapping ISBNs to metadata
+func LoadFixtures(path string) (Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures Fixtures
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+func (f Fixtures) Lookup(ctx context.Context, number string) (Metadata, error) {
+	for key, found := range f {
+		if isbn.Normalize(key) == number {
+			found.ISBN = number
+			if found.Source == "" {
+				found.Source = "fixtures"
+			}
+			return found, nil
+		}
+	}
+	return Metadata{}, ErrNotFound
+}
@@ -0,0 +1,172 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openLibraryDocuments are trimmed copies of what openlibrary.org serves for The Go Programming Language
+var openLibraryDocuments = map[string]string{
+	"/books/OL26837913M.json": `{
+		"title": "The Go Programming Language",
+		"authors": [{"key": "/authors/OL7115219A"}, {"key": "/authors/OL3405231A"}],
+		"works": [{"key": "/works/OL17802857W"}],
+		"publish_date": "Oct 26, 2015",
+		"publishers": ["Addison-Wesley"],
+		"number_of_pages": 380,
+		"covers": [-1, 8091016]
+	}`,
+	"/works/OL17802857W.json": `{
+		"authors": [{"author": {"key": "/authors/OL7115219A"}}],
+		"description": {"type": "/type/text", "value": "The authoritative resource to writing clear and idiomatic Go."}
+	}`,
+	"/authors/OL7115219A.json": `{"name": "Alan A. A. Donovan"}`,
+	"/authors/OL3405231A.json": `{"name": "Brian W. Kernighan"}`,
+	"/books/OL2M.json":         `{"title": "Anonymous", "works": [{"key": "/works/OL2W"}], "description": "Edition text."}`,
+	"/works/OL2W.json":         `{"authors": [{"author": {"key": "/authors/OL9A"}}], "description": "Work text."}`,
+	"/authors/OL9A.json":       `{"name": "Work Author"}`,
+}
+
+func openLibraryServer(t *testing.T) *httptest.Server {
+	return slowOpenLibraryServer(t, 0)
+}
+
+// slowOpenLibraryServer answers every request after delay
+func slowOpenLibraryServer(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		switch r.URL.Path {
+		case "/isbn/9780134190440.json":
+			http.Redirect(w, r, "/books/OL26837913M.json", http.StatusFound)
+			return
+		case "/isbn/9791090636071.json":
+			http.Redirect(w, r, "/books/OL2M.json", http.StatusFound)
+			return
+		case "/isbn/9780000000002.json":
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		document, ok := openLibraryDocuments[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(document))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenLibraryLookup(t *testing.T) {
+	provider := NewOpenLibrary(openLibraryServer(t).URL+"/", time.Second)
+
+	got, err := provider.Lookup(context.Background(), "9780134190440")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	want := Metadata{
+		ISBN:          "9780134190440",
+		Title:         "The Go Programming Language",
+		Authors:       []string{"Alan A. A. Donovan", "Brian W. Kernighan"},
+		Description:   "The authoritative resource to writing clear and idiomatic Go.",
+		PublishedYear: 2015,
+		Publishers:    []string{"Addison-Wesley"},
+		PageCount:     380,
+		CoverURL:      "https://covers.openlibrary.org/b/id/8091016-L.jpg",
+		Source:        "openlibrary",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+	if got.Author() != "Alan A. A. Donovan, Brian W. Kernighan" {
+		t.Fatalf("unexpected author %q", got.Author())
+	}
+
+	// Editions without authors take them from their work, and keep their own description
+	anonymous, err := provider.Lookup(context.Background(), "9791090636071")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if !reflect.DeepEqual(anonymous.Authors, []string{"Work Author"}) || anonymous.Description != "Edition text." {
+		t.Fatalf("unexpected metadata %+v", anonymous)
+	}
+
+	if _, err := provider.Lookup(context.Background(), "9780804429573"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := provider.Lookup(context.Background(), "9780000000002"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a provider error, got %v", err)
+	}
+}
+
+func TestOpenLibraryLookupTimeout(t *testing.T) {
+	// Each request fits in the timeout, but the edition, its work and its two authors do not
+	provider := NewOpenLibrary(slowOpenLibraryServer(t, 60*time.Millisecond).URL, 200*time.Millisecond)
+
+	start := time.Now()
+	if _, err := provider.Lookup(context.Background(), "9780134190440"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the lookup to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Fatalf("expected the timeout to cover the whole lookup, took %v", elapsed)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	os.WriteFile(path, []byte(`{"0-13-419044-0": {"title": "The Go Programming Language", "authors": ["Alan A. A. Donovan"]}}`), 0o600)
+
+	t.Setenv("METADATA_PROVIDER", "fixtures")
+	t.Setenv("METADATA_FIXTURES_FILE", path)
+	t.Setenv("METADATA_TIMEOUT", "")
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	provider, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	got, err := provider.Lookup(context.Background(), "9780134190440")
+	if err != nil || got.Title != "The Go Programming Language" || got.ISBN != "9780134190440" || got.Source != "fixtures" {
+		t.Fatalf("unexpected lookup %+v, %v", got, err)
+	}
+	if _, err := provider.Lookup(context.Background(), "9791090636071"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("METADATA_PROVIDER", "")
+	t.Setenv("METADATA_OPENLIBRARY_URL", "")
+	t.Setenv("METADATA_TIMEOUT", "")
+	cfg, err := ConfigFromEnv()
+	if err != nil || cfg.Provider != "openlibrary" || cfg.OpenLibraryURL != "https://openlibrary.org" || cfg.Timeout != 5*time.Second {
+		t.Fatalf("unexpected defaults %+v, %v", cfg, err)
+	}
+
+	t.Setenv("METADATA_PROVIDER", "none")
+	cfg, _ = ConfigFromEnv()
+	if provider, err := New(cfg); provider != nil || err != nil {
+		t.Fatalf("expected no provider, got %v, %v", provider, err)
+	}
+
+	for key, value := range map[string]string{"METADATA_PROVIDER": "isbndb", "METADATA_TIMEOUT": "soon"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := ConfigFromEnv(); err == nil {
+				t.Fatalf("expected %s=%s to be rejected", key, value)
+			}
+		})
+	}
+}
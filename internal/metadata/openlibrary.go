@@ -0,0 +1,176 @@
+// The Open Library provider, reading the edition, author and work JSON documents of openlibrary.org
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDocument caps the Open Library documents read, which are a few kilobytes
+const maxDocument = 1 << 20
+
+// OpenLibrary looks books up on Open Library, or a service with the same API at baseURL
+type OpenLibrary struct {
+	baseURL  string
+	coverURL string
+	timeout  time.Duration // for a whole lookup, across its requests
+	client   *http.Client
+}
+
+func NewOpenLibrary(baseURL string, timeout time.Duration) *OpenLibrary {
+	return &OpenLibrary{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		coverURL: "https://covers.openlibrary.org",
+		timeout:  timeout,
+		client:   &http.Client{},
+	}
+}
+
+// olText is a description, either a plain string or a {"type": "/type/text", "value": ...} object
+type olText string
+
+func (t *olText) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*t = olText(text)
+		return nil
+	}
+	var typed struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return err
+	}
+	*t = olText(typed.Value)
+	return nil
+}
+
+type olKey struct {
+	Key string `json:"key"`
+}
+
+type olEdition struct {
+	Title         string   `json:"title"`
+	Subtitle      string   `json:"subtitle"`
+	Authors       []olKey  `json:"authors"`
+	Works         []olKey  `json:"works"`
+	Description   olText   `json:"description"`
+	PublishDate   string   `json:"publish_date"`
+	Publishers    []string `json:"publishers"`
+	NumberOfPages int      `json:"number_of_pages"`
+	Covers        []int    `json:"covers"`
+}
+
+type olWork struct {
+	Authors []struct {
+		Author olKey `json:"author"`
+	} `json:"authors"`
+	Description olText `json:"description"`
+}
+
+var yearPattern = regexp.MustCompile(`\b\d{4}\b`)
+
+// Lookup reads the edition, then its authors, and its work for what the edition leaves out,
+// giving up when they take longer than the timeout altogether
+func (o *OpenLibrary) Lookup(ctx context.Context, isbn string) (Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	var edition olEdition
+	if err := o.get(ctx, "/isbn/"+isbn+".json", &edition); err != nil {
+		return Metadata{}, err
+	}
+
+	found := Metadata{
+		ISBN:        isbn,
+		Title:       edition.Title,
+		Description: strings.TrimSpace(string(edition.Description)),
+		Publishers:  edition.Publishers,
+		PageCount:   edition.NumberOfPages,
+		Source:      "openlibrary",
+	}
+	if edition.Subtitle != "" {
+		found.Title += ": " + edition.Subtitle
+	}
+	if year := yearPattern.FindString(edition.PublishDate); year != "" {
+		found.PublishedYear, _ = strconv.Atoi(year)
+	}
+	for _, cover := range edition.Covers {
+		// Open Library marks missing covers with -1
+		if cover > 0 {
+			found.CoverURL = fmt.Sprintf("%s/b/id/%d-L.jpg", o.coverURL, cover)
+			break
+		}
+	}
+
+	authorKeys := make([]string, 0, len(edition.Authors))
+	for _, author := range edition.Authors {
+		authorKeys = append(authorKeys, author.Key)
+	}
+	if len(edition.Works) > 0 && (len(authorKeys) == 0 || found.Description == "") {
+		var work olWork
+		if err := o.get(ctx, edition.Works[0].Key+".json", &work); err != nil && !errors.Is(err, ErrNotFound) {
+			return Metadata{}, err
+		}
+		if found.Description == "" {
+			found.Description = strings.TrimSpace(string(work.Description))
+		}
+		if len(authorKeys) == 0 {
+			for _, author := range work.Authors {
+				authorKeys = append(authorKeys, author.Author.Key)
+			}
+		}
+	}
+
+	for _, key := range authorKeys {
+		var author struct {
+			Name string `json:"name"`
+		}
+		if err := o.get(ctx, key+".json", &author); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return Metadata{}, err
+		}
+		if author.Name != "" {
+			found.Authors = append(found.Authors, author.Name)
+		}
+	}
+	return found, nil
+}
+
+// get decodes the JSON document at path; Open Library redirects ISBNs to their edition
+func (o *OpenLibrary) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "bookstore-metadata/1.0")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("open library: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("open library: GET %s: %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocument)).Decode(v); err != nil {
+		return fmt.Errorf("open library: GET %s: %w", path, err)
+	}
+	return nil
+}
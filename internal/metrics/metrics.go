@@ -0,0 +1,140 @@
+/*
+   metrics exposes Prometheus collectors for HTTP traffic, the database pool and business events,
+   along with the gin middleware and handler that record and serve them.
+*/
+
+package metrics
+
+import (
+	"bookstore/internal/apierror"
+	"crypto/subtle"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bookstore"
+
+// Registry holds every bookstore collector; it is served at /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Registrations counts successfully created user accounts
+	Registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_registrations_total",
+		Help:      "User accounts registered.",
+	})
+
+	// Logins counts login attempts by result ("success" or "failure")
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+
+	// Purchases counts completed book purchases
+	Purchases = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "book_purchases_total",
+		Help:      "Books purchased.",
+	})
+
+	// Revenue sums the amount paid for completed purchases
+	Revenue = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purchase_revenue_total",
+		Help:      "Total amount paid for purchased books.",
+	})
+
+	// ReviewsPosted counts reviews written by users
+	ReviewsPosted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reviews_posted_total",
+		Help:      "Reviews posted.",
+	})
+
+	// Downloads counts book files streamed through the download proxy
+	Downloads = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "book_downloads_total",
+		Help:      "Book files downloaded.",
+	})
+)
+
+// Login results used as the Logins label
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		Registrations, Logins, Purchases, Revenue, ReviewsPosted, Downloads,
+	)
+}
+
+// RegisterDBStats exposes the connection pool statistics of db
+func RegisterDBStats(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// RecordPurchase counts one purchase and adds its amount to the revenue
+func RecordPurchase(amount float64) {
+	Purchases.Inc()
+	Revenue.Add(amount)
+}
+
+// Middleware records the count and latency of every request, labelled by its route template
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// Use the registered route (e.g. /api/books/:id) so label cardinality stays bounded
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the registry in the Prometheus text format to scrapers sending token as a bearer
+// token, since the metrics reveal traffic and revenue
+func Handler(token string) gin.HandlerFunc {
+	serve := gin.WrapH(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	expected := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		if token == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), expected) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			apierror.Abort(c, apierror.Unauthorized("A valid metrics token is required"))
+			return
+		}
+		serve(c)
+	}
+}
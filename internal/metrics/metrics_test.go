@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bookstore/internal/apierror"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareLabelsByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/books/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/api/books/:id", "200"))
+	for _, id := range []string{"1", "2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/books/"+id, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/api/books/:id", "200")) - before; got != 2 {
+		t.Fatalf("expected 2 requests for the route template, got %v", got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "unmatched", "404")); got < 1 {
+		t.Fatalf("expected the unmatched request to be counted, got %v", got)
+	}
+}
+
+func TestHandlerExposesMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	RecordPurchase(12.5)
+	Logins.WithLabelValues(LoginFailure).Inc()
+
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.GET("/metrics", Handler("scrape-token"))
+	for _, header := range []string{"", "Bearer wrong", "scrape-token"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Authorization", header)
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || strings.Contains(rec.Body.String(), "bookstore_") {
+			t.Fatalf("expected 401 for Authorization %q, got %d", header, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-token")
+	router.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	for _, name := range []string{
+		"bookstore_book_purchases_total",
+		"bookstore_purchase_revenue_total",
+		`bookstore_user_logins_total{result="failure"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, name) {
+			t.Errorf("expected %s in /metrics output", name)
+		}
+	}
+}
+
+func TestRegisterDBStats(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer db.Close()
+
+	if err := RegisterDBStats(db); err != nil {
+		t.Fatalf("RegisterDBStats: %v", err)
+	}
+	if n, err := testutil.GatherAndCount(Registry, "go_sql_open_connections"); err != nil || n != 1 {
+		t.Fatalf("expected the pool gauge to be registered, got %d (%v)", n, err)
+	}
+}
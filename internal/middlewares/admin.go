@@ -3,19 +3,33 @@
 package middlewares
 
 import (
+	"bookstore/internal/apierror"
 	"bookstore/internal/session_manager"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
 
+// adminClientCert is set when admin routes also require a verified TLS client certificate
+var adminClientCert atomic.Bool
+
+// RequireAdminClientCert turns the mutual TLS requirement of admin routes on or off
+func RequireAdminClientCert(required bool) {
+	adminClientCert.Store(required)
+}
+
 func AdminOnly() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if adminClientCert.Load() && (c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0) {
+			apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeClientCertRequired, "A trusted client certificate is required"))
+			return
+		}
+
 		session, _ := session_manager.Store.Get(c.Request, "session-name")
 		role, exists := session.Values["role"]
 		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
-			c.Abort()
+			apierror.Abort(c, apierror.Forbidden("Permission denied"))
 			return
 		}
 		session.Save(c.Request, c.Writer)
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"bookstore/internal/apierror"
+	"bookstore/internal/session_manager"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+func TestAdminOnlyRequiresClientCertificate(t *testing.T) {
+	session_manager.Store = sessions.NewCookieStore([]byte("middlewares-test-secret"))
+	RequireAdminClientCert(true)
+	t.Cleanup(func() { RequireAdminClientCert(false) })
+
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.GET("/admin", AdminOnly(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	// An admin session cookie
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := session_manager.Store.Get(req, "session-name")
+	session.Values["role"] = "admin"
+	session.Save(req, rec)
+	cookie := rec.Result().Cookies()[0]
+
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	cases := []struct {
+		name   string
+		tls    *tls.ConnectionState
+		status int
+		code   string
+	}{
+		{"plain HTTP", nil, http.StatusForbidden, apierror.CodeClientCertRequired},
+		{"TLS without certificate", &tls.ConnectionState{}, http.StatusForbidden, apierror.CodeClientCertRequired},
+		{"verified certificate", verified, http.StatusNoContent, ""},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.TLS = tc.tls
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d %s", tc.name, tc.status, rec.Code, rec.Body)
+		}
+		if tc.code != "" && !strings.Contains(rec.Body.String(), tc.code) {
+			t.Errorf("%s: expected code %s, got %s", tc.name, tc.code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+/*This is a middleware whose main role is to cap the size of request bodies*/
+
+package middlewares
+
+import (
+	"bookstore/internal/apierror"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimit caps request bodies at defaultLimit bytes, or at routeLimits["METHOD /route/:param"]
+// for the routes listed there. Bodies announced as too large are refused up front; others are
+// cut off while reading, which makes binding fail with a 413.
+func BodyLimit(defaultLimit int64, routeLimits map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := defaultLimit
+		if routeLimit, ok := routeLimits[c.Request.Method+" "+c.FullPath()]; ok {
+			limit = routeLimit
+		}
+
+		if c.Request.ContentLength > limit {
+			apierror.Abort(c, apierror.PayloadTooLarge(limit))
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
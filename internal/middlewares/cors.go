@@ -0,0 +1,88 @@
+/*This is a middleware whose main role is to allow credentialed cross-origin requests from the configured frontends only*/
+
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// OriginMatcher reports whether an origin is allowed. Entries are exact origins such as
+// "https://shop.example.com" or wildcard subdomain patterns such as "https://*.example.com",
+// which match subdomains at any depth but not the bare domain.
+type OriginMatcher struct {
+	exact     map[string]bool
+	wildcards []wildcardOrigin
+}
+
+// wildcardOrigin is a parsed "scheme://*.domain[:port]" pattern
+type wildcardOrigin struct {
+	scheme string
+	suffix string // ".domain"
+	port   string
+}
+
+func NewOriginMatcher(origins []string) (*OriginMatcher, error) {
+	m := &OriginMatcher{exact: map[string]bool{}}
+	for _, origin := range origins {
+		if origin == "*" {
+			return nil, errors.New(`"*" cannot be used with credentialed CORS; list the allowed origins`)
+		}
+
+		parsed, err := url.Parse(strings.ToLower(origin))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Path != "" {
+			return nil, fmt.Errorf("invalid CORS origin %q", origin)
+		}
+
+		host := parsed.Hostname()
+		if !strings.Contains(host, "*") {
+			m.exact[parsed.Scheme+"://"+parsed.Host] = true
+			continue
+		}
+
+		suffix, ok := strings.CutPrefix(host, "*")
+		if !ok || !strings.HasPrefix(suffix, ".") || strings.Contains(suffix, "*") || !strings.Contains(suffix[1:], ".") {
+			return nil, fmt.Errorf("wildcards are only allowed as the whole first label, as in https://*.example.com: %q", origin)
+		}
+		m.wildcards = append(m.wildcards, wildcardOrigin{scheme: parsed.Scheme, suffix: suffix, port: parsed.Port()})
+	}
+	return m, nil
+}
+
+// Allowed checks an Origin request header against the configured origins
+func (m *OriginMatcher) Allowed(origin string) bool {
+	parsed, err := url.Parse(strings.ToLower(origin))
+	if err != nil || parsed.Host == "" || parsed.Path != "" {
+		return false
+	}
+	if m.exact[parsed.Scheme+"://"+parsed.Host] {
+		return true
+	}
+
+	host := parsed.Hostname()
+	for _, w := range m.wildcards {
+		if parsed.Scheme == w.scheme && parsed.Port() == w.port && strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS allows credentialed requests from cfg.AllowedOrigins with the given extra request headers
+func CORS(cfg SecurityConfig, allowHeaders ...string) (gin.HandlerFunc, error) {
+	matcher, err := NewOriginMatcher(cfg.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+
+	config := cors.DefaultConfig()
+	config.AllowOriginFunc = matcher.Allowed
+	config.AllowCredentials = true
+	config.AddAllowHeaders(allowHeaders...)
+	return cors.New(config), nil
+}
@@ -0,0 +1,38 @@
+/*This is a middleware whose main role is to flag legacy routes that have an /api/v1 successor*/
+
+package middlewares
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LegacyDeprecatedAt is when the unversioned /api routes were superseded by /api/v1
+var LegacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// Deprecated adds a Deprecation header (RFC 9745) and a Link to the successor route.
+// Path parameters such as ":isbn" in successor are filled in from the matched request.
+// An empty successor leaves the Link to the handler, see SuccessorVersion.
+func Deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", fmt.Sprintf("@%d", LegacyDeprecatedAt.Unix()))
+		if successor != "" {
+			link := successor
+			for _, param := range c.Params {
+				link = strings.ReplaceAll(link, ":"+param.Key, url.PathEscape(param.Value))
+			}
+			SuccessorVersion(c, link)
+		}
+		c.Next()
+	}
+}
+
+// SuccessorVersion sets the Link to the successor of a deprecated route. Handlers call it when
+// the successor depends on the resource rather than on the request path.
+func SuccessorVersion(c *gin.Context, link string) {
+	c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", link))
+}
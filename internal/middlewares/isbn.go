@@ -0,0 +1,20 @@
+package middlewares
+
+import (
+	"bookstore/internal/isbn"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NormalizeISBN rewrites the :isbn route parameter to its canonical ISBN-13, so every route
+// accepts ISBN-10s and hyphenated forms. Invalid values are left alone and match no book.
+func NormalizeISBN() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for i, param := range c.Params {
+			if param.Key == "isbn" {
+				c.Params[i].Value = isbn.Normalize(param.Value)
+			}
+		}
+		c.Next()
+	}
+}
@@ -3,6 +3,7 @@
 package middlewares
 
 import (
+	"bookstore/internal/apierror"
 	"bookstore/internal/models"
 	"bookstore/internal/session_manager"
 	"net/http"
@@ -15,22 +16,19 @@ func CheckOwnershipStatus() gin.HandlerFunc {
 		session, _ := session_manager.Store.Get(c.Request, "session-name")
 		userID, exists := session.Values["user_id"].(uint)
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
+			apierror.Abort(c, apierror.Unauthorized("Unauthorized"))
 			return
 		}
 
 		isbn := c.Param("isbn")
-		ownsBook, err := models.HasUserBoughtBook(userID, isbn)
+		ownsBook, err := models.HasUserBoughtBook(models.DBWithContext(c.Request.Context()), userID, isbn)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check ownership status"})
-			c.Abort()
+			apierror.Abort(c, apierror.Internal("Failed to check ownership status", err))
 			return
 		}
 
 		if ownsBook {
-			c.JSON(http.StatusOK, gin.H{"message": "Already bought"})
-			c.Abort()
+			apierror.Abort(c, apierror.New(http.StatusConflict, apierror.CodeAlreadyOwned, "Already bought"))
 			return
 		}
 
@@ -0,0 +1,141 @@
+/*This is a middleware whose main role is to add browser security headers to every response*/
+
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCSP suits a JSON API: nothing may be loaded and responses may not be framed
+const DefaultCSP = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'"
+
+// SecurityConfig holds the response security headers, the allowed CORS origins, the default body
+// size limit and the proxies trusted to report the client address
+type SecurityConfig struct {
+	ContentSecurityPolicy string
+	HSTSMaxAge            time.Duration // 0 disables HSTS
+	FrameOptions          string
+	ReferrerPolicy        string
+	AllowedOrigins        []string
+	MaxBodySize           int64
+	TrustedProxies        []string // IPs or CIDRs whose X-Forwarded-For is believed; none when empty
+}
+
+// SecurityConfigFromEnv reads the SECURITY_* variables, CORS_ALLOWED_ORIGINS, MAX_BODY_SIZE and
+// TRUSTED_PROXIES. CORS_ALLOWED_ORIGINS falls back to REACT_APP_FRONTEND.
+func SecurityConfigFromEnv() (SecurityConfig, error) {
+	cfg := SecurityConfig{
+		ContentSecurityPolicy: envOr("SECURITY_CSP", DefaultCSP),
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		FrameOptions:          envOr("SECURITY_FRAME_OPTIONS", "DENY"),
+		ReferrerPolicy:        envOr("SECURITY_REFERRER_POLICY", "no-referrer"),
+		MaxBodySize:           1 << 20,
+	}
+
+	if value := os.Getenv("SECURITY_HSTS_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return SecurityConfig{}, fmt.Errorf("SECURITY_HSTS_MAX_AGE must be a duration such as 8760h, or 0 to disable")
+		}
+		cfg.HSTSMaxAge = maxAge
+	}
+
+	if value := os.Getenv("MAX_BODY_SIZE"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			return SecurityConfig{}, fmt.Errorf("MAX_BODY_SIZE must be a positive number of bytes")
+		}
+		cfg.MaxBodySize = size
+	}
+
+	origins := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if origins == "" {
+		origins = os.Getenv("REACT_APP_FRONTEND")
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, proxy)
+		}
+	}
+	return cfg, nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// SecurityHeaders sets CSP, HSTS, X-Content-Type-Options, X-Frame-Options and Referrer-Policy.
+// HSTS is only sent over HTTPS, directly or behind a trusted proxy setting X-Forwarded-Proto.
+// Handlers serving HTML may replace the Content-Security-Policy for their own response.
+func SecurityHeaders(cfg SecurityConfig) gin.HandlerFunc {
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d; includeSubDomains", int64(cfg.HSTSMaxAge/time.Second))
+	}
+	proxies := parseProxies(cfg.TrustedProxies)
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		if cfg.ContentSecurityPolicy != "" {
+			header.Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+		}
+		header.Set("X-Content-Type-Options", "nosniff")
+		if cfg.FrameOptions != "" {
+			header.Set("X-Frame-Options", cfg.FrameOptions)
+		}
+		if cfg.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		if hsts != "" && (c.Request.TLS != nil || (c.GetHeader("X-Forwarded-Proto") == "https" && fromProxy(c, proxies))) {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+		c.Next()
+	}
+}
+
+// parseProxies turns TrustedProxies into networks, a single IP being a network of its own.
+// Invalid entries are skipped; gin's SetTrustedProxies rejects them at startup.
+func parseProxies(proxies []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil {
+				bits := 128
+				if ip.To4() != nil {
+					bits = 32
+				}
+				proxy = fmt.Sprintf("%s/%d", proxy, bits)
+			}
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+// fromProxy tells whether the request comes straight from one of the trusted proxies
+func fromProxy(c *gin.Context, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	for _, network := range proxies {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+	"bookstore/internal/apierror"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestOriginMatcher(t *testing.T) {
+	matcher, err := NewOriginMatcher([]string{"http://localhost:5173", "https://*.example.com", "https://*.staging.example.org:8443"})
+	if err != nil {
+		t.Fatalf("NewOriginMatcher: %v", err)
+	}
+
+	cases := map[string]bool{
+		"http://localhost:5173":                true,
+		"HTTP://LOCALHOST:5173":                true,
+		"http://localhost:3000":                false,
+		"https://shop.example.com":             true,
+		"https://a.b.example.com":              true,
+		"https://example.com":                  false,
+		"http://shop.example.com":              false,
+		"https://shop.example.com.evil.io":     false,
+		"https://evilexample.com":              false,
+		"https://app.staging.example.org:8443": true,
+		"https://app.staging.example.org":      false,
+		"null":                                 false,
+	}
+	for origin, want := range cases {
+		if got := matcher.Allowed(origin); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestOriginMatcherRejectsUnsafePatterns(t *testing.T) {
+	for _, origin := range []string{"*", "https://*", "https://*.com", "https://shop.*.example.com", "ftp://example.com", "example.com"} {
+		if _, err := NewOriginMatcher([]string{origin}); err == nil {
+			t.Errorf("expected %q to be rejected", origin)
+		}
+	}
+}
+
+func TestSecurityConfigFromEnv(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	t.Setenv("REACT_APP_FRONTEND", "http://localhost:5173/")
+	t.Setenv("SECURITY_HSTS_MAX_AGE", "")
+	t.Setenv("MAX_BODY_SIZE", "")
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	cfg, err := SecurityConfigFromEnv()
+	if err != nil {
+		t.Fatalf("SecurityConfigFromEnv: %v", err)
+	}
+	if len(cfg.AllowedOrigins) != 1 || cfg.AllowedOrigins[0] != "http://localhost:5173" {
+		t.Fatalf("expected the frontend origin as fallback, got %v", cfg.AllowedOrigins)
+	}
+	if cfg.ContentSecurityPolicy != DefaultCSP || cfg.MaxBodySize != 1<<20 || cfg.HSTSMaxAge != 365*24*time.Hour || cfg.TrustedProxies != nil {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://*.example.org")
+	t.Setenv("MAX_BODY_SIZE", "2048")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1, 192.168.0.0/16,")
+	cfg, _ = SecurityConfigFromEnv()
+	if len(cfg.AllowedOrigins) != 2 || cfg.MaxBodySize != 2048 || len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1] != "192.168.0.0/16" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("MAX_BODY_SIZE", "lots")
+	if _, err := SecurityConfigFromEnv(); err == nil {
+		t.Fatal("expected an invalid MAX_BODY_SIZE to be rejected")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	router := gin.New()
+	router.Use(SecurityHeaders(SecurityConfig{ContentSecurityPolicy: DefaultCSP, HSTSMaxAge: time.Hour, FrameOptions: "DENY", ReferrerPolicy: "no-referrer", TrustedProxies: []string{"10.0.0.1"}}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	want := map[string]string{
+		"Content-Security-Policy": DefaultCSP,
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+	}
+	for header, value := range want {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("%s: expected %q, got %q", header, value, got)
+		}
+	}
+	if rec.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("expected no HSTS over plain HTTP")
+	}
+
+	// X-Forwarded-Proto counts only when a trusted proxy sends it
+	for remote, want := range map[string]string{"203.0.113.7:4000": "", "10.0.0.1:4000": "max-age=3600; includeSubDomains"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Strict-Transport-Security"); got != want {
+			t.Errorf("from %s: expected HSTS header %q, got %q", remote, want, got)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	corsMiddleware, err := CORS(SecurityConfig{AllowedOrigins: []string{"https://*.example.com"}}, "X-CSRF-Token")
+	if err != nil {
+		t.Fatalf("CORS: %v", err)
+	}
+	router := gin.New()
+	router.Use(corsMiddleware)
+	router.POST("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "X-CSRF-Token")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://shop.example.com")
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://shop.example.com" || rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected the subdomain to be allowed, got %v", rec.Header())
+	}
+	if !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "X-Csrf-Token") {
+		t.Fatalf("expected the CSRF header to be allowed, got %q", rec.Header().Get("Access-Control-Allow-Headers"))
+	}
+	if rec := preflight("https://evil.io"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected an unknown origin to be refused, got %d", rec.Code)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(apierror.Middleware(), BodyLimit(64, map[string]int64{"POST /big": 1024}))
+	handler := func(c *gin.Context) {
+		var body map[string]string
+		if err := c.ShouldBindJSON(&body); err != nil {
+			apierror.Abort(c, apierror.Validation(err))
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	router.POST("/small", handler)
+	router.POST("/big", handler)
+
+	payload := `{"comment":"` + strings.Repeat("a", 200) + `"}`
+	send := func(path string, chunked bool) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload))
+		if chunked {
+			req.ContentLength = -1 // the size is only discovered while reading
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send("/small", false); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("announced body over the default: expected 413, got %d", code)
+	}
+	if code := send("/small", true); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("streamed body over the default: expected 413, got %d", code)
+	}
+	if code := send("/big", true); code != http.StatusOK {
+		t.Errorf("body within the route limit: expected 200, got %d", code)
+	}
+}
@@ -0,0 +1,105 @@
+// includes the audit log model and helper functions.
+
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditChange is the before and after value of one changed field
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditChanges maps field names to their change; it is stored as JSON text
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+func (c *AuditChanges) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	default:
+		return errors.New("unsupported type for AuditChanges")
+	}
+}
+
+// AuditLog records who did what to which record, from where and when
+type AuditLog struct {
+	ID         uint         `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time    `json:"created_at" gorm:"index"`
+	ActorID    *uint        `json:"actor_id" gorm:"index"` // nil when the actor is unknown, e.g. a failed login
+	ActorName  string       `json:"actor_name" gorm:"index"`
+	Action     string       `json:"action" gorm:"index;not null"`
+	TargetType string       `json:"target_type"`
+	TargetID   string       `json:"target_id"`
+	Changes    AuditChanges `json:"changes" gorm:"type:text"`
+	IP         string       `json:"ip"`
+	RequestID  string       `json:"request_id"`
+}
+
+// AuditFilter narrows down ListAuditLogs; zero values are ignored
+type AuditFilter struct {
+	ActorID   *uint
+	ActorName string
+	Action    string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// CreateAuditLog stores an audit log entry
+func CreateAuditLog(db *gorm.DB, entry *AuditLog) error {
+	return db.Create(entry).Error
+}
+
+// ListAuditLogs retrieves audit log entries matching the filter, newest first
+func ListAuditLogs(db *gorm.DB, filter AuditFilter) ([]AuditLog, error) {
+	query := db.Model(&AuditLog{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.ActorName != "" {
+		query = query.Where("actor_name = ?", filter.ActorName)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	var entries []AuditLog
+	if err := query.Order("created_at DESC, id DESC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,307 @@
+// includes the authors credited on books, the roles they are credited in, and their helper functions.
+
+package models
+
+import (
+	"bookstore/internal/slug"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Contributor roles
+const (
+	RoleAuthor      = "author"
+	RoleEditor      = "editor"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+)
+
+// ErrAuthorName is returned for author names without a letter or digit, which have no slug
+var ErrAuthorName = errors.New("an author name must contain a letter or digit")
+
+// Author is a person credited on books, identified in URLs by the slug of their name
+type Author struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	Biography string    `json:"biography,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// BookContributor credits an author on a book in a role; an author may have several roles on a book
+type BookContributor struct {
+	BookID   uint   `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	AuthorID uint   `json:"-" gorm:"primaryKey;autoIncrement:false;index"`
+	Role     string `json:"role" gorm:"primaryKey"`
+	Position int    `json:"-" gorm:"not null"` // order of the contributors on the book
+	Author   Author `json:"author"`
+}
+
+type ContributorInput struct {
+	Name string `json:"name" binding:"required,max=200,slug"`
+	Role string `json:"role" binding:"omitempty,oneof=author editor translator illustrator"` // author when left out
+}
+
+type AuthorInput struct {
+	Name      string `json:"name" binding:"required,max=200,slug"`
+	Biography string `json:"biography" binding:"max=10000"`
+}
+
+// authorSeparators split a credit line such as "Alan Donovan, Brian Kernighan & Rob Pike"
+var authorSeparators = regexp.MustCompile(`(?i)\s*[;,&]\s*|\s+and\s+`)
+
+// otherSeparators are the separators besides commas, which rule out an inverted "Last, First" name
+var otherSeparators = regexp.MustCompile(`(?i)[;&]|\s+and\s+`)
+
+// initials matches given names written as initials only, such as "J. R. R." or "J.R.R."
+var initials = regexp.MustCompile(`^(\p{Lu}\.\s*)+$`)
+
+// nameSuffixes belong to the name before them rather than being names of their own
+var nameSuffixes = map[string]bool{"jr": true, "jr.": true, "sr": true, "sr.": true, "ii": true, "iii": true, "iv": true, "phd": true, "ph.d.": true}
+
+// SplitAuthorNames splits a free-text author string into names, on commas, semicolons, "&" and "and".
+// A single name written "Last, First", such as "Tolkien, J. R. R.", is kept whole.
+func SplitAuthorNames(author string) []string {
+	if last, first, ok := invertedName(author); ok {
+		return []string{last + ", " + first}
+	}
+	var names []string
+	for _, name := range authorSeparators.Split(author, -1) {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case nameSuffixes[strings.ToLower(name)] && len(names) > 0:
+			names[len(names)-1] += ", " + name
+		default:
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// invertedName recognizes a single name written "Last, First": one comma and no other separator,
+// with a one-word surname before it or only initials after it, unlike "Alan Donovan, Brian Kernighan"
+func invertedName(author string) (string, string, bool) {
+	if strings.Count(author, ",") != 1 || otherSeparators.MatchString(author) {
+		return "", "", false
+	}
+	last, first, _ := strings.Cut(author, ",")
+	last, first = strings.TrimSpace(last), strings.TrimSpace(first)
+	if last == "" || first == "" || nameSuffixes[strings.ToLower(first)] {
+		return "", "", false
+	}
+	return last, first, len(strings.Fields(last)) == 1 || initials.MatchString(first)
+}
+
+// CreditLine joins the names of the contributors in the author role, or of every contributor
+// when none is; books keep it in their author field
+func CreditLine(contributors []ContributorInput) string {
+	var authors, others []string
+	for _, contributor := range contributors {
+		others = append(others, contributor.Name)
+		if contributor.Role == RoleAuthor {
+			authors = append(authors, contributor.Name)
+		}
+	}
+	if len(authors) == 0 {
+		authors = others
+	}
+	return strings.Join(authors, ", ")
+}
+
+// GetAllAuthors retrieves every author without their biography, ordered by name
+func GetAllAuthors(db *gorm.DB) ([]Author, error) {
+	authors := []Author{}
+	if err := db.Select("id", "name", "slug").Order("name").Order("id").Find(&authors).Error; err != nil {
+		return nil, err
+	}
+	return authors, nil
+}
+
+// GetAuthorBySlug retrieves an author by slug
+func GetAuthorBySlug(db *gorm.DB, authorSlug string) (Author, error) {
+	var author Author
+	err := db.Where("slug = ?", authorSlug).First(&author).Error
+	return author, err
+}
+
+// CountAuthorBooks maps author IDs to the number of books, deleted ones aside, that credit them
+func CountAuthorBooks(db *gorm.DB) (map[uint]int, error) {
+	var rows []struct {
+		AuthorID uint
+		Books    int
+	}
+	err := db.Model(&BookContributor{}).
+		Select("book_contributors.author_id, COUNT(DISTINCT book_contributors.book_id) AS books").
+		Joins("JOIN books ON books.id = book_contributors.book_id AND books.deleted_at IS NULL").
+		Group("book_contributors.author_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.AuthorID] = row.Books
+	}
+	return counts, nil
+}
+
+// GetAuthorBooks retrieves the books crediting an author, in any role, newest first
+func GetAuthorBooks(db *gorm.DB, authorID uint) ([]Book, error) {
+	books := []Book{}
+	err := WithBookDetails(db).
+		Where("id IN (?)", db.Model(&BookContributor{}).Select("book_id").Where("author_id = ?", authorID)).
+		Order("published_year DESC").Order("title").
+		Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// FindOrCreateAuthor returns the author whose name has the same slug as name, creating them if needed
+func FindOrCreateAuthor(db *gorm.DB, name string) (Author, error) {
+	authorSlug := slug.Make(name)
+	if authorSlug == "" {
+		return Author{}, ErrAuthorName
+	}
+	author, err := GetAuthorBySlug(db, authorSlug)
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return author, err
+	}
+	author = Author{Name: strings.TrimSpace(name), Slug: authorSlug}
+	return author, db.Create(&author).Error
+}
+
+// SetBookContributors replaces the contributors of a book, creating the authors it does not know
+// yet, and loads them into book.Contributors. The book's author field becomes their credit line,
+// spelled the way the authors are.
+func SetBookContributors(db *gorm.DB, book *Book, contributors []ContributorInput) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("book_id = ?", book.ID).Delete(&BookContributor{}).Error; err != nil {
+			return err
+		}
+
+		type credit struct {
+			authorID uint
+			role     string
+		}
+		rows := []BookContributor{}
+		seen := make(map[credit]bool, len(contributors))
+		for _, contributor := range contributors {
+			author, err := FindOrCreateAuthor(tx, contributor.Name)
+			if err != nil {
+				return err
+			}
+			role := contributor.Role
+			if role == "" {
+				role = RoleAuthor
+			}
+			if seen[credit{author.ID, role}] {
+				continue
+			}
+			seen[credit{author.ID, role}] = true
+			rows = append(rows, BookContributor{BookID: book.ID, AuthorID: author.ID, Role: role, Position: len(rows), Author: author})
+		}
+		if len(rows) > 0 {
+			if err := tx.Omit(clause.Associations).Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		book.Contributors = rows
+		return setCreditLine(tx, book)
+	})
+}
+
+// setCreditLine rewrites the author field of a book from its loaded contributors
+func setCreditLine(db *gorm.DB, book *Book) error {
+	credit := CreditLine(book.Input("").Contributors)
+	if credit == "" || credit == book.Author {
+		return nil
+	}
+	book.Author = credit
+	return db.Model(&Book{}).Unscoped().Where("id = ?", book.ID).Update("author", credit).Error
+}
+
+// RefreshCreditLines rewrites the author field of the books crediting an author, after a rename
+func RefreshCreditLines(db *gorm.DB, authorID uint) error {
+	var books []Book
+	err := WithContributors(db.Unscoped()).
+		Where("id IN (?)", db.Model(&BookContributor{}).Select("book_id").Where("author_id = ?", authorID)).
+		Find(&books).Error
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		if err := setCreditLine(db, &book); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithContributors preloads the contributors of the books found, in order, with their author's name
+func WithContributors(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Contributors", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Preload("Contributors.Author", func(tx *gorm.DB) *gorm.DB { return tx.Select("id", "name", "slug") })
+}
+
+// AuthorSplit reports what SplitAuthors did
+type AuthorSplit struct {
+	Books   int // books given contributors
+	Authors int // authors created
+}
+
+// SplitAuthors gives contributors to the books, including deleted ones, stored before authors were
+// records of their own, by splitting their author string, which then becomes their credit line.
+// Books that have contributors are left alone, so it is idempotent; it runs once, see RunOnce.
+func SplitAuthors(db *gorm.DB) (AuthorSplit, error) {
+	var report AuthorSplit
+	var books []Book
+	err := db.Unscoped().Select("id", "author").
+		Where("id NOT IN (?)", db.Model(&BookContributor{}).Select("book_id")).
+		Find(&books).Error
+	if err != nil || len(books) == 0 {
+		return report, err
+	}
+
+	var before int64
+	if err := db.Model(&Author{}).Count(&before).Error; err != nil {
+		return report, err
+	}
+	for _, book := range books {
+		var contributors []ContributorInput
+		for _, name := range SplitAuthorNames(book.Author) {
+			if slug.Make(name) != "" {
+				contributors = append(contributors, ContributorInput{Name: name, Role: RoleAuthor})
+			}
+		}
+		if len(contributors) == 0 {
+			continue
+		}
+		if err := SetBookContributors(db, &book, contributors); err != nil {
+			return report, err
+		}
+		report.Books++
+	}
+	var after int64
+	if err := db.Model(&Author{}).Count(&after).Error; err != nil {
+		return report, err
+	}
+	report.Authors = int(after - before)
+	return report, nil
+}
+
+// CountAuthorCredits counts the credits of an author, on books deleted or not
+func CountAuthorCredits(db *gorm.DB, authorID uint) (int64, error) {
+	var count int64
+	err := db.Model(&BookContributor{}).Where("author_id = ?", authorID).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,71 @@
+// includes the ebook files uploaded for a book and their helper functions.
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Supported ebook file formats
+const (
+	FormatEPUB = "epub"
+	FormatPDF  = "pdf"
+)
+
+// BookFile is an ebook file of a book kept in the blob store; a book has at most one file per format
+type BookFile struct {
+	ID          uint      `json:"-" gorm:"primary_key"`
+	BookID      uint      `json:"-" gorm:"uniqueIndex:idx_book_files_book_format"` // books in the trash can share the ISBN of another book
+	ISBN        string    `json:"isbn" gorm:"not null;index"`
+	Format      string    `json:"format" gorm:"not null;uniqueIndex:idx_book_files_book_format"`
+	StorageKey  string    `json:"-" gorm:"not null"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type" gorm:"not null"`
+	Size        int64     `json:"size" gorm:"not null"`
+	SHA256      string    `json:"sha256" gorm:"column:sha256;not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GetBookFiles retrieves the files of a book, ordered by format
+func GetBookFiles(db *gorm.DB, bookID uint) ([]BookFile, error) {
+	files := []BookFile{}
+	err := db.Where("book_id = ?", bookID).Order("format").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetBookFile retrieves the file of a book in the given format
+func GetBookFile(db *gorm.DB, bookID uint, format string) (BookFile, error) {
+	var file BookFile
+	err := db.Where("book_id = ? AND format = ?", bookID, format).First(&file).Error
+	return file, err
+}
+
+// SaveBookFile stores file as the book's file in its format, replacing the previous one.
+// It returns the replaced file, if any, so its blob can be removed.
+func SaveBookFile(db *gorm.DB, file *BookFile) (*BookFile, error) {
+	var replaced *BookFile
+	err := db.Transaction(func(tx *gorm.DB) error {
+		existing, err := GetBookFile(tx, file.BookID, file.Format)
+		if err == gorm.ErrRecordNotFound {
+			return tx.Create(file).Error
+		} else if err != nil {
+			return err
+		}
+		replaced = &existing
+		file.ID = existing.ID
+		file.CreatedAt = existing.CreatedAt
+		return tx.Save(file).Error
+	})
+	return replaced, err
+}
+
+// DeleteBookFile removes the record of a book's file
+func DeleteBookFile(db *gorm.DB, file BookFile) error {
+	return db.Delete(&file).Error
+}
@@ -3,8 +3,15 @@
 package models
 
 import (
+	"bookstore/internal/isbn"
+	"bookstore/internal/slug"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"golang.org/x/text/language"
 	"gorm.io/gorm"
 )
 
@@ -22,61 +29,334 @@ type Book struct {
 	Title         string   `json:"title" gorm:"not null"`
 	Author        string   `json:"author" gorm:"not null"`
 	Description   string   `json:"description"`
-	ISBN          string   `json:"isbn" gorm:"unique;not null"`
+	ISBN          string   `json:"isbn" gorm:"not null"`      // canonical ISBN-13, see BeforeSave; unique outside the trash
+	ISBN10        string   `json:"isbn10,omitempty" gorm:"-"` // ISBN-10 form, for ISBNs starting with 978
 	PublishedYear int      `json:"published_year"`
 	Price         float64  `json:"price"`
+	CoverVersion  string   `json:"-"`                        // version of the uploaded cover, empty without one
+	Cover         Cover    `json:"cover,omitempty" gorm:"-"` // cover URLs, filled in by the handlers
 	Reviews       []Review // One-to-many relationship with reviews
 	// BookDownload  BookDownload `gorm:"foreignkey:ISBN"`
+
+	Contributors []BookContributor `json:"contributors"` // authors and other credits, in order
+	Categories   []Category        `json:"categories" gorm:"many2many:book_categories"`
+	Tags         []Tag             `json:"tags" gorm:"many2many:book_tags"`
+
+	SeriesID     *uint   `json:"-" gorm:"index"`
+	Series       *Series `json:"series,omitempty"`
+	SeriesVolume float64 `json:"series_volume,omitempty"`        // position of the book in its series
+	WorkID       *uint   `json:"work_id,omitempty" gorm:"index"` // the work this book is an edition of
+	Edition      string  `json:"edition,omitempty"`              // tells the editions of a work apart, such as "Hardcover"
+
+	PublisherID     *uint      `json:"-" gorm:"index"`
+	Publisher       *Publisher `json:"publisher,omitempty"`
+	ImprintID       *uint      `json:"-" gorm:"index"`
+	Imprint         *Imprint   `json:"imprint,omitempty"`
+	Language        string     `json:"language,omitempty" gorm:"index"` // BCP 47 tag, such as "en" or "pt-BR"
+	PageCount       int        `json:"page_count,omitempty"`
+	Format          string     `json:"format,omitempty" gorm:"index"`
+	FileSize        int64      `json:"file_size,omitempty"`        // in bytes, for ebooks and audiobooks
+	PublicationDate string     `json:"publication_date,omitempty"` // YYYY-MM-DD, the published year is its year
+	AgeRating       int        `json:"age_rating,omitempty"`       // youngest age the book is meant for, 0 for all ages
+}
+
+// Book formats
+const (
+	FormatHardcover = "hardcover"
+	FormatPaperback = "paperback"
+	FormatEbook     = "ebook"
+	FormatAudiobook = "audiobook"
+)
+
+// BeforeSave stores the ISBN in its canonical ISBN-13 form and rejects invalid ones
+func (b *Book) BeforeSave(tx *gorm.DB) error {
+	// Updates through db.Model(&Book{}) carry no ISBN
+	if b.ISBN == "" {
+		return nil
+	}
+	canonical, err := isbn.Parse(b.ISBN)
+	if err != nil {
+		return fmt.Errorf("book ISBN %q: %w", b.ISBN, err)
+	}
+	b.ISBN = canonical.String()
+	b.ISBN10, _ = canonical.ISBN10()
+	return nil
+}
+
+// AfterFind fills in the ISBN-10 form of the ISBN
+func (b *Book) AfterFind(tx *gorm.DB) error {
+	b.ISBN10, _ = isbn.ISBN(b.ISBN).ISBN10()
+	return nil
+}
+
+// Cover holds the URLs of a book's cover thumbnails, keyed by size name
+type Cover map[string]CoverImage
+
+// CoverImage is one thumbnail size in every generated format
+type CoverImage struct {
+	JPEG string `json:"jpeg"`
+	WebP string `json:"webp"`
 }
 
 type BookDownload struct {
-	ISBN         string `gorm:"not null"` // Using ISBN as primary key
+	BookID       uint   `gorm:"index"` // books in the trash can share the ISBN of another book
+	ISBN         string `gorm:"not null"`
 	DownloadLink string `gorm:"not null"`
 }
 
 type BookInput struct {
 	Title         string  `json:"title" binding:"required"`
-	Author        string  `json:"author" binding:"required"`
+	Author        string  `json:"author" binding:"required_without=Contributors"` // split into authors when contributors are left out
 	Description   string  `json:"description"`
-	ISBN          string  `json:"isbn" binding:"required"`
+	ISBN          string  `json:"isbn" binding:"required,isbn"` // ISBN-10 or ISBN-13, hyphens allowed
 	PublishedYear int     `json:"published_year"`
 	Price         float64 `json:"price" binding:"required"`
-	DownloadLink  string  `json:"download_link" binding:"required"`
+	DownloadLink  string  `json:"download_link" binding:"omitempty,url"` // optional when the files are uploaded
+
+	Contributors []ContributorInput `json:"contributors,omitempty" binding:"omitempty,max=50,dive"`
+
+	// Categories are slugs of existing categories, tags are names and are created as needed.
+	// Left out (null), they keep the stored ones; an empty list removes them.
+	Categories []string `json:"categories" binding:"omitempty,max=20,dive,required"`
+	Tags       []string `json:"tags" binding:"omitempty,max=50,dive,max=50,slug"`
+
+	// Publishers and imprints are names, created as needed; an imprint needs its publisher
+	Publisher       string `json:"publisher" binding:"omitempty,max=200,slug"`
+	Imprint         string `json:"imprint" binding:"excluded_without=Publisher,omitempty,max=200,slug"`
+	Language        string `json:"language" binding:"omitempty,max=35,bcp47_language_tag"`
+	PageCount       int    `json:"page_count" binding:"min=0,max=100000"`
+	Format          string `json:"format" binding:"omitempty,oneof=hardcover paperback ebook audiobook"`
+	FileSize        int64  `json:"file_size" binding:"min=0"`
+	PublicationDate string `json:"publication_date" binding:"omitempty,datetime=2006-01-02"` // sets published_year
+	AgeRating       int    `json:"age_rating" binding:"min=0,max=21"`
+}
+
+// NormalizeISBN replaces the ISBN with its canonical ISBN-13; call it once the input is validated
+func (in *BookInput) NormalizeISBN() {
+	in.ISBN = isbn.Normalize(in.ISBN)
+}
+
+// NormalizeContributors fills in the contributors from the author string when they are left out,
+// defaults their role to author, and replaces the author string with their credit line
+func (in *BookInput) NormalizeContributors() {
+	var contributors []ContributorInput
+	for _, contributor := range in.Contributors {
+		contributor.Name = strings.TrimSpace(contributor.Name)
+		if contributor.Role == "" {
+			contributor.Role = RoleAuthor
+		}
+		contributors = append(contributors, contributor)
+	}
+	if len(contributors) == 0 {
+		for _, name := range SplitAuthorNames(in.Author) {
+			contributors = append(contributors, ContributorInput{Name: name, Role: RoleAuthor})
+		}
+	}
+	in.Contributors = contributors
+	if credit := CreditLine(in.Contributors); credit != "" {
+		in.Author = credit
+	}
+}
+
+// NormalizeTaxonomy lowercases the category slugs, trims the tags, drops duplicates and sorts both
+func (in *BookInput) NormalizeTaxonomy() {
+	for i := range in.Categories {
+		in.Categories[i] = strings.ToLower(strings.TrimSpace(in.Categories[i]))
+	}
+	in.Categories = normalizeNames(in.Categories, func(s string) string { return s })
+	in.Tags = normalizeNames(in.Tags, slug.Make)
+}
+
+// NormalizeDetails trims the publisher and imprint, puts the language tag in its canonical form
+// and takes the published year from the publication date; call it once the input is validated
+func (in *BookInput) NormalizeDetails() {
+	in.Publisher = strings.TrimSpace(in.Publisher)
+	in.Imprint = strings.TrimSpace(in.Imprint)
+	if tag, err := language.Parse(in.Language); err == nil {
+		in.Language = tag.String()
+	}
+	if date, err := time.Parse("2006-01-02", in.PublicationDate); err == nil {
+		in.PublishedYear = date.Year()
+	}
+}
+
+// SetDetails copies the bibliographic details of an input to the book; AssignPublisher sets its
+// publisher and imprint
+func (b *Book) SetDetails(in BookInput) {
+	b.Language = in.Language
+	b.PageCount = in.PageCount
+	b.Format = in.Format
+	b.FileSize = in.FileSize
+	b.PublicationDate = in.PublicationDate
+	b.AgeRating = in.AgeRating
+}
+
+// Input describes a stored book in the admin input format, used for audit diffs and exports.
+// Contributors, categories, tags, the publisher and the imprint are included when they were loaded.
+func (b Book) Input(downloadLink string) BookInput {
+	var contributors []ContributorInput
+	for _, contributor := range b.Contributors {
+		contributors = append(contributors, ContributorInput{Name: contributor.Author.Name, Role: contributor.Role})
+	}
+	var categories, tags []string
+	for _, category := range b.Categories {
+		categories = append(categories, category.Slug)
+	}
+	for _, tag := range b.Tags {
+		tags = append(tags, tag.Name)
+	}
+	sort.Strings(categories)
+	sort.Strings(tags)
+	var publisher, imprint string
+	if b.Publisher != nil {
+		publisher = b.Publisher.Name
+	}
+	if b.Imprint != nil {
+		imprint = b.Imprint.Name
+	}
+	return BookInput{
+		Title:         b.Title,
+		Author:        b.Author,
+		Description:   b.Description,
+		ISBN:          b.ISBN,
+		PublishedYear: b.PublishedYear,
+		Price:         b.Price,
+		DownloadLink:  downloadLink,
+		Contributors:  contributors,
+		Categories:    categories,
+		Tags:          tags,
+
+		Publisher:       publisher,
+		Imprint:         imprint,
+		Language:        b.Language,
+		PageCount:       b.PageCount,
+		Format:          b.Format,
+		FileSize:        b.FileSize,
+		PublicationDate: b.PublicationDate,
+		AgeRating:       b.AgeRating,
+	}
+}
+
+type ReviewInput struct {
+	Rating  int    `json:"rating" binding:"required,min=1,max=5"`
+	Comment string `json:"comment"`
 }
 
 // helper functions
 
-func GetAllBooks() ([]Book, error) {
-	var books []Book
-	err := DB.Find(&books).Error
+// BookFilter narrows the book listing; empty fields do not filter
+type BookFilter struct {
+	Category     string   // slug of a category; the books of its subcategories match too
+	Tags         []string // slugs of tags the books must all have
+	Publisher    string   // slug of a publisher
+	Language     string   // language tag; "en" matches "en-GB" too
+	Format       string
+	MaxAgeRating *int // books meant for this age or younger
+}
+
+// apply adds the conditions of the filter to query
+func (f BookFilter) apply(db, query *gorm.DB) (*gorm.DB, error) {
+	if f.Category != "" {
+		category, err := GetCategoryBySlug(db, f.Category)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return query.Where("1 = 0"), nil
+		} else if err != nil {
+			return nil, err
+		}
+		ids, err := CategorySubtree(db, category.ID)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("books.id IN (?)", db.Table("book_categories").Select("book_id").Where("category_id IN ?", ids))
+	}
+	for _, tag := range f.Tags {
+		query = query.Where("books.id IN (?)", db.Table("book_tags").Select("book_tags.book_id").
+			Joins("JOIN tags ON tags.id = book_tags.tag_id").Where("tags.slug = ?", tag))
+	}
+	if f.Publisher != "" {
+		query = query.Where("books.publisher_id IN (?)", db.Model(&Publisher{}).Select("id").Where("slug = ?", f.Publisher))
+	}
+	if f.Language != "" {
+		query = query.Where("books.language = ? OR books.language LIKE ?", f.Language, f.Language+"-%")
+	}
+	if f.Format != "" {
+		query = query.Where("books.format = ?", f.Format)
+	}
+	if f.MaxAgeRating != nil {
+		query = query.Where("books.age_rating <= ?", *f.MaxAgeRating)
+	}
+	return query, nil
+}
+
+// GetAllBooks retrieves every book in the catalog
+func GetAllBooks(db *gorm.DB) ([]Book, error) {
+	return FindBooks(db, BookFilter{})
+}
+
+// FindBooks retrieves the books matching a filter
+func FindBooks(db *gorm.DB, filter BookFilter) ([]Book, error) {
+	books := []Book{}
+	query, err := filter.apply(db, WithBookDetails(db))
 	if err != nil {
 		return nil, err
 	}
+	if err := query.Find(&books).Error; err != nil {
+		return nil, err
+	}
 	return books, nil
 }
 
-func GetBookByID(bookID int) (Book, error) {
+// WithBookDetails preloads the contributors, categories, tags, series, publisher and imprint of
+// the books found
+func WithBookDetails(db *gorm.DB) *gorm.DB {
+	return WithContributors(db).
+		Preload("Categories", func(tx *gorm.DB) *gorm.DB { return tx.Order("name") }).
+		Preload("Tags", func(tx *gorm.DB) *gorm.DB { return tx.Order("name") }).
+		Preload("Series", func(tx *gorm.DB) *gorm.DB { return tx.Select("id", "name", "slug") }).
+		Preload("Publisher", func(tx *gorm.DB) *gorm.DB { return tx.Select("id", "name", "slug") }).
+		Preload("Imprint")
+}
+
+// GetBookByID retrieves a book by its primary key
+func GetBookByID(db *gorm.DB, bookID int) (Book, error) {
 	var book Book
-	err := DB.First(&book, bookID).Error
+	err := WithBookDetails(db).First(&book, bookID).Error
 	if err != nil {
 		return Book{}, err
 	}
 	return book, nil
 }
 
-func GetBookByISBN(isbn string) (Book, error) {
+// GetBookByISBN retrieves a book by its ISBN, given as an ISBN-10 or ISBN-13
+func GetBookByISBN(db *gorm.DB, number string) (Book, error) {
 	var book Book
-	if err := DB.Where("isbn = ?", isbn).First(&book).Error; err != nil {
+	if err := WithBookDetails(db).Where("isbn = ?", isbn.Normalize(number)).First(&book).Error; err != nil {
 		return book, err
 	}
 	return book, nil
 }
 
-func GetBookDownloadByISBN(isbn string) (*BookDownload, error) {
+// GetBookDownload retrieves the download link record of a book
+func GetBookDownload(db *gorm.DB, bookID uint) (*BookDownload, error) {
 	var bookDownload BookDownload
-	err := DB.Where("isbn = ?", isbn).First(&bookDownload).Error
+	err := db.Where("book_id = ?", bookID).First(&bookDownload).Error
 	if err != nil {
 		return nil, err
 	}
 	return &bookDownload, nil
 }
+
+// SetCoverVersion records the version of a book's cover; an empty version removes the cover
+func SetCoverVersion(db *gorm.DB, bookID uint, version string) error {
+	return db.Model(&Book{}).Where("id = ?", bookID).Update("cover_version", version).Error
+}
+
+// CoverVersionInUse reports whether a book other than exceptID, deleted ones included, shows the
+// cover version under the ISBN as stored. A book and those in the trash with its ISBN can share thumbnails.
+func CoverVersionInUse(db *gorm.DB, storedISBN, version string, exceptID uint) (bool, error) {
+	var count int64
+	err := db.Model(&Book{}).Unscoped().
+		Where("isbn = ? AND cover_version = ? AND id <> ?", storedISBN, version, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
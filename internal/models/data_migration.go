@@ -0,0 +1,37 @@
+// includes the markers of data migrations that run once, such as splitting author strings.
+
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DataMigration marks a data migration as applied
+type DataMigration struct {
+	Name      string    `gorm:"primary_key"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// RunOnce runs the data migration called name unless its marker says it was applied, and records
+// the marker in the same transaction. It reports whether the migration ran.
+func RunOnce(db *gorm.DB, name string, migrate func(tx *gorm.DB) error) (bool, error) {
+	ran := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("name = ?", name).First(&DataMigration{}).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := migrate(tx); err != nil {
+			return err
+		}
+		ran = true
+		return tx.Create(&DataMigration{Name: name, AppliedAt: time.Now()}).Error
+	})
+	return ran && err == nil, err
+}
@@ -3,45 +3,131 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"strings"
 
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
-func InitDB() (*gorm.DB, error) {
-	dbUsername := os.Getenv("DB_USERNAME")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbTimeZone := os.Getenv("DB_TIME_ZONE")
+// Supported values for the DB_DRIVER environment variable
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// SQLiteMemory is the DSN for a private, in-memory SQLite database
+const SQLiteMemory = ":memory:"
+
+// DBConfig selects the database backend and how to connect to it
+type DBConfig struct {
+	Driver string
+	DSN    string
+}
+
+// DBConfigFromEnv builds the database configuration from environment variables.
+// DB_DRIVER defaults to postgres; for sqlite, DB_SQLITE_PATH is a file path or ":memory:".
+func DBConfigFromEnv() DBConfig {
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("DB_DRIVER")))
+	if driver == "" {
+		driver = DriverPostgres
+	}
+
+	switch driver {
+	case DriverSQLite:
+		path := os.Getenv("DB_SQLITE_PATH")
+		if path == "" {
+			path = SQLiteMemory
+		}
+		return DBConfig{Driver: driver, DSN: path}
+	default:
+		dsn := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable TimeZone=%s",
+			os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"),
+			os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_TIME_ZONE"))
+		return DBConfig{Driver: driver, DSN: dsn}
+	}
+}
 
-	dsn := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable TimeZone=%s",
-		dbUsername, dbPassword, dbName, dbHost, dbPort, dbTimeZone)
+func dialector(cfg DBConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case DriverPostgres:
+		return postgres.Open(cfg.DSN), nil
+	case DriverSQLite:
+		return sqlite.Open(cfg.DSN), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// OpenDB connects to the configured backend, migrates the schema and sets the package level DB
+func OpenDB(cfg DBConfig) (*gorm.DB, error) {
+	dial, err := dialector(cfg)
 	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
 		return nil, err
 	}
 
-	DB = db
+	db, err := gorm.Open(dial, &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	// Every connection to ":memory:" gets its own empty database, so pin the pool to one
+	if cfg.Driver == DriverSQLite && cfg.DSN == SQLiteMemory {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
 
 	// Auto Migrate the models to create/update tables
-	err = DB.AutoMigrate(&User{})
-	err = DB.AutoMigrate(&Book{})
-	err = DB.AutoMigrate(&Review{})
-	err = DB.AutoMigrate(&Balance{})
-	err = DB.AutoMigrate(&Transaction{})
-	err = DB.AutoMigrate(&BookDownload{})
+	err = db.AutoMigrate(&User{}, &Book{}, &Review{}, &Balance{}, &Transaction{}, &BookDownload{}, &AuditLog{}, &DownloadLog{}, &BookFile{}, &Watermark{}, &Author{}, &BookContributor{}, &Category{}, &Tag{}, &Series{}, &Work{}, &Publisher{}, &Imprint{}, &DataMigration{})
 	if err != nil {
-		log.Fatalf("Error auto migrating database: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("auto migrating database: %w", err)
 	}
+	if err := migrateReusableISBNs(db); err != nil {
+		return nil, fmt.Errorf("migrating book ISBNs: %w", err)
+	}
+
+	DB = db
 	return db, nil
 }
+
+func InitDB() (*gorm.DB, error) {
+	return OpenDB(DBConfigFromEnv())
+}
+
+// DBWithContext returns the package level DB bound to ctx, so queries are cancelled and traced with the request
+func DBWithContext(ctx context.Context) *gorm.DB {
+	return DB.WithContext(ctx)
+}
+
+// PingDB checks that the database is reachable
+func PingDB(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("database is not initialized")
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// CloseDB closes the connection pool behind the package level DB
+func CloseDB() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,542 @@
+package models
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestDBConfigFromEnvDefaultsToPostgres(t *testing.T) {
+	t.Setenv("DB_DRIVER", "")
+	t.Setenv("DB_USERNAME", "postgres")
+	t.Setenv("DB_NAME", "bookstoredb")
+
+	cfg := DBConfigFromEnv()
+	if cfg.Driver != DriverPostgres {
+		t.Fatalf("expected driver %q, got %q", DriverPostgres, cfg.Driver)
+	}
+	if !strings.Contains(cfg.DSN, "user=postgres") || !strings.Contains(cfg.DSN, "dbname=bookstoredb") {
+		t.Fatalf("unexpected postgres DSN %q", cfg.DSN)
+	}
+}
+
+func TestDBConfigFromEnvSQLite(t *testing.T) {
+	t.Setenv("DB_DRIVER", "SQLite")
+	t.Setenv("DB_SQLITE_PATH", "")
+
+	cfg := DBConfigFromEnv()
+	if cfg.Driver != DriverSQLite || cfg.DSN != SQLiteMemory {
+		t.Fatalf("expected in-memory sqlite, got %+v", cfg)
+	}
+
+	t.Setenv("DB_SQLITE_PATH", "bookstore.db")
+	if cfg := DBConfigFromEnv(); cfg.DSN != "bookstore.db" {
+		t.Fatalf("expected DSN bookstore.db, got %q", cfg.DSN)
+	}
+}
+
+func TestOpenDBUnsupportedDriver(t *testing.T) {
+	if _, err := OpenDB(DBConfig{Driver: "oracle"}); err == nil {
+		t.Fatal("expected an error for an unsupported driver")
+	}
+}
+
+func TestOpenDBSQLiteMemory(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	if DB != db {
+		t.Fatal("expected OpenDB to set the package level DB")
+	}
+
+	book := Book{Title: "Go", Author: "Gopher", ISBN: "9780134190440", Price: 10}
+	if err := DB.Create(&book).Error; err != nil {
+		t.Fatalf("creating book: %v", err)
+	}
+
+	got, err := GetBookByISBN(DB, "9780134190440")
+	if err != nil {
+		t.Fatalf("GetBookByISBN: %v", err)
+	}
+	if got.ID != book.ID {
+		t.Fatalf("expected book %d, got %d", book.ID, got.ID)
+	}
+}
+
+func TestOpenDBSQLiteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookstore.db")
+
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: path})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	if err := CreateBalance(db, 1, 50); err != nil {
+		t.Fatalf("CreateBalance: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	// Reopening the file must keep the data
+	db, err = OpenDB(DBConfig{Driver: DriverSQLite, DSN: path})
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	balance, err := GetBalanceByUserID(db, 1)
+	if err != nil {
+		t.Fatalf("GetBalanceByUserID: %v", err)
+	}
+	if balance.Amount != 50 {
+		t.Fatalf("expected balance 50, got %v", balance.Amount)
+	}
+}
+
+func TestNormalizeISBNs(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+
+	// Rows written before ISBNs were validated, bypassing the BeforeSave normalization
+	raw := db.Session(&gorm.Session{SkipHooks: true})
+	for _, book := range []Book{
+		{Title: "Go", Author: "A", ISBN: "0-13-419044-0", CoverVersion: "v1"},
+		{Title: "SICP", Author: "A", ISBN: "9780262510875"},
+		{Title: "SICP again", Author: "A", ISBN: "0262510871"},
+		{Title: "Broken", Author: "A", ISBN: "12345"},
+	} {
+		if err := raw.Create(&book).Error; err != nil {
+			t.Fatalf("creating book: %v", err)
+		}
+	}
+	raw.Create(&BookDownload{BookID: 1, ISBN: "0-13-419044-0", DownloadLink: "https://example.com/go"})
+	raw.Create(&BookFile{BookID: 1, ISBN: "0-13-419044-0", Format: FormatPDF, StorageKey: "k", ContentType: "application/pdf", SHA256: "s"})
+
+	report, err := NormalizeISBNs(db)
+	if err != nil {
+		t.Fatalf("NormalizeISBNs: %v", err)
+	}
+	if len(report.Renamed) != 1 || report.Renamed[0] != (ISBNRename{BookID: 1, Old: "0-13-419044-0", New: "9780134190440", CoverVersion: "v1"}) {
+		t.Fatalf("unexpected renames %+v", report.Renamed)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Old != "0262510871" || len(report.Invalid) != 1 || report.Invalid[0] != "12345" {
+		t.Fatalf("unexpected conflicts %+v or invalid ISBNs %v", report.Conflicts, report.Invalid)
+	}
+
+	book, err := GetBookByISBN(db, "0134190440")
+	if err != nil || book.ISBN != "9780134190440" || book.ISBN10 != "0134190440" {
+		t.Fatalf("expected the book under its ISBN-13, got %+v, %v", book, err)
+	}
+	if download, err := GetBookDownload(db, book.ID); err != nil || download.ISBN != "9780134190440" {
+		t.Fatalf("expected the download link to follow, got %+v, %v", download, err)
+	}
+	if file, err := GetBookFile(db, book.ID, FormatPDF); err != nil || file.ISBN != "9780134190440" {
+		t.Fatalf("expected the book file to follow, got %+v, %v", file, err)
+	}
+
+	// Running again changes nothing
+	if report, err := NormalizeISBNs(db); err != nil || len(report.Renamed) != 0 {
+		t.Fatalf("expected a second run to be a no-op, got %+v, %v", report, err)
+	}
+}
+
+func TestBookISBNIsStoredCanonical(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	book := Book{Title: "Go", Author: "A", ISBN: "0-13-419044-0"}
+	if err := db.Create(&book).Error; err != nil {
+		t.Fatalf("creating book: %v", err)
+	}
+	if book.ISBN != "9780134190440" || book.ISBN10 != "0134190440" {
+		t.Fatalf("expected the canonical ISBN, got %q and %q", book.ISBN, book.ISBN10)
+	}
+	if err := db.Create(&Book{Title: "Bad", Author: "A", ISBN: "0134190441"}).Error; err == nil {
+		t.Fatal("expected an invalid ISBN to be rejected")
+	}
+}
+
+func TestSplitAuthorNames(t *testing.T) {
+	cases := map[string][]string{
+		"J. K. Rowling":                          {"J. K. Rowling"},
+		"Alan Donovan, Brian Kernighan":          {"Alan Donovan", "Brian Kernighan"},
+		"Kernighan and Ritchie":                  {"Kernighan", "Ritchie"},
+		"Abelson & Sussman; Sussman":             {"Abelson", "Sussman", "Sussman"},
+		"Martin Luther King, Jr., Coretta Scott": {"Martin Luther King, Jr.", "Coretta Scott"},
+		"Alexander Sandburg":                     {"Alexander Sandburg"},
+		"Tolkien, J. R. R.":                      {"Tolkien, J. R. R."},
+		"Kernighan, Brian":                       {"Kernighan, Brian"},
+		"Le Guin, U.K.":                          {"Le Guin, U.K."},
+		"King, Jr.":                              {"King, Jr."},
+		"Tolkien, J. R. R. and C. Tolkien":       {"Tolkien", "J. R. R.", "C. Tolkien"},
+		" , ":                                    nil,
+	}
+	for in, want := range cases {
+		if got := SplitAuthorNames(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("SplitAuthorNames(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSplitAuthors(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	for _, book := range []Book{
+		{Title: "Harry Potter", Author: "J. K. Rowling", ISBN: "9780747532699"},
+		{Title: "The Casual Vacancy", Author: "J.K. Rowling", ISBN: "9780316228534"},
+		{Title: "SICP", Author: "Harold Abelson and Gerald Jay Sussman", ISBN: "9780262510875"},
+		{Title: "Untitled", Author: "?", ISBN: "9791090636071"},
+	} {
+		if err := db.Create(&book).Error; err != nil {
+			t.Fatalf("creating book: %v", err)
+		}
+	}
+
+	report, err := SplitAuthors(db)
+	if err != nil {
+		t.Fatalf("SplitAuthors: %v", err)
+	}
+	if report != (AuthorSplit{Books: 3, Authors: 3}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	rowling, err := GetAuthorBySlug(db, "j-k-rowling")
+	if err != nil || rowling.Name != "J. K. Rowling" {
+		t.Fatalf("expected both spellings to share an author, got %+v, %v", rowling, err)
+	}
+	books, err := GetAuthorBooks(db, rowling.ID)
+	if err != nil || len(books) != 2 {
+		t.Fatalf("expected two books by the author, got %d, %v", len(books), err)
+	}
+	sicp, _ := GetBookByISBN(db, "9780262510875")
+	if len(sicp.Contributors) != 2 || sicp.Contributors[1].Author.Slug != "gerald-jay-sussman" || sicp.Contributors[1].Role != RoleAuthor {
+		t.Fatalf("unexpected contributors %+v", sicp.Contributors)
+	}
+
+	// Running again changes nothing
+	if report, err := SplitAuthors(db); err != nil || report.Books != 0 {
+		t.Fatalf("expected a second run to be a no-op, got %+v, %v", report, err)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+
+	runs := 0
+	migrate := func(tx *gorm.DB) error {
+		runs++
+		return nil
+	}
+	failing := func(tx *gorm.DB) error { return errors.New("failed") }
+	if ran, err := RunOnce(db, "split", failing); ran || err == nil {
+		t.Fatalf("expected a failed migration to report its error, got %v, %v", ran, err)
+	}
+	if ran, err := RunOnce(db, "split", migrate); !ran || err != nil {
+		t.Fatalf("expected the migration to run after a failure, got %v, %v", ran, err)
+	}
+	if ran, err := RunOnce(db, "split", migrate); ran || err != nil || runs != 1 {
+		t.Fatalf("expected the marker to skip a second run, got %v, %v after %d runs", ran, err, runs)
+	}
+}
+
+func TestSetBookContributors(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	book := Book{Title: "Gödel, Escher, Bach", Author: "Douglas Hofstadter", ISBN: "9780465026562"}
+	db.Create(&book)
+
+	contributors := []ContributorInput{
+		{Name: "Douglas Hofstadter", Role: RoleAuthor},
+		{Name: "Douglas Hofstadter", Role: RoleIllustrator},
+		{Name: "Douglas  Hofstadter", Role: RoleAuthor},
+		{Name: "Jean-Luc Henry", Role: RoleTranslator},
+	}
+	if err := SetBookContributors(db, &book, contributors); err != nil {
+		t.Fatalf("SetBookContributors: %v", err)
+	}
+	if len(book.Contributors) != 3 || book.Contributors[2].Role != RoleTranslator || book.Contributors[2].Position != 2 {
+		t.Fatalf("expected duplicate credits to be dropped, got %+v", book.Contributors)
+	}
+	if credits, _ := CountAuthorCredits(db, book.Contributors[0].AuthorID); credits != 2 {
+		t.Fatalf("expected two credits, got %d", credits)
+	}
+	if err := SetBookContributors(db, &book, []ContributorInput{{Name: "!!"}}); !errors.Is(err, ErrAuthorName) {
+		t.Fatalf("expected ErrAuthorName, got %v", err)
+	}
+	got, _ := GetBookByISBN(db, book.ISBN)
+	if len(got.Contributors) != 3 {
+		t.Fatalf("expected a failed replacement to keep the contributors, got %+v", got.Contributors)
+	}
+}
+
+func TestCategoryTreeAndFacets(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	fiction := Category{Name: "Fiction", Slug: "fiction"}
+	db.Create(&fiction)
+	fantasy := Category{Name: "Fantasy", Slug: "fantasy", ParentID: &fiction.ID}
+	db.Create(&fantasy)
+	epic := Category{Name: "Epic Fantasy", Slug: "epic-fantasy", ParentID: &fantasy.ID}
+	db.Create(&epic)
+	computing := Category{Name: "Computing", Slug: "computing"}
+	db.Create(&computing)
+
+	categories, _ := GetAllCategories(db)
+	tree := CategoryTree(categories)
+	if len(tree) != 2 || tree[0].Slug != "computing" || tree[1].Children[0].Children[0].Slug != "epic-fantasy" {
+		t.Fatalf("unexpected tree %+v", tree)
+	}
+	if subtree, _ := CategorySubtree(db, fiction.ID); len(subtree) != 3 {
+		t.Fatalf("expected fiction and its two subcategories, got %v", subtree)
+	}
+	if err := CheckCategoryParent(db, fiction.ID, epic.ID); !errors.Is(err, ErrCategoryCycle) {
+		t.Fatalf("expected ErrCategoryCycle, got %v", err)
+	}
+	if err := CheckCategoryParent(db, epic.ID, computing.ID); err != nil {
+		t.Fatalf("expected the move to be allowed, got %v", err)
+	}
+
+	books := []Book{
+		{Title: "The Hobbit", Author: "J. R. R. Tolkien", ISBN: "9780547928227", Price: 10},
+		{Title: "A Game of Thrones", Author: "George R. R. Martin", ISBN: "9780553593716", Price: 10},
+		{Title: "SICP", Author: "Harold Abelson", ISBN: "9780262510875", Price: 10},
+	}
+	assigned := [][]Category{{fantasy, epic}, {epic}, {computing}}
+	tags := [][]string{{"Classic", "dragons"}, {"Dragons"}, {"classic"}}
+	for i := range books {
+		db.Create(&books[i])
+		if err := SetBookTaxonomy(db, &books[i], assigned[i], tags[i]); err != nil {
+			t.Fatalf("SetBookTaxonomy: %v", err)
+		}
+	}
+	if all, _ := GetAllTags(db); len(all) != 2 || all[0].Name != "Classic" {
+		t.Fatalf("expected tags to be shared by slug, got %+v", all)
+	}
+
+	found, err := FindBooks(db, BookFilter{Category: "fiction", Tags: []string{"dragons", "classic"}})
+	if err != nil || len(found) != 1 || found[0].ISBN != books[0].ISBN {
+		t.Fatalf("expected the hobbit, got %+v, %v", found, err)
+	}
+	if found, _ := FindBooks(db, BookFilter{Category: "unknown"}); len(found) != 0 {
+		t.Fatalf("expected an unknown category to match nothing, got %d books", len(found))
+	}
+
+	facets, err := CountFacets(db, BookFilter{Category: "fiction"})
+	if err != nil {
+		t.Fatalf("CountFacets: %v", err)
+	}
+	counts := map[string]int{}
+	for _, facet := range facets.Categories {
+		counts[facet.Slug] = facet.Count
+	}
+	if facets.Total != 2 || len(counts) != 3 || counts["fiction"] != 2 || counts["fantasy"] != 2 || counts["epic-fantasy"] != 2 {
+		t.Fatalf("expected each book counted once per category, got %+v", facets)
+	}
+	if len(facets.Tags) != 2 || facets.Tags[0].Slug != "dragons" || facets.Tags[0].Count != 2 || facets.Tags[1].Count != 1 {
+		t.Fatalf("unexpected tag counts %+v", facets.Tags)
+	}
+
+	if err := DeleteCategory(db, computing); err != nil {
+		t.Fatalf("DeleteCategory: %v", err)
+	}
+	sicp, _ := GetBookByISBN(db, books[2].ISBN)
+	if len(sicp.Categories) != 0 || len(sicp.Tags) != 1 {
+		t.Fatalf("expected the category to be removed from the book, got %+v", sicp.Categories)
+	}
+}
+
+func TestSeriesAndEditions(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	discworld := Series{Name: "Discworld", Slug: "discworld"}
+	db.Create(&discworld)
+	books := []Book{
+		{Title: "Equal Rites", Author: "Terry Pratchett", ISBN: "9780552131056", PublishedYear: 1987, Price: 9},
+		{Title: "The Colour of Magic", Author: "Terry Pratchett", ISBN: "9780552124751", PublishedYear: 1983, Price: 8},
+		{Title: "The Colour of Magic", Author: "Terry Pratchett", ISBN: "9780062225672", PublishedYear: 2013, Price: 5},
+	}
+	for i, volume := range []float64{3, 1, 1} {
+		db.Create(&books[i])
+		if err := SetBookSeries(db, &books[i], discworld, volume); err != nil {
+			t.Fatalf("SetBookSeries: %v", err)
+		}
+	}
+	inOrder, err := GetSeriesBooks(db, discworld.ID)
+	if err != nil || len(inOrder) != 3 || inOrder[0].ISBN != "9780062225672" || inOrder[2].ISBN != "9780552131056" {
+		t.Fatalf("expected the books by volume, got %+v, %v", inOrder, err)
+	}
+	if inOrder[0].Series == nil || inOrder[0].Series.Slug != "discworld" || inOrder[0].SeriesVolume != 1 {
+		t.Fatalf("expected the series to be loaded, got %+v", inOrder[0].Series)
+	}
+
+	work := Work{Title: "The Colour of Magic"}
+	db.Create(&work)
+	SetBookWork(db, &books[2], work, "Ebook")
+	SetBookWork(db, &books[1], work, "Paperback")
+	editions, err := GetEditions(db, work.ID)
+	if err != nil || len(editions) != 2 || editions[0].Edition != "Paperback" || editions[1].Price != 5 {
+		t.Fatalf("expected both editions, oldest first, got %+v, %v", editions, err)
+	}
+
+	// Deleting a grouping keeps its books, deleted ones included
+	db.Delete(&books[0])
+	if err := DeleteSeries(db, discworld); err != nil {
+		t.Fatalf("DeleteSeries: %v", err)
+	}
+	if err := DeleteWork(db, work); err != nil {
+		t.Fatalf("DeleteWork: %v", err)
+	}
+	var grouped int64
+	db.Model(&Book{}).Unscoped().Where("series_id IS NOT NULL OR work_id IS NOT NULL").Count(&grouped)
+	if grouped != 0 {
+		t.Fatalf("expected every book to be ungrouped, %d are not", grouped)
+	}
+}
+
+func TestPublishersAndDetailFilters(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	books := []Book{
+		{Title: "Go", Author: "Alan Donovan", ISBN: "9780134190440", Price: 40, Language: "en-GB", Format: FormatPaperback, AgeRating: 16},
+		{Title: "Der Prozess", Author: "Franz Kafka", ISBN: "9783150094525", Price: 5, Language: "de", Format: FormatEbook},
+		{Title: "Matilda", Author: "Roald Dahl", ISBN: "9780142410370", Price: 8, Language: "en", Format: FormatPaperback, AgeRating: 8},
+	}
+	names := [][2]string{{"Addison-Wesley", "Professional"}, {"Reclam", ""}, {"addison wesley", ""}}
+	for i := range books {
+		if err := AssignPublisher(db, &books[i], names[i][0], names[i][1]); err != nil {
+			t.Fatalf("AssignPublisher: %v", err)
+		}
+		if err := db.Omit("Publisher", "Imprint").Create(&books[i]).Error; err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	// Names with the same slug share a publisher
+	if *books[0].PublisherID != *books[2].PublisherID || books[0].Imprint == nil || books[0].Imprint.Slug != "professional" {
+		t.Fatalf("expected the same publisher and an imprint, got %+v %+v", books[0].Publisher, books[2].Publisher)
+	}
+	if err := AssignPublisher(db, &books[0], "", "Professional"); err != nil || books[0].PublisherID != nil || books[0].ImprintID != nil {
+		t.Fatalf("expected no publisher without a name, got %+v, %v", books[0].Publisher, err)
+	}
+	if err := AssignPublisher(db, &books[0], "--", ""); !errors.Is(err, ErrPublisherName) {
+		t.Fatalf("expected ErrPublisherName, got %v", err)
+	}
+
+	publishers, _ := GetAllPublishers(db)
+	if len(publishers) != 2 || publishers[0].Slug != "addison-wesley" || len(publishers[0].Imprints) != 1 {
+		t.Fatalf("unexpected publishers %+v", publishers)
+	}
+	counts, _ := CountPublisherBooks(db)
+	if counts[publishers[0].ID] != 2 || counts[publishers[1].ID] != 1 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+
+	eight := 8
+	for _, tc := range []struct {
+		filter BookFilter
+		want   int
+	}{
+		{BookFilter{Publisher: "addison-wesley"}, 2},
+		{BookFilter{Language: "en"}, 2},
+		{BookFilter{Language: "en-GB"}, 1},
+		{BookFilter{Language: "en", Format: FormatPaperback, MaxAgeRating: &eight}, 1},
+		{BookFilter{Publisher: "reclam", Language: "en"}, 0},
+	} {
+		found, err := FindBooks(db, tc.filter)
+		if err != nil || len(found) != tc.want {
+			t.Errorf("%+v: expected %d books, got %d, %v", tc.filter, tc.want, len(found), err)
+		}
+	}
+
+	db.Delete(&books[1])
+	if titles, _ := CountPublisherTitles(db, *books[1].PublisherID); titles != 1 {
+		t.Fatalf("expected the deleted book to count as a title, got %d", titles)
+	}
+}
+
+func TestRestoreAndPurgeBooks(t *testing.T) {
+	db, err := OpenDB(DBConfig{Driver: DriverSQLite, DSN: SQLiteMemory})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	bought := Book{Title: "Go", Author: "Alan Donovan", ISBN: "9780134190440", Price: 40}
+	unsold := Book{Title: "SICP", Author: "Harold Abelson", ISBN: "9780262510875", Price: 10}
+	for _, book := range []*Book{&bought, &unsold} {
+		db.Create(book)
+		if err := SetBookTaxonomy(db, book, nil, []string{"classic"}); err != nil {
+			t.Fatalf("SetBookTaxonomy: %v", err)
+		}
+		db.Create(&BookDownload{BookID: book.ID, ISBN: book.ISBN, DownloadLink: "https://example.com/" + book.ISBN})
+		db.Delete(book)
+	}
+	db.Create(&Transaction{UserID: 1, BookID: bought.ID, Amount: 40})
+
+	deleted, err := GetDeletedBooks(db)
+	if err != nil || len(deleted) != 2 || len(deleted[0].Tags) != 1 {
+		t.Fatalf("expected both books with their tags, got %+v, %v", deleted, err)
+	}
+	if purchases, _ := CountDeletedBookPurchases(db); purchases[bought.ID] != 1 || purchases[unsold.ID] != 0 {
+		t.Fatalf("unexpected purchases %v", purchases)
+	}
+
+	if _, err := PurgeBook(db, bought); !errors.Is(err, ErrBookPurchased) {
+		t.Fatalf("expected ErrBookPurchased, got %v", err)
+	}
+	if _, err := PurgeBook(db, unsold); err != nil {
+		t.Fatalf("PurgeBook: %v", err)
+	}
+	var left int64
+	db.Table("book_tags").Where("book_id = ?", unsold.ID).Count(&left)
+	if left != 0 {
+		t.Fatalf("expected the tags of the purged book to be removed, %d are left", left)
+	}
+	if _, err := GetBookDownload(db, unsold.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the download link to be purged, got %v", err)
+	}
+	if err := db.Create(&Book{Title: "SICP", Author: "Harold Abelson", ISBN: unsold.ISBN, Price: 10}).Error; err != nil {
+		t.Fatalf("expected the ISBN to be free again, got %v", err)
+	}
+
+	// A book in the trash gives up its ISBN, even a bought one, and cannot come back while it is taken
+	taker := Book{Title: "Go, reprinted", Author: "Alan Donovan", ISBN: bought.ISBN, Price: 45}
+	if err := db.Create(&taker).Error; err != nil {
+		t.Fatalf("expected a new book to take the ISBN of a deleted one, got %v", err)
+	}
+	if err := db.Create(&Book{Title: "Go, again", Author: "Alan Donovan", ISBN: bought.ISBN}).Error; err == nil {
+		t.Fatal("expected the ISBN to stay unique outside the trash")
+	}
+	if err := RestoreBook(db, &bought); !errors.Is(err, ErrISBNTaken) {
+		t.Fatalf("expected ErrISBNTaken, got %v", err)
+	}
+	if err := db.Model(&Book{}).Unscoped().Where("id = ?", bought.ID).Update("deleted_at", nil).Error; err == nil {
+		t.Fatal("expected the index to refuse two books with the ISBN outside the trash")
+	}
+	db.Unscoped().Delete(&taker)
+
+	if err := RestoreBook(db, &bought); err != nil {
+		t.Fatalf("RestoreBook: %v", err)
+	}
+	if _, err := GetBookByISBN(db, bought.ISBN); err != nil || bought.DeletedAt.Valid {
+		t.Fatalf("expected the book to be back, got %v", err)
+	}
+	if _, err := GetDeletedBookByISBN(db, bought.ISBN); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the book to leave the trash, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+// includes the download log used to count and limit downloads of purchased books.
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DownloadLog records one download of a book by a user, made with a signed download URL
+type DownloadLog struct {
+	ID        uint      `gorm:"primary_key"`
+	UserID    uint      `gorm:"not null;index:idx_download_logs_user_book"`
+	BookID    uint      `gorm:"not null;index:idx_download_logs_user_book"`
+	Link      string    `gorm:"index"` // signature of the download URL
+	Format    string    // format of the uploaded file, empty for the download link
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// RecordDownload logs a download of a book by a user with the signed URL link, in a format
+func RecordDownload(db *gorm.DB, userID, bookID uint, link, format string) error {
+	return db.Create(&DownloadLog{UserID: userID, BookID: bookID, Link: link, Format: format}).Error
+}
+
+// HasDownloaded reports whether a download of the book in a format was already logged for the
+// signed URL link, which makes another request with it a continuation of that download
+func HasDownloaded(db *gorm.DB, userID, bookID uint, link, format string) (bool, error) {
+	var count int64
+	err := db.Model(&DownloadLog{}).
+		Where("user_id = ? AND book_id = ? AND link = ? AND format = ?", userID, bookID, link, format).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CountDownloadsSince counts the downloads of a book by a user since the given time
+func CountDownloadsSince(db *gorm.DB, userID, bookID uint, since time.Time) (int64, error) {
+	var count int64
+	err := db.Model(&DownloadLog{}).
+		Where("user_id = ? AND book_id = ? AND created_at >= ?", userID, bookID, since).
+		Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,78 @@
+// includes the migration of books stored before ISBNs were validated to their canonical ISBN-13.
+
+package models
+
+import (
+	"bookstore/internal/isbn"
+
+	"gorm.io/gorm"
+)
+
+// ISBNRename is a book whose stored ISBN differs from its canonical form
+type ISBNRename struct {
+	BookID       uint
+	Old          string
+	New          string
+	CoverVersion string // the cover stored under the old ISBN, if any
+}
+
+// ISBNNormalization reports what NormalizeISBNs changed, and what it had to leave alone
+type ISBNNormalization struct {
+	Renamed   []ISBNRename
+	Invalid   []string     // stored ISBNs that are not valid ISBNs
+	Conflicts []ISBNRename // canonical forms already taken by another book
+}
+
+// NormalizeISBNs rewrites every stored ISBN, including those of deleted books, to its canonical
+// ISBN-13, along with the download links and files recorded under it. It is idempotent, so it
+// runs on every start. Covers live in the blob store and are moved by the caller.
+func NormalizeISBNs(db *gorm.DB) (ISBNNormalization, error) {
+	var report ISBNNormalization
+	var books []Book
+	if err := db.Unscoped().Select("id", "isbn", "cover_version").Find(&books).Error; err != nil {
+		return report, err
+	}
+
+	taken := make(map[string]bool, len(books))
+	for _, book := range books {
+		taken[book.ISBN] = true
+	}
+
+	for _, book := range books {
+		canonical, err := isbn.Parse(book.ISBN)
+		if err != nil {
+			report.Invalid = append(report.Invalid, book.ISBN)
+			continue
+		}
+		if canonical.String() == book.ISBN {
+			continue
+		}
+		rename := ISBNRename{BookID: book.ID, Old: book.ISBN, New: canonical.String(), CoverVersion: book.CoverVersion}
+		if taken[rename.New] {
+			report.Conflicts = append(report.Conflicts, rename)
+			continue
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&Book{}).Unscoped().Where("id = ?", book.ID).Update("isbn", rename.New).Error; err != nil {
+				return err
+			}
+			return MoveISBNRecords(tx, book.ID, rename.New)
+		})
+		if err != nil {
+			return report, err
+		}
+		taken[rename.Old] = false
+		taken[rename.New] = true
+		report.Renamed = append(report.Renamed, rename)
+	}
+	return report, nil
+}
+
+// MoveISBNRecords records a book's new ISBN on its download link and files
+func MoveISBNRecords(db *gorm.DB, bookID uint, newISBN string) error {
+	if err := db.Model(&BookDownload{}).Where("book_id = ?", bookID).Update("isbn", newISBN).Error; err != nil {
+		return err
+	}
+	return db.Model(&BookFile{}).Where("book_id = ?", bookID).Update("isbn", newISBN).Error
+}
@@ -0,0 +1,44 @@
+// includes the migration that lets a new book take the ISBN of a book in the trash.
+
+package models
+
+import "gorm.io/gorm"
+
+// The names books.isbn's unique constraint had on postgres: its own name when the column was
+// created with it, or the one gorm gives a constraint it adds to an existing column
+var legacyISBNConstraints = []string{"books_isbn_key", "idx_books_isbn"}
+
+// migrateReusableISBNs replaces the unique constraint on books.isbn by a unique index on the ISBNs
+// of the books outside the trash. As a book can then share its ISBN with books in the trash,
+// download links and files are tied to their book by ID instead. It runs after AutoMigrate.
+func migrateReusableISBNs(db *gorm.DB) error {
+	_, err := RunOnce(db, "reusable-isbns", func(tx *gorm.DB) error {
+		// AutoMigrate rebuilt the SQLite table without the constraint, but postgres keeps it
+		if tx.Dialector.Name() == DriverPostgres {
+			for _, name := range legacyISBNConstraints {
+				if err := tx.Exec("ALTER TABLE books DROP CONSTRAINT IF EXISTS " + name).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// Until now ISBNs were unique, so they tell which book a record belongs to
+		for _, table := range []string{"book_downloads", "book_files"} {
+			err := tx.Exec("UPDATE " + table + " SET book_id = (SELECT id FROM books WHERE books.isbn = " + table + ".isbn) WHERE book_id IS NULL").Error
+			if err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasIndex(&BookFile{}, "idx_book_files_isbn_format") {
+			return tx.Migrator().DropIndex(&BookFile{}, "idx_book_files_isbn_format")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// gorm cannot declare a partial index on SQLite, where AutoMigrate rebuilds the table and drops
+	// it whenever it finds a unique index it does not know, so it is created on every start
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_books_isbn_live ON books (isbn) WHERE deleted_at IS NULL").Error
+}
@@ -0,0 +1,156 @@
+// includes the publishers of books and their imprints, and their helper functions.
+
+package models
+
+import (
+	"bookstore/internal/slug"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrPublisherName is returned for publisher and imprint names without a letter or digit
+var ErrPublisherName = errors.New("a publisher or imprint name must contain a letter or digit")
+
+// Publisher is a publishing house, identified in URLs by the slug of its name
+type Publisher struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	Imprints  []Imprint `json:"imprints,omitempty"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// Imprint is a brand books are published under; its slug is unique within its publisher
+type Imprint struct {
+	ID          uint      `json:"id" gorm:"primary_key"`
+	PublisherID uint      `json:"-" gorm:"uniqueIndex:idx_imprint_publisher_slug;not null"`
+	Name        string    `json:"name" gorm:"not null"`
+	Slug        string    `json:"slug" gorm:"uniqueIndex:idx_imprint_publisher_slug;not null"`
+	CreatedAt   time.Time `json:"-"`
+	UpdatedAt   time.Time `json:"-"`
+}
+
+type PublisherInput struct {
+	Name string `json:"name" binding:"required,max=200,slug"`
+}
+
+// GetAllPublishers retrieves every publisher with its imprints, ordered by name
+func GetAllPublishers(db *gorm.DB) ([]Publisher, error) {
+	publishers := []Publisher{}
+	err := db.Preload("Imprints", func(tx *gorm.DB) *gorm.DB { return tx.Order("name") }).
+		Order("name").Order("id").
+		Find(&publishers).Error
+	if err != nil {
+		return nil, err
+	}
+	return publishers, nil
+}
+
+// GetPublisherBySlug retrieves a publisher with its imprints by slug
+func GetPublisherBySlug(db *gorm.DB, publisherSlug string) (Publisher, error) {
+	var publisher Publisher
+	err := db.Preload("Imprints", func(tx *gorm.DB) *gorm.DB { return tx.Order("name") }).
+		Where("slug = ?", publisherSlug).
+		First(&publisher).Error
+	return publisher, err
+}
+
+// CountPublisherBooks maps publisher IDs to their number of books, deleted ones aside
+func CountPublisherBooks(db *gorm.DB) (map[uint]int, error) {
+	var rows []struct {
+		PublisherID uint
+		Books       int
+	}
+	err := db.Model(&Book{}).
+		Select("publisher_id, COUNT(*) AS books").
+		Where("publisher_id IS NOT NULL").
+		Group("publisher_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.PublisherID] = row.Books
+	}
+	return counts, nil
+}
+
+// CountPublisherTitles counts the books of a publisher, deleted ones included
+func CountPublisherTitles(db *gorm.DB, publisherID uint) (int64, error) {
+	var count int64
+	err := db.Model(&Book{}).Unscoped().Where("publisher_id = ?", publisherID).Count(&count).Error
+	return count, err
+}
+
+// GetPublisherBooks retrieves the books of a publisher, newest first
+func GetPublisherBooks(db *gorm.DB, publisherID uint) ([]Book, error) {
+	books := []Book{}
+	err := WithBookDetails(db).
+		Where("publisher_id = ?", publisherID).
+		Order("published_year DESC").Order("title").
+		Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// DeletePublisher deletes a publisher and its imprints
+func DeletePublisher(db *gorm.DB, publisher Publisher) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("publisher_id = ?", publisher.ID).Delete(&Imprint{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&publisher).Error
+	})
+}
+
+// AssignPublisher sets the publisher and imprint of a book by name, finding them by slug and
+// creating those that do not exist; empty names leave the book without them. The book still
+// has to be saved.
+func AssignPublisher(db *gorm.DB, book *Book, publisherName, imprintName string) error {
+	book.PublisherID, book.Publisher = nil, nil
+	book.ImprintID, book.Imprint = nil, nil
+	if publisherName == "" {
+		return nil
+	}
+
+	publisherSlug := slug.Make(publisherName)
+	if publisherSlug == "" {
+		return ErrPublisherName
+	}
+	var publisher Publisher
+	err := db.Where("slug = ?", publisherSlug).First(&publisher).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		publisher = Publisher{Name: strings.TrimSpace(publisherName), Slug: publisherSlug}
+		err = db.Create(&publisher).Error
+	}
+	if err != nil {
+		return err
+	}
+	book.PublisherID, book.Publisher = &publisher.ID, &publisher
+	if imprintName == "" {
+		return nil
+	}
+
+	imprintSlug := slug.Make(imprintName)
+	if imprintSlug == "" {
+		return ErrPublisherName
+	}
+	var imprint Imprint
+	err = db.Where("publisher_id = ? AND slug = ?", publisher.ID, imprintSlug).First(&imprint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		imprint = Imprint{PublisherID: publisher.ID, Name: strings.TrimSpace(imprintName), Slug: imprintSlug}
+		err = db.Create(&imprint).Error
+	}
+	if err != nil {
+		return err
+	}
+	book.ImprintID, book.Imprint = &imprint.ID, &imprint
+	return nil
+}
@@ -0,0 +1,193 @@
+// includes the groupings of books: series, whose books are numbered volumes, and works, whose books
+// are editions of the same text, and their helper functions.
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Series is a sequence of books, identified in URLs by the slug of its name
+type Series struct {
+	ID          uint      `json:"id" gorm:"primary_key"`
+	Name        string    `json:"name" gorm:"not null"`
+	Slug        string    `json:"slug" gorm:"uniqueIndex;not null"`
+	Description string    `json:"description,omitempty" gorm:"type:text"`
+	CreatedAt   time.Time `json:"-"`
+	UpdatedAt   time.Time `json:"-"`
+}
+
+// Work is a text published in several editions, such as a hardcover, an ebook and translations,
+// each of them a book with its own ISBN and price
+type Work struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	Title     string    `json:"title" gorm:"not null"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+type SeriesInput struct {
+	Name        string `json:"name" binding:"required,max=200,slug"`
+	Description string `json:"description" binding:"max=10000"`
+}
+
+// VolumeInput places a book in a series; fractions number the books between two volumes
+type VolumeInput struct {
+	Volume float64 `json:"volume" binding:"required,gt=0,lt=100000"`
+}
+
+type WorkInput struct {
+	Title string `json:"title" binding:"required,max=500"`
+}
+
+// EditionInput adds a book to a work, with a label telling it apart from the other editions
+type EditionInput struct {
+	Edition string `json:"edition" binding:"max=100"`
+}
+
+// GetAllSeries retrieves every series, ordered by name
+func GetAllSeries(db *gorm.DB) ([]Series, error) {
+	series := []Series{}
+	if err := db.Order("name").Order("id").Find(&series).Error; err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// GetSeriesBySlug retrieves a series by slug
+func GetSeriesBySlug(db *gorm.DB, seriesSlug string) (Series, error) {
+	var series Series
+	err := db.Where("slug = ?", seriesSlug).First(&series).Error
+	return series, err
+}
+
+// CountSeriesBooks maps series IDs to their number of books, deleted ones aside
+func CountSeriesBooks(db *gorm.DB) (map[uint]int, error) {
+	var rows []struct {
+		SeriesID uint
+		Books    int
+	}
+	err := db.Model(&Book{}).
+		Select("series_id, COUNT(*) AS books").
+		Where("series_id IS NOT NULL").
+		Group("series_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.SeriesID] = row.Books
+	}
+	return counts, nil
+}
+
+// GetSeriesBooks retrieves the books of a series in reading order: by volume, then by title and
+// ISBN, so the editions of a volume follow each other
+func GetSeriesBooks(db *gorm.DB, seriesID uint) ([]Book, error) {
+	books := []Book{}
+	err := WithBookDetails(db).
+		Where("series_id = ?", seriesID).
+		Order("series_volume").Order("title").Order("isbn").
+		Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// SetBookSeries places a book in a series as the given volume, moving it out of any other series
+func SetBookSeries(db *gorm.DB, book *Book, series Series, volume float64) error {
+	err := db.Model(&Book{}).Where("id = ?", book.ID).
+		Updates(map[string]any{"series_id": series.ID, "series_volume": volume}).Error
+	if err != nil {
+		return err
+	}
+	book.SeriesID = &series.ID
+	book.Series = &series
+	book.SeriesVolume = volume
+	return nil
+}
+
+// RemoveBookSeries takes a book out of its series
+func RemoveBookSeries(db *gorm.DB, book *Book) error {
+	err := db.Model(&Book{}).Where("id = ?", book.ID).
+		Updates(map[string]any{"series_id": nil, "series_volume": 0}).Error
+	if err != nil {
+		return err
+	}
+	book.SeriesID = nil
+	book.Series = nil
+	book.SeriesVolume = 0
+	return nil
+}
+
+// DeleteSeries takes every book, deleted ones included, out of a series and deletes it
+func DeleteSeries(db *gorm.DB, series Series) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Book{}).Unscoped().Where("series_id = ?", series.ID).
+			Updates(map[string]any{"series_id": nil, "series_volume": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&series).Error
+	})
+}
+
+// GetWorkByID retrieves a work by its primary key
+func GetWorkByID(db *gorm.DB, workID uint) (Work, error) {
+	var work Work
+	err := db.First(&work, workID).Error
+	return work, err
+}
+
+// GetEditions retrieves the editions of a work, oldest first, then by edition label and ISBN
+func GetEditions(db *gorm.DB, workID uint) ([]Book, error) {
+	books := []Book{}
+	err := WithBookDetails(db).
+		Where("work_id = ?", workID).
+		Order("published_year").Order("edition").Order("isbn").
+		Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// SetBookWork makes a book an edition of a work, moving it out of any other work
+func SetBookWork(db *gorm.DB, book *Book, work Work, edition string) error {
+	err := db.Model(&Book{}).Where("id = ?", book.ID).
+		Updates(map[string]any{"work_id": work.ID, "edition": edition}).Error
+	if err != nil {
+		return err
+	}
+	book.WorkID = &work.ID
+	book.Edition = edition
+	return nil
+}
+
+// RemoveBookWork takes a book out of its work
+func RemoveBookWork(db *gorm.DB, book *Book) error {
+	err := db.Model(&Book{}).Where("id = ?", book.ID).
+		Updates(map[string]any{"work_id": nil, "edition": ""}).Error
+	if err != nil {
+		return err
+	}
+	book.WorkID = nil
+	book.Edition = ""
+	return nil
+}
+
+// DeleteWork takes every book, deleted ones included, out of a work and deletes it
+func DeleteWork(db *gorm.DB, work Work) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Book{}).Unscoped().Where("work_id = ?", work.ID).
+			Updates(map[string]any{"work_id": nil, "edition": ""}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&work).Error
+	})
+}
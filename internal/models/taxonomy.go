@@ -0,0 +1,335 @@
+// includes the classification of books: a tree of categories and free-form tags, and their helper functions.
+
+package models
+
+import (
+	"bookstore/internal/slug"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrCategoryCycle is returned when a category would become its own ancestor
+var ErrCategoryCycle = errors.New("a category cannot be moved under itself or one of its subcategories")
+
+// Category is a node of the category tree; top-level categories have no parent
+type Category struct {
+	ID          uint       `json:"id" gorm:"primary_key"`
+	Name        string     `json:"name" gorm:"not null"`
+	Slug        string     `json:"slug" gorm:"uniqueIndex;not null"`
+	Description string     `json:"description,omitempty" gorm:"type:text"`
+	ParentID    *uint      `json:"parent_id" gorm:"index"`
+	Children    []Category `json:"children,omitempty" gorm:"-"` // filled in by CategoryTree
+	CreatedAt   time.Time  `json:"-"`
+	UpdatedAt   time.Time  `json:"-"`
+}
+
+// Tag is a free-form label; books create the tags they are given
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+type CategoryInput struct {
+	Name        string `json:"name" binding:"required,max=100,slug"`
+	Parent      string `json:"parent"` // slug of the parent category, empty for a top-level one
+	Description string `json:"description" binding:"max=2000"`
+}
+
+type TagInput struct {
+	Name string `json:"name" binding:"required,max=50,slug"`
+}
+
+// GetAllCategories retrieves every category, ordered by name
+func GetAllCategories(db *gorm.DB) ([]Category, error) {
+	categories := []Category{}
+	if err := db.Order("name").Order("id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// GetCategoryBySlug retrieves a category by slug
+func GetCategoryBySlug(db *gorm.DB, categorySlug string) (Category, error) {
+	var category Category
+	err := db.Where("slug = ?", categorySlug).First(&category).Error
+	return category, err
+}
+
+// CategoryTree nests the categories under their parents, keeping their order
+func CategoryTree(categories []Category) []Category {
+	children := make(map[uint][]Category, len(categories))
+	var roots []Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+	var nest func(nodes []Category) []Category
+	nest = func(nodes []Category) []Category {
+		for i := range nodes {
+			nodes[i].Children = nest(children[nodes[i].ID])
+		}
+		return nodes
+	}
+	if roots == nil {
+		return []Category{}
+	}
+	return nest(roots)
+}
+
+// CategoryAncestors maps every category to its ancestors, nearest first
+func CategoryAncestors(categories []Category) map[uint][]uint {
+	parents := make(map[uint]uint, len(categories))
+	for _, category := range categories {
+		if category.ParentID != nil {
+			parents[category.ID] = *category.ParentID
+		}
+	}
+	ancestors := make(map[uint][]uint, len(categories))
+	for _, category := range categories {
+		var chain []uint
+		// The length check guards against a cycle written to the database by hand
+		for id, ok := parents[category.ID]; ok && len(chain) < len(categories); id, ok = parents[id] {
+			chain = append(chain, id)
+		}
+		ancestors[category.ID] = chain
+	}
+	return ancestors
+}
+
+// CategorySubtree returns the IDs of a category and of every category below it
+func CategorySubtree(db *gorm.DB, categoryID uint) ([]uint, error) {
+	categories, err := GetAllCategories(db)
+	if err != nil {
+		return nil, err
+	}
+	ids := []uint{categoryID}
+	for id, chain := range CategoryAncestors(categories) {
+		for _, ancestor := range chain {
+			if ancestor == categoryID {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// CheckCategoryParent rejects moving a category under itself or one of its subcategories
+func CheckCategoryParent(db *gorm.DB, categoryID, parentID uint) error {
+	subtree, err := CategorySubtree(db, categoryID)
+	if err != nil {
+		return err
+	}
+	for _, id := range subtree {
+		if id == parentID {
+			return ErrCategoryCycle
+		}
+	}
+	return nil
+}
+
+// CountSubcategories counts the categories directly under a category
+func CountSubcategories(db *gorm.DB, categoryID uint) (int64, error) {
+	var count int64
+	err := db.Model(&Category{}).Where("parent_id = ?", categoryID).Count(&count).Error
+	return count, err
+}
+
+// DeleteCategory removes a category and its assignments to books
+func DeleteCategory(db *gorm.DB, category Category) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM book_categories WHERE category_id = ?", category.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+}
+
+// FindCategories looks up categories by slug, returning the slugs that match none
+func FindCategories(db *gorm.DB, slugs []string) ([]Category, []string, error) {
+	categories := []Category{}
+	if len(slugs) == 0 {
+		return categories, nil, nil
+	}
+	if err := db.Where("slug IN ?", slugs).Order("slug").Find(&categories).Error; err != nil {
+		return nil, nil, err
+	}
+	found := make(map[string]bool, len(categories))
+	for _, category := range categories {
+		found[category.Slug] = true
+	}
+	var missing []string
+	for _, categorySlug := range slugs {
+		if !found[categorySlug] {
+			missing = append(missing, categorySlug)
+		}
+	}
+	return categories, missing, nil
+}
+
+// GetAllTags retrieves every tag, ordered by name
+func GetAllTags(db *gorm.DB) ([]Tag, error) {
+	tags := []Tag{}
+	if err := db.Order("name").Order("id").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetTagBySlug retrieves a tag by slug
+func GetTagBySlug(db *gorm.DB, tagSlug string) (Tag, error) {
+	var tag Tag
+	err := db.Where("slug = ?", tagSlug).First(&tag).Error
+	return tag, err
+}
+
+// FindOrCreateTags returns the tags with the slugs of names, creating the missing ones
+func FindOrCreateTags(db *gorm.DB, names []string) ([]Tag, error) {
+	tags := []Tag{}
+	for _, name := range names {
+		tagSlug := slug.Make(name)
+		tag, err := GetTagBySlug(db, tagSlug)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			tag = Tag{Name: strings.TrimSpace(name), Slug: tagSlug}
+			err = db.Create(&tag).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// DeleteTag removes a tag from every book and deletes it
+func DeleteTag(db *gorm.DB, tag Tag) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM book_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+}
+
+// SetBookTaxonomy replaces the categories of a book, and its tags by name, creating the tags it
+// does not know yet; nil leaves them as they are
+func SetBookTaxonomy(db *gorm.DB, book *Book, categories []Category, tagNames []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if categories != nil {
+			if err := tx.Omit("Categories.*").Model(book).Association("Categories").Replace(categories); err != nil {
+				return err
+			}
+			book.Categories = categories
+		}
+		if tagNames != nil {
+			tags, err := FindOrCreateTags(tx, tagNames)
+			if err != nil {
+				return err
+			}
+			if err := tx.Omit("Tags.*").Model(book).Association("Tags").Replace(tags); err != nil {
+				return err
+			}
+			book.Tags = tags
+		}
+		return nil
+	})
+}
+
+// FacetCount is a category or tag with the number of books it classifies
+type FacetCount struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	ParentID *uint  `json:"parent_id,omitempty"`
+	Count    int    `json:"count"`
+}
+
+// Facets counts the books matching a filter in each category and tag. A book counts once
+// towards each category above its own, so a parent counts the books of its subcategories.
+type Facets struct {
+	Total      int64        `json:"total"`
+	Categories []FacetCount `json:"categories"`
+	Tags       []FacetCount `json:"tags"`
+}
+
+// CountFacets counts the books matching filter by category and by tag, leaving out empty ones
+func CountFacets(db *gorm.DB, filter BookFilter) (Facets, error) {
+	facets := Facets{Categories: []FacetCount{}, Tags: []FacetCount{}}
+	matching, err := filter.apply(db, db.Model(&Book{}))
+	if err != nil {
+		return facets, err
+	}
+	if err := matching.Count(&facets.Total).Error; err != nil {
+		return facets, err
+	}
+	bookIDs := db.Model(&Book{}).Select("id")
+	if bookIDs, err = filter.apply(db, bookIDs); err != nil {
+		return facets, err
+	}
+
+	categories, err := GetAllCategories(db)
+	if err != nil {
+		return facets, err
+	}
+	var assignments []struct {
+		BookID     uint
+		CategoryID uint
+	}
+	err = db.Table("book_categories").Select("book_id", "category_id").Where("book_id IN (?)", bookIDs).Scan(&assignments).Error
+	if err != nil {
+		return facets, err
+	}
+	ancestors := CategoryAncestors(categories)
+	booksIn := make(map[uint]map[uint]bool, len(categories))
+	for _, assignment := range assignments {
+		for _, id := range append([]uint{assignment.CategoryID}, ancestors[assignment.CategoryID]...) {
+			if booksIn[id] == nil {
+				booksIn[id] = make(map[uint]bool)
+			}
+			booksIn[id][assignment.BookID] = true
+		}
+	}
+	for _, category := range categories {
+		if count := len(booksIn[category.ID]); count > 0 {
+			facets.Categories = append(facets.Categories, FacetCount{ID: category.ID, Name: category.Name, Slug: category.Slug, ParentID: category.ParentID, Count: count})
+		}
+	}
+
+	err = db.Table("book_tags").
+		Select("tags.id, tags.name, tags.slug, COUNT(*) AS count").
+		Joins("JOIN tags ON tags.id = book_tags.tag_id").
+		Where("book_tags.book_id IN (?)", bookIDs).
+		Group("tags.id, tags.name, tags.slug").
+		Order("count DESC").Order("tags.name").
+		Scan(&facets.Tags).Error
+	return facets, err
+}
+
+// normalizeNames trims names and drops those sharing a slug with an earlier one, then sorts them
+func normalizeNames(names []string, key func(string) string) []string {
+	if names == nil {
+		return nil
+	}
+	normalized := []string{}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if seen[key(name)] {
+			continue
+		}
+		seen[key(name)] = true
+		normalized = append(normalized, name)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
@@ -3,11 +3,16 @@
 package models
 
 import (
+	"bookstore/internal/isbn"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// ErrInsufficientFunds is returned when a balance cannot cover a payment
+var ErrInsufficientFunds = errors.New("insufficient balance")
+
 type Balance struct {
 	ID        uint      `gorm:"primary_key"`
 	UserID    uint      `gorm:"not null"`
@@ -86,10 +91,29 @@ func UpdateBalance(db *gorm.DB, userID uint, newAmount float64) error {
 	return db.Save(&balance).Error
 }
 
+// DeductBalance takes amount off a user's balance in a single conditional update, so concurrent
+// payments cannot overdraw it. It returns ErrInsufficientFunds when the balance is too low.
+func DeductBalance(db *gorm.DB, userID uint, amount float64) error {
+	result := db.Model(&Balance{}).
+		Where("user_id = ? AND amount >= ?", userID, amount).
+		Updates(map[string]any{"amount": gorm.Expr("amount - ?", amount), "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Either the balance is too low or the user has none
+		if _, err := GetBalanceByUserID(db, userID); err != nil {
+			return err
+		}
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
 // HasUserBoughtBook checks if a user has bought a specific book by ISBN
-func HasUserBoughtBook(userID uint, isbn string) (bool, error) {
+func HasUserBoughtBook(db *gorm.DB, userID uint, number string) (bool, error) {
 	var transaction Transaction
-	err := DB.Where("user_id = ? AND book_id IN (SELECT id FROM books WHERE isbn = ?)", userID, isbn).First(&transaction).Error
+	err := db.Where("user_id = ? AND book_id IN (SELECT id FROM books WHERE isbn = ?)", userID, isbn.Normalize(number)).First(&transaction).Error
 	if err == gorm.ErrRecordNotFound {
 		return false, nil // User hasn't bought the book
 	} else if err != nil {
@@ -97,3 +121,86 @@ func HasUserBoughtBook(userID uint, isbn string) (bool, error) {
 	}
 	return true, nil // User has bought the book
 }
+
+// Order is a purchase as exposed by the API, joined with the book it bought
+type Order struct {
+	ID        uint      `json:"id"`
+	ISBN      string    `json:"isbn"`
+	Title     string    `json:"title"`
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrderInput struct {
+	ISBN string `json:"isbn" binding:"required"`
+}
+
+// CreateOrder records the purchase of a book and returns it as an order
+func CreateOrder(db *gorm.DB, userID uint, book Book) (Order, error) {
+	transaction := Transaction{
+		UserID: userID,
+		BookID: book.ID,
+		Amount: book.Price,
+	}
+	if err := db.Create(&transaction).Error; err != nil {
+		return Order{}, err
+	}
+	return Order{
+		ID:        transaction.ID,
+		ISBN:      book.ISBN,
+		Title:     book.Title,
+		Amount:    transaction.Amount,
+		CreatedAt: transaction.CreatedAt,
+	}, nil
+}
+
+func ordersQuery(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Table("transactions").
+		Select("transactions.id, books.isbn, books.title, transactions.amount, transactions.created_at").
+		Joins("JOIN books ON books.id = transactions.book_id").
+		Where("transactions.user_id = ?", userID)
+}
+
+// GetOrdersByUserID retrieves a user's orders, newest first
+func GetOrdersByUserID(db *gorm.DB, userID uint) ([]Order, error) {
+	orders := []Order{}
+	err := ordersQuery(db, userID).Order("transactions.created_at DESC, transactions.id DESC").Scan(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// GetOrderByID retrieves one of a user's orders; other users' orders are not found
+func GetOrderByID(db *gorm.DB, userID, orderID uint) (Order, error) {
+	var order Order
+	result := ordersQuery(db, userID).Where("transactions.id = ?", orderID).Limit(1).Scan(&order)
+	if result.Error != nil {
+		return Order{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Order{}, gorm.ErrRecordNotFound
+	}
+	return order, nil
+}
+
+// GetOwnedBookByISBN retrieves the book with the ISBN that a user has bought, deleted ones included.
+// When the user bought both a book in the catalog and one in the trash with the ISBN, it is the former.
+func GetOwnedBookByISBN(db *gorm.DB, userID uint, number string) (Book, error) {
+	var book Book
+	err := db.Unscoped().
+		Where("isbn = ? AND id IN (SELECT book_id FROM transactions WHERE user_id = ?)", isbn.Normalize(number), userID).
+		Order("deleted_at IS NOT NULL").
+		First(&book).Error
+	return book, err
+}
+
+// GetOwnedBooks retrieves every book a user has bought, deleted ones included
+func GetOwnedBooks(db *gorm.DB, userID uint) ([]Book, error) {
+	books := []Book{}
+	err := db.Unscoped().Where("id IN (SELECT book_id FROM transactions WHERE user_id = ?)", userID).Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
@@ -0,0 +1,116 @@
+// includes the trash of soft-deleted books: listing, restoring and permanently purging them.
+
+package models
+
+import (
+	"bookstore/internal/isbn"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrBookPurchased is returned when purging a book someone bought, since its owners can still download it
+var ErrBookPurchased = errors.New("the book has been bought")
+
+// ErrISBNTaken is returned when restoring a book whose ISBN another book took while it was in the trash
+var ErrISBNTaken = errors.New("another book has the ISBN")
+
+// GetDeletedBooks retrieves the deleted books, most recently deleted first
+func GetDeletedBooks(db *gorm.DB) ([]Book, error) {
+	books := []Book{}
+	err := WithBookDetails(db.Unscoped()).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").Order("isbn").
+		Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// GetDeletedBookByISBN retrieves a deleted book by ISBN, the most recently deleted one when the
+// trash holds several with the ISBN
+func GetDeletedBookByISBN(db *gorm.DB, number string) (Book, error) {
+	var book Book
+	err := WithBookDetails(db.Unscoped()).
+		Where("isbn = ? AND deleted_at IS NOT NULL", isbn.Normalize(number)).
+		Order("deleted_at DESC").
+		First(&book).Error
+	return book, err
+}
+
+// CountDeletedBookPurchases maps the IDs of deleted books to their number of purchases
+func CountDeletedBookPurchases(db *gorm.DB) (map[uint]int, error) {
+	var rows []struct {
+		BookID    uint
+		Purchases int
+	}
+	err := db.Model(&Transaction{}).
+		Select("transactions.book_id, COUNT(*) AS purchases").
+		Joins("JOIN books ON books.id = transactions.book_id AND books.deleted_at IS NOT NULL").
+		Group("transactions.book_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.BookID] = row.Purchases
+	}
+	return counts, nil
+}
+
+// RestoreBook brings a deleted book back into the catalog, unless another book took its ISBN
+func RestoreBook(db *gorm.DB, book *Book) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&Book{}).Where("isbn = ? AND id <> ?", book.ISBN, book.ID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrISBNTaken
+		}
+		return tx.Model(&Book{}).Unscoped().Where("id = ?", book.ID).Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		return err
+	}
+	book.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+// PurgeBook permanently deletes a deleted book with its contributors, classification, reviews,
+// download link and file records. Books someone bought are kept for their owners. It returns the
+// files, whose blobs the caller removes.
+func PurgeBook(db *gorm.DB, book Book) ([]BookFile, error) {
+	var files []BookFile
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var purchases int64
+		if err := tx.Model(&Transaction{}).Where("book_id = ?", book.ID).Count(&purchases).Error; err != nil {
+			return err
+		}
+		if purchases > 0 {
+			return ErrBookPurchased
+		}
+
+		for _, table := range []string{"book_contributors", "book_categories", "book_tags", "reviews"} {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE book_id = ?", book.ID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("book_id = ?", book.ID).Find(&files).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("book_id = ?", book.ID).Delete(&BookFile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("book_id = ?", book.ID).Delete(&BookDownload{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&Book{}, book.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
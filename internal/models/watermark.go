@@ -0,0 +1,52 @@
+// includes the watermarked copies of book files made for their buyers.
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Watermark is the copy of a book file marked for one buyer. The record outlives its blob so a
+// leaked copy can always be traced back through its fingerprint; the blob is only a cache.
+type Watermark struct {
+	ID            uint      `json:"-" gorm:"primary_key"`
+	Fingerprint   string    `json:"fingerprint" gorm:"not null;uniqueIndex"`
+	UserID        uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_watermarks_user_book_format"`
+	BookID        uint      `json:"book_id" gorm:"not null;uniqueIndex:idx_watermarks_user_book_format"`
+	Format        string    `json:"format" gorm:"not null;uniqueIndex:idx_watermarks_user_book_format"`
+	TransactionID uint      `json:"transaction_id" gorm:"not null"`
+	SourceSHA256  string    `json:"source_sha256" gorm:"column:source_sha256;not null"` // the book file the copy was made from
+	StorageKey    string    `json:"-" gorm:"not null"`
+	Size          int64     `json:"size" gorm:"not null"`
+	SHA256        string    `json:"sha256" gorm:"column:sha256;not null"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// GetWatermark retrieves the copy of a book made for a user in the given format
+func GetWatermark(db *gorm.DB, userID, bookID uint, format string) (Watermark, error) {
+	var watermark Watermark
+	err := db.Where("user_id = ? AND book_id = ? AND format = ?", userID, bookID, format).First(&watermark).Error
+	return watermark, err
+}
+
+// GetWatermarkByFingerprint retrieves the copy carrying the given fingerprint
+func GetWatermarkByFingerprint(db *gorm.DB, fingerprint string) (Watermark, error) {
+	var watermark Watermark
+	err := db.Where("fingerprint = ?", fingerprint).First(&watermark).Error
+	return watermark, err
+}
+
+// SaveWatermark creates or updates the record of a copy
+func SaveWatermark(db *gorm.DB, watermark *Watermark) error {
+	return db.Save(watermark).Error
+}
+
+// GetPurchase retrieves the first transaction in which a user bought a book
+func GetPurchase(db *gorm.DB, userID, bookID uint) (Transaction, error) {
+	var transaction Transaction
+	err := db.Where("user_id = ? AND book_id = ?", userID, bookID).Order("id").First(&transaction).Error
+	return transaction, err
+}
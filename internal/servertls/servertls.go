@@ -0,0 +1,210 @@
+/*
+   servertls provides the server's optional TLS setup: certificates that are reloaded from disk
+   without a restart, an optional client CA pool for mutual TLS, and the HTTP-to-HTTPS redirect.
+*/
+
+package servertls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config selects the certificate files and the optional TLS features
+type Config struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string        // enables mutual TLS for admin routes
+	RedirectAddr   string        // e.g. ":80"; empty disables the redirect listener
+	ReloadInterval time.Duration // how often the files are checked for changes
+}
+
+// ConfigFromEnv reads TLS_CERT_FILE, TLS_KEY_FILE, TLS_CLIENT_CA_FILE, TLS_REDIRECT_ADDR and TLS_RELOAD_INTERVAL
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		CertFile:       os.Getenv("TLS_CERT_FILE"),
+		KeyFile:        os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		RedirectAddr:   os.Getenv("TLS_REDIRECT_ADDR"),
+		ReloadInterval: 30 * time.Second,
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return Config{}, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if !cfg.Enabled() && (cfg.ClientCAFile != "" || cfg.RedirectAddr != "") {
+		return Config{}, errors.New("TLS_CLIENT_CA_FILE and TLS_REDIRECT_ADDR require TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if value := os.Getenv("TLS_RELOAD_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return Config{}, fmt.Errorf("TLS_RELOAD_INTERVAL must be a positive duration such as 30s")
+		}
+		cfg.ReloadInterval = interval
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether the server should speak TLS
+func (c Config) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// MutualTLS reports whether client certificates are verified
+func (c Config) MutualTLS() bool {
+	return c.ClientCAFile != ""
+}
+
+// Reloader holds the current certificate and client CA pool. New handshakes pick up
+// reloaded files while established connections keep going with what they negotiated.
+type Reloader struct {
+	cfg Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	versions  map[string]fileVersion
+}
+
+// fileVersion identifies a revision of a file on disk
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader loads the configured files, failing if any of them is unusable
+func NewReloader(cfg Config) (*Reloader, error) {
+	r := &Reloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.MutualTLS() {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) currentVersions() map[string]fileVersion {
+	versions := map[string]fileVersion{}
+	for _, file := range r.files() {
+		if info, err := os.Stat(file); err == nil {
+			versions[file] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return versions
+}
+
+// Reload reads the certificate, key and client CA files again. On error the previous
+// material stays in use.
+func (r *Reloader) Reload() error {
+	versions := r.currentVersions()
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.MutualTLS() {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("reading client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCAs, r.versions = &cert, clientCAs, versions
+	r.mu.Unlock()
+	return nil
+}
+
+// changed reports whether any file differs from the version last loaded
+func (r *Reloader) changed() bool {
+	current := r.currentVersions()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, file := range r.files() {
+		if current[file] != r.versions[file] {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the files whenever they change on disk until ctx is done.
+// Replacing files is usually not atomic, so a failed reload is retried on the next tick.
+func (r *Reloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				logrus.WithError(err).Warn("TLS files changed but could not be reloaded; keeping the current certificate")
+				continue
+			}
+			logrus.Info("Reloaded TLS certificate after a file change")
+		}
+	}
+}
+
+// TLSConfig returns the server configuration; every handshake reads the current material
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			// Client certificates are optional at the handshake; admin routes insist on one
+			if r.clientCAs != nil {
+				config.ClientCAs = r.clientCAs
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return config, nil
+		},
+	}
+}
+
+// RedirectHandler sends every plain HTTP request to the same URL on the HTTPS port
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
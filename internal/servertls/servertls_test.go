@@ -0,0 +1,243 @@
+package servertls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM encoded certificate and key for commonName
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("issuing certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+// serve starts an HTTPS server using the reloader and reports whether a client certificate was verified
+func serve(t *testing.T, r *Reloader) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	server := &http.Server{
+		TLSConfig: r.TLSConfig(),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if len(req.TLS.VerifiedChains) > 0 {
+				w.Write([]byte(req.TLS.VerifiedChains[0][0].Subject.CommonName))
+			}
+		}),
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+// servedCommonName performs a handshake and returns the common name of the server certificate
+func servedCommonName(t *testing.T, url string, roots *x509.CertPool) string {
+	t.Helper()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, DisableKeepAlives: true}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	for _, key := range []string{"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_CLIENT_CA_FILE", "TLS_REDIRECT_ADDR", "TLS_RELOAD_INTERVAL"} {
+		t.Setenv(key, "")
+	}
+	cfg, err := ConfigFromEnv()
+	if err != nil || cfg.Enabled() {
+		t.Fatalf("expected TLS to be off by default, got %+v (%v)", cfg, err)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "server.crt")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected a certificate without a key to be rejected")
+	}
+	t.Setenv("TLS_KEY_FILE", "server.key")
+	t.Setenv("TLS_RELOAD_INTERVAL", "5s")
+	cfg, err = ConfigFromEnv()
+	if err != nil || !cfg.Enabled() || cfg.MutualTLS() || cfg.ReloadInterval != 5*time.Second {
+		t.Fatalf("unexpected config %+v (%v)", cfg, err)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	t.Setenv("TLS_REDIRECT_ADDR", ":80")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected the redirect listener to require TLS")
+	}
+}
+
+func TestReloadOnFileChange(t *testing.T) {
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	dir := t.TempDir()
+	cfg := Config{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "server.key"), ReloadInterval: 10 * time.Millisecond}
+	certPEM, keyPEM := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+
+	reloader, err := NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	url := serve(t, reloader)
+	if cn := servedCommonName(t, url, roots); cn != "first" {
+		t.Fatalf("expected the first certificate, got %q", cn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx)
+
+	// A broken write keeps the current certificate
+	writeFile(t, cfg.CertFile, []byte("not a certificate"))
+	time.Sleep(50 * time.Millisecond)
+	if cn := servedCommonName(t, url, roots); cn != "first" {
+		t.Fatalf("expected the first certificate to stay in use, got %q", cn)
+	}
+
+	certPEM, keyPEM = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.KeyFile, keyPEM)
+	writeFile(t, cfg.CertFile, certPEM)
+	deadline := time.Now().Add(2 * time.Second)
+	for servedCommonName(t, url, roots) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("the new certificate was not picked up")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	dir := t.TempDir()
+	cfg := Config{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "clients.pem"),
+	}
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+	writeFile(t, cfg.ClientCAFile, ca.pem)
+
+	reloader, err := NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	url := serve(t, reloader)
+
+	get := func(certificates []tls.Certificate) string {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates}}}
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		defer resp.Body.Close()
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		return string(body[:n])
+	}
+
+	// Without a certificate the handshake still succeeds; routes decide whether they need one
+	if got := get(nil); got != "" {
+		t.Fatalf("expected no verified client, got %q", got)
+	}
+
+	clientCert, clientKey := ca.issue(t, "admin-laptop", x509.ExtKeyUsageClientAuth)
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("client key pair: %v", err)
+	}
+	if got := get([]tls.Certificate{pair}); got != "admin-laptop" {
+		t.Fatalf("expected the verified client admin-laptop, got %q", got)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	cases := map[string]string{
+		"8443": "https://shop.example.com:8443/api/v1/books?page=2",
+		"443":  "https://shop.example.com/api/v1/books?page=2",
+	}
+	for port, want := range cases {
+		rec := httptest.NewRecorder()
+		RedirectHandler(port).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://shop.example.com:8080/api/v1/books?page=2", nil))
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != want {
+			t.Errorf("port %s: expected 308 to %s, got %d %s", port, want, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
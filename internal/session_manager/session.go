@@ -1,9 +1,107 @@
 package session_manager
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/sessions"
 )
 
+// Store holds the session cookie store; Setup replaces it once the configuration is loaded
 var Store = sessions.NewCookieStore([]byte(os.Getenv("SESSION_SECRET_KEY")))
+
+// Config holds the session secret and the attributes of the session cookie
+type Config struct {
+	Secret   string
+	SameSite http.SameSite
+	Secure   bool
+	HttpOnly bool
+	MaxAge   time.Duration
+	Domain   string
+}
+
+// ConfigFromEnv reads SESSION_SECRET_KEY and the SESSION_COOKIE_* variables.
+// Defaults: SameSite=Lax, Secure=false, HttpOnly=true, MaxAge=24h.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Secret:   os.Getenv("SESSION_SECRET_KEY"),
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		MaxAge:   24 * time.Hour,
+		Domain:   os.Getenv("SESSION_COOKIE_DOMAIN"),
+	}
+
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SESSION_COOKIE_SAMESITE"))) {
+	case "", "lax":
+	case "strict":
+		cfg.SameSite = http.SameSiteStrictMode
+	case "none":
+		cfg.SameSite = http.SameSiteNoneMode
+	default:
+		return Config{}, fmt.Errorf("SESSION_COOKIE_SAMESITE must be lax, strict or none")
+	}
+
+	var err error
+	if cfg.Secure, err = boolFromEnv("SESSION_COOKIE_SECURE", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.HttpOnly, err = boolFromEnv("SESSION_COOKIE_HTTPONLY", true); err != nil {
+		return Config{}, err
+	}
+	if value := os.Getenv("SESSION_COOKIE_MAX_AGE"); value != "" {
+		if cfg.MaxAge, err = time.ParseDuration(value); err != nil || cfg.MaxAge <= 0 {
+			return Config{}, fmt.Errorf("SESSION_COOKIE_MAX_AGE must be a positive duration such as 24h")
+		}
+	}
+	return cfg, nil
+}
+
+func boolFromEnv(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+	return parsed, nil
+}
+
+// NewStore builds a cookie store whose cookies carry the configured attributes
+func NewStore(cfg Config) (*sessions.CookieStore, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("SESSION_SECRET_KEY is not set")
+	}
+	// Browsers drop SameSite=None cookies that are not Secure
+	if cfg.SameSite == http.SameSiteNoneMode && !cfg.Secure {
+		return nil, errors.New("SESSION_COOKIE_SAMESITE=none requires SESSION_COOKIE_SECURE=true")
+	}
+
+	store := sessions.NewCookieStore([]byte(cfg.Secret))
+	store.Options = &sessions.Options{
+		Path:     "/",
+		Domain:   cfg.Domain,
+		MaxAge:   int(cfg.MaxAge / time.Second),
+		Secure:   cfg.Secure,
+		HttpOnly: cfg.HttpOnly,
+		SameSite: cfg.SameSite,
+	}
+	store.MaxAge(store.Options.MaxAge)
+	return store, nil
+}
+
+// Setup replaces the package level Store with one built from cfg
+func Setup(cfg Config) error {
+	store, err := NewStore(cfg)
+	if err != nil {
+		return err
+	}
+	Store = store
+	return nil
+}
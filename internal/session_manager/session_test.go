@@ -0,0 +1,66 @@
+package session_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnvDefaults(t *testing.T) {
+	for _, key := range []string{"SESSION_COOKIE_SAMESITE", "SESSION_COOKIE_SECURE", "SESSION_COOKIE_HTTPONLY", "SESSION_COOKIE_MAX_AGE", "SESSION_COOKIE_DOMAIN"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("SESSION_SECRET_KEY", "secret")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	if cfg.SameSite != http.SameSiteLaxMode || cfg.Secure || !cfg.HttpOnly || cfg.MaxAge != 24*time.Hour {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+}
+
+func TestConfigFromEnvRejectsInvalidValues(t *testing.T) {
+	cases := map[string]string{
+		"SESSION_COOKIE_SAMESITE": "sometimes",
+		"SESSION_COOKIE_SECURE":   "maybe",
+		"SESSION_COOKIE_MAX_AGE":  "-1h",
+	}
+	for key, value := range cases {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := ConfigFromEnv(); err == nil {
+				t.Fatalf("expected an error for %s=%s", key, value)
+			}
+		})
+	}
+}
+
+func TestNewStoreCookieAttributes(t *testing.T) {
+	if _, err := NewStore(Config{}); err == nil {
+		t.Fatal("expected an error without a secret")
+	}
+	if _, err := NewStore(Config{Secret: "s", SameSite: http.SameSiteNoneMode}); err == nil {
+		t.Fatal("expected SameSite=None without Secure to be rejected")
+	}
+
+	store, err := NewStore(Config{Secret: "s", SameSite: http.SameSiteStrictMode, Secure: true, HttpOnly: true, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := store.Get(req, "session-name")
+	session.Values["user_id"] = uint(1)
+	if err := session.Save(req, rec); err != nil {
+		t.Fatalf("saving session: %v", err)
+	}
+
+	cookie := rec.Result().Cookies()[0]
+	if cookie.SameSite != http.SameSiteStrictMode || !cookie.Secure || !cookie.HttpOnly || cookie.MaxAge != 3600 || cookie.Path != "/" {
+		t.Fatalf("unexpected cookie attributes %+v", cookie)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+   slug turns names into the lowercase, hyphen-separated identifiers used in URLs, such as
+   /api/v1/authors/j-k-rowling. Accents are dropped so "Camus" and "Camús" share a slug, and
+   punctuation only separates words so "J. K. Rowling" and "J.K. Rowling" do too.
+*/
+
+package slug
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength caps the length of a slug, in bytes; longer slugs are cut at a word boundary
+const MaxLength = 100
+
+// letters that do not decompose into a base letter and an accent
+var ligatures = strings.NewReplacer("ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "ð", "d", "þ", "th", "ı", "i")
+
+// Make returns the slug of a name, empty when the name has no letter or digit
+func Make(name string) string {
+	folded := ligatures.Replace(norm.NFKD.String(strings.ToLower(name)))
+
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range folded {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accents left over from the decomposition
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			pendingHyphen = true
+		}
+	}
+
+	slug := norm.NFC.String(b.String())
+	if len(slug) > MaxLength {
+		slug = slug[:MaxLength]
+		if i := strings.LastIndexByte(slug, '-'); i > 0 {
+			slug = slug[:i]
+		} else {
+			slug = strings.ToValidUTF8(slug, "")
+		}
+	}
+	return slug
+}
+
+// Valid reports whether s is a slug, as Make returns them
+func Valid(s string) bool {
+	return s != "" && Make(s) == s
+}
@@ -0,0 +1,43 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{in: "J. K. Rowling", want: "j-k-rowling"},
+		{in: "J.K. Rowling", want: "j-k-rowling"},
+		{in: "  Ursula K. Le Guin ", want: "ursula-k-le-guin"},
+		{in: "Gabriel García Márquez", want: "gabriel-garcia-marquez"},
+		{in: "Søren Kierkegaard", want: "soren-kierkegaard"},
+		{in: "Stanisław Lem", want: "stanislaw-lem"},
+		{in: "Фёдор Достоевский", want: "федор-достоевскии"},
+		{in: "Science-Fiction & Fantasy", want: "science-fiction-fantasy"},
+		{in: "1984", want: "1984"},
+		{in: "?!", want: ""},
+	}
+	for _, tc := range cases {
+		if got := Make(tc.in); got != tc.want {
+			t.Errorf("Make(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMakeTruncatesAtWordBoundary(t *testing.T) {
+	got := Make(strings.Repeat("word ", 40))
+	if len(got) > MaxLength || strings.HasSuffix(got, "-") || !strings.HasSuffix(got, "word") {
+		t.Fatalf("unexpected slug %q", got)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for s, want := range map[string]bool{"j-k-rowling": true, "J-K-Rowling": false, "j--k": false, "-j": false, "": false} {
+		if got := Valid(s); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// recordSpans installs an in-memory tracer provider for the duration of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := Setup(context.Background(), Config{Exporter: ExporterNone}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+type testBook struct {
+	ID   uint
+	ISBN string
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&testBook{}); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	if err := db.Use(GormPlugin{}); err != nil {
+		t.Fatalf("registering plugin: %v", err)
+	}
+	return db
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	if cfg := ConfigFromEnv(); cfg.Exporter != ExporterNone || cfg.ServiceName != "bookstore" {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+
+	if _, err := Setup(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Fatal("expected an error for an unsupported exporter")
+	}
+}
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	router := gin.New()
+	router.Use(Middleware("bookstore"))
+	router.GET("/api/books/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/books/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if got := spans[0].SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected the incoming trace ID, got %s", got)
+	}
+	if got := spans[0].Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Fatalf("expected the incoming span as parent, got %s", got)
+	}
+	if spans[0].Name() != "/api/books/:id" {
+		t.Fatalf("expected the route as span name, got %q", spans[0].Name())
+	}
+}
+
+func TestGormPluginCreatesChildSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	db := openTestDB(t)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	tx := db.WithContext(ctx)
+	if err := tx.Create(&testBook{ISBN: "9780134190440"}).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var book testBook
+	if err := tx.Where("isbn = ?", "9780134190440").First(&book).Error; err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	// Not found must not mark the span as failed
+	tx.Where("isbn = ?", "missing").First(&testBook{})
+	parent.End()
+
+	var queries []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() != "request" {
+			queries = append(queries, span)
+		}
+	}
+	if len(queries) != 3 {
+		t.Fatalf("expected 3 query spans, got %d", len(queries))
+	}
+
+	wantNames := []string{"INSERT test_books", "SELECT test_books", "SELECT test_books"}
+	for i, span := range queries {
+		if span.Name() != wantNames[i] {
+			t.Errorf("span %d: expected name %q, got %q", i, wantNames[i], span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %d: expected the request span as parent", i)
+		}
+		if attr(span, "db.system") != "sqlite" || attr(span, "db.sql.table") != "test_books" {
+			t.Errorf("span %d: unexpected attributes %v", i, span.Attributes())
+		}
+		if span.Status().Code != 0 {
+			t.Errorf("span %d: expected an unset status, got %v", i, span.Status())
+		}
+	}
+	if attr(queries[1], "db.statement") == "" {
+		t.Error("expected the SQL statement to be recorded")
+	}
+}
+
+func TestGormPluginRecordsErrors(t *testing.T) {
+	recorder := recordSpans(t)
+	db := openTestDB(t)
+
+	db.Exec("SELECT * FROM no_such_table")
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status().Description == "" || len(spans[0].Events()) == 0 {
+		t.Fatalf("expected the error to be recorded, got %+v", spans[0].Status())
+	}
+}
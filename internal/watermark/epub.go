@@ -0,0 +1,165 @@
+package watermark
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+)
+
+// pageID is the manifest id, and base name, of the licence page added to EPUBs
+const pageID = "bookstore-watermark"
+
+var (
+	metadataEnd = regexp.MustCompile(`</([\w-]+:)?metadata\s*>`)
+	manifestEnd = regexp.MustCompile(`</([\w-]+:)?manifest\s*>`)
+	spineEnd    = regexp.MustCompile(`</([\w-]+:)?spine\s*>`)
+)
+
+// EPUB writes a copy of the EPUB in src to dst, marked with a licence page at the end of the
+// reading order, the mark in the package metadata and the fingerprint in the archive comment.
+// Entries other than the package document are copied without being recompressed.
+func EPUB(dst io.Writer, src io.ReaderAt, size int64, mark Mark) error {
+	archive, err := zip.NewReader(src, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	opfPath := packagePath(archive)
+
+	out := zip.NewWriter(dst)
+	page := ""
+	for _, f := range archive.File {
+		if f.Name != opfPath {
+			if err := out.Copy(f); err != nil {
+				return fmt.Errorf("copying %s: %w", f.Name, err)
+			}
+			continue
+		}
+
+		opf, err := readEntry(f)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		if marked, ok := markPackage(opf, mark); ok {
+			opf = marked
+			page = path.Join(path.Dir(opfPath), pageID+".xhtml")
+		}
+		w, err := out.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: f.Modified})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(opf); err != nil {
+			return err
+		}
+	}
+
+	if page != "" {
+		w, err := out.CreateHeader(&zip.FileHeader{Name: page, Method: zip.Deflate, Modified: mark.PurchasedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, licencePage(mark)); err != nil {
+			return err
+		}
+	}
+	if err := out.SetComment(mark.token()); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// packagePath returns the path of the package document (OPF) named by META-INF/container.xml, if any
+func packagePath(archive *zip.Reader) string {
+	for _, f := range archive.File {
+		if f.Name != "META-INF/container.xml" {
+			continue
+		}
+		data, err := readEntry(f)
+		if err != nil {
+			return ""
+		}
+		var container struct {
+			Rootfiles []struct {
+				FullPath  string `xml:"full-path,attr"`
+				MediaType string `xml:"media-type,attr"`
+			} `xml:"rootfiles>rootfile"`
+		}
+		if err := xml.Unmarshal(data, &container); err != nil {
+			return ""
+		}
+		for _, rootfile := range container.Rootfiles {
+			if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+				return rootfile.FullPath
+			}
+		}
+	}
+	return ""
+}
+
+// markPackage adds the mark to the metadata of a package document and the licence page to its
+// manifest and spine. It reports false, leaving the document alone, when a section is missing.
+func markPackage(opf []byte, mark Mark) ([]byte, bool) {
+	notice := html.EscapeString(mark.Notice())
+	opf, ok := insertBefore(opf, metadataEnd, func(prefix string) string {
+		return fmt.Sprintf(`<%smeta name="%s" content="%s"/><%smeta name="bookstore-licence" content="%s"/>`,
+			prefix, pageID, mark.token(), prefix, notice)
+	})
+	if !ok {
+		return nil, false
+	}
+	opf, ok = insertBefore(opf, manifestEnd, func(prefix string) string {
+		return fmt.Sprintf(`<%sitem id="%s" href="%s.xhtml" media-type="application/xhtml+xml"/>`, prefix, pageID, pageID)
+	})
+	if !ok {
+		return nil, false
+	}
+	opf, ok = insertBefore(opf, spineEnd, func(prefix string) string {
+		return fmt.Sprintf(`<%sitemref idref="%s"/>`, prefix, pageID)
+	})
+	return opf, ok
+}
+
+// insertBefore inserts text before the last match of the closing tag pattern; the text is
+// built from the namespace prefix of the matched tag, such as "opf:"
+func insertBefore(doc []byte, closing *regexp.Regexp, text func(prefix string) string) ([]byte, bool) {
+	matches := closing.FindAllSubmatchIndex(doc, -1)
+	if matches == nil {
+		return nil, false
+	}
+	last := matches[len(matches)-1]
+	prefix := ""
+	if last[2] >= 0 {
+		prefix = string(doc[last[2]:last[3]])
+	}
+	var out bytes.Buffer
+	out.Write(doc[:last[0]])
+	out.WriteString(text(prefix))
+	out.Write(doc[last[0]:])
+	return out.Bytes(), true
+}
+
+func licencePage(mark Mark) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Licence</title></head>
+<body>
+<p>` + html.EscapeString(mark.Notice()) + `</p>
+<p><small>` + mark.token() + `</small></p>
+</body>
+</html>
+`
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
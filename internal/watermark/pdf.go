@@ -0,0 +1,316 @@
+package watermark
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// tailSize is how much of the end of a PDF is searched for the last trailer
+	tailSize = 16 << 10
+	// maxDictSize bounds how far a dictionary is read from its start
+	maxDictSize = 64 << 10
+	// maxXrefSections bounds how many previous cross-reference sections are followed
+	maxXrefSections = 32
+)
+
+var (
+	sizeKey    = regexp.MustCompile(`/Size\s+(\d+)`)
+	rootKey    = regexp.MustCompile(`/Root\s+(\d+\s+\d+\s+R)`)
+	infoKey    = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	prevKey    = regexp.MustCompile(`/Prev\s+(\d+)`)
+	idKey      = regexp.MustCompile(`/ID\s*(\[[^\]]*\])`)
+	encryptKey = regexp.MustCompile(`/Encrypt\b`)
+)
+
+// trailer is what a PDF update needs to know about the latest revision of the file
+type trailer struct {
+	startxref int64 // offset of the latest cross-reference section
+	classic   bool  // a cross-reference table rather than a cross-reference stream
+	size      int   // number of objects, and so the next free object number
+	root      string
+	infoNum   int // 0 when the document has no information dictionary
+	id        string
+}
+
+// PDF writes a copy of the PDF in src to dst followed by an incremental update: a new document
+// information dictionary carrying the mark and a comment with the fingerprint. The entries of
+// the original dictionary, such as the title, are kept when it can be located.
+// Encrypted PDFs are not supported.
+func PDF(dst io.Writer, src io.ReaderAt, size int64, mark Mark) error {
+	tr, err := readTrailer(src, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	previous := ""
+	if tr.infoNum > 0 && tr.classic {
+		previous = findInfo(src, size, tr)
+	}
+
+	if _, err := io.Copy(dst, io.NewSectionReader(src, 0, size)); err != nil {
+		return err
+	}
+
+	var update bytes.Buffer
+	fmt.Fprintf(&update, "\n%% %s\n", mark.token())
+	infoNum := tr.size
+	infoOffset := size + int64(update.Len())
+	fmt.Fprintf(&update, "%d 0 obj\n<<%s /BookstoreWatermark %s /BookstoreLicence %s >>\nendobj\n",
+		infoNum, previous, pdfString(mark.token()), pdfString(mark.Notice()))
+
+	xrefOffset := size + int64(update.Len())
+	id := ""
+	if tr.id != "" {
+		id = " /ID " + tr.id
+	}
+	if tr.classic {
+		fmt.Fprintf(&update, "xref\n%d 1\n%010d 00000 n \ntrailer\n<< /Size %d /Root %s /Info %d 0 R /Prev %d%s >>\n",
+			infoNum, infoOffset, infoNum+1, tr.root, infoNum, tr.startxref, id)
+	} else {
+		// A file using cross-reference streams must be updated with one
+		xrefNum := infoNum + 1
+		entries := make([]byte, 0, 14)
+		for _, offset := range []int64{infoOffset, xrefOffset} {
+			entries = append(entries, 1)
+			entries = binary.BigEndian.AppendUint32(entries, uint32(offset))
+			entries = append(entries, 0, 0)
+		}
+		fmt.Fprintf(&update, "%d 0 obj\n<< /Type /XRef /Size %d /Index [%d 2] /W [1 4 2] /Root %s /Info %d 0 R /Prev %d%s /Length %d >>\nstream\n",
+			xrefNum, xrefNum+1, infoNum, tr.root, infoNum, tr.startxref, id, len(entries))
+		update.Write(entries)
+		update.WriteString("\nendstream\nendobj\n")
+	}
+	fmt.Fprintf(&update, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	_, err = dst.Write(update.Bytes())
+	return err
+}
+
+// readTrailer finds the latest cross-reference section of a PDF and reads its trailer
+func readTrailer(src io.ReaderAt, size int64) (trailer, error) {
+	var tr trailer
+	tail, err := readAt(src, size-tailSize, tailSize, size)
+	if err != nil {
+		return tr, err
+	}
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return tr, errors.New("no startxref")
+	}
+	fields := bytes.Fields(tail[i+len("startxref"):])
+	if len(fields) == 0 {
+		return tr, errors.New("no startxref offset")
+	}
+	tr.startxref, err = strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil || tr.startxref < 0 || tr.startxref >= size {
+		return tr, errors.New("invalid startxref offset")
+	}
+
+	section, err := readAt(src, tr.startxref, maxDictSize, size)
+	if err != nil {
+		return tr, err
+	}
+	var dict []byte
+	if bytes.HasPrefix(bytes.TrimLeft(section, " \t\r\n"), []byte("xref")) {
+		tr.classic = true
+		j := bytes.LastIndex(tail[:i], []byte("trailer"))
+		if j < 0 {
+			return tr, errors.New("no trailer")
+		}
+		dict = balancedDict(tail[j:])
+	} else {
+		dict = balancedDict(section)
+		if !bytes.Contains(dict, []byte("/XRef")) {
+			return tr, errors.New("startxref does not point to a cross-reference section")
+		}
+	}
+	if dict == nil {
+		return tr, errors.New("malformed trailer")
+	}
+	if encryptKey.Match(dict) {
+		return tr, errors.New("the PDF is encrypted")
+	}
+
+	m := sizeKey.FindSubmatch(dict)
+	if m == nil {
+		return tr, errors.New("the trailer has no /Size")
+	}
+	tr.size, _ = strconv.Atoi(string(m[1]))
+	m = rootKey.FindSubmatch(dict)
+	if m == nil {
+		return tr, errors.New("the trailer has no /Root")
+	}
+	tr.root = string(m[1])
+	if m = infoKey.FindSubmatch(dict); m != nil {
+		tr.infoNum, _ = strconv.Atoi(string(m[1]))
+	}
+	if m = idKey.FindSubmatch(dict); m != nil {
+		tr.id = string(m[1])
+	}
+	return tr, nil
+}
+
+// findInfo returns the entries of the document information dictionary, following the chain of
+// cross-reference tables. It returns "" when the dictionary cannot be located.
+func findInfo(src io.ReaderAt, size int64, tr trailer) string {
+	offset := tr.startxref
+	for i := 0; i < maxXrefSections && offset >= 0; i++ {
+		objOffset, prev, found := lookupXref(bufio.NewReader(io.NewSectionReader(src, offset, size-offset)), tr.infoNum)
+		if found {
+			object, err := readAt(src, objOffset, maxDictSize, size)
+			if err != nil || !bytes.HasPrefix(object, []byte(strconv.Itoa(tr.infoNum)+" ")) {
+				return ""
+			}
+			dict := balancedDict(object)
+			if dict == nil {
+				return ""
+			}
+			return " " + strings.TrimSpace(string(dict[2:len(dict)-2]))
+		}
+		offset = prev
+	}
+	return ""
+}
+
+// lookupXref searches a cross-reference table for an object in use. It returns the offset of the
+// object when found, and otherwise the offset of the previous table or -1.
+func lookupXref(r *bufio.Reader, num int) (objOffset, prev int64, found bool) {
+	if line, _ := readLine(r); line != "xref" {
+		return 0, -1, false
+	}
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return 0, -1, false
+		}
+		if strings.HasPrefix(line, "trailer") {
+			rest := make([]byte, maxDictSize)
+			n, _ := io.ReadFull(r, rest)
+			dict := balancedDict(append([]byte(line), rest[:n]...))
+			if m := prevKey.FindSubmatch(dict); m != nil {
+				prev, _ = strconv.ParseInt(string(m[1]), 10, 64)
+				return 0, prev, false
+			}
+			return 0, -1, false
+		}
+
+		var start, count int
+		if _, err := fmt.Sscanf(line, "%d %d", &start, &count); err != nil {
+			return 0, -1, false
+		}
+		for k := 0; k < count; k++ {
+			entry, err := readLine(r)
+			if err != nil {
+				return 0, -1, false
+			}
+			if start+k != num {
+				continue
+			}
+			fields := strings.Fields(entry)
+			if len(fields) == 3 && fields[2] == "n" {
+				offset, err := strconv.ParseInt(fields[0], 10, 64)
+				return offset, -1, err == nil
+			}
+			// A free entry: the object was deleted in this revision
+			return 0, -1, false
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// balancedDict returns the first dictionary in b, from "<<" to its matching ">>", skipping
+// over strings that could contain delimiters. It returns nil if the dictionary is not closed.
+func balancedDict(b []byte) []byte {
+	start := bytes.Index(b, []byte("<<"))
+	if start < 0 {
+		return nil
+	}
+	depth := 0
+	for i := start; i < len(b); i++ {
+		switch b[i] {
+		case '(':
+			// Literal strings nest parentheses and escape with backslashes
+			nesting := 0
+			for ; i < len(b); i++ {
+				if b[i] == '\\' {
+					i++
+				} else if b[i] == '(' {
+					nesting++
+				} else if b[i] == ')' {
+					if nesting--; nesting == 0 {
+						break
+					}
+				}
+			}
+		case '<':
+			if i+1 < len(b) && b[i+1] == '<' {
+				depth++
+				i++
+			} else if end := bytes.IndexByte(b[i:], '>'); end >= 0 {
+				i += end // a hexadecimal string
+			}
+		case '>':
+			if i+1 < len(b) && b[i+1] == '>' {
+				i++
+				if depth--; depth == 0 {
+					return b[start : i+1]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pdfString encodes text as a PDF string: literal for printable ASCII, UTF-16 otherwise
+func pdfString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+	}
+	units := utf16.Encode([]rune(s))
+	encoded := make([]byte, 0, 2+2*len(units))
+	encoded = append(encoded, 0xfe, 0xff)
+	for _, u := range units {
+		encoded = binary.BigEndian.AppendUint16(encoded, u)
+	}
+	return "<" + strings.ToUpper(hex.EncodeToString(encoded)) + ">"
+}
+
+// readAt reads up to n bytes at offset, clamped to the file
+func readAt(src io.ReaderAt, offset, n, size int64) ([]byte, error) {
+	if offset < 0 {
+		n += offset
+		offset = 0
+	}
+	if offset+n > size {
+		n = size - offset
+	}
+	buf := make([]byte, n)
+	read, err := src.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:read], nil
+}
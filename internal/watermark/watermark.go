@@ -0,0 +1,114 @@
+/*
+   watermark marks ebook files with the identity of their buyer so leaked copies can be traced.
+   EPUBs get a visible "licensed to" page and metadata; PDFs get their document information
+   rewritten through an incremental update. Every copy carries a random fingerprint that
+   Extract recovers, and that the server maps back to the purchase.
+*/
+
+package watermark
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// marker prefixes the fingerprint wherever it is embedded, so Extract can find it in any copy
+const marker = "bookstore-watermark:"
+
+// maxScannedEntry bounds the EPUB entries Extract decompresses; the marked entries are small
+const maxScannedEntry = 1 << 20
+
+var (
+	fingerprintPattern = regexp.MustCompile(marker + `([0-9a-f]{32})`)
+
+	ErrNotFound    = errors.New("no watermark found")
+	ErrUnsupported = errors.New("the file cannot be watermarked")
+)
+
+// Mark identifies the purchase a copy is made for
+type Mark struct {
+	Fingerprint   string
+	Buyer         string // shown to the reader, e.g. "Jane <jane@example.com>"
+	TransactionID uint
+	PurchasedAt   time.Time
+}
+
+// NewFingerprint returns a random fingerprint for a new copy
+func NewFingerprint() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Notice is the human-readable licence line embedded in every copy
+func (m Mark) Notice() string {
+	return fmt.Sprintf("Licensed to %s, transaction #%d on %s.", m.Buyer, m.TransactionID, m.PurchasedAt.UTC().Format("2006-01-02"))
+}
+
+func (m Mark) token() string {
+	return marker + m.Fingerprint
+}
+
+// Extract returns the fingerprint of a watermarked EPUB or PDF, or ErrNotFound.
+// When a file carries several fingerprints the last one embedded wins.
+func Extract(r io.ReaderAt, size int64) (string, error) {
+	if archive, err := zip.NewReader(r, size); err == nil {
+		return extractZIP(archive)
+	}
+	return scan(io.NewSectionReader(r, 0, size))
+}
+
+func extractZIP(archive *zip.Reader) (string, error) {
+	if m := fingerprintPattern.FindStringSubmatch(archive.Comment); m != nil {
+		return m[1], nil
+	}
+	for _, f := range archive.File {
+		if f.UncompressedSize64 > maxScannedEntry {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxScannedEntry))
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		if m := fingerprintPattern.FindSubmatch(data); m != nil {
+			return string(m[1]), nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// scan searches a stream for the last fingerprint, reading it in overlapping chunks
+func scan(r io.Reader) (string, error) {
+	const chunk = 64 << 10
+	overlap := len(marker) + 32
+	buf := make([]byte, 0, chunk+overlap)
+	found := ""
+	for {
+		n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if all := fingerprintPattern.FindAllSubmatch(buf, -1); all != nil {
+			found = string(all[len(all)-1][1])
+		}
+		if err != nil {
+			break
+		}
+		// Keep the tail in case a marker straddles two chunks
+		keep := buf[len(buf)-overlap:]
+		buf = append(buf[:0], keep...)
+	}
+	if found == "" {
+		return "", ErrNotFound
+	}
+	return found, nil
+}
@@ -0,0 +1,255 @@
+package watermark
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMark = Mark{
+	Fingerprint:   "0123456789abcdef0123456789abcdef",
+	Buyer:         "Zoë <zoe@example.com>",
+	TransactionID: 42,
+	PurchasedAt:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+}
+
+// testPDF builds a small PDF with a cross-reference table and a document information dictionary
+func testPDF() []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 200] >>",
+		"<< /Title (The Go \\(Programming\\) Language) /Author <416C616E> >>",
+	}
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R /ID [<AB12><AB12>] >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+// testXrefStreamPDF builds a PDF 1.5 file whose cross-reference section is an uncompressed stream
+func testXrefStreamPDF() []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	catalog := b.Len()
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	pages := b.Len()
+	b.WriteString("2 0 obj\n<< /Type /Pages /Kids [] /Count 0 >>\nendobj\n")
+	xref := b.Len()
+	var entries []byte
+	for _, entry := range [][3]int{{0, 0, 255}, {1, catalog, 0}, {1, pages, 0}, {1, xref, 0}} {
+		entries = append(entries, byte(entry[0]), byte(entry[1]>>8), byte(entry[1]), byte(entry[2]))
+	}
+	fmt.Fprintf(&b, "3 0 obj\n<< /Type /XRef /Size 4 /W [1 2 1] /Root 1 0 R /DecodeParms << /Columns 4 >> /Length %d >>\nstream\n", len(entries))
+	b.Write(entries)
+	fmt.Fprintf(&b, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+	return b.Bytes()
+}
+
+// testEPUB builds an EPUB with a namespaced package document in a subdirectory
+func testEPUB(t *testing.T, withPackage bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	mimetype, _ := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	mimetype.Write([]byte("application/epub+zip"))
+	container, _ := archive.Create("META-INF/container.xml")
+	if withPackage {
+		container.Write([]byte(`<?xml version="1.0"?><container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">` +
+			`<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`))
+		opf, _ := archive.Create("OEBPS/content.opf")
+		opf.Write([]byte(`<?xml version="1.0"?><opf:package xmlns:opf="http://www.idpf.org/2007/opf" version="3.0">` +
+			`<opf:metadata><dc:title xmlns:dc="http://purl.org/dc/elements/1.1/">Go</dc:title></opf:metadata>` +
+			`<opf:manifest><opf:item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/></opf:manifest>` +
+			`<opf:spine><opf:itemref idref="ch1"/></opf:spine></opf:package>`))
+		chapter, _ := archive.Create("OEBPS/ch1.xhtml")
+		chapter.Write([]byte(strings.Repeat("<p>chapter</p>", 100)))
+	} else {
+		container.Write([]byte(`<?xml version="1.0"?><container version="1.0"/>`))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("building EPUB: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func entry(t *testing.T, archive *zip.Reader, name string) string {
+	t.Helper()
+	f, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("opening %s: %v", name, err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	return string(data)
+}
+
+func TestPDF(t *testing.T) {
+	src := testPDF()
+	var out bytes.Buffer
+	if err := PDF(&out, bytes.NewReader(src), int64(len(src)), testMark); err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	marked := out.Bytes()
+	if !bytes.HasPrefix(marked, src) {
+		t.Fatal("expected the original revision to be kept intact")
+	}
+
+	tr, err := readTrailer(bytes.NewReader(marked), int64(len(marked)))
+	if err != nil {
+		t.Fatalf("reading the updated trailer: %v", err)
+	}
+	if !tr.classic || tr.size != 6 || tr.root != "1 0 R" || tr.infoNum != 5 || tr.id != "[<AB12><AB12>]" {
+		t.Fatalf("unexpected updated trailer %+v", tr)
+	}
+	info := findInfo(bytes.NewReader(marked), int64(len(marked)), tr)
+	for _, want := range []string{`/Title (The Go \(Programming\) Language)`, "/Author <416C616E>", "/BookstoreWatermark (" + marker + testMark.Fingerprint + ")", "/BookstoreLicence <FEFF"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("expected the new information dictionary to contain %q, got %q", want, info)
+		}
+	}
+
+	got, err := Extract(bytes.NewReader(marked), int64(len(marked)))
+	if err != nil || got != testMark.Fingerprint {
+		t.Fatalf("Extract = %q, %v", got, err)
+	}
+}
+
+func TestPDFWithCrossReferenceStream(t *testing.T) {
+	src := testXrefStreamPDF()
+	var out bytes.Buffer
+	if err := PDF(&out, bytes.NewReader(src), int64(len(src)), testMark); err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	marked := out.Bytes()
+	tr, err := readTrailer(bytes.NewReader(marked), int64(len(marked)))
+	if err != nil {
+		t.Fatalf("reading the updated trailer: %v", err)
+	}
+	if tr.classic || tr.size != 6 || tr.infoNum != 4 || tr.root != "1 0 R" {
+		t.Fatalf("unexpected updated trailer %+v", tr)
+	}
+	if !bytes.Contains(marked[len(src):], []byte("/Prev "+fmt.Sprint(bytes.LastIndex(src, []byte("3 0 obj"))))) {
+		t.Fatalf("expected the update to point to the previous section:\n%s", marked[len(src):])
+	}
+	if got, err := Extract(bytes.NewReader(marked), int64(len(marked))); err != nil || got != testMark.Fingerprint {
+		t.Fatalf("Extract = %q, %v", got, err)
+	}
+}
+
+func TestPDFUnsupported(t *testing.T) {
+	encrypted := bytes.Replace(testPDF(), []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt 9 0 R"), 1)
+	for name, src := range map[string][]byte{
+		"no trailer": []byte("%PDF-1.7 " + strings.Repeat("chapter ", 50)),
+		"encrypted":  encrypted,
+	} {
+		if err := PDF(io.Discard, bytes.NewReader(src), int64(len(src)), testMark); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, got %v", name, err)
+		}
+	}
+}
+
+func TestEPUB(t *testing.T) {
+	src := testEPUB(t, true)
+	var out bytes.Buffer
+	if err := EPUB(&out, bytes.NewReader(src), int64(len(src)), testMark); err != nil {
+		t.Fatalf("EPUB: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("reading the marked EPUB: %v", err)
+	}
+	if first := archive.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Fatalf("expected the mimetype to stay the first, stored entry, got %s", first.Name)
+	}
+
+	opf := entry(t, archive, "OEBPS/content.opf")
+	for _, want := range []string{
+		`<opf:meta name="bookstore-watermark" content="` + marker + testMark.Fingerprint + `"/>`,
+		"Licensed to Zoë &lt;zoe@example.com&gt;, transaction #42 on 2024-03-01.",
+		`<opf:item id="bookstore-watermark" href="bookstore-watermark.xhtml" media-type="application/xhtml+xml"/></opf:manifest>`,
+		`<opf:itemref idref="ch1"/><opf:itemref idref="bookstore-watermark"/></opf:spine>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("expected the package document to contain %q, got %s", want, opf)
+		}
+	}
+	if page := entry(t, archive, "OEBPS/bookstore-watermark.xhtml"); !strings.Contains(page, "Licensed to Zoë &lt;zoe@example.com&gt;") {
+		t.Errorf("expected a licence page, got %s", page)
+	}
+	if entry(t, archive, "OEBPS/ch1.xhtml") != strings.Repeat("<p>chapter</p>", 100) {
+		t.Error("expected the chapters to be copied unchanged")
+	}
+
+	// The archive comment is enough to identify a copy, even without its pages
+	if got, err := Extract(bytes.NewReader(out.Bytes()), int64(out.Len())); err != nil || got != testMark.Fingerprint {
+		t.Fatalf("Extract = %q, %v", got, err)
+	}
+}
+
+func TestEPUBWithoutPackageDocument(t *testing.T) {
+	src := testEPUB(t, false)
+	var out bytes.Buffer
+	if err := EPUB(&out, bytes.NewReader(src), int64(len(src)), testMark); err != nil {
+		t.Fatalf("EPUB: %v", err)
+	}
+	archive, _ := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if len(archive.File) != 2 || archive.Comment != marker+testMark.Fingerprint {
+		t.Fatalf("expected the entries to be copied and the archive commented, got %d entries and %q", len(archive.File), archive.Comment)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	plain := testPDF()
+	if _, err := Extract(bytes.NewReader(plain), int64(len(plain))); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an unmarked file, got %v", err)
+	}
+
+	// A marker straddling two scanned chunks is still found
+	straddling := append(bytes.Repeat([]byte{' '}, 64<<10-10), marker+testMark.Fingerprint...)
+	if got, err := Extract(bytes.NewReader(straddling), int64(len(straddling))); err != nil || got != testMark.Fingerprint {
+		t.Fatalf("Extract = %q, %v", got, err)
+	}
+
+	// The entries of an EPUB whose comment was stripped are searched
+	src := testEPUB(t, true)
+	var marked bytes.Buffer
+	EPUB(&marked, bytes.NewReader(src), int64(len(src)), testMark)
+	archive, _ := zip.NewReader(bytes.NewReader(marked.Bytes()), int64(marked.Len()))
+	var stripped bytes.Buffer
+	out := zip.NewWriter(&stripped)
+	for _, f := range archive.File {
+		out.Copy(f)
+	}
+	out.Close()
+	if got, err := Extract(bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); err != nil || got != testMark.Fingerprint {
+		t.Fatalf("Extract = %q, %v", got, err)
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	cases := map[string]string{
+		`a (b) \c`: `(a \(b\) \\c)`,
+		"é":        "<FEFF00E9>",
+	}
+	for in, want := range cases {
+		if got := pdfString(in); got != want {
+			t.Errorf("pdfString(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -3,23 +3,32 @@ package main
 import (
 	"bookstore/internal/models"
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strconv"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"bookstore/internal/blobstore"
+	"bookstore/internal/delivery"
 	"bookstore/internal/handlers"
+	"bookstore/internal/logging"
+	"bookstore/internal/metadata"
+	"bookstore/internal/metrics"
+	"bookstore/internal/middlewares"
+	"bookstore/internal/servertls"
+	"bookstore/internal/session_manager"
+	"bookstore/internal/tracing"
 
 	"github.com/sirupsen/logrus"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // Checks whether admin user exists in the db (if not enforces the developer to create one)
@@ -74,24 +83,20 @@ func checkAdmin(db *gorm.DB) {
 }
 
 // setting up the routes
-func run() {
+func run(tracingConfig tracing.Config, securityConfig middlewares.SecurityConfig, tlsConfig servertls.Config) {
 
-	// Initialize the Gin router
-	router := gin.Default()
-	// Set up CORS middleware to allow any origin
-
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{os.Getenv("REACT_APP_FRONTEND")}
-	config.AllowCredentials = true
-
-	router.Use(cors.New(config))
-
-	//Configuring all the defined routes
-	handlers.InitializeRoutes(router)
-	handlers.InitializeBookRoutes(router)
-	handlers.InitializeAdminRoutes(router)
-	handlers.InitializeReviewRoutes(router)
-	handlers.InitializeTransactionRoutes(router)
+	// Initialize the Gin router with security headers, CORS for the configured frontends
+	// (CORS_ALLOWED_ORIGINS), body size limits and JSON access logs, then every route
+	router, err := handlers.NewRouter(tracingConfig.ServiceName, securityConfig)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error configuring the router")
+	}
+	// Prometheus scrapes /metrics with METRICS_TOKEN as a bearer token; without one it is not served
+	handlers.MetricsToken = os.Getenv("METRICS_TOKEN")
+	if handlers.MetricsToken == "" {
+		logrus.Warn("METRICS_TOKEN is not set, so /metrics is disabled")
+	}
+	handlers.RegisterRoutes(router)
 
 	// Get the port from the environment variable
 	appPort := os.Getenv("APP_PORT")
@@ -99,12 +104,120 @@ func run() {
 		appPort = "8080" // Default port
 	}
 
-	// Start the HTTP server
-	port := ":" + appPort
-	logrus.Infof("Starting the server on port %s", port)
-	if err := http.ListenAndServe(port, router); err != nil {
-		logrus.WithError(err).Fatal("Error starting the server")
+	server := &http.Server{
+		Addr:              ":" + appPort,
+		Handler:           router,
+		ReadTimeout:       durationFromEnv("SERVER_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: durationFromEnv("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      durationFromEnv("SERVER_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       durationFromEnv("SERVER_IDLE_TIMEOUT", 60*time.Second),
+	}
+	shutdownTimeout := durationFromEnv("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second)
+	// File uploads, imports and downloads get longer deadlines than the timeouts above
+	handlers.TransferTimeout = durationFromEnv("SERVER_TRANSFER_TIMEOUT", 30*time.Minute)
+
+	// Optional TLS (TLS_CERT_FILE/TLS_KEY_FILE), with mutual TLS for admin routes when TLS_CLIENT_CA_FILE is set
+	var reloader *servertls.Reloader
+	if tlsConfig.Enabled() {
+		reloader, err = servertls.NewReloader(tlsConfig)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error loading TLS certificate")
+		}
+		server.TLSConfig = reloader.TLSConfig()
+		middlewares.RequireAdminClientCert(tlsConfig.MutualTLS())
+	}
+
+	// Stop on SIGINT (Ctrl+C) or SIGTERM (sent by deploys)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start the HTTP(S) server, and the HTTP-to-HTTPS redirect listener if configured
+	serverErr := make(chan error, 2)
+	go func() {
+		if reloader != nil {
+			logrus.Infof("Starting the HTTPS server on port %s", server.Addr)
+			serverErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		logrus.Infof("Starting the server on port %s", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var redirectServer *http.Server
+	if reloader != nil {
+		// New certificates are picked up on file change or SIGHUP without dropping connections
+		go reloader.Watch(ctx)
+		go reloadOnSIGHUP(ctx, reloader)
+
+		if tlsConfig.RedirectAddr != "" {
+			redirectServer = &http.Server{
+				Addr:              tlsConfig.RedirectAddr,
+				Handler:           servertls.RedirectHandler(appPort),
+				ReadHeaderTimeout: server.ReadHeaderTimeout,
+				IdleTimeout:       server.IdleTimeout,
+			}
+			go func() {
+				logrus.Infof("Redirecting HTTP on %s to HTTPS", redirectServer.Addr)
+				serverErr <- redirectServer.ListenAndServe()
+			}()
+		}
+	}
+
+	select {
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Fatal("Error starting the server")
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	// Fail readiness first, then let in-flight requests (e.g. purchases) finish before closing the DB
+	logrus.Info("Shutdown signal received, draining requests")
+	handlers.MarkShuttingDown()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logrus.WithError(err).Error("Server did not shut down cleanly")
+	}
+
+	if err := models.CloseDB(); err != nil {
+		logrus.WithError(err).Error("Failed to close the database pool")
+	}
+	logrus.Info("Server stopped")
+}
+
+// reloadOnSIGHUP reloads the TLS certificate whenever the process receives SIGHUP
+func reloadOnSIGHUP(ctx context.Context, reloader *servertls.Reloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := reloader.Reload(); err != nil {
+				logrus.WithError(err).Error("SIGHUP: failed to reload TLS certificate; keeping the current one")
+				continue
+			}
+			logrus.Info("SIGHUP: reloaded TLS certificate")
+		}
+	}
+}
+
+// durationFromEnv parses a duration such as "15s" from the environment, falling back on a default
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
 	}
+	return value
 }
 
 func main() {
@@ -116,55 +229,133 @@ func main() {
 		return
 	}
 
-	// Get log file name from environment variable
-	logFileName := os.Getenv("LOG_FILENAME")
-	if logFileName == "" {
-		logFileName = "app.log" // Default log file name
+	// Set up logrus with JSON formatting on the configured sink (LOG_OUTPUT: file, stdout or both)
+	if err := logging.Setup(logging.ConfigFromEnv()); err != nil {
+		fmt.Println("Error configuring logging:", err)
+		return
 	}
 
-	// Combine relative path with log file name
-	logFilePath := filepath.Join("..", logFileName)
+	// Session cookie secret and attributes (SESSION_SECRET_KEY, SESSION_COOKIE_*)
+	sessionConfig, err := session_manager.ConfigFromEnv()
+	if err == nil {
+		err = session_manager.Setup(sessionConfig)
+	}
+	if err != nil {
+		logrus.WithError(err).Fatal("Error configuring sessions")
+	}
 
-	// Get max size from environment variable
-	logFileMaxSizeStr := os.Getenv("LOG_FILE_MAXSIZE")
-	logFileMaxSize, err := strconv.Atoi(logFileMaxSizeStr)
+	// Signed download URLs and download limits (DOWNLOAD_*)
+	deliveryConfig, err := delivery.ConfigFromEnv()
+	if err == nil {
+		err = delivery.Setup(deliveryConfig)
+	}
 	if err != nil {
-		logFileMaxSize = 10 // Default max Size
+		logrus.WithError(err).Fatal("Error configuring downloads")
 	}
 
-	// Get max age from environment variable
-	logFileMaxAgeStr := os.Getenv("LOG_FILE_MAXAGE")
-	logFileMaxAge, err := strconv.Atoi(logFileMaxAgeStr)
+	// Storage of uploaded ebook files (BLOB_STORE: local or s3)
+	blobConfig, err := blobstore.ConfigFromEnv()
+	if err == nil {
+		err = blobstore.Setup(blobConfig)
+	}
 	if err != nil {
-		logFileMaxAge = 7 // Default max age
+		logrus.WithError(err).Fatal("Error configuring the blob store")
 	}
 
-	// Get max backups from environment variable
-	logFileMaxBackupsStr := os.Getenv("LOG_FILE_MAXSIZE")
-	logFileMaxBackups, err := strconv.Atoi(logFileMaxBackupsStr)
+	// Book metadata lookups by ISBN (METADATA_PROVIDER: openlibrary, fixtures or none)
+	metadataConfig, err := metadata.ConfigFromEnv()
+	if err == nil {
+		err = metadata.Setup(metadataConfig)
+	}
 	if err != nil {
-		logFileMaxBackups = 3 // Default max Backups
+		logrus.WithError(err).Fatal("Error configuring metadata lookups")
 	}
 
-	// Configure log rotation
-	logFile := &lumberjack.Logger{
-		Filename:   logFilePath,
-		MaxSize:    logFileMaxSize,    // Max size in megabytes before rotation
-		MaxBackups: logFileMaxBackups, // Max number of old log files to retain
-		MaxAge:     logFileMaxAge,     // Max days to retain log files
+	securityConfig, err := middlewares.SecurityConfigFromEnv()
+	if err != nil {
+		logrus.WithError(err).Fatal("Error reading security configuration")
 	}
 
-	// Set up logrus with custom output and JSON formatting
-	logrus.SetOutput(logFile)
-	logrus.SetFormatter(&logrus.JSONFormatter{})
+	// Links in responses, such as signed download URLs, start with PUBLIC_BASE_URL or are relative
+	handlers.PublicBaseURL, err = handlers.PublicBaseURLFromEnv()
+	if err != nil {
+		logrus.WithError(err).Fatal("Error reading the public base URL")
+	}
+
+	tlsConfig, err := servertls.ConfigFromEnv()
+	if err != nil {
+		logrus.WithError(err).Fatal("Error reading TLS configuration")
+	}
+
+	// Set up tracing (OTEL_TRACES_EXPORTER: none, stdout or otlp)
+	tracingConfig := tracing.ConfigFromEnv()
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingConfig)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error configuring tracing")
+	}
 
 	// Initialize the database
 	_, db_err := models.InitDB()
 	if db_err != nil {
 		logrus.WithError(db_err).Fatal("Error initializing database")
 	}
+	if err := models.DB.Use(tracing.GormPlugin{}); err != nil {
+		logrus.WithError(err).Fatal("Error registering database tracing")
+	}
+
+	// Give books stored before ISBNs were validated their canonical ISBN-13; covers are moved along
+	normalized, err := models.NormalizeISBNs(models.DB)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error normalizing ISBNs")
+	}
+	for _, rename := range normalized.Renamed {
+		logrus.WithFields(logrus.Fields{"book_id": rename.BookID, "from": rename.Old, "to": rename.New}).Info("Normalized ISBN")
+	}
+	for _, conflict := range normalized.Conflicts {
+		logrus.WithFields(logrus.Fields{"book_id": conflict.BookID, "isbn": conflict.Old, "canonical": conflict.New}).
+			Warn("ISBN left as is: another book already has its canonical form")
+	}
+	for _, invalid := range normalized.Invalid {
+		logrus.WithField("isbn", invalid).Warn("Stored ISBN is not a valid ISBN")
+	}
+	handlers.RenameCovers(context.Background(), normalized.Renamed)
+
+	// Split the author strings of books stored before authors had records of their own, once
+	var split models.AuthorSplit
+	_, err = models.RunOnce(models.DB, "split-authors", func(tx *gorm.DB) (err error) {
+		split, err = models.SplitAuthors(tx)
+		return err
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("Error splitting book authors")
+	}
+	if split.Books > 0 {
+		logrus.WithFields(logrus.Fields{"books": split.Books, "authors": split.Authors}).Info("Split book authors into author records")
+	}
+
+	// "import" and "export" manage the catalog from the command line instead of starting the server
+	if len(os.Args) > 1 {
+		code := runCommand(os.Args[1:])
+		models.CloseDB()
+		shutdownTracing(context.Background())
+		os.Exit(code)
+	}
+
+	// Expose the connection pool statistics on /metrics
+	if sqlDB, err := models.DB.DB(); err == nil {
+		if err := metrics.RegisterDBStats(sqlDB); err != nil {
+			logrus.WithError(err).Warn("Failed to register database metrics")
+		}
+	}
 
 	checkAdmin(models.DB) // enforcing admin account
-	run()
+	run(tracingConfig, securityConfig, tlsConfig)
+
+	// Flush spans still buffered by the exporter
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		logrus.WithError(err).Error("Failed to flush traces")
+	}
 
 }